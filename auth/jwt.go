@@ -5,12 +5,14 @@ import (
 	"os"
 	"time"
 
-	"tcg-server-go/database"
 	"tcg-server-go/models"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenTTL is how long an access token can be used; clients renew it with their refresh token
+const AccessTokenTTL = 15 * time.Minute
+
 var jwtSecret = []byte("mi_clave_secreta_muy_segura")
 
 func init() {
@@ -20,27 +22,25 @@ func init() {
 	}
 }
 
-func GenerateToken(email string) (string, error) {
-	// Get user from database to get user ID
-	var userID int
-	if database.DB != nil {
-		user, err := database.GetUserByEmail(email)
-		if err != nil || user == nil {
-			return "", fmt.Errorf("user not found")
-		}
-		userID = user.ID
-	} else {
-		// Fallback for testing
-		userID = 1 // Default user ID for testing
+// GenerateToken issues an access token for a user. Each token gets a random jti so it can
+// be revoked on its own.
+func GenerateToken(user *models.User) (string, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", fmt.Errorf("error generating token ID: %v", err)
 	}
 
+	now := time.Now()
 	claims := models.Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:       user.ID,
+		Email:        user.Email,
+		TokenVersion: user.TokenVersion,
+		Role:         user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
@@ -51,13 +51,14 @@ func GenerateToken(email string) (string, error) {
 func ValidateToken(tokenString string) (*models.Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return jwtSecret, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*models.Claims); ok && token.Valid {
+	// Tokens without a jti cannot be revoked, so they are not accepted
+	if claims, ok := token.Claims.(*models.Claims); ok && token.Valid && claims.ID != "" {
 		return claims, nil
 	}
 
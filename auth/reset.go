@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"tcg-server-go/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ResetTokenTTL is how long a password reset token can be used
+const ResetTokenTTL = time.Hour
+
+// ErrInvalidResetToken is returned for reset tokens that are unknown, expired or already used
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// CreatePasswordReset generates a reset token for a user. Only its hash is stored, so the
+// returned token must be sent to the user right away.
+func CreatePasswordReset(resets repository.PasswordResetRepository, userID int) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("error generating reset token: %v", err)
+	}
+
+	if err := resets.CreatePasswordReset(userID, hashToken(token), time.Now().Add(ResetTokenTTL)); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ResetPassword sets a new password with a reset token. The token and every other
+// outstanding token of the user are used up, and access and refresh tokens issued before
+// are revoked.
+func ResetPassword(repos *repository.Repositories, token, password string) error {
+	userID, err := repos.PasswordResets.ConsumePasswordReset(hashToken(token))
+	if err != nil {
+		return err
+	}
+	if userID == 0 {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := repos.Users.UpdatePassword(userID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	return repos.Tokens.RevokeUserRefreshTokens(userID)
+}
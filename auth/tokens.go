@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+)
+
+// RefreshTokenTTL is how long a refresh token can be used. Every refresh rotates it, so an
+// active session never expires.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken is returned for refresh tokens that are unknown, expired or revoked
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that was already rotated is
+	// presented again. It may have been stolen, so the whole session is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// IssueTokens starts a session for a user with a new access token and refresh token
+func IssueTokens(repos *repository.Repositories, user *models.User) (*models.LoginResponse, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("error generating token family: %v", err)
+	}
+
+	refreshToken, stored, err := newRefreshToken(user.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := repos.Tokens.CreateRefreshToken(stored); err != nil {
+		return nil, err
+	}
+
+	return loginResponse(user, refreshToken)
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and refresh token. The
+// presented token is used up; presenting it again revokes every token of its session.
+func RefreshTokens(repos *repository.Repositories, refreshToken string) (*models.LoginResponse, error) {
+	stored, err := repos.Tokens.GetRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.RevokedAt != nil || !stored.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.UsedAt != nil {
+		return nil, revokeReusedFamily(repos, stored.FamilyID)
+	}
+
+	user, err := repos.Users.GetUserByID(stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	nextToken, next, err := newRefreshToken(user.ID, stored.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := repos.Tokens.RotateRefreshToken(stored.ID, next)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another request used the token first
+		return nil, revokeReusedFamily(repos, stored.FamilyID)
+	}
+
+	return loginResponse(user, nextToken)
+}
+
+// Logout revokes an access token until it expires and the session of a refresh token.
+// Either may be omitted.
+func Logout(repos *repository.Repositories, claims *models.Claims, refreshToken string) error {
+	if claims != nil {
+		if err := repos.Tokens.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	stored, err := repos.Tokens.GetRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return nil
+	}
+
+	return repos.Tokens.RevokeRefreshTokenFamily(stored.FamilyID)
+}
+
+// revokeReusedFamily revokes the session of a reused refresh token and reports the reuse
+func revokeReusedFamily(repos *repository.Repositories, familyID string) error {
+	if err := repos.Tokens.RevokeRefreshTokenFamily(familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// newRefreshToken generates a refresh token of a session, returning the token to hand to
+// the client and the row to store, which only has its hash
+func newRefreshToken(userID int, familyID string) (string, *models.RefreshToken, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("error generating refresh token: %v", err)
+	}
+
+	stored := &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	return token, stored, nil
+}
+
+// loginResponse pairs a new access token for the user with a refresh token
+func loginResponse(user *models.User, refreshToken string) (*models.LoginResponse, error) {
+	accessToken, err := GenerateToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// randomToken returns n random bytes encoded for use in URLs and JSON
+func randomToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// randomHex returns n random bytes as hex, for identifiers stored in fixed-width columns
+func randomHex(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// hashToken returns the SHA-256 of a token. Tokens are random enough that a fast hash is
+// safe, and it lets the token be looked up directly.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,63 +2,35 @@ package auth
 
 import (
 	"log"
-	"tcg-server-go/database"
 	"tcg-server-go/models"
+	"tcg-server-go/repository"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Sample users (fallback for testing when database is not available)
-var users = map[string]string{
-	"admin@example.com": "$2a$10$N.zmdr9k7uOCQb376NoUnuTJ8iAt6Z5EHsM8lE9lBOsl7iKTVEFDa", // password: "admin123"
-	"user@example.com":  "$2a$10$8K1p/a0dL1LXMIgoEDFrwOfgqwAGcwZQh3UPHz3UaCgHpVqKqKqKq", // password: "user123"
-}
-
-func ValidateCredentials(email, password string) bool {
-	// Try database first
-	if database.DB != nil {
-		user, err := database.GetUserByEmail(email)
-		if err != nil || user == nil {
-			return false
-		}
-
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-			return false
-		}
-
-		return true
-	}
-
-	// Fallback to in-memory users for testing
-	hashedPassword, exists := users[email]
-	if !exists {
+func ValidateCredentials(users repository.UserRepository, email, password string) bool {
+	user, err := users.GetUserByEmail(email)
+	if err != nil || user == nil {
 		return false
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
 		return false
 	}
 
 	return true
 }
 
-func UserExists(email string) bool {
-	// Try database first
-	if database.DB != nil {
-		exists, err := database.EmailExists(email)
-		if err != nil {
-			return false
-		}
-		return exists
+func UserExists(users repository.UserRepository, email string) bool {
+	exists, err := users.EmailExists(email)
+	if err != nil {
+		return false
 	}
-
-	// Fallback to in-memory users for testing
-	_, exists := users[email]
 	return exists
 }
 
-// AddUser adds a new user to database or fallback to in-memory
-func AddUser(user *models.User) error {
+// AddUser hashes the password of a new user and stores it with its default user info
+func AddUser(repos *repository.Repositories, user *models.User) error {
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -67,36 +39,29 @@ func AddUser(user *models.User) error {
 
 	user.Password = string(hashedPassword)
 
-	// Try database first
-	if database.DB != nil {
-		err = database.CreateUser(user)
-		if err != nil {
-			return err
-		}
-
-		// Create default user info for the new user
-		_, err = database.CreateDefaultUserInfo(user.ID)
-		if err != nil {
-			// Log the error but don't fail user creation
-			// User can still exist without user info
-			log.Printf("Failed to create default user info for user %d: %v", user.ID, err)
-		}
+	err = repos.Users.CreateUser(user)
+	if err != nil {
+		return err
+	}
 
-		return nil
+	// Create default user info for the new user
+	_, err = repos.UserInfo.CreateDefaultUserInfo(user.ID)
+	if err != nil {
+		// Log the error but don't fail user creation
+		// User can still exist without user info
+		log.Printf("Failed to create default user info for user %d: %v", user.ID, err)
 	}
 
-	// Fallback to in-memory users for testing
-	users[user.Email] = user.Password
 	return nil
 }
 
 // CreateUser creates a new user with validation
-func CreateUser(req *models.CreateUserRequest) (*models.User, error) {
+func CreateUser(repos *repository.Repositories, req *models.CreateUserRequest) (*models.User, error) {
 	user := &models.User{
 		Name:     req.Name,
 		Email:    req.Email,
 		Password: req.Password,
 	}
 
-	return user, AddUser(user)
+	return user, AddUser(repos, user)
 }
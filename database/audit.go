@@ -0,0 +1,112 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"tcg-server-go/models"
+)
+
+// insertAuditEntry records a change in the audit log, within the transaction making the
+// change so one is never kept without the other. newValue is what the change wrote; it is
+// encoded here since the ID of a created entity is only known inside the transaction.
+func insertAuditEntry(db execer, entry *models.AuditEntry, newValue interface{}) error {
+	if newValue != nil {
+		encoded, err := json.Marshal(newValue)
+		if err != nil {
+			return fmt.Errorf("error encoding audited value: %v", err)
+		}
+		entry.NewValue = encoded
+	}
+
+	query := `
+		INSERT INTO audit_log (user_id, action, entity_type, entity_id, old_value, new_value, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	entry.CreatedAt = time.Now()
+	result, err := db.Exec(query, entry.UserID, entry.Action, entry.EntityType, entry.EntityID,
+		nullableJSON(entry.OldValue), nullableJSON(entry.NewValue), entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating audit entry: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting audit entry ID: %v", err)
+	}
+
+	entry.ID = int(id)
+	return nil
+}
+
+// GetAuditEntries lists audit entries, newest first. It also returns the total number of
+// entries matching the filter for pagination.
+func GetAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	// Build the filter dynamically based on provided fields
+	where := " WHERE 1 = 1"
+	args := []interface{}{}
+
+	if filter.EntityType != "" {
+		where += " AND entity_type = ?"
+		args = append(args, filter.EntityType)
+	}
+
+	if filter.EntityID != 0 {
+		where += " AND entity_id = ?"
+		args = append(args, filter.EntityID)
+	}
+
+	if filter.UserID != 0 {
+		where += " AND user_id = ?"
+		args = append(args, filter.UserID)
+	}
+
+	var total int
+	err := DB.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting audit entries: %v", err)
+	}
+
+	query := `
+		SELECT id, user_id, action, entity_type, entity_id, old_value, new_value, created_at
+		FROM audit_log` + where + `
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := DB.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying audit entries: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var oldValue, newValue []byte
+		err := rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &entry.EntityType, &entry.EntityID,
+			&oldValue, &newValue, &entry.CreatedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning audit entry: %v", err)
+		}
+		entry.OldValue = oldValue
+		entry.NewValue = newValue
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating audit entries: %v", err)
+	}
+
+	return entries, total, nil
+}
+
+// nullableJSON stores empty JSON values as NULL
+func nullableJSON(value []byte) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return string(value)
+}
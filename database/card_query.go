@@ -0,0 +1,153 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"tcg-server-go/models"
+)
+
+// cardSortColumns maps the sort keys to the expression cards are ordered by. Cards without
+// HP or attack damage sort as 0.
+var cardSortColumns = map[string]string{
+	models.CardSortID:     "id",
+	models.CardSortName:   "name",
+	models.CardSortHP:     "COALESCE(hp, 0)",
+	models.CardSortAttack: "COALESCE(attack_damage, 0)",
+	models.CardSortCost:   "attack_cost_total",
+}
+
+// fullTextQuery builds a boolean mode query matching the cards with a word starting with
+// each of the given words
+func fullTextQuery(words []string) string {
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = "+" + word + "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// inPlaceholders returns the placeholders of an IN list of n values
+func inPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// QueryCards returns a page of the cards matching a filter, in the order of its sort, and
+// whether more cards follow
+func QueryCards(filter models.CardFilter) ([]*models.Card, bool, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if len(filter.Types) > 0 {
+		conditions = append(conditions, "type IN ("+inPlaceholders(len(filter.Types))+")")
+		for _, cardType := range filter.Types {
+			args = append(args, cardType)
+		}
+	}
+
+	if len(filter.Elements) > 0 {
+		conditions = append(conditions, "element IN ("+inPlaceholders(len(filter.Elements))+")")
+		for _, element := range filter.Elements {
+			args = append(args, element)
+		}
+	}
+
+	if len(filter.Rarities) > 0 {
+		conditions = append(conditions, "rarity IN ("+inPlaceholders(len(filter.Rarities))+")")
+		for _, rarity := range filter.Rarities {
+			args = append(args, rarity)
+		}
+	}
+
+	if len(filter.Sets) > 0 {
+		conditions = append(conditions, "set_code IN ("+inPlaceholders(len(filter.Sets))+")")
+		for _, set := range filter.Sets {
+			args = append(args, set)
+		}
+	}
+
+	if filter.MinHP != nil {
+		conditions = append(conditions, "hp >= ?")
+		args = append(args, *filter.MinHP)
+	}
+
+	if filter.MaxHP != nil {
+		conditions = append(conditions, "hp <= ?")
+		args = append(args, *filter.MaxHP)
+	}
+
+	if filter.MinCost != nil {
+		conditions = append(conditions, "attack_cost_total >= ?")
+		args = append(args, *filter.MinCost)
+	}
+
+	if filter.MaxCost != nil {
+		conditions = append(conditions, "attack_cost_total <= ?")
+		args = append(args, *filter.MaxCost)
+	}
+
+	if filter.EffectID != 0 {
+		conditions = append(conditions, "id IN (SELECT card_id FROM card_effects WHERE effect_id = ?)")
+		args = append(args, filter.EffectID)
+	}
+
+	if filter.Search != "" {
+		words := models.SearchWords(filter.Search)
+		if len(words) == 0 {
+			return []*models.Card{}, false, nil
+		}
+		conditions = append(conditions, "MATCH(name, legend) AGAINST(? IN BOOLEAN MODE)")
+		args = append(args, fullTextQuery(words))
+	}
+
+	key, desc, ok := models.ParseCardSort(filter.Sort)
+	if !ok {
+		key, desc = models.CardSortID, false
+	}
+	column := cardSortColumns[key]
+	direction, after := "ASC", ">"
+	if desc {
+		direction, after = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		var value interface{} = filter.After.Number
+		if key == models.CardSortName {
+			value = filter.After.Text
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND id > ?))", column, after, column))
+		args = append(args, value, value, filter.After.ID)
+	}
+
+	query := "SELECT " + cardColumns + " FROM cards"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY " + column + " " + direction + ", id ASC LIMIT ?"
+	args = append(args, filter.Limit+1)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("error querying cards: %v", err)
+	}
+	defer rows.Close()
+
+	cards := []*models.Card{}
+	for rows.Next() {
+		card := &models.Card{}
+		if err := rows.Scan(cardScanFields(card)...); err != nil {
+			return nil, false, fmt.Errorf("error scanning card: %v", err)
+		}
+		cards = append(cards, card)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("error iterating cards: %v", err)
+	}
+
+	more := len(cards) > filter.Limit
+	if more {
+		cards = cards[:filter.Limit]
+	}
+	return cards, more, nil
+}
@@ -2,22 +2,70 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"tcg-server-go/models"
 	"time"
 )
 
-// CreateCard creates a new card record in the database
-func CreateCard(card *models.Card) error {
+// cardColumns lists the cards columns in the order expected by cardScanFields
+const cardColumns = "id, name, type, legend, element, hp, attack_name, attack_damage, attack_cost, retreat_cost, rarity, set_code, created_at, updated_at"
+
+// qualifiedCardColumns returns cardColumns prefixed with a table alias, for joins
+func qualifiedCardColumns(alias string) string {
+	columns := strings.Split(cardColumns, ", ")
+	for i, column := range columns {
+		columns[i] = alias + "." + column
+	}
+	return strings.Join(columns, ", ")
+}
+
+// cardScanFields returns the scan destinations for cardColumns
+func cardScanFields(card *models.Card) []interface{} {
+	return []interface{}{
+		&card.ID,
+		&card.Name,
+		&card.Type,
+		&card.Legend,
+		&card.Element,
+		&card.HP,
+		&card.AttackName,
+		&card.AttackDamage,
+		&card.AttackCost,
+		&card.RetreatCost,
+		&card.Rarity,
+		&card.SetCode,
+		&card.CreatedAt,
+		&card.UpdatedAt,
+	}
+}
+
+// CreateCard creates a new card record in the database, audited by the given entry
+func CreateCard(card *models.Card, audit *models.AuditEntry) error {
 	query := `
-		INSERT INTO cards (name, type, legend, element, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO cards (name, type, legend, element, hp, attack_name, attack_damage, attack_cost,
+		                   retreat_cost, rarity, set_code, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now()
 	card.CreatedAt = now
 	card.UpdatedAt = now
+	if card.Rarity == "" {
+		card.Rarity = models.CardRarityCommon
+	}
+	if card.SetCode == "" {
+		card.SetCode = models.DefaultSetCode
+	}
 
-	result, err := DB.Exec(query, card.Name, card.Type, card.Legend, card.Element, card.CreatedAt, card.UpdatedAt)
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, card.Name, card.Type, card.Legend, card.Element, card.HP, card.AttackName,
+		card.AttackDamage, card.AttackCost, card.RetreatCost, card.Rarity, card.SetCode, card.CreatedAt, card.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -28,27 +76,27 @@ func CreateCard(card *models.Card) error {
 	}
 
 	card.ID = int(id)
+	audit.EntityID = card.ID
+	if err := insertAuditEntry(tx, audit, card); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
 	return nil
 }
 
 // GetCardByID retrieves a card by its ID
 func GetCardByID(id int) (*models.Card, error) {
 	query := `
-		SELECT id, name, type, legend, element, created_at, updated_at
+		SELECT ` + cardColumns + `
 		FROM cards
 		WHERE id = ?
 	`
 
 	card := &models.Card{}
-	err := DB.QueryRow(query, id).Scan(
-		&card.ID,
-		&card.Name,
-		&card.Type,
-		&card.Legend,
-		&card.Element,
-		&card.CreatedAt,
-		&card.UpdatedAt,
-	)
+	err := DB.QueryRow(query, id).Scan(cardScanFields(card)...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -60,24 +108,56 @@ func GetCardByID(id int) (*models.Card, error) {
 	return card, nil
 }
 
+// GetCardsByIDs retrieves several cards in one query, by ID. Cards that do not exist are
+// left out of the map.
+func GetCardsByIDs(ids []int) (map[int]*models.Card, error) {
+	cards := make(map[int]*models.Card)
+	if len(ids) == 0 {
+		return cards, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	query := `
+		SELECT ` + cardColumns + `
+		FROM cards
+		WHERE id IN (` + inPlaceholders(len(ids)) + `)
+	`
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying cards: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		card := &models.Card{}
+		if err := rows.Scan(cardScanFields(card)...); err != nil {
+			return nil, fmt.Errorf("error scanning card: %v", err)
+		}
+		cards[card.ID] = card
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cards: %v", err)
+	}
+
+	return cards, nil
+}
+
 // GetCardByName retrieves a card by its name
 func GetCardByName(name string) (*models.Card, error) {
 	query := `
-		SELECT id, name, type, legend, element, created_at, updated_at
+		SELECT ` + cardColumns + `
 		FROM cards
 		WHERE name = ?
 	`
 
 	card := &models.Card{}
-	err := DB.QueryRow(query, name).Scan(
-		&card.ID,
-		&card.Name,
-		&card.Type,
-		&card.Legend,
-		&card.Element,
-		&card.CreatedAt,
-		&card.UpdatedAt,
-	)
+	err := DB.QueryRow(query, name).Scan(cardScanFields(card)...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -92,7 +172,7 @@ func GetCardByName(name string) (*models.Card, error) {
 // GetAllCards retrieves all cards from the database
 func GetAllCards() ([]*models.Card, error) {
 	query := `
-		SELECT id, name, type, legend, element, created_at, updated_at
+		SELECT ` + cardColumns + `
 		FROM cards
 		ORDER BY id
 	`
@@ -106,15 +186,7 @@ func GetAllCards() ([]*models.Card, error) {
 	var cards []*models.Card
 	for rows.Next() {
 		card := &models.Card{}
-		err := rows.Scan(
-			&card.ID,
-			&card.Name,
-			&card.Type,
-			&card.Legend,
-			&card.Element,
-			&card.CreatedAt,
-			&card.UpdatedAt,
-		)
+		err := rows.Scan(cardScanFields(card)...)
 		if err != nil {
 			return nil, err
 		}
@@ -131,7 +203,7 @@ func GetAllCards() ([]*models.Card, error) {
 // GetCardsByType retrieves all cards of a specific type
 func GetCardsByType(cardType models.CardType) ([]*models.Card, error) {
 	query := `
-		SELECT id, name, type, legend, element, created_at, updated_at
+		SELECT ` + cardColumns + `
 		FROM cards
 		WHERE type = ?
 		ORDER BY id
@@ -146,15 +218,7 @@ func GetCardsByType(cardType models.CardType) ([]*models.Card, error) {
 	var cards []*models.Card
 	for rows.Next() {
 		card := &models.Card{}
-		err := rows.Scan(
-			&card.ID,
-			&card.Name,
-			&card.Type,
-			&card.Legend,
-			&card.Element,
-			&card.CreatedAt,
-			&card.UpdatedAt,
-		)
+		err := rows.Scan(cardScanFields(card)...)
 		if err != nil {
 			return nil, err
 		}
@@ -171,7 +235,7 @@ func GetCardsByType(cardType models.CardType) ([]*models.Card, error) {
 // GetCardsByElement retrieves all cards of a specific element
 func GetCardsByElement(element models.CardElement) ([]*models.Card, error) {
 	query := `
-		SELECT id, name, type, legend, element, created_at, updated_at
+		SELECT ` + cardColumns + `
 		FROM cards
 		WHERE element = ?
 		ORDER BY id
@@ -186,15 +250,39 @@ func GetCardsByElement(element models.CardElement) ([]*models.Card, error) {
 	var cards []*models.Card
 	for rows.Next() {
 		card := &models.Card{}
-		err := rows.Scan(
-			&card.ID,
-			&card.Name,
-			&card.Type,
-			&card.Legend,
-			&card.Element,
-			&card.CreatedAt,
-			&card.UpdatedAt,
-		)
+		err := rows.Scan(cardScanFields(card)...)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, card)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// GetCardsBySet retrieves all cards of a set
+func GetCardsBySet(setCode string) ([]*models.Card, error) {
+	query := `
+		SELECT ` + cardColumns + `
+		FROM cards
+		WHERE set_code = ?
+		ORDER BY id
+	`
+
+	rows, err := DB.Query(query, setCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []*models.Card
+	for rows.Next() {
+		card := &models.Card{}
+		err := rows.Scan(cardScanFields(card)...)
 		if err != nil {
 			return nil, err
 		}
@@ -212,13 +300,15 @@ func GetCardsByElement(element models.CardElement) ([]*models.Card, error) {
 func UpdateCard(card *models.Card) error {
 	query := `
 		UPDATE cards
-		SET name = ?, type = ?, legend = ?, element = ?, updated_at = ?
+		SET name = ?, type = ?, legend = ?, element = ?, hp = ?, attack_name = ?, attack_damage = ?,
+		    attack_cost = ?, retreat_cost = ?, rarity = ?, set_code = ?, updated_at = ?
 		WHERE id = ?
 	`
 
 	card.UpdatedAt = time.Now()
 
-	result, err := DB.Exec(query, card.Name, card.Type, card.Legend, card.Element, card.UpdatedAt, card.ID)
+	result, err := DB.Exec(query, card.Name, card.Type, card.Legend, card.Element, card.HP, card.AttackName,
+		card.AttackDamage, card.AttackCost, card.RetreatCost, card.Rarity, card.SetCode, card.UpdatedAt, card.ID)
 	if err != nil {
 		return err
 	}
@@ -235,8 +325,9 @@ func UpdateCard(card *models.Card) error {
 	return nil
 }
 
-// UpdateCardPartial updates specific fields of a card
-func UpdateCardPartial(id int, req *models.UpdateCardRequest) error {
+// UpdateCardPartial updates specific fields of a card, audited by the given entry with the
+// card as it is after the update
+func UpdateCardPartial(id int, req *models.UpdateCardRequest, audit *models.AuditEntry) error {
 	// Build dynamic query based on provided fields
 	query := "UPDATE cards SET updated_at = ?"
 	args := []interface{}{time.Now()}
@@ -261,10 +352,51 @@ func UpdateCardPartial(id int, req *models.UpdateCardRequest) error {
 		args = append(args, *req.Element)
 	}
 
+	if req.HP != nil {
+		query += ", hp = ?"
+		args = append(args, *req.HP)
+	}
+
+	if req.AttackName != nil {
+		query += ", attack_name = ?"
+		args = append(args, *req.AttackName)
+	}
+
+	if req.AttackDamage != nil {
+		query += ", attack_damage = ?"
+		args = append(args, *req.AttackDamage)
+	}
+
+	if req.AttackCost != nil {
+		query += ", attack_cost = ?"
+		args = append(args, *req.AttackCost)
+	}
+
+	if req.RetreatCost != nil {
+		query += ", retreat_cost = ?"
+		args = append(args, *req.RetreatCost)
+	}
+
+	if req.Rarity != nil {
+		query += ", rarity = ?"
+		args = append(args, *req.Rarity)
+	}
+
+	if req.SetCode != nil {
+		query += ", set_code = ?"
+		args = append(args, *req.SetCode)
+	}
+
 	query += " WHERE id = ?"
 	args = append(args, id)
 
-	result, err := DB.Exec(query, args...)
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		return err
 	}
@@ -278,27 +410,66 @@ func UpdateCardPartial(id int, req *models.UpdateCardRequest) error {
 		return sql.ErrNoRows
 	}
 
+	card := &models.Card{}
+	if err := tx.QueryRow(`SELECT `+cardColumns+` FROM cards WHERE id = ?`, id).Scan(cardScanFields(card)...); err != nil {
+		return fmt.Errorf("error reading updated card: %v", err)
+	}
+	if err := insertAuditEntry(tx, audit, card); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
 	return nil
 }
 
-// DeleteCard deletes a card by ID
-func DeleteCard(id int) error {
-	query := `DELETE FROM cards WHERE id = ?`
-
-	result, err := DB.Exec(query, id)
+// cardReferencesQuery counts the copies of a card players hold. Its effects and the limits
+// formats put on it are not counted: they go with the card.
+const cardReferencesQuery = `
+	SELECT
+		(SELECT COUNT(*) FROM user_cards WHERE card_id = ?) +
+		(SELECT COUNT(*) FROM deck_cards WHERE card_id = ?) +
+		(SELECT COUNT(*) FROM trade_cards WHERE card_id = ?) +
+		(SELECT COUNT(*) FROM market_listings WHERE card_id = ?) +
+		(SELECT COUNT(*) FROM table_stakes WHERE card_id = ?) +
+		(SELECT COUNT(*) FROM user_tables WHERE owner_stake_card_id = ?)`
+
+// DeleteCard deletes a card by ID, audited by the given entry. It fails with
+// models.ErrCardInUse while players hold the card, since deleting it would take their copies
+// away. The card row is locked first, so no copy can be given out between the check and the
+// delete.
+func DeleteCard(id int, audit *models.AuditEntry) error {
+	tx, err := DB.Begin()
 	if err != nil {
-		return err
+		return fmt.Errorf("error starting transaction: %v", err)
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	var locked int
+	err = tx.QueryRow(`SELECT id FROM cards WHERE id = ? FOR UPDATE`, id).Scan(&locked)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	var references int
+	if err := tx.QueryRow(cardReferencesQuery, id, id, id, id, id, id).Scan(&references); err != nil {
+		return fmt.Errorf("error counting references to card %d: %v", id, err)
+	}
+	if references > 0 {
+		return models.ErrCardInUse
 	}
 
+	if _, err := tx.Exec(`DELETE FROM cards WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if err := insertAuditEntry(tx, audit, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
 	return nil
 }
 
@@ -328,17 +499,22 @@ func CardNameExists(name string) (bool, error) {
 	return count > 0, nil
 }
 
-// SearchCards searches for cards by name (partial match)
+// SearchCards finds the cards whose name or legend has a word starting with each word of the
+// search term, using the full-text index
 func SearchCards(searchTerm string) ([]*models.Card, error) {
+	words := models.SearchWords(searchTerm)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
 	query := `
-		SELECT id, name, type, legend, element, created_at, updated_at
+		SELECT ` + cardColumns + `
 		FROM cards
-		WHERE name LIKE ?
+		WHERE MATCH(name, legend) AGAINST(? IN BOOLEAN MODE)
 		ORDER BY name
 	`
 
-	searchPattern := "%" + searchTerm + "%"
-	rows, err := DB.Query(query, searchPattern)
+	rows, err := DB.Query(query, fullTextQuery(words))
 	if err != nil {
 		return nil, err
 	}
@@ -347,15 +523,7 @@ func SearchCards(searchTerm string) ([]*models.Card, error) {
 	var cards []*models.Card
 	for rows.Next() {
 		card := &models.Card{}
-		err := rows.Scan(
-			&card.ID,
-			&card.Name,
-			&card.Type,
-			&card.Legend,
-			&card.Element,
-			&card.CreatedAt,
-			&card.UpdatedAt,
-		)
+		err := rows.Scan(cardScanFields(card)...)
 		if err != nil {
 			return nil, err
 		}
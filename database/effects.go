@@ -3,23 +3,65 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
+
+	"tcg-server-go/models"
 )
 
+// scanEffects reads effect rows selected as id, description, script, created_at, updated_at, deleted_at
+func scanEffects(rows *sql.Rows) ([]models.Effect, error) {
+	defer rows.Close()
+
+	var effects []models.Effect
+	for rows.Next() {
+		effect, err := scanEffect(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning effect: %v", err)
+		}
+		effects = append(effects, *effect)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating effects: %v", err)
+	}
+
+	return effects, nil
+}
+
+func scanEffect(row rowScanner) (*models.Effect, error) {
+	effect := &models.Effect{}
+	var script []byte
+	err := row.Scan(&effect.ID, &effect.Description, &script, &effect.CreatedAt, &effect.UpdatedAt, &effect.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	effect.Script = script
+	return effect, nil
+}
+
 // GetEffectByID retrieves an effect by its ID
-func GetEffectByID(id int) (*sql.Row, error) {
+func GetEffectByID(id int) (*models.Effect, error) {
 	query := `
-		SELECT id, description, created_at, updated_at, deleted_at
+		SELECT id, description, script, created_at, updated_at, deleted_at
 		FROM effects WHERE id = ? AND deleted_at IS NULL
 	`
 
-	row := DB.QueryRow(query, id)
-	return row, nil
+	effect, err := scanEffect(DB.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Effect not found
+		}
+		return nil, fmt.Errorf("error getting effect: %v", err)
+	}
+
+	return effect, nil
 }
 
 // GetAllEffects retrieves all non-deleted effects
-func GetAllEffects() (*sql.Rows, error) {
+func GetAllEffects() ([]models.Effect, error) {
 	query := `
-		SELECT id, description, created_at, updated_at, deleted_at
+		SELECT id, description, script, created_at, updated_at, deleted_at
 		FROM effects WHERE deleted_at IS NULL
 		ORDER BY id
 	`
@@ -29,22 +71,115 @@ func GetAllEffects() (*sql.Rows, error) {
 		return nil, fmt.Errorf("error querying effects: %v", err)
 	}
 
-	return rows, nil
+	return scanEffects(rows)
+}
+
+// CreateEffect creates a new effect, audited by the given entry
+func CreateEffect(effect *models.Effect, audit *models.AuditEntry) error {
+	query := `
+		INSERT INTO effects (description, script, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	effect.CreatedAt = now
+	effect.UpdatedAt = now
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, effect.Description, nullableJSON(effect.Script), effect.CreatedAt, effect.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating effect: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting effect ID: %v", err)
+	}
+
+	effect.ID = int(id)
+	audit.EntityID = effect.ID
+	if err := insertAuditEntry(tx, audit, effect); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
 }
 
-// SoftDeleteEffect soft deletes an effect by setting deleted_at
-func SoftDeleteEffect(id int) error {
+// UpdateEffect updates the description and script of an effect that has not been deleted,
+// audited by the given entry
+func UpdateEffect(effect *models.Effect, audit *models.AuditEntry) error {
+	query := `
+		UPDATE effects
+		SET description = ?, script = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	effect.UpdatedAt = time.Now()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, effect.Description, nullableJSON(effect.Script), effect.UpdatedAt, effect.ID)
+	if err != nil {
+		return fmt.Errorf("error updating effect: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := insertAuditEntry(tx, audit, effect); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// SoftDeleteEffect soft deletes an effect by setting deleted_at, audited by the given entry
+func SoftDeleteEffect(id int, audit *models.AuditEntry) error {
 	query := `
 		UPDATE effects 
 		SET deleted_at = NOW(), updated_at = NOW()
 		WHERE id = ? AND deleted_at IS NULL
 	`
 
-	_, err := DB.Exec(query, id)
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query, id)
 	if err != nil {
 		return fmt.Errorf("error soft deleting effect: %v", err)
 	}
 
+	if err := insertAuditEntry(tx, audit, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
 	return nil
 }
 
@@ -73,25 +208,39 @@ func HardDeleteEffect(id int) error {
 	return tx.Commit()
 }
 
-// CreateCardEffect creates a relationship between a card and an effect
-func CreateCardEffect(cardID, effectID int) error {
+// CreateCardEffect creates a relationship between a card and an effect, audited by the
+// given entry
+func CreateCardEffect(cardID, effectID int, audit *models.AuditEntry) error {
 	query := `
 		INSERT INTO card_effects (card_id, effect_id)
 		VALUES (?, ?)
 	`
 
-	_, err := DB.Exec(query, cardID, effectID)
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query, cardID, effectID)
 	if err != nil {
 		return fmt.Errorf("error creating card effect: %v", err)
 	}
 
+	if err := insertAuditEntry(tx, audit, models.CardEffect{CardID: cardID, EffectID: effectID}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
 	return nil
 }
 
 // GetEffectsByCardID retrieves all effects for a specific card
-func GetEffectsByCardID(cardID int) (*sql.Rows, error) {
+func GetEffectsByCardID(cardID int) ([]models.Effect, error) {
 	query := `
-		SELECT e.id, e.description, e.created_at, e.updated_at, e.deleted_at
+		SELECT e.id, e.description, e.script, e.created_at, e.updated_at, e.deleted_at
 		FROM effects e
 		JOIN card_effects ce ON e.id = ce.effect_id
 		WHERE ce.card_id = ? AND e.deleted_at IS NULL
@@ -103,13 +252,61 @@ func GetEffectsByCardID(cardID int) (*sql.Rows, error) {
 		return nil, fmt.Errorf("error querying card effects: %v", err)
 	}
 
-	return rows, nil
+	return scanEffects(rows)
+}
+
+// GetEffectsByCardIDs retrieves the effects of several cards in one query, by card ID. Cards
+// without effects are left out of the map.
+func GetEffectsByCardIDs(cardIDs []int) (map[int][]models.Effect, error) {
+	effects := make(map[int][]models.Effect)
+	if len(cardIDs) == 0 {
+		return effects, nil
+	}
+
+	placeholders := make([]string, len(cardIDs))
+	args := make([]interface{}, len(cardIDs))
+	for i, cardID := range cardIDs {
+		placeholders[i] = "?"
+		args[i] = cardID
+	}
+
+	query := `
+		SELECT ce.card_id, e.id, e.description, e.script, e.created_at, e.updated_at, e.deleted_at
+		FROM effects e
+		JOIN card_effects ce ON e.id = ce.effect_id
+		WHERE ce.card_id IN (` + strings.Join(placeholders, ", ") + `) AND e.deleted_at IS NULL
+		ORDER BY ce.card_id, e.id
+	`
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying card effects: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cardID int
+		var effect models.Effect
+		var script []byte
+		err := rows.Scan(&cardID, &effect.ID, &effect.Description, &script, &effect.CreatedAt, &effect.UpdatedAt, &effect.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning card effect: %v", err)
+		}
+		effect.Script = script
+		effects[cardID] = append(effects[cardID], effect)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating card effects: %v", err)
+	}
+
+	return effects, nil
 }
 
 // GetCardsByEffectID retrieves all cards that have a specific effect
-func GetCardsByEffectID(effectID int) (*sql.Rows, error) {
+func GetCardsByEffectID(effectID int) ([]*models.Card, error) {
 	query := `
-		SELECT c.id, c.name, c.type, c.legend, c.element, c.created_at, c.updated_at
+		SELECT ` + qualifiedCardColumns("c") + `
 		FROM cards c
 		JOIN card_effects ce ON c.id = ce.card_id
 		WHERE ce.effect_id = ?
@@ -120,22 +317,50 @@ func GetCardsByEffectID(effectID int) (*sql.Rows, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error querying effect cards: %v", err)
 	}
+	defer rows.Close()
+
+	var cards []*models.Card
+	for rows.Next() {
+		card := &models.Card{}
+		if err := rows.Scan(cardScanFields(card)...); err != nil {
+			return nil, fmt.Errorf("error scanning effect card: %v", err)
+		}
+		cards = append(cards, card)
+	}
 
-	return rows, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating effect cards: %v", err)
+	}
+
+	return cards, nil
 }
 
-// DeleteCardEffect removes a relationship between a card and an effect
-func DeleteCardEffect(cardID, effectID int) error {
+// DeleteCardEffect removes a relationship between a card and an effect, audited by the
+// given entry
+func DeleteCardEffect(cardID, effectID int, audit *models.AuditEntry) error {
 	query := `
 		DELETE FROM card_effects 
 		WHERE card_id = ? AND effect_id = ?
 	`
 
-	_, err := DB.Exec(query, cardID, effectID)
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query, cardID, effectID)
 	if err != nil {
 		return fmt.Errorf("error deleting card effect: %v", err)
 	}
 
+	if err := insertAuditEntry(tx, audit, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
 	return nil
 }
 
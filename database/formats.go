@@ -0,0 +1,322 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"tcg-server-go/legality"
+	"tcg-server-go/models"
+)
+
+// formatColumns lists the deck_formats columns in the order scanFormat expects them
+const formatColumns = "id, code, name, min_cards, max_cards, max_copies, min_energy_percent, max_energy_percent, created_at, updated_at"
+
+func scanFormat(row rowScanner) (*models.DeckFormat, error) {
+	format := &models.DeckFormat{}
+	err := row.Scan(&format.ID, &format.Code, &format.Name, &format.MinCards, &format.MaxCards, &format.MaxCopies,
+		&format.MinEnergyPercent, &format.MaxEnergyPercent, &format.CreatedAt, &format.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return format, nil
+}
+
+// GetFormats lists every deck format with its rules
+func GetFormats() ([]models.DeckFormat, error) {
+	rows, err := DB.Query("SELECT " + formatColumns + " FROM deck_formats ORDER BY code")
+	if err != nil {
+		return nil, fmt.Errorf("error querying formats: %v", err)
+	}
+
+	formats := []models.DeckFormat{}
+	for rows.Next() {
+		format, err := scanFormat(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning format: %v", err)
+		}
+		formats = append(formats, *format)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating formats: %v", err)
+	}
+
+	for i := range formats {
+		if err := loadFormatRules(DB, &formats[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return formats, nil
+}
+
+// GetFormat returns a deck format with its rules, or nil if it does not exist
+func GetFormat(code string) (*models.DeckFormat, error) {
+	return getFormat(DB, code)
+}
+
+func getFormat(db querier, code string) (*models.DeckFormat, error) {
+	format, err := scanFormat(db.QueryRow("SELECT "+formatColumns+" FROM deck_formats WHERE code = ?", code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting format: %v", err)
+	}
+
+	if err := loadFormatRules(db, format); err != nil {
+		return nil, err
+	}
+
+	return format, nil
+}
+
+// loadFormatRules loads the legal sets and the banned and restricted cards of a format
+func loadFormatRules(db querier, format *models.DeckFormat) error {
+	rows, err := db.Query("SELECT set_code FROM deck_format_sets WHERE format_id = ? ORDER BY set_code", format.ID)
+	if err != nil {
+		return fmt.Errorf("error querying format sets: %v", err)
+	}
+	defer rows.Close()
+
+	format.Sets = []string{}
+	for rows.Next() {
+		var set string
+		if err := rows.Scan(&set); err != nil {
+			return fmt.Errorf("error scanning format set: %v", err)
+		}
+		format.Sets = append(format.Sets, set)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating format sets: %v", err)
+	}
+
+	limits, err := db.Query("SELECT card_id, card_limit FROM deck_format_cards WHERE format_id = ? ORDER BY card_id", format.ID)
+	if err != nil {
+		return fmt.Errorf("error querying format cards: %v", err)
+	}
+	defer limits.Close()
+
+	format.CardLimits = []models.FormatCardLimit{}
+	for limits.Next() {
+		var limit models.FormatCardLimit
+		if err := limits.Scan(&limit.CardID, &limit.Limit); err != nil {
+			return fmt.Errorf("error scanning format card: %v", err)
+		}
+		format.CardLimits = append(format.CardLimits, limit)
+	}
+	if err := limits.Err(); err != nil {
+		return fmt.Errorf("error iterating format cards: %v", err)
+	}
+
+	return nil
+}
+
+// SaveFormat creates a format or replaces every rule of an existing one, including its
+// legal sets and its banned and restricted list, audited by the given entry. The decks of
+// the format are then checked against the new rules; the decks whose validity changed are
+// returned.
+func SaveFormat(format *models.DeckFormat, audit *models.AuditEntry) ([]models.DeckValidation, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO deck_formats (code, name, min_cards, max_cards, max_copies, min_energy_percent, max_energy_percent)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE name = VALUES(name), min_cards = VALUES(min_cards), max_cards = VALUES(max_cards),
+			max_copies = VALUES(max_copies), min_energy_percent = VALUES(min_energy_percent),
+			max_energy_percent = VALUES(max_energy_percent), updated_at = NOW()
+	`, format.Code, format.Name, format.MinCards, format.MaxCards, format.MaxCopies, format.MinEnergyPercent,
+		format.MaxEnergyPercent)
+	if err != nil {
+		return nil, fmt.Errorf("error saving format: %v", err)
+	}
+
+	var formatID int
+	if err := tx.QueryRow("SELECT id FROM deck_formats WHERE code = ? FOR UPDATE", format.Code).Scan(&formatID); err != nil {
+		return nil, fmt.Errorf("error getting format ID: %v", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM deck_format_sets WHERE format_id = ?", formatID); err != nil {
+		return nil, fmt.Errorf("error clearing format sets: %v", err)
+	}
+	for _, set := range format.Sets {
+		if _, err := tx.Exec("INSERT IGNORE INTO deck_format_sets (format_id, set_code) VALUES (?, ?)", formatID, set); err != nil {
+			return nil, fmt.Errorf("error adding format set: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM deck_format_cards WHERE format_id = ?", formatID); err != nil {
+		return nil, fmt.Errorf("error clearing format cards: %v", err)
+	}
+	for _, limit := range format.CardLimits {
+		_, err := tx.Exec(`
+			INSERT INTO deck_format_cards (format_id, card_id, card_limit) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE card_limit = VALUES(card_limit)
+		`, formatID, limit.CardID, limit.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("error adding format card: %v", err)
+		}
+	}
+
+	saved, err := getFormat(tx, format.Code)
+	if err != nil {
+		return nil, err
+	}
+	audit.EntityID = saved.ID
+	if err := insertAuditEntry(tx, audit, saved); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing format: %v", err)
+	}
+	*format = *saved
+
+	return RevalidateFormatDecks(format.Code)
+}
+
+// RevalidateFormatDecks checks every deck of a format against its current rules and
+// updates decks.valid. It returns the decks whose validity changed.
+func RevalidateFormatDecks(code string) ([]models.DeckValidation, error) {
+	format, err := GetFormat(code)
+	if err != nil {
+		return nil, err
+	}
+	if format == nil {
+		return nil, models.ErrFormatNotFound
+	}
+
+	rows, err := DB.Query("SELECT id, user_id, name, format, valid FROM decks WHERE format = ? ORDER BY id", code)
+	if err != nil {
+		return nil, fmt.Errorf("error querying format decks: %v", err)
+	}
+	decks := []models.Deck{}
+	for rows.Next() {
+		var deck models.Deck
+		if err := rows.Scan(&deck.ID, &deck.UserID, &deck.Name, &deck.Format, &deck.Valid); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning format deck: %v", err)
+		}
+		decks = append(decks, deck)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating format decks: %v", err)
+	}
+
+	changed := []models.DeckValidation{}
+	for _, deck := range decks {
+		validation, err := checkDeck(&deck, format)
+		if err != nil {
+			return nil, err
+		}
+		if validation.Valid == deck.Valid {
+			continue
+		}
+		if err := UpdateDeckValidity(deck.ID, validation.Valid); err != nil {
+			return nil, fmt.Errorf("error updating deck validity: %v", err)
+		}
+		changed = append(changed, *validation)
+	}
+
+	return changed, nil
+}
+
+// ValidateDeck checks a saved deck against the rules of its format and the cards its owner
+// has, and updates decks.valid if it changed. It returns nil if the deck does not exist.
+func ValidateDeck(deckID int) (*models.DeckValidation, error) {
+	deck, err := GetDeckByID(deckID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting deck: %v", err)
+	}
+	if deck == nil {
+		return nil, nil
+	}
+
+	format, err := GetFormat(deck.Format)
+	if err != nil {
+		return nil, err
+	}
+	if format == nil {
+		return nil, models.ErrFormatNotFound
+	}
+
+	validation, err := checkDeck(deck, format)
+	if err != nil {
+		return nil, err
+	}
+	if validation.Valid != deck.Valid {
+		if err := UpdateDeckValidity(deck.ID, validation.Valid); err != nil {
+			return nil, fmt.Errorf("error updating deck validity: %v", err)
+		}
+	}
+
+	return validation, nil
+}
+
+// checkDeck checks the saved cards of a deck against a format and its owner's collection
+func checkDeck(deck *models.Deck, format *models.DeckFormat) (*models.DeckValidation, error) {
+	deckCards, err := GetDeckCards(deck.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting deck cards: %v", err)
+	}
+
+	violations := legality.Check(format, deckCards)
+	owned, err := ownershipViolations(deck.UserID, deckCards)
+	if err != nil {
+		return nil, err
+	}
+	violations = append(violations, owned...)
+
+	return &models.DeckValidation{
+		DeckID:     deck.ID,
+		Format:     format.Code,
+		Valid:      len(violations) == 0,
+		Violations: violations,
+	}, nil
+}
+
+// ownershipViolations reports the cards of a deck the user does not have enough copies of
+func ownershipViolations(userID int, deckCards []models.DeckCard) ([]models.DeckViolation, error) {
+	counts := make(map[int]int)
+	names := make(map[int]string)
+	order := []int{}
+	for _, deckCard := range deckCards {
+		if deckCard.Card == nil {
+			continue // Reported as an unknown card
+		}
+		if _, ok := counts[deckCard.CardID]; !ok {
+			order = append(order, deckCard.CardID)
+		}
+		counts[deckCard.CardID] += deckCard.Number
+		names[deckCard.CardID] = deckCard.Card.Name
+	}
+
+	violations := []models.DeckViolation{}
+	for _, cardID := range order {
+		userCard, err := GetUserCardByUserAndCard(userID, cardID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting user card: %v", err)
+		}
+
+		owned := 0
+		if userCard != nil {
+			owned = userCard.Amount
+		}
+		if owned < counts[cardID] {
+			id := cardID
+			violations = append(violations, models.DeckViolation{
+				Rule:    models.RuleNotOwned,
+				CardID:  &id,
+				Message: fmt.Sprintf("you have %d of the %d copies of %s", owned, counts[cardID], names[cardID]),
+			})
+		}
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,318 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tcg-server-go/market"
+	"tcg-server-go/models"
+)
+
+// listingSelect selects listings joined with their card, scanned by scanListing
+const listingSelect = `
+	SELECT l.id, l.seller_id, l.card_id, l.amount, l.price, l.status, l.buyer_id, l.fee, l.sold_at,
+	       l.created_at, l.updated_at, `
+
+// scanListing scans a row of listingSelect
+func scanListing(row rowScanner) (*models.Listing, error) {
+	listing := &models.Listing{Card: &models.Card{}}
+	fields := []interface{}{
+		&listing.ID,
+		&listing.SellerID,
+		&listing.CardID,
+		&listing.Amount,
+		&listing.Price,
+		&listing.Status,
+		&listing.BuyerID,
+		&listing.Fee,
+		&listing.SoldAt,
+		&listing.CreatedAt,
+		&listing.UpdatedAt,
+	}
+
+	if err := row.Scan(append(fields, cardScanFields(listing.Card)...)...); err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// CreateListing puts copies of a card up for sale, moving them from the seller's collection
+// into escrow. It fails with models.ErrNotEnoughCards or models.ErrBreaksDeck like a trade would.
+func CreateListing(listing *models.Listing) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := takeUserCards(tx, listing.SellerID, listing.CardID, listing.Amount, now); err != nil {
+		return err
+	}
+
+	listing.Status = models.ListingStatusActive
+	listing.CreatedAt = now
+	listing.UpdatedAt = now
+
+	result, err := tx.Exec(`
+		INSERT INTO market_listings (seller_id, card_id, amount, price, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, listing.SellerID, listing.CardID, listing.Amount, listing.Price, listing.Status, listing.CreatedAt, listing.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating listing: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting listing ID: %v", err)
+	}
+	listing.ID = int(id)
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing listing: %v", err)
+	}
+
+	return nil
+}
+
+// GetListingByID retrieves a listing with its card
+func GetListingByID(id int) (*models.Listing, error) {
+	query := listingSelect + qualifiedCardColumns("c") + `
+		FROM market_listings l
+		JOIN cards c ON c.id = l.card_id
+		WHERE l.id = ?
+	`
+
+	listing, err := scanListing(DB.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Listing not found
+		}
+		return nil, fmt.Errorf("error getting listing: %v", err)
+	}
+
+	return listing, nil
+}
+
+// SearchListings lists the active listings matching the filter with their cards. It also
+// returns the total number of matching listings for pagination.
+func SearchListings(filter models.ListingFilter) ([]models.Listing, int, error) {
+	// Build the filter dynamically based on provided fields
+	where := " WHERE l.status = ?"
+	args := []interface{}{models.ListingStatusActive}
+
+	if filter.CardID != 0 {
+		where += " AND l.card_id = ?"
+		args = append(args, filter.CardID)
+	}
+
+	if filter.SellerID != 0 {
+		where += " AND l.seller_id = ?"
+		args = append(args, filter.SellerID)
+	}
+
+	if filter.Element != "" {
+		where += " AND c.element = ?"
+		args = append(args, filter.Element)
+	}
+
+	if filter.Rarity != "" {
+		where += " AND c.rarity = ?"
+		args = append(args, filter.Rarity)
+	}
+
+	if filter.MinPrice != 0 {
+		where += " AND l.price >= ?"
+		args = append(args, filter.MinPrice)
+	}
+
+	if filter.MaxPrice != 0 {
+		where += " AND l.price <= ?"
+		args = append(args, filter.MaxPrice)
+	}
+
+	from := " FROM market_listings l JOIN cards c ON c.id = l.card_id"
+
+	var total int
+	err := DB.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting listings: %v", err)
+	}
+
+	order := " ORDER BY l.id DESC"
+	switch filter.Sort {
+	case models.ListingSortPriceAsc:
+		order = " ORDER BY l.price ASC, l.id ASC"
+	case models.ListingSortPriceDesc:
+		order = " ORDER BY l.price DESC, l.id ASC"
+	}
+
+	query := listingSelect + qualifiedCardColumns("c") + from + where + order + " LIMIT ? OFFSET ?"
+
+	rows, err := DB.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying listings: %v", err)
+	}
+	defer rows.Close()
+
+	listings := []models.Listing{}
+	for rows.Next() {
+		listing, err := scanListing(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning listing: %v", err)
+		}
+		listings = append(listings, *listing)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating listings: %v", err)
+	}
+
+	return listings, total, nil
+}
+
+// CancelListing withdraws an active listing and returns its copies to the seller. It returns
+// false if the listing was no longer active.
+func CancelListing(id int) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var sellerID, cardID, amount int
+	var status models.ListingStatus
+	err = tx.QueryRow(`SELECT seller_id, card_id, amount, status FROM market_listings WHERE id = ? FOR UPDATE`, id).
+		Scan(&sellerID, &cardID, &amount, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting listing: %v", err)
+	}
+	if status != models.ListingStatusActive {
+		return false, nil
+	}
+
+	now := time.Now()
+	if err := giveUserCards(tx, sellerID, cardID, amount, now); err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`UPDATE market_listings SET status = ?, updated_at = ? WHERE id = ?`,
+		models.ListingStatusCancelled, now, id)
+	if err != nil {
+		return false, fmt.Errorf("error cancelling listing: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing listing cancellation: %v", err)
+	}
+
+	return true, nil
+}
+
+// BuyListing sells an active listing to a buyer in one transaction: the buyer pays the
+// price, the seller gets it minus the marketplace fee, the fee goes to the configured sink
+// and the copies leave escrow for the buyer's collection. It fails with models.ErrListingNotActive,
+// models.ErrOwnListing or models.ErrInsufficientFunds without changing anything.
+func BuyListing(id, buyerID int, config market.Config) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var sellerID, cardID, amount, price int
+	var status models.ListingStatus
+	err = tx.QueryRow(`SELECT seller_id, card_id, amount, price, status FROM market_listings WHERE id = ? FOR UPDATE`, id).
+		Scan(&sellerID, &cardID, &amount, &price, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ErrListingNotActive
+		}
+		return fmt.Errorf("error getting listing: %v", err)
+	}
+	if status != models.ListingStatusActive {
+		return models.ErrListingNotActive
+	}
+	if sellerID == buyerID {
+		return models.ErrOwnListing
+	}
+
+	userIDs := []int{buyerID, sellerID}
+	if config.FeeSink != 0 {
+		userIDs = append(userIDs, config.FeeSink)
+	}
+	if err := lockUserInfo(tx, userIDs...); err != nil {
+		return err
+	}
+
+	if _, err := spendMoney(tx, buyerID, price); err != nil {
+		return err
+	}
+
+	fee := config.Fee(price)
+	if err := addMoney(tx, sellerID, price-fee); err != nil {
+		return err
+	}
+	if config.FeeSink != 0 && fee > 0 {
+		if err := addMoney(tx, config.FeeSink, fee); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if err := giveUserCards(tx, buyerID, cardID, amount, now); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE market_listings
+		SET status = ?, buyer_id = ?, fee = ?, sold_at = ?, updated_at = ?
+		WHERE id = ?
+	`, models.ListingStatusSold, buyerID, fee, now, now, id)
+	if err != nil {
+		return fmt.Errorf("error selling listing: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing sale: %v", err)
+	}
+
+	return nil
+}
+
+// GetCardSales lists the latest sales of a card, newest first
+func GetCardSales(cardID, limit int) ([]models.Sale, error) {
+	query := `
+		SELECT id, amount, price, sold_at
+		FROM market_listings
+		WHERE card_id = ? AND status = ?
+		ORDER BY sold_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := DB.Query(query, cardID, models.ListingStatusSold, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying sales: %v", err)
+	}
+	defer rows.Close()
+
+	sales := []models.Sale{}
+	for rows.Next() {
+		var sale models.Sale
+		if err := rows.Scan(&sale.ListingID, &sale.Amount, &sale.Price, &sale.SoldAt); err != nil {
+			return nil, fmt.Errorf("error scanning sale: %v", err)
+		}
+		sale.UnitPrice = float64(sale.Price) / float64(sale.Amount)
+		sales = append(sales, sale)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sales: %v", err)
+	}
+
+	return sales, nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// addedColumn matches the column added by an ALTER TABLE clause
+var addedColumn = regexp.MustCompile(`(?i)ADD COLUMN (IF NOT EXISTS )?(\w+)`)
+
+// TestTableStateColumnsMigrated checks that every column read from table_state is either
+// created by the initial schema or added by a later migration that can run against a
+// table created before the column existed.
+func TestTableStateColumnsMigrated(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+
+	created := map[string]bool{}
+	added := map[string]bool{}
+	for _, migration := range migrations {
+		for _, statement := range splitStatements(migration.Up) {
+			switch {
+			case strings.HasPrefix(statement, "CREATE TABLE IF NOT EXISTS table_state "):
+				for _, line := range strings.Split(statement, "\n")[1:] {
+					if fields := strings.Fields(line); len(fields) > 0 {
+						created[fields[0]] = true
+					}
+				}
+			case strings.HasPrefix(statement, "ALTER TABLE table_state"):
+				for _, match := range addedColumn.FindAllStringSubmatch(statement, -1) {
+					if match[1] == "" {
+						t.Errorf("migration %04d adds table_state.%s without IF NOT EXISTS", migration.Version, match[2])
+					}
+					added[match[2]] = true
+				}
+			}
+		}
+	}
+
+	for _, column := range strings.Split(tableStateColumns, ",") {
+		column = strings.TrimSpace(column)
+		if !created[column] && !added[column] {
+			t.Errorf("table_state.%s is neither created nor added by a migration", column)
+		}
+	}
+}
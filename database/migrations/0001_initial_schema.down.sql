@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS table_state;
+DROP TABLE IF EXISTS card_effects;
+DROP TABLE IF EXISTS effects;
+DROP TABLE IF EXISTS user_tables;
+DROP TABLE IF EXISTS tables;
+DROP TABLE IF EXISTS deck_cards;
+DROP TABLE IF EXISTS decks;
+DROP TABLE IF EXISTS user_cards;
+DROP TABLE IF EXISTS cards;
+DROP TABLE IF EXISTS user_info;
+DROP TABLE IF EXISTS users;
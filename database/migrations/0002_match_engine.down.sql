@@ -0,0 +1,20 @@
+ALTER TABLE user_tables
+    DROP FOREIGN KEY IF EXISTS fk_user_tables_owner_deck,
+    DROP FOREIGN KEY IF EXISTS fk_user_tables_rival_deck;
+
+ALTER TABLE user_tables
+    DROP COLUMN IF EXISTS owner_deck_id,
+    DROP COLUMN IF EXISTS rival_deck_id;
+
+ALTER TABLE table_state
+    DROP COLUMN IF EXISTS owners_hand,
+    DROP COLUMN IF EXISTS owners_deck,
+    DROP COLUMN IF EXISTS rivals_hand,
+    DROP COLUMN IF EXISTS rivals_deck,
+    DROP COLUMN IF EXISTS owners_ready,
+    DROP COLUMN IF EXISTS rivals_ready,
+    DROP COLUMN IF EXISTS phase,
+    DROP COLUMN IF EXISTS turn,
+    DROP COLUMN IF EXISTS active_seat,
+    DROP COLUMN IF EXISTS energy_attached,
+    DROP COLUMN IF EXISTS winner_seat;
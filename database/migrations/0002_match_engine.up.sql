@@ -0,0 +1,20 @@
+-- Server-authoritative match state and the decks each player brought to a table
+
+ALTER TABLE table_state
+    ADD COLUMN IF NOT EXISTS owners_hand JSON NULL AFTER rivals_graveyard,
+    ADD COLUMN IF NOT EXISTS owners_deck JSON NULL AFTER owners_hand,
+    ADD COLUMN IF NOT EXISTS rivals_hand JSON NULL AFTER owners_deck,
+    ADD COLUMN IF NOT EXISTS rivals_deck JSON NULL AFTER rivals_hand,
+    ADD COLUMN IF NOT EXISTS owners_ready BOOLEAN NOT NULL DEFAULT FALSE AFTER rivals_deck,
+    ADD COLUMN IF NOT EXISTS rivals_ready BOOLEAN NOT NULL DEFAULT FALSE AFTER owners_ready,
+    ADD COLUMN IF NOT EXISTS phase VARCHAR(20) NOT NULL DEFAULT 'setup' AFTER rivals_ready,
+    ADD COLUMN IF NOT EXISTS turn INT NOT NULL DEFAULT 0 AFTER phase,
+    ADD COLUMN IF NOT EXISTS active_seat ENUM('owner','rival') NULL AFTER turn,
+    ADD COLUMN IF NOT EXISTS energy_attached BOOLEAN NOT NULL DEFAULT FALSE AFTER active_seat,
+    ADD COLUMN IF NOT EXISTS winner_seat ENUM('owner','rival') NULL AFTER energy_attached;
+
+ALTER TABLE user_tables
+    ADD COLUMN IF NOT EXISTS owner_deck_id INT NULL AFTER time,
+    ADD COLUMN IF NOT EXISTS rival_deck_id INT NULL AFTER owner_deck_id,
+    ADD CONSTRAINT fk_user_tables_owner_deck FOREIGN KEY IF NOT EXISTS (owner_deck_id) REFERENCES decks(id) ON DELETE SET NULL,
+    ADD CONSTRAINT fk_user_tables_rival_deck FOREIGN KEY IF NOT EXISTS (rival_deck_id) REFERENCES decks(id) ON DELETE SET NULL;
@@ -0,0 +1,10 @@
+ALTER TABLE cards
+    DROP INDEX IF EXISTS idx_rarity,
+    DROP INDEX IF EXISTS idx_set_code,
+    DROP COLUMN IF EXISTS hp,
+    DROP COLUMN IF EXISTS attack_name,
+    DROP COLUMN IF EXISTS attack_damage,
+    DROP COLUMN IF EXISTS attack_cost,
+    DROP COLUMN IF EXISTS retreat_cost,
+    DROP COLUMN IF EXISTS rarity,
+    DROP COLUMN IF EXISTS set_code;
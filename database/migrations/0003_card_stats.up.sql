@@ -0,0 +1,18 @@
+-- Card stats used by the game engine
+
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS hp INT NULL AFTER element,
+    ADD COLUMN IF NOT EXISTS attack_name VARCHAR(100) NULL AFTER hp,
+    ADD COLUMN IF NOT EXISTS attack_damage INT NULL AFTER attack_name,
+    ADD COLUMN IF NOT EXISTS attack_cost JSON NULL AFTER attack_damage,
+    ADD COLUMN IF NOT EXISTS retreat_cost INT NOT NULL DEFAULT 0 AFTER attack_cost,
+    ADD COLUMN IF NOT EXISTS rarity ENUM('Common', 'Uncommon', 'Rare', 'Epic', 'Legendary') NOT NULL DEFAULT 'Common' AFTER retreat_cost,
+    ADD COLUMN IF NOT EXISTS set_code VARCHAR(10) NOT NULL DEFAULT 'BASE' AFTER rarity,
+    ADD INDEX IF NOT EXISTS idx_rarity (rarity),
+    ADD INDEX IF NOT EXISTS idx_set_code (set_code);
+
+-- Monsters used to start with 100 HP and hit for 10 plus 10 per attached energy. Their
+-- attack damage and cost stay NULL so the engine keeps dealing that damage for free.
+UPDATE cards
+SET hp = 100, attack_name = 'Strike', retreat_cost = 1
+WHERE type = 'Monster' AND hp IS NULL;
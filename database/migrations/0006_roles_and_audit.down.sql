@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS audit_log;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS role;
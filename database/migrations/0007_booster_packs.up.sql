@@ -0,0 +1,33 @@
+-- Booster pack catalogue and the history of opened packs
+
+-- A pack draws from the cards of its set. slots is a JSON array with one object per card
+-- in the pack, mapping each rarity to its weight for that slot.
+CREATE TABLE IF NOT EXISTS packs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL,
+    price INT NOT NULL,
+    set_code VARCHAR(10) NOT NULL,
+    slots JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_set_code (set_code)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- seed is the random seed the pulls were rolled with, so an opening can be replayed
+CREATE TABLE IF NOT EXISTS pack_openings (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    pack_id INT NOT NULL,
+    price INT NOT NULL,
+    seed BIGINT NOT NULL,
+    card_ids JSON NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_pack_openings_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_pack_openings_pack FOREIGN KEY (pack_id) REFERENCES packs(id) ON DELETE CASCADE,
+    INDEX idx_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO packs (name, description, price, set_code, slots)
+VALUES ('Base Booster', 'Five cards from the base set, with at least one Uncommon and one Rare or better.', 100, 'BASE',
+        '[{"Common": 100}, {"Common": 100}, {"Common": 100}, {"Uncommon": 80, "Rare": 20}, {"Rare": 80, "Epic": 15, "Legendary": 5}]');
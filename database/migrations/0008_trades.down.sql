@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS trade_cards;
+DROP TABLE IF EXISTS trades;
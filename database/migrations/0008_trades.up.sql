@@ -0,0 +1,34 @@
+-- Trade offers of cards and money between players
+
+-- A counter-offer is a new trade with the parties swapped; counter_of_id points at the
+-- offer it answers, which is marked as countered
+CREATE TABLE IF NOT EXISTS trades (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    proposer_id INT NOT NULL,
+    recipient_id INT NOT NULL,
+    offered_money INT NOT NULL DEFAULT 0,
+    requested_money INT NOT NULL DEFAULT 0,
+    status ENUM('pending', 'accepted', 'declined', 'cancelled', 'countered', 'expired') NOT NULL DEFAULT 'pending',
+    counter_of_id INT NULL,
+    expires_at DATETIME NOT NULL,
+    resolved_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT fk_trades_proposer FOREIGN KEY (proposer_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_trades_recipient FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_trades_counter_of FOREIGN KEY (counter_of_id) REFERENCES trades(id) ON DELETE SET NULL,
+    INDEX idx_proposer_id (proposer_id),
+    INDEX idx_recipient_id (recipient_id),
+    INDEX idx_status_expires_at (status, expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- side is 'offered' for cards the proposer gives and 'requested' for cards the recipient gives
+CREATE TABLE IF NOT EXISTS trade_cards (
+    trade_id INT NOT NULL,
+    side ENUM('offered', 'requested') NOT NULL,
+    card_id INT NOT NULL,
+    amount INT NOT NULL,
+    PRIMARY KEY (trade_id, side, card_id),
+    CONSTRAINT fk_trade_cards_trade FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE,
+    CONSTRAINT fk_trade_cards_card FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
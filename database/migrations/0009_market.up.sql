@@ -0,0 +1,24 @@
+-- Fixed-price card listings of the marketplace
+
+-- The listed copies are taken out of the seller's user_cards while the listing is active
+-- (escrow) and go to the buyer or back to the seller. price is for all the copies; fee is
+-- the part of it kept by the marketplace on sale.
+CREATE TABLE IF NOT EXISTS market_listings (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    seller_id INT NOT NULL,
+    card_id INT NOT NULL,
+    amount INT NOT NULL,
+    price INT NOT NULL,
+    status ENUM('active', 'sold', 'cancelled') NOT NULL DEFAULT 'active',
+    buyer_id INT NULL,
+    fee INT NOT NULL DEFAULT 0,
+    sold_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT fk_market_listings_seller FOREIGN KEY (seller_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_market_listings_card FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE,
+    CONSTRAINT fk_market_listings_buyer FOREIGN KEY (buyer_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_status_card_id (status, card_id),
+    INDEX idx_seller_id (seller_id),
+    INDEX idx_card_id_sold_at (card_id, sold_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
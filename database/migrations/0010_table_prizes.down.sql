@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS table_stakes;
+
+ALTER TABLE user_tables
+    DROP FOREIGN KEY IF EXISTS fk_user_tables_owner_stake_card;
+
+ALTER TABLE user_tables
+    DROP COLUMN IF EXISTS owner_stake_card_id;
+
+ALTER TABLE user_info
+    DROP COLUMN IF EXISTS aura;
@@ -0,0 +1,28 @@
+-- Stakes and prizes of table matches
+
+ALTER TABLE user_info
+    ADD COLUMN IF NOT EXISTS aura INT NOT NULL DEFAULT 0 AFTER money;
+
+-- Card the owner stakes on a table with a card prize
+ALTER TABLE user_tables
+    ADD COLUMN IF NOT EXISTS owner_stake_card_id INT NULL AFTER rival_deck_id,
+    ADD CONSTRAINT fk_user_tables_owner_stake_card FOREIGN KEY IF NOT EXISTS (owner_stake_card_id) REFERENCES cards(id) ON DELETE SET NULL;
+
+-- Money or cards held in escrow from each player when the rival joins. They are paid to the
+-- winner when the match finishes; paid_to is set at the same time, so a stake is paid once.
+CREATE TABLE IF NOT EXISTS table_stakes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    table_id INT NOT NULL,
+    user_id INT NOT NULL,
+    money INT NOT NULL DEFAULT 0,
+    card_id INT NULL,
+    amount INT NOT NULL DEFAULT 0,
+    paid_to INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    paid_at DATETIME NULL,
+    CONSTRAINT fk_table_stakes_table FOREIGN KEY (table_id) REFERENCES tables(id) ON DELETE CASCADE,
+    CONSTRAINT fk_table_stakes_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_table_stakes_card FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE,
+    CONSTRAINT fk_table_stakes_paid_to FOREIGN KEY (paid_to) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE KEY unique_table_stake (table_id, user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
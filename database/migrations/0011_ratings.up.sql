@@ -0,0 +1,33 @@
+-- Glicko-2 ratings of the ranked ladder
+
+-- Users without a row have not played a ranked match and have the default rating
+CREATE TABLE IF NOT EXISTS user_ratings (
+    user_id INT PRIMARY KEY,
+    rating DOUBLE NOT NULL DEFAULT 1500,
+    deviation DOUBLE NOT NULL DEFAULT 350,
+    volatility DOUBLE NOT NULL DEFAULT 0.06,
+    games INT NOT NULL DEFAULT 0,
+    wins INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT fk_user_ratings_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_rating (rating)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- One row per player of every finished match, written when the table is settled
+CREATE TABLE IF NOT EXISTS rating_history (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    table_id INT NOT NULL,
+    opponent_id INT NULL,
+    won BOOLEAN NOT NULL,
+    rating_before DOUBLE NOT NULL,
+    rating_after DOUBLE NOT NULL,
+    deviation DOUBLE NOT NULL,
+    volatility DOUBLE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_rating_history_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_rating_history_table FOREIGN KEY (table_id) REFERENCES tables(id) ON DELETE CASCADE,
+    CONSTRAINT fk_rating_history_opponent FOREIGN KEY (opponent_id) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE KEY unique_rating_history_table_user (table_id, user_id),
+    INDEX idx_user_id_created_at (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,12 @@
+ALTER TABLE user_tables
+    DROP INDEX IF EXISTS idx_user_tables_clock_seat;
+
+ALTER TABLE user_tables
+    DROP COLUMN IF EXISTS clock_charged_at,
+    DROP COLUMN IF EXISTS clock_seat,
+    DROP COLUMN IF EXISTS rival_time_ms,
+    DROP COLUMN IF EXISTS owner_time_ms;
+
+ALTER TABLE tables
+    DROP COLUMN IF EXISTS time_increment,
+    DROP COLUMN IF EXISTS initial_time;
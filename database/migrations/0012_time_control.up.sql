@@ -0,0 +1,16 @@
+-- Chess-clock time control of table matches
+
+-- Seconds on each player's clock when the match starts, NULL for untimed tables, and the
+-- seconds a player gets back every time their turn ends
+ALTER TABLE tables
+    ADD COLUMN IF NOT EXISTS initial_time INT NULL AFTER amount,
+    ADD COLUMN IF NOT EXISTS time_increment INT NOT NULL DEFAULT 0 AFTER initial_time;
+
+-- Clocks of the match, kept by the server. Only the time of clock_seat runs, starting from
+-- clock_charged_at; time holds the seconds played so far.
+ALTER TABLE user_tables
+    ADD COLUMN IF NOT EXISTS owner_time_ms INT NULL AFTER time,
+    ADD COLUMN IF NOT EXISTS rival_time_ms INT NULL AFTER owner_time_ms,
+    ADD COLUMN IF NOT EXISTS clock_seat ENUM('owner', 'rival') NULL AFTER rival_time_ms,
+    ADD COLUMN IF NOT EXISTS clock_charged_at DATETIME(3) NULL AFTER clock_seat,
+    ADD INDEX IF NOT EXISTS idx_user_tables_clock_seat (clock_seat);
@@ -0,0 +1,10 @@
+ALTER TABLE decks
+    DROP FOREIGN KEY IF EXISTS fk_decks_format;
+
+ALTER TABLE decks
+    DROP INDEX IF EXISTS idx_format,
+    DROP COLUMN IF EXISTS format;
+
+DROP TABLE IF EXISTS deck_format_cards;
+DROP TABLE IF EXISTS deck_format_sets;
+DROP TABLE IF EXISTS deck_formats;
@@ -0,0 +1,43 @@
+-- Deck building formats, their banned and restricted lists and legal sets
+
+-- NULL limits are not enforced. max_copies does not apply to energies.
+CREATE TABLE IF NOT EXISTS deck_formats (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(20) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    min_cards INT NOT NULL DEFAULT 40,
+    max_cards INT NULL,
+    max_copies INT NULL,
+    min_energy_percent INT NOT NULL DEFAULT 0,
+    max_energy_percent INT NOT NULL DEFAULT 100,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Sets in rotation. A format without rows allows every set.
+CREATE TABLE IF NOT EXISTS deck_format_sets (
+    format_id INT NOT NULL,
+    set_code VARCHAR(10) NOT NULL,
+    PRIMARY KEY (format_id, set_code),
+    CONSTRAINT fk_deck_format_sets_format FOREIGN KEY (format_id) REFERENCES deck_formats(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Copies of a card allowed in a deck: 0 bans the card, 1 restricts it
+CREATE TABLE IF NOT EXISTS deck_format_cards (
+    format_id INT NOT NULL,
+    card_id INT NOT NULL,
+    card_limit INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (format_id, card_id),
+    CONSTRAINT fk_deck_format_cards_format FOREIGN KEY (format_id) REFERENCES deck_formats(id) ON DELETE CASCADE,
+    CONSTRAINT fk_deck_format_cards_card FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- unlimited keeps the rules decks were built with so far
+INSERT IGNORE INTO deck_formats (code, name, min_cards, max_cards, max_copies, min_energy_percent, max_energy_percent)
+VALUES ('unlimited', 'Unlimited', 40, NULL, NULL, 0, 100),
+       ('standard', 'Standard', 40, 60, 4, 10, 50);
+
+ALTER TABLE decks
+    ADD COLUMN IF NOT EXISTS format VARCHAR(20) NOT NULL DEFAULT 'unlimited' AFTER name,
+    ADD INDEX IF NOT EXISTS idx_format (format),
+    ADD CONSTRAINT fk_decks_format FOREIGN KEY IF NOT EXISTS (format) REFERENCES deck_formats(code) ON UPDATE CASCADE;
@@ -0,0 +1,2 @@
+ALTER TABLE effects
+    DROP COLUMN IF EXISTS script;
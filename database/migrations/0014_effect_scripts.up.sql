@@ -0,0 +1,4 @@
+-- Executable effects: a versioned JSON script the match engine runs. Effects without a
+-- script only describe the card.
+ALTER TABLE effects
+    ADD COLUMN IF NOT EXISTS script JSON NULL AFTER description;
@@ -0,0 +1,7 @@
+ALTER TABLE cards
+    DROP INDEX IF EXISTS ft_name_legend;
+
+ALTER TABLE cards
+    DROP INDEX IF EXISTS idx_hp,
+    DROP INDEX IF EXISTS idx_attack_cost_total,
+    DROP COLUMN IF EXISTS attack_cost_total;
@@ -0,0 +1,15 @@
+-- Card queries: the total attack cost so cards can be filtered and sorted by it, and a
+-- full-text index on the name and legend for searching
+
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS attack_cost_total INT AS (
+        COALESCE(JSON_VALUE(attack_cost, '$.Fire'), 0) + COALESCE(JSON_VALUE(attack_cost, '$.Water'), 0) +
+        COALESCE(JSON_VALUE(attack_cost, '$.Wind'), 0) + COALESCE(JSON_VALUE(attack_cost, '$.Earth'), 0) +
+        COALESCE(JSON_VALUE(attack_cost, '$.Neutral'), 0) + COALESCE(JSON_VALUE(attack_cost, '$.Holy'), 0) +
+        COALESCE(JSON_VALUE(attack_cost, '$.Dark'), 0)
+    ) STORED AFTER attack_cost,
+    ADD INDEX IF NOT EXISTS idx_hp (hp),
+    ADD INDEX IF NOT EXISTS idx_attack_cost_total (attack_cost_total);
+
+ALTER TABLE cards
+    ADD FULLTEXT INDEX IF NOT EXISTS ft_name_legend (name, legend);
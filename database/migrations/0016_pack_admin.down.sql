@@ -0,0 +1,2 @@
+ALTER TABLE packs
+    DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,4 @@
+-- Packs are retired with a soft delete so the history of their openings is kept
+
+ALTER TABLE packs
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL AFTER updated_at;
@@ -0,0 +1,2 @@
+ALTER TABLE table_state
+    DROP COLUMN IF EXISTS version;
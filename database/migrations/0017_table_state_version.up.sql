@@ -0,0 +1,4 @@
+-- Optimistic locking of match states, so server instances cannot overwrite each other's moves
+
+ALTER TABLE table_state
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 0 AFTER winner_seat;
@@ -0,0 +1,22 @@
+-- Cards held in a trade, a market listing or a table stake are copies players own, so a card
+-- cannot be deleted while it is referenced there
+
+ALTER TABLE trade_cards
+    DROP FOREIGN KEY IF EXISTS fk_trade_cards_card;
+ALTER TABLE trade_cards
+    ADD CONSTRAINT fk_trade_cards_card FOREIGN KEY IF NOT EXISTS (card_id) REFERENCES cards(id) ON DELETE RESTRICT;
+
+ALTER TABLE market_listings
+    DROP FOREIGN KEY IF EXISTS fk_market_listings_card;
+ALTER TABLE market_listings
+    ADD CONSTRAINT fk_market_listings_card FOREIGN KEY IF NOT EXISTS (card_id) REFERENCES cards(id) ON DELETE RESTRICT;
+
+ALTER TABLE table_stakes
+    DROP FOREIGN KEY IF EXISTS fk_table_stakes_card;
+ALTER TABLE table_stakes
+    ADD CONSTRAINT fk_table_stakes_card FOREIGN KEY IF NOT EXISTS (card_id) REFERENCES cards(id) ON DELETE RESTRICT;
+
+ALTER TABLE user_tables
+    DROP FOREIGN KEY IF EXISTS fk_user_tables_owner_stake_card;
+ALTER TABLE user_tables
+    ADD CONSTRAINT fk_user_tables_owner_stake_card FOREIGN KEY IF NOT EXISTS (owner_stake_card_id) REFERENCES cards(id) ON DELETE RESTRICT;
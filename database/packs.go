@@ -0,0 +1,270 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tcg-server-go/models"
+)
+
+// packColumns lists the packs columns in the order scanPack expects them
+const packColumns = `id, name, description, price, set_code, slots, created_at, updated_at, deleted_at`
+
+// scanPack reads a pack selected with packColumns
+func scanPack(row rowScanner) (*models.Pack, error) {
+	pack := &models.Pack{}
+	err := row.Scan(&pack.ID, &pack.Name, &pack.Description, &pack.Price, &pack.SetCode, &pack.Slots,
+		&pack.CreatedAt, &pack.UpdatedAt, &pack.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// GetPacks retrieves the store catalogue, cheapest first
+func GetPacks() ([]models.Pack, error) {
+	query := `
+		SELECT ` + packColumns + `
+		FROM packs
+		WHERE deleted_at IS NULL
+		ORDER BY price, id
+	`
+
+	rows, err := DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying packs: %v", err)
+	}
+	defer rows.Close()
+
+	packs := []models.Pack{}
+	for rows.Next() {
+		pack, err := scanPack(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning pack: %v", err)
+		}
+		packs = append(packs, *pack)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating packs: %v", err)
+	}
+
+	return packs, nil
+}
+
+// GetPackByID retrieves a pack that has not been deleted by its ID
+func GetPackByID(id int) (*models.Pack, error) {
+	query := `
+		SELECT ` + packColumns + `
+		FROM packs
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	pack, err := scanPack(DB.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Pack not found
+		}
+		return nil, fmt.Errorf("error getting pack: %v", err)
+	}
+
+	return pack, nil
+}
+
+// GetPackByName retrieves a pack by its name. Deleted packs keep their name, so they are
+// included.
+func GetPackByName(name string) (*models.Pack, error) {
+	query := `
+		SELECT ` + packColumns + `
+		FROM packs
+		WHERE name = ?
+	`
+
+	pack, err := scanPack(DB.QueryRow(query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Pack not found
+		}
+		return nil, fmt.Errorf("error getting pack: %v", err)
+	}
+
+	return pack, nil
+}
+
+// CreatePack adds a pack to the store catalogue, audited by the given entry
+func CreatePack(pack *models.Pack, audit *models.AuditEntry) error {
+	query := `
+		INSERT INTO packs (name, description, price, set_code, slots, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	pack.CreatedAt = now
+	pack.UpdatedAt = now
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, pack.Name, pack.Description, pack.Price, pack.SetCode, pack.Slots,
+		pack.CreatedAt, pack.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating pack: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting pack ID: %v", err)
+	}
+
+	pack.ID = int(id)
+	audit.EntityID = pack.ID
+	if err := insertAuditEntry(tx, audit, pack); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// UpdatePack replaces the fields of a pack that has not been deleted, audited by the given
+// entry
+func UpdatePack(pack *models.Pack, audit *models.AuditEntry) error {
+	query := `
+		UPDATE packs
+		SET name = ?, description = ?, price = ?, set_code = ?, slots = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	pack.UpdatedAt = time.Now()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, pack.Name, pack.Description, pack.Price, pack.SetCode, pack.Slots,
+		pack.UpdatedAt, pack.ID)
+	if err != nil {
+		return fmt.Errorf("error updating pack: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := insertAuditEntry(tx, audit, pack); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// SoftDeletePack takes a pack off the store by setting deleted_at, audited by the given
+// entry. Its openings are kept.
+func SoftDeletePack(id int, audit *models.AuditEntry) error {
+	query := `
+		UPDATE packs
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("error soft deleting pack: %v", err)
+	}
+
+	if err := insertAuditEntry(tx, audit, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// OpenPack charges a user the price of a pack, adds the pulled cards to their collection and
+// records the opening, all in one transaction. It returns false without changing anything if
+// the user cannot afford the pack.
+func OpenPack(opening *models.PackOpening) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the balance so concurrent purchases cannot both spend it
+	var money int
+	err = tx.QueryRow(`SELECT money FROM user_info WHERE user_id = ? FOR UPDATE`, opening.UserID).Scan(&money)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, fmt.Errorf("user info not found")
+		}
+		return false, fmt.Errorf("error getting user money: %v", err)
+	}
+
+	if money < opening.Price {
+		return false, nil
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE user_info SET money = money - ?, updated_at = ? WHERE user_id = ?`,
+		opening.Price, now, opening.UserID)
+	if err != nil {
+		return false, fmt.Errorf("error spending money: %v", err)
+	}
+
+	for _, cardID := range opening.CardIDs {
+		_, err = tx.Exec(`
+			INSERT INTO user_cards (user_id, card_id, amount, created_at, updated_at)
+			VALUES (?, ?, 1, ?, ?)
+			ON DUPLICATE KEY UPDATE amount = amount + 1, updated_at = VALUES(updated_at)
+		`, opening.UserID, cardID, now, now)
+		if err != nil {
+			return false, fmt.Errorf("error adding card %d: %v", cardID, err)
+		}
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO pack_openings (user_id, pack_id, price, seed, card_ids, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, opening.UserID, opening.PackID, opening.Price, opening.Seed, opening.CardIDs, now)
+	if err != nil {
+		return false, fmt.Errorf("error recording pack opening: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, fmt.Errorf("error getting pack opening ID: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing pack opening: %v", err)
+	}
+
+	opening.ID = int(id)
+	opening.MoneyLeft = money - opening.Price
+	opening.CreatedAt = now
+	return true, nil
+}
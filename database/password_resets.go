@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreatePasswordReset stores the hash of a reset token for a user
+func CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES (?, ?, ?)
+	`
+
+	_, err := DB.Exec(query, userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating password reset: %v", err)
+	}
+
+	return nil
+}
+
+// ConsumePasswordReset marks a reset token as used and returns the ID of its user.
+// Every other outstanding token of the user is used up as well. It returns 0 if the
+// token does not exist, has expired or was already used.
+func ConsumePasswordReset(tokenHash string) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	var userID int
+	err = tx.QueryRow(`
+		SELECT user_id FROM password_resets
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE
+	`, tokenHash, now).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil // Unknown, expired or used token
+		}
+		return 0, fmt.Errorf("error getting password reset: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE password_resets
+		SET used_at = ?
+		WHERE user_id = ? AND used_at IS NULL
+	`, now, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error using password reset: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing password reset: %v", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tcg-server-go/models"
+	"tcg-server-go/rating"
+)
+
+// GetUserRating returns the rating of a user, or the default rating if they have not
+// played a ranked match yet
+func GetUserRating(userID int) (*models.Rating, error) {
+	query := `
+		SELECT user_id, rating, deviation, volatility, games, wins, updated_at
+		FROM user_ratings
+		WHERE user_id = ?
+	`
+
+	userRating := &models.Rating{}
+	var updatedAt time.Time
+	err := DB.QueryRow(query, userID).Scan(&userRating.UserID, &userRating.Rating, &userRating.Deviation,
+		&userRating.Volatility, &userRating.Games, &userRating.Wins, &updatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return defaultUserRating(userID), nil
+		}
+		return nil, fmt.Errorf("error getting user rating: %v", err)
+	}
+	userRating.UpdatedAt = &updatedAt
+	userRating.Category = rating.Category(rating.Rating{
+		Rating:     userRating.Rating,
+		Deviation:  userRating.Deviation,
+		Volatility: userRating.Volatility,
+	})
+
+	return userRating, nil
+}
+
+// GetRatingHistory returns the latest rating changes of a user, newest first
+func GetRatingHistory(userID, limit int) ([]models.RatingChange, error) {
+	query := `
+		SELECT id, user_id, table_id, opponent_id, won, rating_before, rating_after, deviation, volatility, created_at
+		FROM rating_history
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	rows, err := DB.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying rating history: %v", err)
+	}
+	defer rows.Close()
+
+	changes := []models.RatingChange{}
+	for rows.Next() {
+		var change models.RatingChange
+		err := rows.Scan(&change.ID, &change.UserID, &change.TableID, &change.OpponentID, &change.Won,
+			&change.RatingBefore, &change.RatingAfter, &change.Deviation, &change.Volatility, &change.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning rating change: %v", err)
+		}
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rating history: %v", err)
+	}
+
+	return changes, nil
+}
+
+// GetLeaderboard lists the players that played a ranked match by rating, highest first.
+// It also returns the total number of ranked players for pagination.
+func GetLeaderboard(limit, offset int) ([]models.LeaderboardEntry, int, error) {
+	var total int
+	err := DB.QueryRow("SELECT COUNT(*) FROM user_ratings WHERE games > 0").Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting ranked players: %v", err)
+	}
+
+	query := `
+		SELECT r.user_id, u.name, r.rating, r.deviation, r.volatility, r.games, r.wins
+		FROM user_ratings r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.games > 0
+		ORDER BY r.rating DESC, r.deviation ASC, r.user_id ASC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := DB.Query(query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying leaderboard: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []models.LeaderboardEntry{}
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		var volatility float64
+		err := rows.Scan(&entry.UserID, &entry.Name, &entry.Rating, &entry.Deviation, &volatility,
+			&entry.Games, &entry.Wins)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning leaderboard entry: %v", err)
+		}
+		entry.Rank = offset + len(entries) + 1
+		entry.Category = rating.Category(rating.Rating{Rating: entry.Rating, Deviation: entry.Deviation, Volatility: volatility})
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating leaderboard: %v", err)
+	}
+
+	return entries, total, nil
+}
+
+// updateRatings rates a finished match within a transaction: both players get their new
+// Glicko-2 rating and a row in the rating history
+func updateRatings(tx *sql.Tx, tableID uint, winnerID, loserID int, now time.Time) ([]models.RatingChange, error) {
+	start := rating.Default()
+	for _, userID := range []int{winnerID, loserID} {
+		_, err := tx.Exec(`
+			INSERT IGNORE INTO user_ratings (user_id, rating, deviation, volatility, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, userID, start.Rating, start.Deviation, start.Volatility, now)
+		if err != nil {
+			return nil, fmt.Errorf("error creating user rating: %v", err)
+		}
+	}
+
+	current := make(map[int]rating.Rating, 2)
+	rows, err := tx.Query(`
+		SELECT user_id, rating, deviation, volatility
+		FROM user_ratings
+		WHERE user_id IN (?, ?)
+		ORDER BY user_id
+		FOR UPDATE
+	`, winnerID, loserID)
+	if err != nil {
+		return nil, fmt.Errorf("error locking user ratings: %v", err)
+	}
+	for rows.Next() {
+		var userID int
+		var r rating.Rating
+		if err := rows.Scan(&userID, &r.Rating, &r.Deviation, &r.Volatility); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning user rating: %v", err)
+		}
+		current[userID] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user ratings: %v", err)
+	}
+
+	changes := []models.RatingChange{
+		ratingChange(tableID, winnerID, loserID, true, current, now),
+		ratingChange(tableID, loserID, winnerID, false, current, now),
+	}
+
+	for i, change := range changes {
+		wins := 0
+		if change.Won {
+			wins = 1
+		}
+		_, err := tx.Exec(`
+			UPDATE user_ratings
+			SET rating = ?, deviation = ?, volatility = ?, games = games + 1, wins = wins + ?, updated_at = ?
+			WHERE user_id = ?
+		`, change.RatingAfter, change.Deviation, change.Volatility, wins, now, change.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("error updating user rating: %v", err)
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO rating_history (user_id, table_id, opponent_id, won, rating_before, rating_after, deviation, volatility, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, change.UserID, change.TableID, change.OpponentID, change.Won, change.RatingBefore, change.RatingAfter,
+			change.Deviation, change.Volatility, now)
+		if err != nil {
+			return nil, fmt.Errorf("error creating rating history: %v", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("error getting rating history ID: %v", err)
+		}
+		changes[i].ID = int(id)
+	}
+
+	return changes, nil
+}
+
+// ratingChange computes the new rating of a player after a match, using the ratings both
+// players had before it
+func ratingChange(tableID uint, userID, opponentID int, won bool, current map[int]rating.Rating, now time.Time) models.RatingChange {
+	score := 0.0
+	if won {
+		score = 1
+	}
+	before := current[userID]
+	after := rating.Update(before, current[opponentID], score)
+
+	return models.RatingChange{
+		UserID:       userID,
+		TableID:      tableID,
+		OpponentID:   &opponentID,
+		Won:          won,
+		RatingBefore: before.Rating,
+		RatingAfter:  after.Rating,
+		Deviation:    after.Deviation,
+		Volatility:   after.Volatility,
+		CreatedAt:    now,
+	}
+}
+
+// defaultUserRating is the rating of a user without ranked matches
+func defaultUserRating(userID int) *models.Rating {
+	start := rating.Default()
+	return &models.Rating{
+		UserID:     userID,
+		Rating:     start.Rating,
+		Deviation:  start.Deviation,
+		Volatility: start.Volatility,
+		Category:   rating.Category(start),
+	}
+}
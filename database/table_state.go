@@ -9,8 +9,52 @@ import (
 	"tcg-server-go/models"
 )
 
+// tableStateColumns lists the table_state columns in the order scanTableState expects them
+const tableStateColumns = `
+	id, table_id, log, owners_deck_id, rivals_deck_id,
+	owners_active_monster, owners_bench_monster_1, owners_bench_monster_2, owners_bench_monster_3,
+	owners_active_monster_hp, owners_bench_monster_1_hp, owners_bench_monster_2_hp, owners_bench_monster_3_hp,
+	owners_graveyard, rivals_active_monster, rivals_bench_monster_1, rivals_bench_monster_2, rivals_bench_monster_3,
+	rivals_active_monster_hp, rivals_bench_monster_1_hp, rivals_bench_monster_2_hp, rivals_bench_monster_3_hp,
+	rivals_graveyard, owners_hand, owners_deck, rivals_hand, rivals_deck,
+	owners_ready, rivals_ready, phase, turn, active_seat, energy_attached, winner_seat,
+	version, created_at, updated_at
+`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 // CreateTableState creates a new table state record (internal use only)
 func CreateTableState(tableState *models.TableState) error {
+	return insertTableState(DB, tableState)
+}
+
+// StartTableState creates the state of a new match and starts its clock in one transaction,
+// so a failure leaves no state behind that would keep the table from being dealt again
+func StartTableState(tableState *models.TableState, clock *models.TableClock) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertTableState(tx, tableState); err != nil {
+		return err
+	}
+	if err := updateTableClock(tx, clock); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// insertTableState inserts a table state, on its own or as part of a transaction
+func insertTableState(db execer, tableState *models.TableState) error {
 	query := `
 		INSERT INTO table_state (
 			table_id, log, owners_deck_id, rivals_deck_id,
@@ -18,8 +62,9 @@ func CreateTableState(tableState *models.TableState) error {
 			owners_active_monster_hp, owners_bench_monster_1_hp, owners_bench_monster_2_hp, owners_bench_monster_3_hp,
 			owners_graveyard, rivals_active_monster, rivals_bench_monster_1, rivals_bench_monster_2, rivals_bench_monster_3,
 			rivals_active_monster_hp, rivals_bench_monster_1_hp, rivals_bench_monster_2_hp, rivals_bench_monster_3_hp,
-			rivals_graveyard
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			rivals_graveyard, owners_hand, owners_deck, rivals_hand, rivals_deck,
+			owners_ready, rivals_ready, phase, turn, active_seat, energy_attached, winner_seat
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	// Convert slices to JSON strings
@@ -33,14 +78,24 @@ func CreateTableState(tableState *models.TableState) error {
 	rivalsBenchMonster2JSON, _ := json.Marshal(tableState.RivalsBenchMonster2)
 	rivalsBenchMonster3JSON, _ := json.Marshal(tableState.RivalsBenchMonster3)
 	rivalsGraveyardJSON, _ := json.Marshal(tableState.RivalsGraveyard)
+	ownersHandJSON, _ := json.Marshal(tableState.OwnersHand)
+	ownersDeckJSON, _ := json.Marshal(tableState.OwnersDeck)
+	rivalsHandJSON, _ := json.Marshal(tableState.RivalsHand)
+	rivalsDeckJSON, _ := json.Marshal(tableState.RivalsDeck)
 
-	result, err := DB.Exec(query,
+	if tableState.Phase == "" {
+		tableState.Phase = "setup"
+	}
+
+	result, err := db.Exec(query,
 		tableState.TableID, tableState.Log, tableState.OwnersDeckID, tableState.RivalsDeckID,
 		ownersActiveMonsterJSON, ownersBenchMonster1JSON, ownersBenchMonster2JSON, ownersBenchMonster3JSON,
 		tableState.OwnersActiveMonsterHP, tableState.OwnersBenchMonster1HP, tableState.OwnersBenchMonster2HP, tableState.OwnersBenchMonster3HP,
 		ownersGraveyardJSON, rivalsActiveMonsterJSON, rivalsBenchMonster1JSON, rivalsBenchMonster2JSON, rivalsBenchMonster3JSON,
 		tableState.RivalsActiveMonsterHP, tableState.RivalsBenchMonster1HP, tableState.RivalsBenchMonster2HP, tableState.RivalsBenchMonster3HP,
-		rivalsGraveyardJSON,
+		rivalsGraveyardJSON, ownersHandJSON, ownersDeckJSON, rivalsHandJSON, rivalsDeckJSON,
+		tableState.OwnersReady, tableState.RivalsReady, tableState.Phase, tableState.Turn, tableState.ActiveSeat,
+		tableState.EnergyAttached, tableState.WinnerSeat,
 	)
 	if err != nil {
 		return fmt.Errorf("error creating table state: %v", err)
@@ -58,32 +113,14 @@ func CreateTableState(tableState *models.TableState) error {
 // GetTableStateByTableID retrieves the current state of a table (internal use only)
 func GetTableStateByTableID(tableID uint) (*models.TableState, error) {
 	query := `
-		SELECT id, table_id, log, owners_deck_id, rivals_deck_id,
-			owners_active_monster, owners_bench_monster_1, owners_bench_monster_2, owners_bench_monster_3,
-			owners_active_monster_hp, owners_bench_monster_1_hp, owners_bench_monster_2_hp, owners_bench_monster_3_hp,
-			owners_graveyard, rivals_active_monster, rivals_bench_monster_1, rivals_bench_monster_2, rivals_bench_monster_3,
-			rivals_active_monster_hp, rivals_bench_monster_1_hp, rivals_bench_monster_2_hp, rivals_bench_monster_3_hp,
-			rivals_graveyard, created_at, updated_at
+		SELECT ` + tableStateColumns + `
 		FROM table_state
 		WHERE table_id = ?
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
 
-	var tableState models.TableState
-	var ownersActiveMonsterJSON, ownersBenchMonster1JSON, ownersBenchMonster2JSON, ownersBenchMonster3JSON,
-		ownersGraveyardJSON, rivalsActiveMonsterJSON, rivalsBenchMonster1JSON, rivalsBenchMonster2JSON,
-		rivalsBenchMonster3JSON, rivalsGraveyardJSON sql.NullString
-
-	err := DB.QueryRow(query, tableID).Scan(
-		&tableState.ID, &tableState.TableID, &tableState.Log, &tableState.OwnersDeckID, &tableState.RivalsDeckID,
-		&ownersActiveMonsterJSON, &ownersBenchMonster1JSON, &ownersBenchMonster2JSON, &ownersBenchMonster3JSON,
-		&tableState.OwnersActiveMonsterHP, &tableState.OwnersBenchMonster1HP, &tableState.OwnersBenchMonster2HP, &tableState.OwnersBenchMonster3HP,
-		&ownersGraveyardJSON, &rivalsActiveMonsterJSON, &rivalsBenchMonster1JSON, &rivalsBenchMonster2JSON, &rivalsBenchMonster3JSON,
-		&tableState.RivalsActiveMonsterHP, &tableState.RivalsBenchMonster1HP, &tableState.RivalsBenchMonster2HP, &tableState.RivalsBenchMonster3HP,
-		&rivalsGraveyardJSON, &tableState.CreatedAt, &tableState.UpdatedAt,
-	)
-
+	tableState, err := scanTableState(DB.QueryRow(query, tableID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -91,42 +128,12 @@ func GetTableStateByTableID(tableID uint) (*models.TableState, error) {
 		return nil, fmt.Errorf("error getting table state: %v", err)
 	}
 
-	// Parse JSON arrays
-	if ownersActiveMonsterJSON.Valid {
-		json.Unmarshal([]byte(ownersActiveMonsterJSON.String), &tableState.OwnersActiveMonster)
-	}
-	if ownersBenchMonster1JSON.Valid {
-		json.Unmarshal([]byte(ownersBenchMonster1JSON.String), &tableState.OwnersBenchMonster1)
-	}
-	if ownersBenchMonster2JSON.Valid {
-		json.Unmarshal([]byte(ownersBenchMonster2JSON.String), &tableState.OwnersBenchMonster2)
-	}
-	if ownersBenchMonster3JSON.Valid {
-		json.Unmarshal([]byte(ownersBenchMonster3JSON.String), &tableState.OwnersBenchMonster3)
-	}
-	if ownersGraveyardJSON.Valid {
-		json.Unmarshal([]byte(ownersGraveyardJSON.String), &tableState.OwnersGraveyard)
-	}
-	if rivalsActiveMonsterJSON.Valid {
-		json.Unmarshal([]byte(rivalsActiveMonsterJSON.String), &tableState.RivalsActiveMonster)
-	}
-	if rivalsBenchMonster1JSON.Valid {
-		json.Unmarshal([]byte(rivalsBenchMonster1JSON.String), &tableState.RivalsBenchMonster1)
-	}
-	if rivalsBenchMonster2JSON.Valid {
-		json.Unmarshal([]byte(rivalsBenchMonster2JSON.String), &tableState.RivalsBenchMonster2)
-	}
-	if rivalsBenchMonster3JSON.Valid {
-		json.Unmarshal([]byte(rivalsBenchMonster3JSON.String), &tableState.RivalsBenchMonster3)
-	}
-	if rivalsGraveyardJSON.Valid {
-		json.Unmarshal([]byte(rivalsGraveyardJSON.String), &tableState.RivalsGraveyard)
-	}
-
-	return &tableState, nil
+	return tableState, nil
 }
 
-// UpdateTableState updates an existing table state (internal use only)
+// UpdateTableState updates an existing table state (internal use only). The state is only
+// saved if its version is still the one stored, and models.ErrStaleTableState is returned
+// otherwise; on success the version of tableState is bumped.
 func UpdateTableState(tableState *models.TableState) error {
 	query := `
 		UPDATE table_state SET
@@ -135,8 +142,10 @@ func UpdateTableState(tableState *models.TableState) error {
 			owners_active_monster_hp = ?, owners_bench_monster_1_hp = ?, owners_bench_monster_2_hp = ?, owners_bench_monster_3_hp = ?,
 			owners_graveyard = ?, rivals_active_monster = ?, rivals_bench_monster_1 = ?, rivals_bench_monster_2 = ?, rivals_bench_monster_3 = ?,
 			rivals_active_monster_hp = ?, rivals_bench_monster_1_hp = ?, rivals_bench_monster_2_hp = ?, rivals_bench_monster_3_hp = ?,
-			rivals_graveyard = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
+			rivals_graveyard = ?, owners_hand = ?, owners_deck = ?, rivals_hand = ?, rivals_deck = ?,
+			owners_ready = ?, rivals_ready = ?, phase = ?, turn = ?, active_seat = ?, energy_attached = ?, winner_seat = ?,
+			version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND version = ?
 	`
 
 	// Convert slices to JSON strings
@@ -150,19 +159,34 @@ func UpdateTableState(tableState *models.TableState) error {
 	rivalsBenchMonster2JSON, _ := json.Marshal(tableState.RivalsBenchMonster2)
 	rivalsBenchMonster3JSON, _ := json.Marshal(tableState.RivalsBenchMonster3)
 	rivalsGraveyardJSON, _ := json.Marshal(tableState.RivalsGraveyard)
+	ownersHandJSON, _ := json.Marshal(tableState.OwnersHand)
+	ownersDeckJSON, _ := json.Marshal(tableState.OwnersDeck)
+	rivalsHandJSON, _ := json.Marshal(tableState.RivalsHand)
+	rivalsDeckJSON, _ := json.Marshal(tableState.RivalsDeck)
 
-	_, err := DB.Exec(query,
+	result, err := DB.Exec(query,
 		tableState.Log, tableState.OwnersDeckID, tableState.RivalsDeckID,
 		ownersActiveMonsterJSON, ownersBenchMonster1JSON, ownersBenchMonster2JSON, ownersBenchMonster3JSON,
 		tableState.OwnersActiveMonsterHP, tableState.OwnersBenchMonster1HP, tableState.OwnersBenchMonster2HP, tableState.OwnersBenchMonster3HP,
 		ownersGraveyardJSON, rivalsActiveMonsterJSON, rivalsBenchMonster1JSON, rivalsBenchMonster2JSON, rivalsBenchMonster3JSON,
 		tableState.RivalsActiveMonsterHP, tableState.RivalsBenchMonster1HP, tableState.RivalsBenchMonster2HP, tableState.RivalsBenchMonster3HP,
-		rivalsGraveyardJSON, tableState.ID,
+		rivalsGraveyardJSON, ownersHandJSON, ownersDeckJSON, rivalsHandJSON, rivalsDeckJSON,
+		tableState.OwnersReady, tableState.RivalsReady, tableState.Phase, tableState.Turn, tableState.ActiveSeat,
+		tableState.EnergyAttached, tableState.WinnerSeat, tableState.ID, tableState.Version,
 	)
 	if err != nil {
 		return fmt.Errorf("error updating table state: %v", err)
 	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error updating table state: %v", err)
+	}
+	if rowsAffected == 0 {
+		return models.ErrStaleTableState
+	}
+
+	tableState.Version++
 	return nil
 }
 
@@ -179,12 +203,7 @@ func DeleteTableState(id uint) error {
 // GetTableStateHistory retrieves the history of table states for a specific table (internal use only)
 func GetTableStateHistory(tableID uint, limit int) ([]models.TableState, error) {
 	query := `
-		SELECT id, table_id, log, owners_deck_id, rivals_deck_id,
-			owners_active_monster, owners_bench_monster_1, owners_bench_monster_2, owners_bench_monster_3,
-			owners_active_monster_hp, owners_bench_monster_1_hp, owners_bench_monster_2_hp, owners_bench_monster_3_hp,
-			owners_graveyard, rivals_active_monster, rivals_bench_monster_1, rivals_bench_monster_2, rivals_bench_monster_3,
-			rivals_active_monster_hp, rivals_bench_monster_1_hp, rivals_bench_monster_2_hp, rivals_bench_monster_3_hp,
-			rivals_graveyard, created_at, updated_at
+		SELECT ` + tableStateColumns + `
 		FROM table_state
 		WHERE table_id = ?
 		ORDER BY created_at DESC
@@ -199,58 +218,66 @@ func GetTableStateHistory(tableID uint, limit int) ([]models.TableState, error)
 
 	var tableStates []models.TableState
 	for rows.Next() {
-		var tableState models.TableState
-		var ownersActiveMonsterJSON, ownersBenchMonster1JSON, ownersBenchMonster2JSON, ownersBenchMonster3JSON,
-			ownersGraveyardJSON, rivalsActiveMonsterJSON, rivalsBenchMonster1JSON, rivalsBenchMonster2JSON,
-			rivalsBenchMonster3JSON, rivalsGraveyardJSON sql.NullString
-
-		err := rows.Scan(
-			&tableState.ID, &tableState.TableID, &tableState.Log, &tableState.OwnersDeckID, &tableState.RivalsDeckID,
-			&ownersActiveMonsterJSON, &ownersBenchMonster1JSON, &ownersBenchMonster2JSON, &ownersBenchMonster3JSON,
-			&tableState.OwnersActiveMonsterHP, &tableState.OwnersBenchMonster1HP, &tableState.OwnersBenchMonster2HP, &tableState.OwnersBenchMonster3HP,
-			&ownersGraveyardJSON, &rivalsActiveMonsterJSON, &rivalsBenchMonster1JSON, &rivalsBenchMonster2JSON, &rivalsBenchMonster3JSON,
-			&tableState.RivalsActiveMonsterHP, &tableState.RivalsBenchMonster1HP, &tableState.RivalsBenchMonster2HP, &tableState.RivalsBenchMonster3HP,
-			&rivalsGraveyardJSON, &tableState.CreatedAt, &tableState.UpdatedAt,
-		)
+		tableState, err := scanTableState(rows)
 		if err != nil {
 			log.Printf("Error scanning table state row: %v", err)
 			continue
 		}
 
-		// Parse JSON arrays
-		if ownersActiveMonsterJSON.Valid {
-			json.Unmarshal([]byte(ownersActiveMonsterJSON.String), &tableState.OwnersActiveMonster)
-		}
-		if ownersBenchMonster1JSON.Valid {
-			json.Unmarshal([]byte(ownersBenchMonster1JSON.String), &tableState.OwnersBenchMonster1)
-		}
-		if ownersBenchMonster2JSON.Valid {
-			json.Unmarshal([]byte(ownersBenchMonster2JSON.String), &tableState.OwnersBenchMonster2)
-		}
-		if ownersBenchMonster3JSON.Valid {
-			json.Unmarshal([]byte(ownersBenchMonster3JSON.String), &tableState.OwnersBenchMonster3)
-		}
-		if ownersGraveyardJSON.Valid {
-			json.Unmarshal([]byte(ownersGraveyardJSON.String), &tableState.OwnersGraveyard)
-		}
-		if rivalsActiveMonsterJSON.Valid {
-			json.Unmarshal([]byte(rivalsActiveMonsterJSON.String), &tableState.RivalsActiveMonster)
-		}
-		if rivalsBenchMonster1JSON.Valid {
-			json.Unmarshal([]byte(rivalsBenchMonster1JSON.String), &tableState.RivalsBenchMonster1)
-		}
-		if rivalsBenchMonster2JSON.Valid {
-			json.Unmarshal([]byte(rivalsBenchMonster2JSON.String), &tableState.RivalsBenchMonster2)
-		}
-		if rivalsBenchMonster3JSON.Valid {
-			json.Unmarshal([]byte(rivalsBenchMonster3JSON.String), &tableState.RivalsBenchMonster3)
-		}
-		if rivalsGraveyardJSON.Valid {
-			json.Unmarshal([]byte(rivalsGraveyardJSON.String), &tableState.RivalsGraveyard)
-		}
-
-		tableStates = append(tableStates, tableState)
+		tableStates = append(tableStates, *tableState)
 	}
 
 	return tableStates, nil
 }
+
+// scanTableState scans a row selected with tableStateColumns and parses its JSON arrays
+func scanTableState(row rowScanner) (*models.TableState, error) {
+	var tableState models.TableState
+	var ownersActiveMonsterJSON, ownersBenchMonster1JSON, ownersBenchMonster2JSON, ownersBenchMonster3JSON,
+		ownersGraveyardJSON, rivalsActiveMonsterJSON, rivalsBenchMonster1JSON, rivalsBenchMonster2JSON,
+		rivalsBenchMonster3JSON, rivalsGraveyardJSON, ownersHandJSON, ownersDeckJSON,
+		rivalsHandJSON, rivalsDeckJSON sql.NullString
+
+	err := row.Scan(
+		&tableState.ID, &tableState.TableID, &tableState.Log, &tableState.OwnersDeckID, &tableState.RivalsDeckID,
+		&ownersActiveMonsterJSON, &ownersBenchMonster1JSON, &ownersBenchMonster2JSON, &ownersBenchMonster3JSON,
+		&tableState.OwnersActiveMonsterHP, &tableState.OwnersBenchMonster1HP, &tableState.OwnersBenchMonster2HP, &tableState.OwnersBenchMonster3HP,
+		&ownersGraveyardJSON, &rivalsActiveMonsterJSON, &rivalsBenchMonster1JSON, &rivalsBenchMonster2JSON, &rivalsBenchMonster3JSON,
+		&tableState.RivalsActiveMonsterHP, &tableState.RivalsBenchMonster1HP, &tableState.RivalsBenchMonster2HP, &tableState.RivalsBenchMonster3HP,
+		&rivalsGraveyardJSON, &ownersHandJSON, &ownersDeckJSON, &rivalsHandJSON, &rivalsDeckJSON,
+		&tableState.OwnersReady, &tableState.RivalsReady, &tableState.Phase, &tableState.Turn, &tableState.ActiveSeat,
+		&tableState.EnergyAttached, &tableState.WinnerSeat,
+		&tableState.Version, &tableState.CreatedAt, &tableState.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON arrays
+	jsonColumns := []struct {
+		raw    sql.NullString
+		target *[]uint
+	}{
+		{ownersActiveMonsterJSON, &tableState.OwnersActiveMonster},
+		{ownersBenchMonster1JSON, &tableState.OwnersBenchMonster1},
+		{ownersBenchMonster2JSON, &tableState.OwnersBenchMonster2},
+		{ownersBenchMonster3JSON, &tableState.OwnersBenchMonster3},
+		{ownersGraveyardJSON, &tableState.OwnersGraveyard},
+		{rivalsActiveMonsterJSON, &tableState.RivalsActiveMonster},
+		{rivalsBenchMonster1JSON, &tableState.RivalsBenchMonster1},
+		{rivalsBenchMonster2JSON, &tableState.RivalsBenchMonster2},
+		{rivalsBenchMonster3JSON, &tableState.RivalsBenchMonster3},
+		{rivalsGraveyardJSON, &tableState.RivalsGraveyard},
+		{ownersHandJSON, &tableState.OwnersHand},
+		{ownersDeckJSON, &tableState.OwnersDeck},
+		{rivalsHandJSON, &tableState.RivalsHand},
+		{rivalsDeckJSON, &tableState.RivalsDeck},
+	}
+	for _, column := range jsonColumns {
+		if column.raw.Valid {
+			json.Unmarshal([]byte(column.raw.String), column.target)
+		}
+	}
+
+	return &tableState, nil
+}
@@ -3,10 +3,13 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"time"
+
+	"tcg-server-go/models"
 )
 
-// CreateTable creates a new table
-func CreateTable(category, privacy, prize string, password *string, amount *int) (*sql.Result, error) {
+// CreateTable creates a new table and returns its ID
+func CreateTable(category, privacy, prize string, password *string, amount *int) (uint, error) {
 	query := `
 		INSERT INTO tables (category, privacy, password, prize, amount, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, NOW(), NOW())
@@ -26,20 +29,25 @@ func CreateTable(category, privacy, prize string, password *string, amount *int)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("error creating table: %v", err)
+		return 0, fmt.Errorf("error creating table: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting table ID: %v", err)
 	}
 
-	return &result, nil
+	return uint(id), nil
 }
 
 // CreateUserTable creates a new user table association
-func CreateUserTable(userID, tableID uint, rivalID *uint) error {
+func CreateUserTable(userID, tableID uint, rivalID *uint, ownerDeckID uint) error {
 	query := `
-		INSERT INTO user_tables (user_id, rival_id, table_id, time)
-		VALUES (?, ?, ?, 0)
+		INSERT INTO user_tables (user_id, rival_id, table_id, time, owner_deck_id)
+		VALUES (?, ?, ?, 0, ?)
 	`
 
-	_, err := DB.Exec(query, userID, rivalID, tableID)
+	_, err := DB.Exec(query, userID, rivalID, tableID, ownerDeckID)
 	if err != nil {
 		return fmt.Errorf("error creating user table: %v", err)
 	}
@@ -47,80 +55,192 @@ func CreateUserTable(userID, tableID uint, rivalID *uint) error {
 	return nil
 }
 
+// OpenTable creates a table with the settings of its owner and seats the owner with their
+// deck. It runs in one transaction, so a table is never left without its owner, stake card
+// or time control. It returns the ID of the table.
+func OpenTable(ownerID, ownerDeckID uint, settings models.TableSettings) (uint, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO tables (category, privacy, password, prize, amount, initial_time, time_increment, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW(), NOW())
+	`, settings.Category, settings.Privacy, settings.Password, settings.Prize, settings.Amount, settings.InitialTime,
+		settings.TimeIncrement)
+	if err != nil {
+		return 0, fmt.Errorf("error creating table: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting table ID: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_tables (user_id, rival_id, table_id, time, owner_deck_id, owner_stake_card_id)
+		VALUES (?, NULL, ?, 0, ?, ?)
+	`, ownerID, id, ownerDeckID, settings.StakeCardID)
+	if err != nil {
+		return 0, fmt.Errorf("error creating user table: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %v", err)
+	}
+	return uint(id), nil
+}
+
 // GetTableByID retrieves a table by its ID
-func GetTableByID(id uint) (*sql.Row, error) {
+func GetTableByID(id uint) (*models.Table, error) {
 	query := `
-		SELECT id, category, privacy, password, prize, amount, winner, created_at, updated_at, finished_at
+		SELECT id, category, privacy, password, prize, amount, initial_time, time_increment, winner, created_at, updated_at, finished_at
 		FROM tables WHERE id = ?
 	`
 
-	row := DB.QueryRow(query, id)
-	return row, nil
+	table := &models.Table{}
+	err := DB.QueryRow(query, id).Scan(&table.ID, &table.Category, &table.Privacy, &table.Password, &table.Prize,
+		&table.Amount, &table.InitialTime, &table.TimeIncrement, &table.Winner, &table.CreatedAt, &table.UpdatedAt,
+		&table.FinishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Table not found
+		}
+		return nil, fmt.Errorf("error getting table: %v", err)
+	}
+
+	return table, nil
+}
+
+// userTableQuery selects user tables with their players and table, as read by scanUserTable
+const userTableQuery = `
+	SELECT ut.id, ut.user_id, ut.rival_id, ut.table_id, ut.time, ut.owner_deck_id, ut.rival_deck_id, ut.owner_stake_card_id,
+	       u.name as user_name, u.email as user_email,
+	       r.name as rival_name, r.email as rival_email,
+	       t.id, t.category, t.privacy, t.password, t.prize, t.amount, t.initial_time, t.time_increment,
+	       t.winner, t.created_at, t.updated_at, t.finished_at
+	FROM user_tables ut
+	JOIN users u ON ut.user_id = u.id
+	LEFT JOIN users r ON ut.rival_id = r.id
+	JOIN tables t ON ut.table_id = t.id
+`
+
+// scanUserTable reads a row selected by userTableQuery
+func scanUserTable(row rowScanner) (*models.UserTable, error) {
+	userTable := &models.UserTable{}
+	var rivalName, rivalEmail sql.NullString
+
+	err := row.Scan(
+		&userTable.ID, &userTable.UserID, &userTable.RivalID, &userTable.TableID, &userTable.Time,
+		&userTable.OwnerDeckID, &userTable.RivalDeckID, &userTable.StakeCardID,
+		&userTable.User.Name, &userTable.User.Email,
+		&rivalName, &rivalEmail,
+		&userTable.Table.ID, &userTable.Table.Category, &userTable.Table.Privacy, &userTable.Table.Password,
+		&userTable.Table.Prize, &userTable.Table.Amount, &userTable.Table.InitialTime, &userTable.Table.TimeIncrement,
+		&userTable.Table.Winner,
+		&userTable.Table.CreatedAt, &userTable.Table.UpdatedAt, &userTable.Table.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	userTable.User.ID = int(userTable.UserID)
+	if userTable.RivalID != nil {
+		userTable.Rival = &models.User{ID: int(*userTable.RivalID), Name: rivalName.String, Email: rivalEmail.String}
+	}
+
+	return userTable, nil
 }
 
 // GetUserTableByTableID retrieves user table by table ID
-func GetUserTableByTableID(tableID uint) (*sql.Row, error) {
-	query := `
-		SELECT ut.id, ut.user_id, ut.rival_id, ut.table_id, ut.time,
-		       u.name as user_name, u.email as user_email,
-		       r.name as rival_name, r.email as rival_email,
-		       t.category, t.privacy, t.prize, t.amount, t.winner, t.created_at, t.updated_at, t.finished_at
-		FROM user_tables ut
-		JOIN users u ON ut.user_id = u.id
-		LEFT JOIN users r ON ut.rival_id = r.id
-		JOIN tables t ON ut.table_id = t.id
-		WHERE ut.table_id = ?
-	`
+func GetUserTableByTableID(tableID uint) (*models.UserTable, error) {
+	userTable, err := scanUserTable(DB.QueryRow(userTableQuery+" WHERE ut.table_id = ?", tableID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // User table not found
+		}
+		return nil, fmt.Errorf("error getting user table: %v", err)
+	}
 
-	row := DB.QueryRow(query, tableID)
-	return row, nil
+	return userTable, nil
 }
 
 // GetUserTablesByUserID retrieves all user tables for a specific user
-func GetUserTablesByUserID(userID uint) (*sql.Rows, error) {
-	query := `
-		SELECT ut.id, ut.user_id, ut.rival_id, ut.table_id, ut.time,
-		       u.name as user_name, u.email as user_email,
-		       r.name as rival_name, r.email as rival_email,
-		       t.category, t.privacy, t.prize, t.amount, t.winner, t.created_at, t.updated_at, t.finished_at
-		FROM user_tables ut
-		JOIN users u ON ut.user_id = u.id
-		LEFT JOIN users r ON ut.rival_id = r.id
-		JOIN tables t ON ut.table_id = t.id
-		WHERE ut.user_id = ? OR ut.rival_id = ?
-	`
-
-	rows, err := DB.Query(query, userID, userID)
+func GetUserTablesByUserID(userID uint) ([]models.UserTable, error) {
+	rows, err := DB.Query(userTableQuery+" WHERE ut.user_id = ? OR ut.rival_id = ?", userID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error querying user tables: %v", err)
 	}
+	defer rows.Close()
+
+	var userTables []models.UserTable
+	for rows.Next() {
+		userTable, err := scanUserTable(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user table: %v", err)
+		}
+		userTables = append(userTables, *userTable)
+	}
 
-	return rows, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user tables: %v", err)
+	}
+
+	return userTables, nil
 }
 
-// UpdateTable updates table fields
-func UpdateTable(id uint, category, privacy, prize string, password *string, amount *int) error {
-	query := `
-		UPDATE tables 
-		SET category = ?, privacy = ?, password = ?, prize = ?, amount = ?, updated_at = NOW()
-		WHERE id = ?
-	`
+// UpdateTable replaces the settings of a table, including the stake card of its owner and
+// its time control, in one transaction. The table and its seats are locked like in
+// JoinTable and only changed while rival_id is NULL, so a rival never joins a table whose
+// stake changes under them; models.ErrTableTaken is returned once a rival has joined.
+func UpdateTable(id uint, settings models.TableSettings) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var lockedID uint
+	err = tx.QueryRow(`
+		SELECT t.id
+		FROM tables t
+		JOIN user_tables ut ON ut.table_id = t.id
+		WHERE t.id = ? AND ut.rival_id IS NULL
+		FOR UPDATE
+	`, id).Scan(&lockedID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ErrTableTaken
+		}
+		return fmt.Errorf("error locking table: %v", err)
+	}
 
-	var err error
-	if password != nil && amount != nil {
-		_, err = DB.Exec(query, category, privacy, *password, prize, *amount, id)
-	} else if password != nil {
-		_, err = DB.Exec(query, category, privacy, *password, prize, nil, id)
-	} else if amount != nil {
-		_, err = DB.Exec(query, category, privacy, nil, prize, *amount, id)
-	} else {
-		_, err = DB.Exec(query, category, privacy, nil, prize, nil, id)
+	result, err := tx.Exec(`
+		UPDATE tables t
+		JOIN user_tables ut ON ut.table_id = t.id
+		SET t.category = ?, t.privacy = ?, t.password = ?, t.prize = ?, t.amount = ?, t.initial_time = ?,
+		    t.time_increment = ?, t.updated_at = NOW(), ut.owner_stake_card_id = ?
+		WHERE t.id = ? AND ut.rival_id IS NULL
+	`, settings.Category, settings.Privacy, settings.Password, settings.Prize, settings.Amount, settings.InitialTime,
+		settings.TimeIncrement, settings.StakeCardID, id)
+	if err != nil {
+		return fmt.Errorf("error updating table: %v", err)
 	}
 
+	// updated_at always changes, so the table row is counted whenever the seat was free
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("error updating table: %v", err)
 	}
+	if rowsAffected == 0 {
+		return models.ErrTableTaken
+	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
 	return nil
 }
 
@@ -156,23 +276,93 @@ func IsTableWaitingForRival(tableID uint) (bool, error) {
 	return count > 0, nil
 }
 
-// UpdateUserTableTime updates the time field for a user table
-func UpdateUserTableTime(userTableID uint, time int) error {
+// GetTableClock returns the clock of the match at a table, or nil if nobody is seated at it
+func GetTableClock(tableID uint) (*models.TableClock, error) {
 	query := `
-		UPDATE user_tables 
-		SET time = ?
-		WHERE id = ?
+		SELECT ut.table_id, ut.owner_time_ms, ut.rival_time_ms, t.time_increment, ut.clock_seat, ut.clock_charged_at,
+		       COALESCE(ts.created_at, t.created_at), ut.time
+		FROM user_tables ut
+		JOIN tables t ON t.id = ut.table_id
+		LEFT JOIN table_state ts ON ts.table_id = ut.table_id
+		WHERE ut.table_id = ?
 	`
 
-	_, err := DB.Exec(query, time, userTableID)
+	clock := &models.TableClock{}
+	err := DB.QueryRow(query, tableID).Scan(&clock.TableID, &clock.OwnerTime, &clock.RivalTime, &clock.Increment,
+		&clock.Running, &clock.ChargedAt, &clock.StartedAt, &clock.Elapsed)
 	if err != nil {
-		return fmt.Errorf("error updating user table time: %v", err)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting table clock: %v", err)
+	}
+
+	return clock, nil
+}
+
+// UpdateTableClock saves the clock of the match at a table
+func UpdateTableClock(clock *models.TableClock) error {
+	return updateTableClock(DB, clock)
+}
+
+// updateTableClock saves a clock, on its own or as part of a transaction
+func updateTableClock(db execer, clock *models.TableClock) error {
+	query := `
+		UPDATE user_tables
+		SET owner_time_ms = ?, rival_time_ms = ?, clock_seat = ?, clock_charged_at = ?, time = ?
+		WHERE table_id = ?
+	`
+
+	_, err := db.Exec(query, clock.OwnerTime, clock.RivalTime, clock.Running, clock.ChargedAt, clock.Elapsed,
+		clock.TableID)
+	if err != nil {
+		return fmt.Errorf("error updating table clock: %v", err)
 	}
 
 	return nil
 }
 
-// DeleteTable deletes a table and its associated user table
+// GetExpiredClocks lists the tables of unfinished matches where the running time of a
+// player ran out by the given time, and of timed matches dealt before dealtBefore that are
+// still in their mulligan
+func GetExpiredClocks(now, dealtBefore time.Time) ([]uint, error) {
+	query := `
+		SELECT ut.table_id
+		FROM user_tables ut
+		JOIN tables t ON t.id = ut.table_id
+		LEFT JOIN table_state ts ON ts.table_id = ut.table_id
+		WHERE t.finished_at IS NULL AND (
+		    (ut.clock_seat IS NOT NULL
+		     AND TIMESTAMPADD(MICROSECOND,
+		         1000 * IF(ut.clock_seat = 'owner', ut.owner_time_ms, ut.rival_time_ms), ut.clock_charged_at) <= ?)
+		    OR (ts.phase = 'mulligan' AND ut.owner_time_ms IS NOT NULL AND ts.created_at <= ?))
+		ORDER BY ut.table_id
+	`
+
+	rows, err := DB.Query(query, now, dealtBefore)
+	if err != nil {
+		return nil, fmt.Errorf("error querying expired clocks: %v", err)
+	}
+	defer rows.Close()
+
+	tableIDs := []uint{}
+	for rows.Next() {
+		var tableID uint
+		if err := rows.Scan(&tableID); err != nil {
+			return nil, fmt.Errorf("error scanning expired clock: %v", err)
+		}
+		tableIDs = append(tableIDs, tableID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating expired clocks: %v", err)
+	}
+
+	return tableIDs, nil
+}
+
+// DeleteTable deletes a table and its associated user table. Stakes in escrow are deleted
+// with it, so it is only meant for tables that never held any.
 func DeleteTable(tableID uint) error {
 	// Start a transaction
 	tx, err := DB.Begin()
@@ -196,3 +386,425 @@ func DeleteTable(tableID uint) error {
 
 	return tx.Commit()
 }
+
+// GetTablePlayers returns the owner and rival (nil while waiting) seated at a table
+func GetTablePlayers(tableID uint) (uint, *uint, error) {
+	query := `
+		SELECT user_id, rival_id FROM user_tables
+		WHERE table_id = ?
+	`
+
+	var ownerID uint
+	var rivalID *uint
+	err := DB.QueryRow(query, tableID).Scan(&ownerID, &rivalID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil, err
+		}
+		return 0, nil, fmt.Errorf("error getting table players: %v", err)
+	}
+
+	return ownerID, rivalID, nil
+}
+
+// JoinTable seats a rival with their deck at a table that is still waiting for one, and
+// puts the stakes of both players in escrow in the same transaction: the money of a money
+// prize, or the copies of their stake card for a card prize. The seat is only taken if
+// rival_id is still NULL, so two players joining at the same time cannot both get it. It
+// returns false if the seat was no longer available. If a player cannot cover their stake
+// nothing changes and the error is returned, wrapped in models.ErrOwnerStake for the owner.
+func JoinTable(tableID, rivalID, rivalDeckID uint, rivalStakeCardID *int) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	table := &models.Table{}
+	var ownerID uint
+	var ownerStakeCardID *int
+	err = tx.QueryRow(`
+		SELECT t.prize, t.amount, ut.user_id, ut.owner_stake_card_id
+		FROM tables t
+		JOIN user_tables ut ON ut.table_id = t.id
+		WHERE t.id = ?
+		FOR UPDATE
+	`, tableID).Scan(&table.Prize, &table.Amount, &ownerID, &ownerStakeCardID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting table: %v", err)
+	}
+
+	query := `
+		UPDATE user_tables
+		SET rival_id = ?, rival_deck_id = ?
+		WHERE table_id = ? AND rival_id IS NULL AND user_id <> ?
+	`
+
+	result, err := tx.Exec(query, rivalID, rivalDeckID, tableID, rivalID)
+	if err != nil {
+		return false, fmt.Errorf("error joining table: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error joining table: %v", err)
+	}
+	if rowsAffected != 1 {
+		return false, nil
+	}
+
+	amount := table.PrizeAmount()
+	now := time.Now()
+	switch {
+	case table.Prize == models.PrizeMoney && amount > 0:
+		if err := lockUserInfo(tx, int(ownerID), int(rivalID)); err != nil {
+			return false, err
+		}
+		if _, err := spendMoney(tx, int(ownerID), amount); err != nil {
+			return false, fmt.Errorf("%w: %v", models.ErrOwnerStake, err)
+		}
+		if _, err := spendMoney(tx, int(rivalID), amount); err != nil {
+			return false, err
+		}
+		for _, userID := range []uint{ownerID, rivalID} {
+			if err := insertTableStake(tx, tableID, models.TableStake{UserID: int(userID), Money: amount}); err != nil {
+				return false, err
+			}
+		}
+
+	case table.Prize == models.PrizeCard:
+		if ownerStakeCardID == nil {
+			return false, fmt.Errorf("%w: no stake card chosen", models.ErrOwnerStake)
+		}
+		if rivalStakeCardID == nil {
+			return false, fmt.Errorf("%w: no stake card chosen", models.ErrNotEnoughCards)
+		}
+		if err := takeUserCards(tx, int(ownerID), *ownerStakeCardID, amount, now); err != nil {
+			return false, fmt.Errorf("%w: %v", models.ErrOwnerStake, err)
+		}
+		if err := takeUserCards(tx, int(rivalID), *rivalStakeCardID, amount, now); err != nil {
+			return false, err
+		}
+		stakes := []models.TableStake{
+			{UserID: int(ownerID), CardID: ownerStakeCardID, Amount: amount},
+			{UserID: int(rivalID), CardID: rivalStakeCardID, Amount: amount},
+		}
+		for _, stake := range stakes {
+			if err := insertTableStake(tx, tableID, stake); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing join: %v", err)
+	}
+
+	return true, nil
+}
+
+// insertTableStake records a stake held in escrow within a transaction
+func insertTableStake(tx *sql.Tx, tableID uint, stake models.TableStake) error {
+	_, err := tx.Exec(`
+		INSERT INTO table_stakes (table_id, user_id, money, card_id, amount)
+		VALUES (?, ?, ?, ?, ?)
+	`, tableID, stake.UserID, stake.Money, stake.CardID, stake.Amount)
+	if err != nil {
+		return fmt.Errorf("error creating table stake: %v", err)
+	}
+
+	return nil
+}
+
+// unpaidTableStakes locks and returns the stakes of a table that have not been paid out yet
+func unpaidTableStakes(tx *sql.Tx, tableID uint) ([]models.TableStake, error) {
+	rows, err := tx.Query(`
+		SELECT user_id, money, card_id, amount
+		FROM table_stakes
+		WHERE table_id = ? AND paid_to IS NULL
+		ORDER BY id
+		FOR UPDATE
+	`, tableID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying table stakes: %v", err)
+	}
+	defer rows.Close()
+
+	stakes := []models.TableStake{}
+	for rows.Next() {
+		var stake models.TableStake
+		if err := rows.Scan(&stake.UserID, &stake.Money, &stake.CardID, &stake.Amount); err != nil {
+			return nil, fmt.Errorf("error scanning table stake: %v", err)
+		}
+		stakes = append(stakes, stake)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating table stakes: %v", err)
+	}
+
+	return stakes, nil
+}
+
+// payTableStake gives a stake held in escrow to a user within a transaction
+func payTableStake(tx *sql.Tx, stake models.TableStake, userID int, now time.Time) error {
+	if stake.Money > 0 {
+		if err := addMoney(tx, userID, stake.Money); err != nil {
+			return fmt.Errorf("error paying table stake: %v", err)
+		}
+	}
+	if stake.CardID != nil && stake.Amount > 0 {
+		if err := giveUserCards(tx, userID, *stake.CardID, stake.Amount, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReleaseTableSeat removes a rival from a table, used to undo a join whose match could not
+// start. The stakes taken when they joined go back to both players.
+func ReleaseTableSeat(tableID, rivalID uint) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE user_tables
+		SET rival_id = NULL, rival_deck_id = NULL
+		WHERE table_id = ? AND rival_id = ?
+	`
+
+	result, err := tx.Exec(query, tableID, rivalID)
+	if err != nil {
+		return fmt.Errorf("error releasing table seat: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error releasing table seat: %v", err)
+	}
+
+	if rowsAffected > 0 {
+		stakes, err := unpaidTableStakes(tx, tableID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, stake := range stakes {
+			if err := payTableStake(tx, stake, stake.UserID, now); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(`DELETE FROM table_stakes WHERE table_id = ?`, tableID); err != nil {
+			return fmt.Errorf("error deleting table stakes: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing seat release: %v", err)
+	}
+
+	return nil
+}
+
+// FinishTable settles the match at a table: it sets winner (true when the owner won) and
+// finished_at, pays both stakes to the winner, grants the aura of an aura prize, gives
+// experience to both players and updates their ratings, all in one transaction. A table is only settled once: if it
+// was already finished nothing changes and a nil result is returned.
+func FinishTable(tableID uint, ownerWon bool, rewards models.MatchRewards) (*models.MatchResult, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	table := &models.Table{}
+	var ownerID uint
+	var rivalID *uint
+	err = tx.QueryRow(`
+		SELECT t.prize, t.amount, t.finished_at, ut.user_id, ut.rival_id
+		FROM tables t
+		JOIN user_tables ut ON ut.table_id = t.id
+		WHERE t.id = ?
+		FOR UPDATE
+	`, tableID).Scan(&table.Prize, &table.Amount, &table.FinishedAt, &ownerID, &rivalID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("table not found")
+		}
+		return nil, fmt.Errorf("error getting table: %v", err)
+	}
+
+	if table.FinishedAt != nil {
+		return nil, nil
+	}
+	if rivalID == nil {
+		return nil, fmt.Errorf("table %d has no rival", tableID)
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE tables SET winner = ?, finished_at = ?, updated_at = ? WHERE id = ?`,
+		ownerWon, now, now, tableID)
+	if err != nil {
+		return nil, fmt.Errorf("error finishing table: %v", err)
+	}
+
+	result := &models.MatchResult{
+		TableID:          tableID,
+		Prize:            table.Prize,
+		WinnerID:         int(ownerID),
+		LoserID:          int(*rivalID),
+		WinnerExperience: rewards.WinnerExperience,
+		LoserExperience:  rewards.LoserExperience,
+		FinishedAt:       now,
+	}
+	if !ownerWon {
+		result.WinnerID, result.LoserID = result.LoserID, result.WinnerID
+	}
+
+	if err := lockUserInfo(tx, result.WinnerID, result.LoserID); err != nil {
+		return nil, err
+	}
+
+	result.Stakes, err = unpaidTableStakes(tx, tableID)
+	if err != nil {
+		return nil, err
+	}
+	for _, stake := range result.Stakes {
+		if err := payTableStake(tx, stake, result.WinnerID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE table_stakes SET paid_to = ?, paid_at = ? WHERE table_id = ? AND paid_to IS NULL`,
+		result.WinnerID, now, tableID)
+	if err != nil {
+		return nil, fmt.Errorf("error paying table stakes: %v", err)
+	}
+
+	if table.Prize == models.PrizeAura {
+		result.Aura = table.PrizeAmount()
+		if err := addAura(tx, result.WinnerID, result.Aura); err != nil {
+			return nil, fmt.Errorf("error granting aura: %v", err)
+		}
+	}
+
+	if _, err := addExperience(tx, result.WinnerID, rewards.WinnerExperience); err != nil {
+		return nil, err
+	}
+	if _, err := addExperience(tx, result.LoserID, rewards.LoserExperience); err != nil {
+		return nil, err
+	}
+
+	result.Ratings, err = updateRatings(tx, tableID, result.WinnerID, result.LoserID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing match result: %v", err)
+	}
+
+	return result, nil
+}
+
+// GetTableDecks returns the decks chosen by the owner and the rival of a table
+func GetTableDecks(tableID uint) (*uint, *uint, error) {
+	query := `
+		SELECT owner_deck_id, rival_deck_id FROM user_tables
+		WHERE table_id = ?
+	`
+
+	var ownerDeckID, rivalDeckID *uint
+	err := DB.QueryRow(query, tableID).Scan(&ownerDeckID, &rivalDeckID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting table decks: %v", err)
+	}
+
+	return ownerDeckID, rivalDeckID, nil
+}
+
+// GetOpenTables lists public tables that are still waiting for a rival, newest first.
+// It also returns the total number of tables matching the filter for pagination.
+func GetOpenTables(filter models.LobbyFilter) ([]models.LobbyTable, int, error) {
+	// Build the filter dynamically based on provided fields
+	where := `
+		WHERE t.privacy = 'public' AND t.finished_at IS NULL AND ut.rival_id IS NULL
+	`
+	args := []interface{}{}
+
+	if filter.Category != "" {
+		where += " AND t.category = ?"
+		args = append(args, filter.Category)
+	}
+
+	if filter.Prize != "" {
+		where += " AND t.prize = ?"
+		args = append(args, filter.Prize)
+	}
+
+	if filter.MinAmount != nil {
+		where += " AND t.amount >= ?"
+		args = append(args, *filter.MinAmount)
+	}
+
+	if filter.MaxAmount != nil {
+		where += " AND t.amount <= ?"
+		args = append(args, *filter.MaxAmount)
+	}
+
+	from := `
+		FROM tables t
+		JOIN user_tables ut ON ut.table_id = t.id
+		JOIN users u ON ut.user_id = u.id
+		LEFT JOIN user_info ui ON ui.user_id = u.id
+	`
+
+	var total int
+	err := DB.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting open tables: %v", err)
+	}
+
+	query := `
+		SELECT t.id, t.category, t.prize, t.amount, t.initial_time, t.time_increment, t.password IS NOT NULL, t.created_at,
+		       u.id, u.name, COALESCE(ui.level, 1)
+	` + from + where + `
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := DB.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying open tables: %v", err)
+	}
+	defer rows.Close()
+
+	tables := []models.LobbyTable{}
+	for rows.Next() {
+		var table models.LobbyTable
+		err := rows.Scan(
+			&table.ID, &table.Category, &table.Prize, &table.Amount, &table.InitialTime, &table.TimeIncrement,
+			&table.HasPassword, &table.CreatedAt,
+			&table.OwnerID, &table.OwnerName, &table.OwnerLevel,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error scanning open table: %v", err)
+		}
+		tables = append(tables, table)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error reading open tables: %v", err)
+	}
+
+	return tables, total, nil
+}
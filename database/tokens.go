@@ -0,0 +1,177 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tcg-server-go/models"
+)
+
+// CreateRefreshToken stores a refresh token
+func CreateRefreshToken(token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	token.CreatedAt = time.Now()
+	result, err := DB.Exec(query, token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating refresh token: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting refresh token ID: %v", err)
+	}
+
+	token.ID = int(id)
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token by the hash of the token
+func GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, token_hash, family_id, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = ?
+	`
+
+	token := &models.RefreshToken{}
+	err := DB.QueryRow(query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.FamilyID,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Token not found
+		}
+		return nil, fmt.Errorf("error getting refresh token: %v", err)
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken marks a refresh token as used and stores the token replacing it.
+// It returns false without storing anything if the token was already used or revoked.
+func RotateRefreshToken(id int, next *models.RefreshToken) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	result, err := tx.Exec(`
+		UPDATE refresh_tokens
+		SET used_at = ?
+		WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL
+	`, now, id)
+	if err != nil {
+		return false, fmt.Errorf("error using refresh token: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil // Used by a concurrent refresh
+	}
+
+	next.CreatedAt = now
+	result, err = tx.Exec(`
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, next.UserID, next.TokenHash, next.FamilyID, next.ExpiresAt, next.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("error creating refresh token: %v", err)
+	}
+
+	nextID, err := result.LastInsertId()
+	if err != nil {
+		return false, fmt.Errorf("error getting refresh token ID: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing refresh token rotation: %v", err)
+	}
+
+	next.ID = int(nextID)
+	return true, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token rotated from the same login
+func RevokeRefreshTokenFamily(familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = ?
+		WHERE family_id = ? AND revoked_at IS NULL
+	`
+
+	_, err := DB.Exec(query, time.Now(), familyID)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %v", err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of a user
+func RevokeUserRefreshTokens(userID int) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = ?
+		WHERE user_id = ? AND revoked_at IS NULL
+	`
+
+	_, err := DB.Exec(query, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %v", err)
+	}
+
+	return nil
+}
+
+// RevokeAccessToken revokes an access token by its jti until it expires. Revocations of
+// tokens that have already expired are deleted on the way, since they are no longer needed.
+func RevokeAccessToken(jti string, expiresAt time.Time) error {
+	now := time.Now()
+
+	if _, err := DB.Exec(`DELETE FROM revoked_tokens WHERE expires_at <= ?`, now); err != nil {
+		return fmt.Errorf("error deleting expired revocations: %v", err)
+	}
+
+	query := `
+		INSERT IGNORE INTO revoked_tokens (jti, expires_at, created_at)
+		VALUES (?, ?, ?)
+	`
+
+	_, err := DB.Exec(query, jti, expiresAt, now)
+	if err != nil {
+		return fmt.Errorf("error revoking access token: %v", err)
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked checks if an access token has been revoked
+func IsAccessTokenRevoked(jti string) (bool, error) {
+	query := `SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?`
+
+	var count int
+	err := DB.QueryRow(query, jti).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error checking revoked token: %v", err)
+	}
+
+	return count > 0, nil
+}
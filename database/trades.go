@@ -0,0 +1,365 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"tcg-server-go/models"
+)
+
+const tradeColumns = "id, proposer_id, recipient_id, offered_money, requested_money, status, counter_of_id, expires_at, resolved_at, created_at, updated_at"
+
+// tradeScanFields returns the scan destinations for tradeColumns
+func tradeScanFields(trade *models.Trade) []interface{} {
+	return []interface{}{
+		&trade.ID,
+		&trade.ProposerID,
+		&trade.RecipientID,
+		&trade.OfferedMoney,
+		&trade.RequestedMoney,
+		&trade.Status,
+		&trade.CounterOfID,
+		&trade.ExpiresAt,
+		&trade.ResolvedAt,
+		&trade.CreatedAt,
+		&trade.UpdatedAt,
+	}
+}
+
+// CreateTrade stores a pending trade offer with its cards
+func CreateTrade(trade *models.Trade) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertTrade(tx, trade); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing trade: %v", err)
+	}
+
+	return nil
+}
+
+// CounterTrade answers a pending trade with a counter-offer. It returns false without storing
+// anything if the trade is no longer pending or has expired.
+func CounterTrade(tradeID int, counter *models.Trade) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE trades
+		SET status = ?, resolved_at = ?, updated_at = ?
+		WHERE id = ? AND status = ? AND expires_at > ?
+	`, models.TradeStatusCountered, now, now, tradeID, models.TradeStatusPending, now)
+	if err != nil {
+		return false, fmt.Errorf("error countering trade: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	counter.CounterOfID = &tradeID
+	if err := insertTrade(tx, counter); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing counter-offer: %v", err)
+	}
+
+	return true, nil
+}
+
+// insertTrade stores a new pending trade and its cards within a transaction
+func insertTrade(tx *sql.Tx, trade *models.Trade) error {
+	now := time.Now()
+	trade.Status = models.TradeStatusPending
+	trade.CreatedAt = now
+	trade.UpdatedAt = now
+
+	result, err := tx.Exec(`
+		INSERT INTO trades (proposer_id, recipient_id, offered_money, requested_money, status, counter_of_id,
+		                    expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, trade.ProposerID, trade.RecipientID, trade.OfferedMoney, trade.RequestedMoney, trade.Status,
+		trade.CounterOfID, trade.ExpiresAt, trade.CreatedAt, trade.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating trade: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting trade ID: %v", err)
+	}
+	trade.ID = int(id)
+
+	sides := map[string][]models.TradeCard{
+		models.TradeSideOffered:   trade.OfferedCards,
+		models.TradeSideRequested: trade.RequestedCards,
+	}
+	for side, cards := range sides {
+		for _, card := range cards {
+			_, err := tx.Exec(`INSERT INTO trade_cards (trade_id, side, card_id, amount) VALUES (?, ?, ?, ?)`,
+				trade.ID, side, card.CardID, card.Amount)
+			if err != nil {
+				return fmt.Errorf("error adding card to trade: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetTradeByID retrieves a trade with its cards
+func GetTradeByID(id int) (*models.Trade, error) {
+	query := `SELECT ` + tradeColumns + ` FROM trades WHERE id = ?`
+
+	trade := &models.Trade{}
+	err := DB.QueryRow(query, id).Scan(tradeScanFields(trade)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Trade not found
+		}
+		return nil, fmt.Errorf("error getting trade: %v", err)
+	}
+
+	trades := []models.Trade{*trade}
+	if err := loadTradeCards(trades); err != nil {
+		return nil, err
+	}
+
+	return &trades[0], nil
+}
+
+// GetTradesByUserID lists the trades a user proposed or received, newest first, optionally
+// only those with the given status
+func GetTradesByUserID(userID int, status models.TradeStatus) ([]models.Trade, error) {
+	query := `SELECT ` + tradeColumns + ` FROM trades WHERE (proposer_id = ? OR recipient_id = ?)`
+	args := []interface{}{userID, userID}
+
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying trades: %v", err)
+	}
+	defer rows.Close()
+
+	trades := []models.Trade{}
+	for rows.Next() {
+		var trade models.Trade
+		if err := rows.Scan(tradeScanFields(&trade)...); err != nil {
+			return nil, fmt.Errorf("error scanning trade: %v", err)
+		}
+		trades = append(trades, trade)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trades: %v", err)
+	}
+
+	if err := loadTradeCards(trades); err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+// loadTradeCards fills the offered and requested cards of the trades with a single query
+func loadTradeCards(trades []models.Trade) error {
+	if len(trades) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Trade, len(trades))
+	placeholders := make([]string, len(trades))
+	args := make([]interface{}, len(trades))
+	for i := range trades {
+		trades[i].OfferedCards = []models.TradeCard{}
+		trades[i].RequestedCards = []models.TradeCard{}
+		byID[trades[i].ID] = &trades[i]
+		placeholders[i] = "?"
+		args[i] = trades[i].ID
+	}
+
+	query := `
+		SELECT trade_id, side, card_id, amount
+		FROM trade_cards
+		WHERE trade_id IN (` + strings.Join(placeholders, ", ") + `)
+		ORDER BY trade_id, card_id
+	`
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("error querying trade cards: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tradeID int
+		var side string
+		var card models.TradeCard
+		if err := rows.Scan(&tradeID, &side, &card.CardID, &card.Amount); err != nil {
+			return fmt.Errorf("error scanning trade card: %v", err)
+		}
+
+		trade := byID[tradeID]
+		if side == models.TradeSideOffered {
+			trade.OfferedCards = append(trade.OfferedCards, card)
+		} else {
+			trade.RequestedCards = append(trade.RequestedCards, card)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating trade cards: %v", err)
+	}
+
+	return nil
+}
+
+// ResolveTrade moves a pending trade that has not expired to a final status, such as
+// declined or cancelled. It returns false if the trade was no longer pending.
+func ResolveTrade(id int, status models.TradeStatus) (bool, error) {
+	now := time.Now()
+	result, err := DB.Exec(`
+		UPDATE trades
+		SET status = ?, resolved_at = ?, updated_at = ?
+		WHERE id = ? AND status = ? AND expires_at > ?
+	`, status, now, now, id, models.TradeStatusPending, now)
+	if err != nil {
+		return false, fmt.Errorf("error resolving trade: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %v", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ExpireTrades marks the pending trades past their expiry as expired
+func ExpireTrades() error {
+	now := time.Now()
+	_, err := DB.Exec(`
+		UPDATE trades
+		SET status = ?, resolved_at = expires_at, updated_at = ?
+		WHERE status = ? AND expires_at <= ?
+	`, models.TradeStatusExpired, now, models.TradeStatusPending, now)
+	if err != nil {
+		return fmt.Errorf("error expiring trades: %v", err)
+	}
+
+	return nil
+}
+
+// AcceptTrade completes a pending trade: cards and money move between both players in one
+// transaction, holding row locks on their balances and collections. It fails without
+// changing anything with models.ErrInsufficientFunds or models.ErrNotEnoughCards if either player no
+// longer has what they give, or with models.ErrBreaksDeck if giving a card would leave one of
+// their saved decks with more copies than they own.
+func AcceptTrade(id int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	trade := &models.Trade{}
+	err = tx.QueryRow(`SELECT `+tradeColumns+` FROM trades WHERE id = ? FOR UPDATE`, id).Scan(tradeScanFields(trade)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ErrTradeNotPending
+		}
+		return fmt.Errorf("error getting trade: %v", err)
+	}
+
+	if trade.Status != models.TradeStatusPending {
+		return models.ErrTradeNotPending
+	}
+
+	now := time.Now()
+	if !trade.ExpiresAt.After(now) {
+		_, err := tx.Exec(`UPDATE trades SET status = ?, resolved_at = expires_at, updated_at = ? WHERE id = ?`,
+			models.TradeStatusExpired, now, id)
+		if err != nil {
+			return fmt.Errorf("error expiring trade: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing trade expiry: %v", err)
+		}
+		return models.ErrTradeExpired
+	}
+
+	trades := []models.Trade{*trade}
+	if err := loadTradeCards(trades); err != nil {
+		return err
+	}
+	trade = &trades[0]
+
+	// Lock both balances before touching any collection, as every money transfer does
+	if err := lockUserInfo(tx, trade.ProposerID, trade.RecipientID); err != nil {
+		return err
+	}
+
+	if err := giveTradeCards(tx, trade.ProposerID, trade.RecipientID, trade.OfferedCards, now); err != nil {
+		return err
+	}
+	if err := giveTradeCards(tx, trade.RecipientID, trade.ProposerID, trade.RequestedCards, now); err != nil {
+		return err
+	}
+
+	if err := transferMoney(tx, trade.ProposerID, trade.RecipientID, trade.OfferedMoney); err != nil {
+		return err
+	}
+	if err := transferMoney(tx, trade.RecipientID, trade.ProposerID, trade.RequestedMoney); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE trades SET status = ?, resolved_at = ?, updated_at = ? WHERE id = ?`,
+		models.TradeStatusAccepted, now, now, id)
+	if err != nil {
+		return fmt.Errorf("error accepting trade: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing trade: %v", err)
+	}
+
+	return nil
+}
+
+// giveTradeCards moves cards from one collection to another within a trade transaction
+func giveTradeCards(tx *sql.Tx, fromID, toID int, cards []models.TradeCard, now time.Time) error {
+	for _, card := range cards {
+		if err := takeUserCards(tx, fromID, card.CardID, card.Amount, now); err != nil {
+			return err
+		}
+		if err := giveUserCards(tx, toID, card.CardID, card.Amount, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
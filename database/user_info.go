@@ -3,6 +3,8 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"sort"
+	"tcg-server-go/legality"
 	"tcg-server-go/models"
 	"time"
 )
@@ -35,7 +37,7 @@ func CreateUserInfo(userInfo *models.UserInfo) error {
 // GetUserInfoByUserID retrieves user info by user ID
 func GetUserInfoByUserID(userID int) (*models.UserInfo, error) {
 	query := `
-		SELECT id, user_id, level, experience, money, created_at, updated_at
+		SELECT id, user_id, level, experience, money, aura, created_at, updated_at
 		FROM user_info
 		WHERE user_id = ?
 	`
@@ -47,6 +49,7 @@ func GetUserInfoByUserID(userID int) (*models.UserInfo, error) {
 		&userInfo.Level,
 		&userInfo.Experience,
 		&userInfo.Money,
+		&userInfo.Aura,
 		&userInfo.CreatedAt,
 		&userInfo.UpdatedAt,
 	)
@@ -64,7 +67,7 @@ func GetUserInfoByUserID(userID int) (*models.UserInfo, error) {
 // GetUserInfoByID retrieves user info by its own ID
 func GetUserInfoByID(id int) (*models.UserInfo, error) {
 	query := `
-		SELECT id, user_id, level, experience, money, created_at, updated_at
+		SELECT id, user_id, level, experience, money, aura, created_at, updated_at
 		FROM user_info
 		WHERE id = ?
 	`
@@ -76,6 +79,7 @@ func GetUserInfoByID(id int) (*models.UserInfo, error) {
 		&userInfo.Level,
 		&userInfo.Experience,
 		&userInfo.Money,
+		&userInfo.Aura,
 		&userInfo.CreatedAt,
 		&userInfo.UpdatedAt,
 	)
@@ -167,20 +171,36 @@ func AddExperience(userID int, experienceToAdd int) (*models.UserInfo, error) {
 	}
 	defer tx.Rollback()
 
+	userInfo, err := addExperience(tx, userID, experienceToAdd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return userInfo, nil
+}
+
+// addExperience adds experience points to a user within a transaction and handles level up
+func addExperience(tx *sql.Tx, userID int, experienceToAdd int) (*models.UserInfo, error) {
 	// Get current user info
 	query := `
-		SELECT id, user_id, level, experience, money, created_at, updated_at
+		SELECT id, user_id, level, experience, money, aura, created_at, updated_at
 		FROM user_info
 		WHERE user_id = ? FOR UPDATE
 	`
 
 	userInfo := &models.UserInfo{}
-	err = tx.QueryRow(query, userID).Scan(
+	err := tx.QueryRow(query, userID).Scan(
 		&userInfo.ID,
 		&userInfo.UserID,
 		&userInfo.Level,
 		&userInfo.Experience,
 		&userInfo.Money,
+		&userInfo.Aura,
 		&userInfo.CreatedAt,
 		&userInfo.UpdatedAt,
 	)
@@ -216,38 +236,78 @@ func AddExperience(userID int, experienceToAdd int) (*models.UserInfo, error) {
 		return nil, err
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return nil, err
+	return userInfo, nil
+}
+
+// addAura adds aura to a user's account within a transaction
+func addAura(tx *sql.Tx, userID int, amount int) error {
+	query := `
+		UPDATE user_info
+		SET aura = aura + ?, updated_at = ?
+		WHERE user_id = ?
+	`
+
+	result, err := tx.Exec(query, amount, time.Now(), userID)
+	if err != nil {
+		return err
 	}
 
-	return userInfo, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
 
 // AddMoney adds money to a user's account
 func AddMoney(userID int, amount int) (*models.UserInfo, error) {
+	if err := addMoney(DB, userID, amount); err != nil {
+		return nil, err
+	}
+
+	// Return updated user info
+	return GetUserInfoByUserID(userID)
+}
+
+// execer runs statements on the connection pool or within a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// querier runs queries on the connection pool or within a transaction
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// addMoney adds money to a user's account, on its own or as part of a transaction
+func addMoney(db execer, userID int, amount int) error {
 	query := `
 		UPDATE user_info
 		SET money = money + ?, updated_at = ?
 		WHERE user_id = ?
 	`
 
-	result, err := DB.Exec(query, amount, time.Now(), userID)
+	result, err := db.Exec(query, amount, time.Now(), userID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if rowsAffected == 0 {
-		return nil, sql.ErrNoRows
+		return sql.ErrNoRows
 	}
 
-	// Return updated user info
-	return GetUserInfoByUserID(userID)
+	return nil
 }
 
 // SpendMoney spends money from a user's account (with validation)
@@ -259,20 +319,37 @@ func SpendMoney(userID int, amount int) (*models.UserInfo, error) {
 	}
 	defer tx.Rollback()
 
+	userInfo, err := spendMoney(tx, userID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return userInfo, nil
+}
+
+// spendMoney spends money from a user's account within a transaction, locking their user info
+// until it ends
+func spendMoney(tx *sql.Tx, userID int, amount int) (*models.UserInfo, error) {
 	// Get current user info with lock
 	query := `
-		SELECT id, user_id, level, experience, money, created_at, updated_at
+		SELECT id, user_id, level, experience, money, aura, created_at, updated_at
 		FROM user_info
 		WHERE user_id = ? FOR UPDATE
 	`
 
 	userInfo := &models.UserInfo{}
-	err = tx.QueryRow(query, userID).Scan(
+	err := tx.QueryRow(query, userID).Scan(
 		&userInfo.ID,
 		&userInfo.UserID,
 		&userInfo.Level,
 		&userInfo.Experience,
 		&userInfo.Money,
+		&userInfo.Aura,
 		&userInfo.CreatedAt,
 		&userInfo.UpdatedAt,
 	)
@@ -286,7 +363,7 @@ func SpendMoney(userID int, amount int) (*models.UserInfo, error) {
 
 	// Check if user has enough money
 	if userInfo.Money < amount {
-		return nil, fmt.Errorf("insufficient funds: required %d, available %d", amount, userInfo.Money)
+		return nil, fmt.Errorf("%w: required %d, available %d", models.ErrInsufficientFunds, amount, userInfo.Money)
 	}
 
 	// Spend money
@@ -305,12 +382,103 @@ func SpendMoney(userID int, amount int) (*models.UserInfo, error) {
 		return nil, err
 	}
 
-	// Commit transaction
-	if err = tx.Commit(); err != nil {
-		return nil, err
+	return userInfo, nil
+}
+
+// transferMoney moves money between two users within a transaction
+func transferMoney(tx *sql.Tx, fromID, toID, amount int) error {
+	if amount == 0 {
+		return nil
 	}
 
-	return userInfo, nil
+	if _, err := spendMoney(tx, fromID, amount); err != nil {
+		return err
+	}
+
+	return addMoney(tx, toID, amount)
+}
+
+// lockUserInfo locks the user info of several users for the rest of a transaction. Rows are
+// locked in user ID order so concurrent transactions on the same users cannot deadlock.
+func lockUserInfo(tx *sql.Tx, userIDs ...int) error {
+	ids := append([]int{}, userIDs...)
+	sort.Ints(ids)
+
+	for i, userID := range ids {
+		if i > 0 && userID == ids[i-1] {
+			continue
+		}
+
+		var id int
+		err := tx.QueryRow(`SELECT id FROM user_info WHERE user_id = ? FOR UPDATE`, userID).Scan(&id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("user info not found")
+			}
+			return fmt.Errorf("error locking user info: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// takeUserCards removes copies of a card from a user's collection within a transaction. It
+// refuses if the user does not own enough copies or if one of their saved decks needs more
+// copies than would remain.
+func takeUserCards(tx *sql.Tx, userID, cardID, amount int, now time.Time) error {
+	var owned int
+	err := tx.QueryRow(`SELECT amount FROM user_cards WHERE user_id = ? AND card_id = ? FOR UPDATE`,
+		userID, cardID).Scan(&owned)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error getting user card: %v", err)
+	}
+	if owned < amount {
+		return fmt.Errorf("%w: card %d", models.ErrNotEnoughCards, cardID)
+	}
+
+	remaining := owned - amount
+	var deckName string
+	var needed int
+	err = tx.QueryRow(`
+		SELECT d.name, dc.number
+		FROM deck_cards dc
+		JOIN decks d ON d.id = dc.deck_id
+		WHERE d.user_id = ? AND dc.card_id = ? AND dc.number > ?
+		ORDER BY d.id
+		LIMIT 1
+	`, userID, cardID, remaining).Scan(&deckName, &needed)
+	if err == nil {
+		return fmt.Errorf("%w: deck %q needs %d copies of card %d", models.ErrBreaksDeck, deckName, needed, cardID)
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("error checking decks: %v", err)
+	}
+
+	if remaining == 0 {
+		_, err = tx.Exec(`DELETE FROM user_cards WHERE user_id = ? AND card_id = ?`, userID, cardID)
+	} else {
+		_, err = tx.Exec(`UPDATE user_cards SET amount = ?, updated_at = ? WHERE user_id = ? AND card_id = ?`,
+			remaining, now, userID, cardID)
+	}
+	if err != nil {
+		return fmt.Errorf("error removing user card: %v", err)
+	}
+
+	return nil
+}
+
+// giveUserCards adds copies of a card to a user's collection within a transaction
+func giveUserCards(tx *sql.Tx, userID, cardID, amount int, now time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO user_cards (user_id, card_id, amount, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE amount = amount + VALUES(amount), updated_at = VALUES(updated_at)
+	`, userID, cardID, amount, now, now)
+	if err != nil {
+		return fmt.Errorf("error adding user card: %v", err)
+	}
+
+	return nil
 }
 
 // DeleteUserInfo deletes user info by user ID
@@ -390,7 +558,7 @@ func CreateUserCard(userCard *models.UserCard) error {
 func GetUserCardByID(id int) (*models.UserCard, error) {
 	query := `
 		SELECT uc.id, uc.user_id, uc.card_id, uc.amount, uc.created_at, uc.updated_at,
-		       c.id, c.name, c.type, c.legend, c.element, c.created_at, c.updated_at
+		       ` + qualifiedCardColumns("c") + `
 		FROM user_cards uc
 		JOIN cards c ON uc.card_id = c.id
 		WHERE uc.id = ?
@@ -398,21 +566,14 @@ func GetUserCardByID(id int) (*models.UserCard, error) {
 
 	userCard := &models.UserCard{}
 	card := &models.Card{}
-	err := DB.QueryRow(query, id).Scan(
+	err := DB.QueryRow(query, id).Scan(append([]interface{}{
 		&userCard.ID,
 		&userCard.UserID,
 		&userCard.CardID,
 		&userCard.Amount,
 		&userCard.CreatedAt,
 		&userCard.UpdatedAt,
-		&card.ID,
-		&card.Name,
-		&card.Type,
-		&card.Legend,
-		&card.Element,
-		&card.CreatedAt,
-		&card.UpdatedAt,
-	)
+	}, cardScanFields(card)...)...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -429,7 +590,7 @@ func GetUserCardByID(id int) (*models.UserCard, error) {
 func GetUserCardByUserAndCard(userID, cardID int) (*models.UserCard, error) {
 	query := `
 		SELECT uc.id, uc.user_id, uc.card_id, uc.amount, uc.created_at, uc.updated_at,
-		       c.id, c.name, c.type, c.legend, c.element, c.created_at, c.updated_at
+		       ` + qualifiedCardColumns("c") + `
 		FROM user_cards uc
 		JOIN cards c ON uc.card_id = c.id
 		WHERE uc.user_id = ? AND uc.card_id = ?
@@ -437,21 +598,14 @@ func GetUserCardByUserAndCard(userID, cardID int) (*models.UserCard, error) {
 
 	userCard := &models.UserCard{}
 	card := &models.Card{}
-	err := DB.QueryRow(query, userID, cardID).Scan(
+	err := DB.QueryRow(query, userID, cardID).Scan(append([]interface{}{
 		&userCard.ID,
 		&userCard.UserID,
 		&userCard.CardID,
 		&userCard.Amount,
 		&userCard.CreatedAt,
 		&userCard.UpdatedAt,
-		&card.ID,
-		&card.Name,
-		&card.Type,
-		&card.Legend,
-		&card.Element,
-		&card.CreatedAt,
-		&card.UpdatedAt,
-	)
+	}, cardScanFields(card)...)...)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -464,11 +618,64 @@ func GetUserCardByUserAndCard(userID, cardID int) (*models.UserCard, error) {
 	return userCard, nil
 }
 
+// GetUserCardsByCardIDs retrieves the copies a user has of several cards in one query, by
+// card ID. Cards the user has no copies of are left out of the map.
+func GetUserCardsByCardIDs(userID int, cardIDs []int) (map[int]*models.UserCard, error) {
+	userCards := make(map[int]*models.UserCard)
+	if len(cardIDs) == 0 {
+		return userCards, nil
+	}
+
+	args := make([]interface{}, 0, len(cardIDs)+1)
+	args = append(args, userID)
+	for _, cardID := range cardIDs {
+		args = append(args, cardID)
+	}
+
+	query := `
+		SELECT uc.id, uc.user_id, uc.card_id, uc.amount, uc.created_at, uc.updated_at,
+		       ` + qualifiedCardColumns("c") + `
+		FROM user_cards uc
+		JOIN cards c ON uc.card_id = c.id
+		WHERE uc.user_id = ? AND uc.card_id IN (` + inPlaceholders(len(cardIDs)) + `)
+	`
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying user cards: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		userCard := &models.UserCard{}
+		card := &models.Card{}
+		err := rows.Scan(append([]interface{}{
+			&userCard.ID,
+			&userCard.UserID,
+			&userCard.CardID,
+			&userCard.Amount,
+			&userCard.CreatedAt,
+			&userCard.UpdatedAt,
+		}, cardScanFields(card)...)...)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user card: %v", err)
+		}
+		userCard.Card = card
+		userCards[userCard.CardID] = userCard
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user cards: %v", err)
+	}
+
+	return userCards, nil
+}
+
 // GetUserCardsByUserID retrieves all cards for a specific user
 func GetUserCardsByUserID(userID int) ([]models.UserCard, error) {
 	query := `
 		SELECT uc.id, uc.user_id, uc.card_id, uc.amount, uc.created_at, uc.updated_at,
-		       c.id, c.name, c.type, c.legend, c.element, c.created_at, c.updated_at
+		       ` + qualifiedCardColumns("c") + `
 		FROM user_cards uc
 		JOIN cards c ON uc.card_id = c.id
 		WHERE uc.user_id = ?
@@ -485,21 +692,14 @@ func GetUserCardsByUserID(userID int) ([]models.UserCard, error) {
 	for rows.Next() {
 		userCard := models.UserCard{}
 		card := models.Card{}
-		err := rows.Scan(
+		err := rows.Scan(append([]interface{}{
 			&userCard.ID,
 			&userCard.UserID,
 			&userCard.CardID,
 			&userCard.Amount,
 			&userCard.CreatedAt,
 			&userCard.UpdatedAt,
-			&card.ID,
-			&card.Name,
-			&card.Type,
-			&card.Legend,
-			&card.Element,
-			&card.CreatedAt,
-			&card.UpdatedAt,
-		)
+		}, cardScanFields(&card)...)...)
 		if err != nil {
 			return nil, err
 		}
@@ -510,6 +710,50 @@ func GetUserCardsByUserID(userID int) ([]models.UserCard, error) {
 	return userCards, nil
 }
 
+// GetCollection returns every card of the catalogue with the copies a user owns, the copies
+// their saved decks need and the copies they can give away
+func GetCollection(userID int) ([]models.CollectionCard, error) {
+	query := `
+		SELECT ` + qualifiedCardColumns("c") + `, COALESCE(uc.amount, 0), COALESCE(dk.needed, 0)
+		FROM cards c
+		LEFT JOIN user_cards uc ON uc.card_id = c.id AND uc.user_id = ?
+		LEFT JOIN (
+			SELECT dc.card_id, MAX(dc.number) AS needed
+			FROM deck_cards dc
+			JOIN decks d ON d.id = dc.deck_id
+			WHERE d.user_id = ?
+			GROUP BY dc.card_id
+		) dk ON dk.card_id = c.id
+		ORDER BY c.id
+	`
+
+	rows, err := DB.Query(query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying collection: %v", err)
+	}
+	defer rows.Close()
+
+	collection := []models.CollectionCard{}
+	for rows.Next() {
+		card := &models.Card{}
+		collectionCard := models.CollectionCard{Card: card}
+		err := rows.Scan(append(cardScanFields(card), &collectionCard.Owned, &collectionCard.InDecks)...)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning collection card: %v", err)
+		}
+		if collectionCard.Owned > collectionCard.InDecks {
+			collectionCard.Tradable = collectionCard.Owned - collectionCard.InDecks
+		}
+		collection = append(collection, collectionCard)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating collection: %v", err)
+	}
+
+	return collection, nil
+}
+
 // UpdateUserCard updates a user card's amount
 func UpdateUserCard(userCard *models.UserCard) error {
 	query := `
@@ -565,14 +809,17 @@ func DeleteUserCardByUserAndCard(userID, cardID int) error {
 // CreateDeck creates a new deck record in the database
 func CreateDeck(deck *models.Deck) error {
 	query := `
-		INSERT INTO decks (user_id, name, valid, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO decks (user_id, name, format, valid, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now()
 	deck.Valid = false // Default to false until validated
+	if deck.Format == "" {
+		deck.Format = models.DefaultFormat
+	}
 
-	result, err := DB.Exec(query, deck.UserID, deck.Name, deck.Valid, now, now)
+	result, err := DB.Exec(query, deck.UserID, deck.Name, deck.Format, deck.Valid, now, now)
 	if err != nil {
 		return err
 	}
@@ -589,7 +836,7 @@ func CreateDeck(deck *models.Deck) error {
 // GetDeckByID retrieves a deck by its ID
 func GetDeckByID(id int) (*models.Deck, error) {
 	query := `
-		SELECT id, user_id, name, valid
+		SELECT id, user_id, name, format, valid
 		FROM decks
 		WHERE id = ?
 	`
@@ -599,6 +846,7 @@ func GetDeckByID(id int) (*models.Deck, error) {
 		&deck.ID,
 		&deck.UserID,
 		&deck.Name,
+		&deck.Format,
 		&deck.Valid,
 	)
 
@@ -615,7 +863,7 @@ func GetDeckByID(id int) (*models.Deck, error) {
 // GetDecksByUserID retrieves all decks for a specific user
 func GetDecksByUserID(userID int) ([]models.Deck, error) {
 	query := `
-		SELECT id, user_id, name, valid
+		SELECT id, user_id, name, format, valid
 		FROM decks
 		WHERE user_id = ?
 		ORDER BY name
@@ -634,6 +882,7 @@ func GetDecksByUserID(userID int) ([]models.Deck, error) {
 			&deck.ID,
 			&deck.UserID,
 			&deck.Name,
+			&deck.Format,
 			&deck.Valid,
 		)
 		if err != nil {
@@ -688,7 +937,7 @@ func AddCardToDeck(deckID, cardID, number int) error {
 func GetDeckCards(deckID int) ([]models.DeckCard, error) {
 	query := `
 		SELECT dc.deck_id, dc.card_id, dc.number,
-		       c.id, c.name, c.type, c.legend, c.element, c.created_at, c.updated_at
+		       ` + qualifiedCardColumns("c") + `
 		FROM deck_cards dc
 		JOIN cards c ON dc.card_id = c.id
 		WHERE dc.deck_id = ?
@@ -705,18 +954,11 @@ func GetDeckCards(deckID int) ([]models.DeckCard, error) {
 	for rows.Next() {
 		deckCard := models.DeckCard{}
 		card := models.Card{}
-		err := rows.Scan(
+		err := rows.Scan(append([]interface{}{
 			&deckCard.DeckID,
 			&deckCard.CardID,
 			&deckCard.Number,
-			&card.ID,
-			&card.Name,
-			&card.Type,
-			&card.Legend,
-			&card.Element,
-			&card.CreatedAt,
-			&card.UpdatedAt,
-		)
+		}, cardScanFields(&card)...)...)
 		if err != nil {
 			return nil, err
 		}
@@ -727,40 +969,37 @@ func GetDeckCards(deckID int) ([]models.DeckCard, error) {
 	return deckCards, nil
 }
 
-// ValidateDeckCreation checks if a user has all the required cards to create a deck
-func ValidateDeckCreation(userID int, cardIDs []int, cardCounts []int) (bool, error) {
+// ValidateDeckCreation checks a deck against the rules of a format and that the user has all
+// the cards it needs. It returns every rule the deck breaks, or none if it can be saved.
+func ValidateDeckCreation(userID int, formatCode string, cardIDs []int, cardCounts []int) ([]models.DeckViolation, error) {
 	if len(cardIDs) != len(cardCounts) {
-		return false, fmt.Errorf("card_ids and card_count arrays must have the same length")
+		return nil, fmt.Errorf("card_ids and card_count arrays must have the same length")
 	}
 
-	// Check minimum 40 cards requirement
-	totalCards := 0
-	for _, count := range cardCounts {
-		totalCards += count
+	format, err := GetFormat(formatCode)
+	if err != nil {
+		return nil, err
 	}
-	if totalCards < 40 {
-		return false, fmt.Errorf("deck must have at least 40 cards")
+	if format == nil {
+		return nil, models.ErrFormatNotFound
 	}
 
+	deckCards := make([]models.DeckCard, 0, len(cardIDs))
 	for i, cardID := range cardIDs {
-		requiredCount := cardCounts[i]
-
-		// Check if user has this card
-		userCard, err := GetUserCardByUserAndCard(userID, cardID)
+		card, err := GetCardByID(cardID)
 		if err != nil {
-			return false, err
-		}
-
-		if userCard == nil {
-			return false, nil // User doesn't have this card
+			return nil, err
 		}
+		deckCards = append(deckCards, models.DeckCard{CardID: cardID, Number: cardCounts[i], Card: card})
+	}
 
-		if userCard.Amount < requiredCount {
-			return false, nil // User doesn't have enough of this card
-		}
+	violations := legality.Check(format, deckCards)
+	owned, err := ownershipViolations(userID, deckCards)
+	if err != nil {
+		return nil, err
 	}
 
-	return true, nil
+	return append(violations, owned...), nil
 }
 
 // GetUserDeckLimit calculates the maximum number of decks a user can have based on their level
@@ -800,8 +1039,9 @@ func CheckUserDeckLimit(userID int) (bool, int, error) {
 	return canCreate, deckLimit, nil
 }
 
-// CreateDeckWithValidation creates a deck and validates that the user has all required cards
-func CreateDeckWithValidation(userID int, name string, cardIDs []int, cardCounts []int) (*models.Deck, error) {
+// CreateDeckWithValidation creates a deck in a format, validating it against the format's
+// rules and that the user has all required cards
+func CreateDeckWithValidation(userID int, name, format string, cardIDs []int, cardCounts []int) (*models.Deck, error) {
 	// Start transaction
 	tx, err := DB.Begin()
 	if err != nil {
@@ -818,29 +1058,34 @@ func CreateDeckWithValidation(userID int, name string, cardIDs []int, cardCounts
 		return nil, fmt.Errorf("deck limit reached: you can only have %d decks", deckLimit)
 	}
 
-	// Validate that user has all required cards
-	valid, err := ValidateDeckCreation(userID, cardIDs, cardCounts)
+	if format == "" {
+		format = models.DefaultFormat
+	}
+
+	// Validate the deck against its format and the user's cards
+	violations, err := ValidateDeckCreation(userID, format, cardIDs, cardCounts)
 	if err != nil {
 		return nil, err
 	}
-	if !valid {
-		return nil, fmt.Errorf("user does not have all required cards")
+	if len(violations) > 0 {
+		return nil, &models.DeckViolationError{Violations: violations}
 	}
 
 	// Create the deck
 	deck := &models.Deck{
 		UserID: userID,
 		Name:   name,
-		Valid:  true, // Valid since we confirmed user has all cards
+		Format: format,
+		Valid:  true, // Valid since it follows its format and the user has all cards
 	}
 
 	createDeckQuery := `
-		INSERT INTO decks (user_id, name, valid, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO decks (user_id, name, format, valid, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now()
-	result, err := tx.Exec(createDeckQuery, deck.UserID, deck.Name, deck.Valid, now, now)
+	result, err := tx.Exec(createDeckQuery, deck.UserID, deck.Name, deck.Format, deck.Valid, now, now)
 	if err != nil {
 		return nil, err
 	}
@@ -893,8 +1138,9 @@ func IsUserInActiveGame(userID int) (bool, error) {
 }
 
 // UpdateDeck updates a deck with validation
-// Validates that the deck belongs to the logged user and user is not in an active game
-func UpdateDeck(deckID int, userID int, name string, cardIDs []int, cardCounts []int) (*models.Deck, error) {
+// Validates that the deck belongs to the logged user and user is not in an active game.
+// An empty format keeps the current one.
+func UpdateDeck(deckID int, userID int, name, format string, cardIDs []int, cardCounts []int) (*models.Deck, error) {
 	// First, check if the deck exists and belongs to the user
 	deck, err := GetDeckByID(deckID)
 	if err != nil {
@@ -916,14 +1162,19 @@ func UpdateDeck(deckID int, userID int, name string, cardIDs []int, cardCounts [
 		return nil, fmt.Errorf("cannot update deck while in an active game")
 	}
 
+	if format == "" {
+		format = deck.Format
+	}
+
 	// Validate the new deck composition
-	valid, err := ValidateDeckCreation(userID, cardIDs, cardCounts)
+	violations, err := ValidateDeckCreation(userID, format, cardIDs, cardCounts)
 	if err != nil {
-		return nil, fmt.Errorf("error validating deck: %v", err)
+		return nil, fmt.Errorf("error validating deck: %w", err)
 	}
-	if !valid {
-		return nil, fmt.Errorf("invalid deck composition")
+	if len(violations) > 0 {
+		return nil, &models.DeckViolationError{Violations: violations}
 	}
+	valid := true
 
 	// Start transaction
 	tx, err := DB.Begin()
@@ -939,10 +1190,10 @@ func UpdateDeck(deckID int, userID int, name string, cardIDs []int, cardCounts [
 	// Update deck name
 	updateQuery := `
 		UPDATE decks 
-		SET name = ?, valid = ?, updated_at = ?
+		SET name = ?, format = ?, valid = ?, updated_at = ?
 		WHERE id = ?
 	`
-	_, err = tx.Exec(updateQuery, name, valid, time.Now(), deckID)
+	_, err = tx.Exec(updateQuery, name, format, valid, time.Now(), deckID)
 	if err != nil {
 		return nil, fmt.Errorf("error updating deck: %v", err)
 	}
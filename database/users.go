@@ -27,6 +27,7 @@ func CreateUser(user *models.User) error {
 	now := time.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
+	user.Role = models.RoleUser // Column default
 
 	result, err := DB.Exec(query, user.Name, user.Email, user.Password, user.ValidationCode, user.ValidationCodeExpiresAt, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
@@ -45,7 +46,7 @@ func CreateUser(user *models.User) error {
 // GetUserByEmail retrieves a user by email
 func GetUserByEmail(email string) (*models.User, error) {
 	query := `
-		SELECT id, name, email, password, validation_code, validation_code_expires_at, validated_at, created_at, updated_at, deleted_at
+		SELECT id, name, email, password, validation_code, validation_code_expires_at, validated_at, token_version, role, created_at, updated_at, deleted_at
 		FROM users
 		WHERE email = ? AND deleted_at IS NULL
 	`
@@ -59,6 +60,8 @@ func GetUserByEmail(email string) (*models.User, error) {
 		&user.ValidationCode,
 		&user.ValidationCodeExpiresAt,
 		&user.ValidatedAt,
+		&user.TokenVersion,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.DeletedAt,
@@ -77,7 +80,7 @@ func GetUserByEmail(email string) (*models.User, error) {
 // GetUserByID retrieves a user by ID
 func GetUserByID(id int) (*models.User, error) {
 	query := `
-		SELECT id, name, email, password, validation_code, validation_code_expires_at, validated_at, created_at, updated_at, deleted_at
+		SELECT id, name, email, password, validation_code, validation_code_expires_at, validated_at, token_version, role, created_at, updated_at, deleted_at
 		FROM users
 		WHERE id = ? AND deleted_at IS NULL
 	`
@@ -91,6 +94,8 @@ func GetUserByID(id int) (*models.User, error) {
 		&user.ValidationCode,
 		&user.ValidationCodeExpiresAt,
 		&user.ValidatedAt,
+		&user.TokenVersion,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.DeletedAt,
@@ -237,11 +242,12 @@ func UpdateUser(user *models.User) error {
 	return nil
 }
 
-// UpdatePassword updates user password
+// UpdatePassword updates user password and bumps the token version, which invalidates
+// every token issued before the change
 func UpdatePassword(userID int, hashedPassword string) error {
 	query := `
 		UPDATE users
-		SET password = ?, updated_at = ?
+		SET password = ?, token_version = token_version + 1, updated_at = ?
 		WHERE id = ? AND deleted_at IS NULL
 	`
 
@@ -262,6 +268,31 @@ func UpdatePassword(userID int, hashedPassword string) error {
 	return nil
 }
 
+// SetUserRole changes the role of a user
+func SetUserRole(userID int, role string) error {
+	query := `
+		UPDATE users
+		SET role = ?, updated_at = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+
+	result, err := DB.Exec(query, role, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 // SoftDeleteUser marks a user as deleted (soft delete)
 func SoftDeleteUser(userID int) error {
 	query := `
@@ -0,0 +1,212 @@
+// Package deckcode converts decks to and from the formats players share them in: compact
+// deck codes and plain-text card lists.
+//
+// A deck code is the unpadded base64url encoding of:
+//
+//	version      1 byte, currently 1
+//	format       uvarint length followed by the format code
+//	entries      uvarint number of cards, then for each card in ID order the uvarint
+//	             difference with the previous card ID and the uvarint number of copies
+//	checksum     CRC-32 (IEEE) of the bytes above, big endian
+//
+// Card IDs are stored as differences so a deck of nearby cards takes a couple of bytes per card.
+package deckcode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tcg-server-go/models"
+)
+
+// Version is the version of the deck codes Encode creates
+const Version = 1
+
+// Limits of what a deck code or list may hold, to refuse absurd input early
+const (
+	MaxEntries = 200
+	MaxCopies  = 999
+)
+
+var (
+	// ErrInvalidCode is returned for deck codes that are not well formed
+	ErrInvalidCode = errors.New("invalid deck code")
+	// ErrChecksum is returned when a deck code was altered or mistyped
+	ErrChecksum = errors.New("deck code checksum does not match")
+	// ErrUnsupportedVersion is returned for deck codes of an unknown version
+	ErrUnsupportedVersion = errors.New("unsupported deck code version")
+)
+
+// Deck is the content of a deck code
+type Deck struct {
+	Format string
+	Cards  []models.DeckCard // CardID and Number only, in card ID order
+}
+
+// Encode returns the deck code of a deck. The same card may be listed more than once.
+func Encode(format string, cards []models.DeckCard) string {
+	counts := merge(cards)
+	cardIDs := make([]int, 0, len(counts))
+	for cardID := range counts {
+		cardIDs = append(cardIDs, cardID)
+	}
+	sort.Ints(cardIDs)
+
+	buf := []byte{Version}
+	buf = binary.AppendUvarint(buf, uint64(len(format)))
+	buf = append(buf, format...)
+	buf = binary.AppendUvarint(buf, uint64(len(cardIDs)))
+	previous := 0
+	for _, cardID := range cardIDs {
+		buf = binary.AppendUvarint(buf, uint64(cardID-previous))
+		buf = binary.AppendUvarint(buf, uint64(counts[cardID]))
+		previous = cardID
+	}
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// Decode reads a deck code. It does not check the cards exist.
+func Decode(code string) (*Deck, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(code))
+	if err != nil || len(buf) < 5 {
+		return nil, ErrInvalidCode
+	}
+
+	body, sum := buf[:len(buf)-4], binary.BigEndian.Uint32(buf[len(buf)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, ErrChecksum
+	}
+	if body[0] != Version {
+		return nil, ErrUnsupportedVersion
+	}
+
+	reader := bytes.NewReader(body[1:])
+	length, err := binary.ReadUvarint(reader)
+	if err != nil || length > uint64(reader.Len()) {
+		return nil, ErrInvalidCode
+	}
+	format := make([]byte, length)
+	reader.Read(format)
+
+	entries, err := binary.ReadUvarint(reader)
+	if err != nil || entries == 0 || entries > MaxEntries {
+		return nil, ErrInvalidCode
+	}
+
+	deck := &Deck{Format: string(format), Cards: make([]models.DeckCard, 0, entries)}
+	cardID := uint64(0)
+	for i := uint64(0); i < entries; i++ {
+		// A delta that large could wrap the card ID around past the check below
+		delta, err := binary.ReadUvarint(reader)
+		if err != nil || (delta == 0 && i > 0) || delta > 1<<31-1 {
+			return nil, ErrInvalidCode
+		}
+		count, err := binary.ReadUvarint(reader)
+		if err != nil || count == 0 || count > MaxCopies {
+			return nil, ErrInvalidCode
+		}
+		cardID += delta
+		if cardID == 0 || cardID > 1<<31-1 {
+			return nil, ErrInvalidCode
+		}
+		deck.Cards = append(deck.Cards, models.DeckCard{CardID: int(cardID), Number: int(count)})
+	}
+	if reader.Len() > 0 {
+		return nil, ErrInvalidCode
+	}
+
+	return deck, nil
+}
+
+// ListEntry is a line of a card list: a number of copies of a card named by the player
+type ListEntry struct {
+	Count int
+	Name  string
+}
+
+// ListError reports a line of a card list that could not be read
+type ListError struct {
+	Line int
+	Text string
+}
+
+func (e *ListError) Error() string {
+	return fmt.Sprintf("line %d is not a card count followed by a card name: %q", e.Line, e.Text)
+}
+
+// listLine matches "3 Fire Drake" and "3x Fire Drake"
+var listLine = regexp.MustCompile(`^(\d+)\s*[xX]?\s+(\S.*)$`)
+
+// ParseList reads a plain-text card list with one "<count> <card name>" per line. Blank
+// lines and lines starting with # or // are skipped. Cards listed more than once are added up.
+func ParseList(text string) ([]ListEntry, error) {
+	entries := []ListEntry{}
+	index := make(map[string]int) // Entry of each name, case insensitive
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "//") {
+			continue
+		}
+
+		match := listLine.FindStringSubmatch(text)
+		if match == nil {
+			return nil, &ListError{Line: line, Text: text}
+		}
+		count, err := strconv.Atoi(match[1])
+		if err != nil || count < 1 || count > MaxCopies {
+			return nil, &ListError{Line: line, Text: text}
+		}
+
+		name := strings.TrimSpace(match[2])
+		key := strings.ToLower(name)
+		if i, ok := index[key]; ok {
+			entries[i].Count += count
+			continue
+		}
+		if len(entries) == MaxEntries {
+			return nil, fmt.Errorf("a card list can have at most %d different cards", MaxEntries)
+		}
+		index[key] = len(entries)
+		entries = append(entries, ListEntry{Count: count, Name: name})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("the card list is empty")
+	}
+
+	return entries, nil
+}
+
+// FormatList writes the cards of a deck as a plain-text card list, in the order given.
+// Every card must be loaded.
+func FormatList(cards []models.DeckCard) string {
+	var list strings.Builder
+	for _, deckCard := range cards {
+		fmt.Fprintf(&list, "%d %s\n", deckCard.Number, deckCard.Card.Name)
+	}
+	return list.String()
+}
+
+// merge adds up the copies of cards listed more than once
+func merge(cards []models.DeckCard) map[int]int {
+	counts := make(map[int]int)
+	for _, deckCard := range cards {
+		counts[deckCard.CardID] += deckCard.Number
+	}
+	return counts
+}
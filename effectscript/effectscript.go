@@ -0,0 +1,230 @@
+// Package effectscript parses and validates the JSON language card effects are written in.
+// A script says when the effect happens (trigger), whether it applies (condition), which
+// monsters or players it affects (target) and what it does to them (operations):
+//
+//	{
+//	  "version": 1,
+//	  "trigger": "on_attack",
+//	  "condition": {"type": "source_energy_at_least", "value": 2},
+//	  "target": {"side": "opponent", "slots": "bench"},
+//	  "operations": [{"op": "damage", "amount": 10}, {"op": "draw", "amount": 1, "target": {"side": "self"}}]
+//	}
+//
+// The game engine runs the scripts; this package only describes them.
+package effectscript
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Version is the version of the language this package reads
+const Version = 1
+
+// MaxOperations is the number of operations a script can have
+const MaxOperations = 10
+
+// Trigger is the event of a match that runs an effect
+type Trigger string
+
+const (
+	TriggerPlay      Trigger = "on_play"       // The card is played from the hand: a monster to a slot, or a spell
+	TriggerAttack    Trigger = "on_attack"     // The monster attacks, once the attack is resolved
+	TriggerAttach    Trigger = "on_attach"     // The energy card is attached to a monster
+	TriggerTurnStart Trigger = "on_turn_start" // The owner of the monster draws for the turn while it is in play
+)
+
+// Side selects whose monsters or player a target is, seen from the owner of the effect
+type Side string
+
+const (
+	SideSelf     Side = "self"
+	SideOpponent Side = "opponent"
+)
+
+// Slots selects the monsters of a side a target covers. Operations on players ignore it.
+type Slots string
+
+const (
+	SlotsActive Slots = "active"
+	SlotsBench  Slots = "bench"
+	SlotsAll    Slots = "all"
+	SlotsSource Slots = "source" // The monster the effect belongs to, or the energy is attached to
+)
+
+// Target selects what an operation affects
+type Target struct {
+	Side  Side  `json:"side"`
+	Slots Slots `json:"slots,omitempty"` // Defaults to active
+}
+
+// ConditionType is a check made before an effect runs
+type ConditionType string
+
+const (
+	ConditionSourceEnergyAtLeast  ConditionType = "source_energy_at_least"  // The source monster has at least value energies attached
+	ConditionHandAtMost           ConditionType = "hand_at_most"            // The owner has at most value cards in hand
+	ConditionOpponentBenchAtLeast ConditionType = "opponent_bench_at_least" // The opponent has at least value bench monsters
+)
+
+// Condition must hold for an effect to run
+type Condition struct {
+	Type  ConditionType `json:"type"`
+	Value int           `json:"value"`
+}
+
+// OpType is something an operation does
+type OpType string
+
+const (
+	OpDamage       OpType = "damage"        // Takes amount HP from every targeted monster
+	OpHeal         OpType = "heal"          // Gives back up to amount HP to every targeted monster
+	OpDraw         OpType = "draw"          // The targeted player draws amount cards
+	OpDiscard      OpType = "discard"       // The targeted player discards the last amount cards of their hand
+	OpAttachEnergy OpType = "attach_energy" // Attaches up to amount energies from the top of the deck to every targeted monster
+)
+
+// maxAmounts caps the amount of each operation
+var maxAmounts = map[OpType]int{
+	OpDamage:       1000,
+	OpHeal:         1000,
+	OpDraw:         10,
+	OpDiscard:      10,
+	OpAttachEnergy: 5,
+}
+
+// Operation is a step of an effect
+type Operation struct {
+	Op     OpType  `json:"op"`
+	Amount int     `json:"amount"`
+	Target *Target `json:"target,omitempty"` // Overrides the target of the script
+}
+
+// Script is a parsed card effect
+type Script struct {
+	Version    int         `json:"version"`
+	Trigger    Trigger     `json:"trigger"`
+	Condition  *Condition  `json:"condition,omitempty"`
+	Target     Target      `json:"target"`
+	Operations []Operation `json:"operations"`
+}
+
+// TargetOf returns the target of an operation of the script
+func (s *Script) TargetOf(op Operation) Target {
+	target := s.Target
+	if op.Target != nil {
+		target = *op.Target
+	}
+	if target.Slots == "" {
+		target.Slots = SlotsActive
+	}
+	return target
+}
+
+// Error lists every problem found in a script
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid effect script: " + strings.Join(e.Problems, "; ")
+}
+
+// Parse reads and validates a script. Problems with the script are returned as an *Error.
+func Parse(raw []byte) (*Script, error) {
+	// The version decides how the rest is read, so check it before anything else
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, &Error{Problems: []string{"the script must be a JSON object with a numeric version"}}
+	}
+	if header.Version != Version {
+		return nil, &Error{Problems: []string{fmt.Sprintf("unsupported version %d, expected %d", header.Version, Version)}}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	script := &Script{}
+	if err := decoder.Decode(script); err != nil {
+		return nil, &Error{Problems: []string{err.Error()}}
+	}
+
+	if problems := script.problems(); len(problems) > 0 {
+		return nil, &Error{Problems: problems}
+	}
+	return script, nil
+}
+
+// problems lists what is wrong with a decoded script
+func (s *Script) problems() []string {
+	problems := []string{}
+
+	switch s.Trigger {
+	case TriggerPlay, TriggerAttack, TriggerAttach, TriggerTurnStart:
+	case "":
+		problems = append(problems, "trigger is required")
+	default:
+		problems = append(problems, fmt.Sprintf("unknown trigger %q", s.Trigger))
+	}
+
+	if s.Condition != nil {
+		switch s.Condition.Type {
+		case ConditionSourceEnergyAtLeast, ConditionHandAtMost, ConditionOpponentBenchAtLeast:
+		default:
+			problems = append(problems, fmt.Sprintf("unknown condition %q", s.Condition.Type))
+		}
+		if s.Condition.Value < 0 {
+			problems = append(problems, "condition value cannot be negative")
+		}
+	}
+
+	problems = append(problems, targetProblems("target", s.Target)...)
+
+	if len(s.Operations) == 0 {
+		problems = append(problems, "at least one operation is required")
+	}
+	if len(s.Operations) > MaxOperations {
+		problems = append(problems, fmt.Sprintf("at most %d operations are allowed", MaxOperations))
+	}
+	for i, op := range s.Operations {
+		field := fmt.Sprintf("operations[%d]", i)
+		maxAmount, ok := maxAmounts[op.Op]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown op %q", field, op.Op))
+		} else if op.Amount < 1 || op.Amount > maxAmount {
+			problems = append(problems, fmt.Sprintf("%s: amount of %s must be between 1 and %d", field, op.Op, maxAmount))
+		}
+		if op.Target != nil {
+			problems = append(problems, targetProblems(field+".target", *op.Target)...)
+		}
+	}
+
+	return problems
+}
+
+func targetProblems(field string, target Target) []string {
+	problems := []string{}
+
+	switch target.Side {
+	case SideSelf, SideOpponent:
+	case "":
+		problems = append(problems, field+": side is required")
+	default:
+		problems = append(problems, fmt.Sprintf("%s: unknown side %q", field, target.Side))
+	}
+
+	switch target.Slots {
+	case "", SlotsActive, SlotsBench, SlotsAll:
+	case SlotsSource:
+		if target.Side != SideSelf {
+			problems = append(problems, field+": the source slot is only on the self side")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s: unknown slots %q", field, target.Slots))
+	}
+
+	return problems
+}
@@ -0,0 +1,86 @@
+package effectscript
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string // A problem the script must be refused with, empty when it is valid
+	}{
+		{name: "valid", script: `{"version": 1, "trigger": "on_attack", "target": {"side": "opponent"}, "operations": [{"op": "damage", "amount": 10}]}`},
+		{
+			name:   "valid with condition and operation target",
+			script: `{"version": 1, "trigger": "on_play", "condition": {"type": "hand_at_most", "value": 3}, "target": {"side": "opponent", "slots": "bench"}, "operations": [{"op": "damage", "amount": 10}, {"op": "draw", "amount": 1, "target": {"side": "self"}}]}`,
+		},
+		{name: "source slot", script: `{"version": 1, "trigger": "on_attach", "target": {"side": "self", "slots": "source"}, "operations": [{"op": "heal", "amount": 1000}]}`},
+
+		{name: "not an object", script: `[1]`, want: "must be a JSON object"},
+		{name: "missing version", script: `{"trigger": "on_play", "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1}]}`, want: "unsupported version 0"},
+		{name: "future version", script: `{"version": 2, "trigger": "on_play", "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1}]}`, want: "unsupported version 2"},
+		{name: "unknown field", script: `{"version": 1, "trigger": "on_play", "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1}], "cost": 2}`, want: `unknown field "cost"`},
+
+		{name: "missing trigger", script: `{"version": 1, "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1}]}`, want: "trigger is required"},
+		{name: "unknown trigger", script: `{"version": 1, "trigger": "on_discard", "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1}]}`, want: `unknown trigger "on_discard"`},
+
+		{name: "unknown condition", script: `{"version": 1, "trigger": "on_play", "condition": {"type": "coin_flip", "value": 1}, "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1}]}`, want: `unknown condition "coin_flip"`},
+		{name: "negative condition value", script: `{"version": 1, "trigger": "on_play", "condition": {"type": "hand_at_most", "value": -1}, "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1}]}`, want: "condition value cannot be negative"},
+
+		{name: "missing side", script: `{"version": 1, "trigger": "on_play", "target": {}, "operations": [{"op": "draw", "amount": 1}]}`, want: "target: side is required"},
+		{name: "unknown side", script: `{"version": 1, "trigger": "on_play", "target": {"side": "both"}, "operations": [{"op": "draw", "amount": 1}]}`, want: `target: unknown side "both"`},
+		{name: "unknown slots", script: `{"version": 1, "trigger": "on_play", "target": {"side": "self", "slots": "hand"}, "operations": [{"op": "draw", "amount": 1}]}`, want: `target: unknown slots "hand"`},
+		{name: "opposing source slot", script: `{"version": 1, "trigger": "on_play", "target": {"side": "opponent", "slots": "source"}, "operations": [{"op": "damage", "amount": 10}]}`, want: "target: the source slot is only on the self side"},
+		{name: "bad operation target", script: `{"version": 1, "trigger": "on_play", "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1, "target": {"side": "both"}}]}`, want: `operations[0].target: unknown side "both"`},
+
+		{name: "no operations", script: `{"version": 1, "trigger": "on_play", "target": {"side": "self"}, "operations": []}`, want: "at least one operation is required"},
+		{
+			name:   "too many operations",
+			script: `{"version": 1, "trigger": "on_play", "target": {"side": "self"}, "operations": [` + strings.Repeat(`{"op": "draw", "amount": 1}, `, MaxOperations) + `{"op": "draw", "amount": 1}]}`,
+			want:   "at most 10 operations are allowed",
+		},
+		{name: "unknown op", script: `{"version": 1, "trigger": "on_play", "target": {"side": "self"}, "operations": [{"op": "steal", "amount": 1}]}`, want: `operations[0]: unknown op "steal"`},
+		{name: "zero amount", script: `{"version": 1, "trigger": "on_play", "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 0}]}`, want: "operations[0]: amount of draw must be between 1 and 10"},
+		{name: "negative amount", script: `{"version": 1, "trigger": "on_play", "target": {"side": "opponent"}, "operations": [{"op": "damage", "amount": -10}]}`, want: "operations[0]: amount of damage must be between 1 and 1000"},
+		{name: "amount above the cap", script: `{"version": 1, "trigger": "on_attach", "target": {"side": "self"}, "operations": [{"op": "attach_energy", "amount": 6}]}`, want: "operations[0]: amount of attach_energy must be between 1 and 5"},
+		{name: "fractional amount", script: `{"version": 1, "trigger": "on_play", "target": {"side": "self"}, "operations": [{"op": "draw", "amount": 1.5}]}`, want: "cannot unmarshal number 1.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := Parse([]byte(tt.script))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				if script == nil {
+					t.Fatal("Parse returned no script")
+				}
+				return
+			}
+
+			var scriptErr *Error
+			if !errors.As(err, &scriptErr) {
+				t.Fatalf("Parse = %v, want an *Error", err)
+			}
+			if !strings.Contains(scriptErr.Error(), tt.want) {
+				t.Errorf("Parse = %v, want a problem containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseListsEveryProblem(t *testing.T) {
+	_, err := Parse([]byte(`{"version": 1, "trigger": "on_discard", "target": {"side": "both"}, "operations": [{"op": "steal", "amount": 1}]}`))
+
+	var scriptErr *Error
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("Parse = %v, want an *Error", err)
+	}
+	if len(scriptErr.Problems) != 3 {
+		t.Errorf("problems = %q, want the trigger, the side and the op", scriptErr.Problems)
+	}
+}
@@ -0,0 +1,311 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"tcg-server-go/models"
+)
+
+// Limits of the time control a table can be created with, in seconds
+const (
+	MinInitialTime = 30
+	MaxInitialTime = 2 * 60 * 60
+	MaxIncrement   = 60
+)
+
+// MulliganTime is how long the players of a timed match have to resolve their mulligan.
+// The clocks only start with the first turn, so a player who has not resolved theirs by
+// then loses the match instead.
+const MulliganTime = 60 * time.Second
+
+// Clock returns the clock of the match at a table as it stands now. The time the running
+// player has spent on their turn is charged to the returned copy only; the saved clock is
+// charged when their turn ends.
+func (m *Matches) Clock(tableID uint) (*models.TableClock, error) {
+	clock, err := m.Tables.GetTableClock(tableID)
+	if err != nil || clock == nil {
+		return clock, err
+	}
+
+	chargeClock(clock, m.now())
+	return clock, nil
+}
+
+// ExpireClocks ends every match where the player whose turn it is ran out of time, or that
+// is still in its mulligan after MulliganTime; they lose the match. It returns the final
+// state of the matches it ended.
+func (m *Matches) ExpireClocks() ([]*models.TableState, error) {
+	now := m.now()
+	tableIDs, err := m.Tables.GetExpiredClocks(now, now.Add(-MulliganTime))
+	if err != nil {
+		return nil, err
+	}
+
+	states := []*models.TableState{}
+	for _, tableID := range tableIDs {
+		state, err := m.expireClock(tableID)
+		if err != nil {
+			log.Printf("Failed to end match at table %d on time: %v", tableID, err)
+			continue
+		}
+		if state != nil {
+			states = append(states, state)
+		}
+	}
+
+	return states, nil
+}
+
+// expireClock ends the match at a table if the running time ran out. It returns nil if an
+// action got in first and the match has moved on.
+func (m *Matches) expireClock(tableID uint) (*models.TableState, error) {
+	unlock := m.lockTable(tableID)
+	defer unlock()
+
+	state, err := m.TableStates.GetTableStateByTableID(tableID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || Phase(state.Phase) == PhaseFinished {
+		return nil, nil
+	}
+
+	clock, err := m.Tables.GetTableClock(tableID)
+	if err != nil || clock == nil {
+		return nil, err
+	}
+
+	now := m.now()
+	seat, ok := expired(clock, state, now)
+	if !ok {
+		return nil, nil
+	}
+
+	if err := m.timeOut(state, clock, seat, now); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// newClock returns the clock of a new match, with both times set to the initial time of its
+// table
+func (m *Matches) newClock(state *models.TableState, now time.Time) (*models.TableClock, error) {
+	table, err := m.Tables.GetTableByID(state.TableID)
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return nil, fmt.Errorf("table %d not found", state.TableID)
+	}
+
+	clock := &models.TableClock{
+		TableID:   state.TableID,
+		Increment: table.TimeIncrement,
+		StartedAt: now,
+	}
+	if table.InitialTime != nil {
+		ownerTime, rivalTime := *table.InitialTime*1000, *table.InitialTime*1000
+		clock.OwnerTime, clock.RivalTime = &ownerTime, &rivalTime
+	}
+
+	syncClock(clock, state, now)
+	return clock, nil
+}
+
+// timeOut ends a match lost on time by the given seat and saves it
+func (m *Matches) timeOut(state *models.TableState, clock *models.TableClock, seat Seat, now time.Time) error {
+	finish(state, seat.Opponent())
+	appendLog(state, "server", fmt.Sprintf("%s ran out of time", seat))
+	syncClock(clock, state, now)
+
+	if err := m.TableStates.UpdateTableState(state); err != nil {
+		return err
+	}
+	return m.Tables.UpdateTableClock(clock)
+}
+
+func (m *Matches) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// syncClock brings a clock in line with the state of its match after an action: the time
+// spent is charged to the running player and, if their turn is over, they get the increment
+// and the clock of the next player starts. The clocks stop when the match finishes, and do
+// not run before the first turn.
+func syncClock(clock *models.TableClock, state *models.TableState, now time.Time) {
+	chargeClock(clock, now)
+	if elapsed := now.Sub(clock.StartedAt); elapsed > 0 {
+		clock.Elapsed = int(elapsed / time.Second)
+	}
+
+	turnOver := clock.Running != nil && (state.ActiveSeat == nil || *state.ActiveSeat != *clock.Running)
+	if turnOver && Phase(state.Phase) != PhaseFinished {
+		if left := clockTime(clock, Seat(*clock.Running)); left != nil {
+			*left += clock.Increment * 1000
+		}
+	}
+
+	clock.Running, clock.ChargedAt = nil, nil
+	if state.ActiveSeat != nil {
+		running := *state.ActiveSeat
+		clock.Running, clock.ChargedAt = &running, &now
+	}
+}
+
+// chargeClock charges the time spent since the clock was last charged to the running
+// player, and counts it as played
+func chargeClock(clock *models.TableClock, now time.Time) {
+	if clock.Running == nil || clock.ChargedAt == nil {
+		return
+	}
+	if elapsed := now.Sub(clock.StartedAt); elapsed > 0 {
+		clock.Elapsed = int(elapsed / time.Second)
+	}
+
+	if left := clockTime(clock, Seat(*clock.Running)); left != nil {
+		if spent := now.Sub(*clock.ChargedAt).Milliseconds(); spent > 0 {
+			*left -= int(spent)
+		}
+		if *left < 0 {
+			*left = 0
+		}
+	}
+	charged := now
+	clock.ChargedAt = &charged
+}
+
+// expired reports whether a player lost the match on time, and who they are
+func expired(clock *models.TableClock, state *models.TableState, now time.Time) (Seat, bool) {
+	if seat, ok := flagged(clock, now); ok {
+		return seat, true
+	}
+	return mulliganExpired(clock, state, now)
+}
+
+// mulliganExpired reports whether the mulligan of a timed match took longer than
+// MulliganTime, and who loses: the player who has not resolved theirs or, if neither has,
+// the owner, who would have played first
+func mulliganExpired(clock *models.TableClock, state *models.TableState, now time.Time) (Seat, bool) {
+	if Phase(state.Phase) != PhaseMulligan || clock.OwnerTime == nil || now.Sub(clock.StartedAt) < MulliganTime {
+		return "", false
+	}
+	if state.OwnersReady {
+		return SeatRival, true
+	}
+	return SeatOwner, true
+}
+
+// flagged reports whether the running player's time ran out, and who they are
+func flagged(clock *models.TableClock, now time.Time) (Seat, bool) {
+	if clock.Running == nil || clock.ChargedAt == nil {
+		return "", false
+	}
+
+	seat := Seat(*clock.Running)
+	left := clockTime(clock, seat)
+	if left == nil {
+		return "", false
+	}
+	return seat, int64(*left) <= now.Sub(*clock.ChargedAt).Milliseconds()
+}
+
+// clockTime returns the time left of a seat, nil on untimed tables
+func clockTime(clock *models.TableClock, seat Seat) *int {
+	if seat == SeatOwner {
+		return clock.OwnerTime
+	}
+	return clock.RivalTime
+}
+
+// ClockWatcher ends the matches where a player ran out of time in the background, so a
+// player cannot hold up a lost match by not acting
+type ClockWatcher struct {
+	Matches  *Matches
+	Interval time.Duration
+	// OnTimeout is called with the final state of every match ended on time
+	OnTimeout func(state *models.TableState)
+
+	mu        sync.Mutex
+	started   bool // Guarded by mu
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewClockWatcher creates a watcher checking the clocks at the given interval (default 1s).
+// It only runs once Start is called; tests can call RunOnce instead.
+func NewClockWatcher(matches *Matches, interval time.Duration) *ClockWatcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	return &ClockWatcher{
+		Matches:  matches,
+		Interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start checks the clocks in the background until Stop is called
+func (w *ClockWatcher) Start() {
+	w.startOnce.Do(func() {
+		w.mu.Lock()
+		w.started = true
+		w.mu.Unlock()
+
+		go func() {
+			defer close(w.done)
+
+			ticker := time.NewTicker(w.Interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					w.RunOnce()
+				case <-w.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop ends the background checks and waits for the current one to finish
+func (w *ClockWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+
+	w.mu.Lock()
+	started := w.started
+	w.mu.Unlock()
+	if started {
+		<-w.done
+	}
+}
+
+// RunOnce ends the matches whose clock ran out and returns their final states
+func (w *ClockWatcher) RunOnce() []*models.TableState {
+	states, err := w.Matches.ExpireClocks()
+	if err != nil {
+		log.Printf("Failed to check match clocks: %v", err)
+		return nil
+	}
+
+	for _, state := range states {
+		if w.OnTimeout != nil {
+			w.OnTimeout(state)
+		}
+	}
+
+	return states
+}
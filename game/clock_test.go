@@ -0,0 +1,43 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"tcg-server-go/models"
+)
+
+func TestMulliganExpired(t *testing.T) {
+	dealt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	timed := 300000
+
+	tests := []struct {
+		name        string
+		phase       Phase
+		ownerTime   *int
+		ownersReady bool
+		rivalsReady bool
+		after       time.Duration
+		loser       Seat
+		lost        bool
+	}{
+		{name: "within the mulligan time", phase: PhaseMulligan, ownerTime: &timed, after: MulliganTime - time.Second},
+		{name: "rival not ready", phase: PhaseMulligan, ownerTime: &timed, ownersReady: true, after: MulliganTime, loser: SeatRival, lost: true},
+		{name: "owner not ready", phase: PhaseMulligan, ownerTime: &timed, rivalsReady: true, after: MulliganTime, loser: SeatOwner, lost: true},
+		{name: "neither ready", phase: PhaseMulligan, ownerTime: &timed, after: time.Hour, loser: SeatOwner, lost: true},
+		{name: "untimed table", phase: PhaseMulligan, after: time.Hour},
+		{name: "first turn started", phase: PhaseDraw, ownerTime: &timed, ownersReady: true, rivalsReady: true, after: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &models.TableClock{OwnerTime: tt.ownerTime, RivalTime: tt.ownerTime, StartedAt: dealt}
+			state := &models.TableState{Phase: string(tt.phase), OwnersReady: tt.ownersReady, RivalsReady: tt.rivalsReady}
+
+			loser, lost := expired(clock, state, dealt.Add(tt.after))
+			if lost != tt.lost || loser != tt.loser {
+				t.Errorf("expired = %q, %v; want %q, %v", loser, lost, tt.loser, tt.lost)
+			}
+		})
+	}
+}
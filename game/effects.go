@@ -0,0 +1,300 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"tcg-server-go/effectscript"
+	"tcg-server-go/models"
+)
+
+// NoSource is the source slot of effects of cards that are not in play, such as spells
+const NoSource = -1
+
+// effectRun is the context an effect runs in
+type effectRun struct {
+	state  *models.TableState
+	owner  Seat // The player of the card the effect belongs to
+	source int  // Slot of the monster the effect belongs to or is attached to, or NoSource
+	card   *models.Card
+}
+
+// slotRef identifies a monster slot of a seat
+type slotRef struct {
+	seat Seat
+	slot int
+}
+
+// trigger runs the scripted effects of a card for an event of the match, then knocks out
+// the monsters left without HP. It returns what happened for the match log, or "" if
+// nothing did. Effects without a script only describe the card and are skipped.
+func (e *Engine) trigger(state *models.TableState, owner Seat, card *models.Card, trigger effectscript.Trigger, source int) (string, error) {
+	if e.Effects == nil {
+		return "", nil
+	}
+
+	effects, err := e.Effects(card.ID)
+	if err != nil {
+		return "", fmt.Errorf("error loading effects of card %d: %v", card.ID, err)
+	}
+
+	run := &effectRun{state: state, owner: owner, source: source, card: card}
+	messages := []string{}
+	for _, effect := range effects {
+		if len(effect.Script) == 0 {
+			continue
+		}
+
+		// Scripts are validated when they are saved, so this only happens if the language changed
+		script, err := effectscript.Parse(effect.Script)
+		if err != nil {
+			log.Printf("Skipping effect %d of card %d: %v", effect.ID, card.ID, err)
+			continue
+		}
+		if script.Trigger != trigger || !run.holds(script.Condition) {
+			continue
+		}
+
+		for _, op := range script.Operations {
+			message, err := e.operate(run, op, script.TargetOf(op))
+			if err != nil {
+				return "", err
+			}
+			if message != "" {
+				messages = append(messages, message)
+			}
+		}
+	}
+
+	if knockedOut := e.resolveKnockOuts(state, owner); knockedOut != "" {
+		messages = append(messages, knockedOut)
+	}
+	if len(messages) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%s %s", card.Name, strings.Join(messages, ", ")), nil
+}
+
+// holds checks the condition of an effect; effects without one always run
+func (run *effectRun) holds(condition *effectscript.Condition) bool {
+	if condition == nil {
+		return true
+	}
+
+	switch condition.Type {
+	case effectscript.ConditionSourceEnergyAtLeast:
+		if run.source == NoSource {
+			return false
+		}
+		stack := *sideOf(run.state, run.owner).slots[run.source]
+		return len(stack) > 0 && len(stack)-1 >= condition.Value
+	case effectscript.ConditionHandAtMost:
+		return len(*sideOf(run.state, run.owner).hand) <= condition.Value
+	case effectscript.ConditionOpponentBenchAtLeast:
+		opponent := sideOf(run.state, run.owner.Opponent())
+		bench := 0
+		for i := ActiveSlot + 1; i < SlotCount; i++ {
+			if len(*opponent.slots[i]) > 0 {
+				bench++
+			}
+		}
+		return bench >= condition.Value
+	}
+	return false
+}
+
+// targets returns the occupied monster slots a target selects
+func (run *effectRun) targets(target effectscript.Target) []slotRef {
+	seat := run.seatOf(target.Side)
+	s := sideOf(run.state, seat)
+
+	var slots []int
+	switch target.Slots {
+	case effectscript.SlotsActive:
+		slots = []int{ActiveSlot}
+	case effectscript.SlotsBench:
+		slots = []int{1, 2, 3}
+	case effectscript.SlotsAll:
+		slots = []int{ActiveSlot, 1, 2, 3}
+	case effectscript.SlotsSource:
+		if run.source != NoSource {
+			slots = []int{run.source}
+		}
+	}
+
+	refs := []slotRef{}
+	for _, slot := range slots {
+		if len(*s.slots[slot]) > 0 && *s.hp[slot] != nil {
+			refs = append(refs, slotRef{seat: seat, slot: slot})
+		}
+	}
+	return refs
+}
+
+func (run *effectRun) seatOf(side effectscript.Side) Seat {
+	if side == effectscript.SideOpponent {
+		return run.owner.Opponent()
+	}
+	return run.owner
+}
+
+// operate applies an operation of an effect and describes what it did
+func (e *Engine) operate(run *effectRun, op effectscript.Operation, target effectscript.Target) (string, error) {
+	switch op.Op {
+	case effectscript.OpDamage:
+		refs := run.targets(target)
+		for _, ref := range refs {
+			hp := sideOf(run.state, ref.seat).hp[ref.slot]
+			remaining := **hp - op.Amount
+			*hp = &remaining
+		}
+		if len(refs) == 0 {
+			return "", nil
+		}
+		return fmt.Sprintf("dealt %d damage to %s", op.Amount, describeTargets(run, refs)), nil
+
+	case effectscript.OpHeal:
+		refs := run.targets(target)
+		for _, ref := range refs {
+			s := sideOf(run.state, ref.seat)
+			monster, err := e.card((*s.slots[ref.slot])[0])
+			if err != nil {
+				return "", err
+			}
+			healed := **s.hp[ref.slot] + op.Amount
+			if max := e.monsterHP(monster); healed > max {
+				healed = max
+			}
+			*s.hp[ref.slot] = &healed
+		}
+		if len(refs) == 0 {
+			return "", nil
+		}
+		return fmt.Sprintf("healed up to %d HP of %s", op.Amount, describeTargets(run, refs)), nil
+
+	case effectscript.OpDraw:
+		s := sideOf(run.state, run.seatOf(target.Side))
+		drawn := len(*s.hand)
+		drawCards(s, op.Amount)
+		drawn = len(*s.hand) - drawn
+		if target.Side == effectscript.SideOpponent {
+			return fmt.Sprintf("made the opponent draw %d cards", drawn), nil
+		}
+		return fmt.Sprintf("drew %d cards", drawn), nil
+
+	case effectscript.OpDiscard:
+		s := sideOf(run.state, run.seatOf(target.Side))
+		discarded := op.Amount
+		if discarded > len(*s.hand) {
+			discarded = len(*s.hand)
+		}
+		kept := len(*s.hand) - discarded
+		*s.graveyard = append(*s.graveyard, (*s.hand)[kept:]...)
+		*s.hand = (*s.hand)[:kept]
+		if target.Side == effectscript.SideOpponent {
+			return fmt.Sprintf("made the opponent discard %d cards", discarded), nil
+		}
+		return fmt.Sprintf("discarded %d cards", discarded), nil
+
+	case effectscript.OpAttachEnergy:
+		refs := run.targets(target)
+		attached := 0
+		for _, ref := range refs {
+			n, err := e.attachFromDeck(sideOf(run.state, ref.seat), ref.slot, op.Amount)
+			if err != nil {
+				return "", err
+			}
+			attached += n
+		}
+		if attached == 0 {
+			return "", nil
+		}
+		return fmt.Sprintf("attached %d energies from the deck to %s", attached, describeTargets(run, refs)), nil
+	}
+
+	return "", fmt.Errorf("unknown effect operation %q", op.Op)
+}
+
+// attachFromDeck attaches up to n energy cards from the top of the deck to a monster and
+// returns how many it attached. The other cards stay in the deck in the same order.
+func (e *Engine) attachFromDeck(s side, slot, n int) (int, error) {
+	attached := 0
+	kept := []uint{}
+	for _, cardID := range *s.deck {
+		if attached < n {
+			card, err := e.card(cardID)
+			if err != nil {
+				return 0, err
+			}
+			if card.Type == models.CardTypeEnergy {
+				*s.slots[slot] = append(*s.slots[slot], cardID)
+				attached++
+				continue
+			}
+		}
+		kept = append(kept, cardID)
+	}
+	*s.deck = kept
+	return attached, nil
+}
+
+// resolveKnockOuts moves the monsters left without HP to the graveyard. A player whose
+// active monster is knocked out promotes a bench monster, or loses the match if they have
+// none. The actor's opponent is checked first, so the actor wins if both players lose.
+func (e *Engine) resolveKnockOuts(state *models.TableState, actor Seat) string {
+	knockedOut := 0
+	for _, seat := range []Seat{actor.Opponent(), actor} {
+		s := sideOf(state, seat)
+		activeLost := false
+		for slot := 0; slot < SlotCount; slot++ {
+			if *s.hp[slot] == nil || **s.hp[slot] > 0 {
+				continue
+			}
+			*s.graveyard = append(*s.graveyard, *s.slots[slot]...)
+			*s.slots[slot] = []uint{}
+			*s.hp[slot] = nil
+			knockedOut++
+			activeLost = activeLost || slot == ActiveSlot
+		}
+
+		if activeLost && !promoteBench(s) && Phase(state.Phase) != PhaseFinished {
+			finish(state, seat.Opponent())
+		}
+	}
+
+	if knockedOut == 0 {
+		return ""
+	}
+	message := "knocking out 1 monster"
+	if knockedOut > 1 {
+		message = fmt.Sprintf("knocking out %d monsters", knockedOut)
+	}
+	if Phase(state.Phase) == PhaseFinished {
+		message += " and ending the match"
+	}
+	return message
+}
+
+// describeTargets names the monsters an operation affected
+func describeTargets(run *effectRun, refs []slotRef) string {
+	if len(refs) == 1 {
+		ref := refs[0]
+		if ref.seat == run.owner && ref.slot == run.source {
+			return "itself"
+		}
+		owner := "its own"
+		if ref.seat != run.owner {
+			owner = "the opposing"
+		}
+		if ref.slot == ActiveSlot {
+			return owner + " active monster"
+		}
+		return fmt.Sprintf("%s monster in bench slot %d", owner, ref.slot)
+	}
+
+	if refs[0].seat != run.owner {
+		return fmt.Sprintf("%d opposing monsters", len(refs))
+	}
+	return fmt.Sprintf("%d of its own monsters", len(refs))
+}
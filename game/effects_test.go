@@ -0,0 +1,160 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tcg-server-go/effectscript"
+	"tcg-server-go/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// Cards of the effect fixture
+const (
+	fixtureDragon   = 1 // The monster whose effect runs
+	fixtureSprite   = 2
+	fixtureGolem    = 3
+	fixtureWisp     = 4
+	fixtureTitan    = 5
+	fixtureFire     = 10
+	fixtureWater    = 11
+	fixtureFireball = 20
+)
+
+// fixtureEngine returns an engine with a small catalogue, where the dragon has the given
+// effect script, and a seeded shuffle
+func fixtureEngine(script json.RawMessage) *Engine {
+	hp := func(n int) *int { return &n }
+	cards := map[int]*models.Card{
+		fixtureDragon:   {ID: fixtureDragon, Name: "Dragon", Type: models.CardTypeMonster, HP: hp(120)},
+		fixtureSprite:   {ID: fixtureSprite, Name: "Sprite", Type: models.CardTypeMonster, HP: hp(60)},
+		fixtureGolem:    {ID: fixtureGolem, Name: "Golem", Type: models.CardTypeMonster, HP: hp(150)},
+		fixtureWisp:     {ID: fixtureWisp, Name: "Wisp", Type: models.CardTypeMonster, HP: hp(40)},
+		fixtureTitan:    {ID: fixtureTitan, Name: "Titan", Type: models.CardTypeMonster},
+		fixtureFire:     {ID: fixtureFire, Name: "Fire Energy", Type: models.CardTypeEnergy, Element: models.CardElementFire},
+		fixtureWater:    {ID: fixtureWater, Name: "Water Energy", Type: models.CardTypeEnergy, Element: models.CardElementWater},
+		fixtureFireball: {ID: fixtureFireball, Name: "Fireball", Type: models.CardTypeSpell},
+	}
+
+	return &Engine{
+		Cards: func(id int) (*models.Card, error) {
+			return cards[id], nil
+		},
+		Effects: func(cardID int) ([]models.Effect, error) {
+			if cardID != fixtureDragon {
+				return nil, nil
+			}
+			return []models.Effect{{ID: 1, Description: "Fixture effect", Script: script}}, nil
+		},
+		Shuffle: rand.New(rand.NewSource(1)).Shuffle,
+	}
+}
+
+// fixtureState returns a match in the main phase of the owner's turn. The owner's dragon is
+// active with two energies attached and a damaged sprite on the bench; the rival has a
+// golem in play and a wisp and a titan on the bench.
+func fixtureState() *models.TableState {
+	hp := func(n int) *int { return &n }
+	owner := string(SeatOwner)
+	return &models.TableState{
+		TableID:               1,
+		OwnersActiveMonster:   []uint{fixtureDragon, fixtureFire, fixtureFire},
+		OwnersActiveMonsterHP: hp(70),
+		OwnersBenchMonster1:   []uint{fixtureSprite},
+		OwnersBenchMonster1HP: hp(25),
+		OwnersBenchMonster2:   []uint{},
+		OwnersBenchMonster3:   []uint{},
+		OwnersGraveyard:       []uint{},
+		OwnersHand:            []uint{fixtureFireball, fixtureWater, fixtureGolem},
+		OwnersDeck:            []uint{fixtureSprite, fixtureFire, fixtureFireball, fixtureWater, fixtureFire},
+		RivalsActiveMonster:   []uint{fixtureGolem},
+		RivalsActiveMonsterHP: hp(150),
+		RivalsBenchMonster1:   []uint{fixtureWisp},
+		RivalsBenchMonster1HP: hp(20),
+		RivalsBenchMonster2:   []uint{fixtureTitan, fixtureWater},
+		RivalsBenchMonster2HP: hp(100),
+		RivalsBenchMonster3:   []uint{},
+		RivalsGraveyard:       []uint{},
+		RivalsHand:            []uint{fixtureWater, fixtureSprite, fixtureFireball, fixtureFire},
+		RivalsDeck:            []uint{fixtureWisp, fixtureWater},
+		OwnersReady:           true,
+		RivalsReady:           true,
+		Phase:                 string(PhaseMain),
+		Turn:                  3,
+		ActiveSeat:            &owner,
+	}
+}
+
+// effectResult is what the golden files hold: the message for the match log and the state
+// the effect left behind
+type effectResult struct {
+	Message string             `json:"message"`
+	State   *models.TableState `json:"state"`
+}
+
+// TestEffectScripts runs every script in testdata/effects as the effect of the owner's active
+// monster and compares the outcome with its golden file. Run with -update to rewrite them.
+func TestEffectScripts(t *testing.T) {
+	scripts, err := filepath.Glob(filepath.Join("testdata", "effects", "*.script.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("no effect scripts in testdata/effects")
+	}
+
+	for _, path := range scripts {
+		name := strings.TrimSuffix(filepath.Base(path), ".script.json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			script, err := effectscript.Parse(raw)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			engine := fixtureEngine(raw)
+			state := fixtureState()
+			dragon, err := engine.card(fixtureDragon)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			message, err := engine.trigger(state, SeatOwner, dragon, script.Trigger, ActiveSlot)
+			if err != nil {
+				t.Fatalf("trigger: %v", err)
+			}
+
+			got, err := json.MarshalIndent(effectResult{Message: message, State: state}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "effects", name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading golden file: %v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("outcome differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,561 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+
+	"tcg-server-go/effectscript"
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+)
+
+// Engine validates actions and applies them to a match state
+type Engine struct {
+	// Cards resolves a card ID to its catalogue entry
+	Cards func(id int) (*models.Card, error)
+	// Effects lists the effects of a card; cards have no effects if it is nil
+	Effects func(cardID int) ([]models.Effect, error)
+	// Shuffle randomizes deck order; tests can inject a seeded implementation
+	Shuffle func(n int, swap func(i, j int))
+}
+
+// NewEngine returns an engine backed by the card catalogue, the effects of the cards and the
+// global random source
+func NewEngine(cards repository.CardRepository, effects repository.EffectRepository) *Engine {
+	return &Engine{
+		Cards:   cards.GetCardByID,
+		Effects: effects.GetEffectsByCardID,
+		Shuffle: rand.Shuffle,
+	}
+}
+
+// side groups the fields of a TableState that belong to one seat
+type side struct {
+	deck      *[]uint
+	hand      *[]uint
+	graveyard *[]uint
+	slots     [SlotCount]*[]uint
+	hp        [SlotCount]**int
+	ready     *bool
+}
+
+// sideOf returns the board of the given seat
+func sideOf(state *models.TableState, seat Seat) side {
+	if seat == SeatOwner {
+		return side{
+			deck:      &state.OwnersDeck,
+			hand:      &state.OwnersHand,
+			graveyard: &state.OwnersGraveyard,
+			slots: [SlotCount]*[]uint{
+				&state.OwnersActiveMonster, &state.OwnersBenchMonster1,
+				&state.OwnersBenchMonster2, &state.OwnersBenchMonster3,
+			},
+			hp: [SlotCount]**int{
+				&state.OwnersActiveMonsterHP, &state.OwnersBenchMonster1HP,
+				&state.OwnersBenchMonster2HP, &state.OwnersBenchMonster3HP,
+			},
+			ready: &state.OwnersReady,
+		}
+	}
+
+	return side{
+		deck:      &state.RivalsDeck,
+		hand:      &state.RivalsHand,
+		graveyard: &state.RivalsGraveyard,
+		slots: [SlotCount]*[]uint{
+			&state.RivalsActiveMonster, &state.RivalsBenchMonster1,
+			&state.RivalsBenchMonster2, &state.RivalsBenchMonster3,
+		},
+		hp: [SlotCount]**int{
+			&state.RivalsActiveMonsterHP, &state.RivalsBenchMonster1HP,
+			&state.RivalsBenchMonster2HP, &state.RivalsBenchMonster3HP,
+		},
+		ready: &state.RivalsReady,
+	}
+}
+
+// Setup loads both decks, shuffles them and deals the opening hands
+func (e *Engine) Setup(state *models.TableState, ownersDeck, rivalsDeck []uint) string {
+	state.OwnersDeck = append([]uint{}, ownersDeck...)
+	state.RivalsDeck = append([]uint{}, rivalsDeck...)
+	state.OwnersHand = []uint{}
+	state.RivalsHand = []uint{}
+	state.OwnersGraveyard = []uint{}
+	state.RivalsGraveyard = []uint{}
+
+	for _, seat := range []Seat{SeatOwner, SeatRival} {
+		s := sideOf(state, seat)
+		for i := range s.slots {
+			*s.slots[i] = []uint{}
+			*s.hp[i] = nil
+		}
+		e.shuffle(*s.deck)
+		drawCards(s, HandSize)
+		*s.ready = false
+	}
+
+	state.Phase = string(PhaseMulligan)
+	state.Turn = 0
+	state.ActiveSeat = nil
+	state.WinnerSeat = nil
+	state.EnergyAttached = false
+
+	return fmt.Sprintf("match set up, both players drew %d cards", HandSize)
+}
+
+// Apply validates an action submitted from a seat and mutates the state if it is legal.
+// It returns a human readable description of what happened for the match log.
+func (e *Engine) Apply(state *models.TableState, seat Seat, action Action) (string, error) {
+	if Phase(state.Phase) == PhaseFinished {
+		return "", ErrMatchFinished
+	}
+
+	switch action.Type {
+	case ActionMulligan:
+		return e.mulligan(state, seat, action.Keep)
+	case ActionConcede:
+		finish(state, seat.Opponent())
+		return "conceded the match", nil
+	}
+
+	// Every other action can only be taken by the player whose turn it is
+	if state.ActiveSeat == nil || Seat(*state.ActiveSeat) != seat {
+		return "", ErrNotYourTurn
+	}
+
+	switch action.Type {
+	case ActionDraw:
+		return e.draw(state, seat)
+	case ActionPlayMonster:
+		return e.playMonster(state, seat, action.CardID, action.Slot)
+	case ActionPlaySpell:
+		return e.playSpell(state, seat, action.CardID)
+	case ActionAttachEnergy:
+		return e.attachEnergy(state, seat, action.CardID, action.Slot)
+	case ActionAttack:
+		return e.attack(state, seat)
+	case ActionRetreat:
+		return e.retreat(state, seat, action.Slot)
+	case ActionEndTurn:
+		return e.endTurn(state, seat)
+	}
+
+	return "", ErrUnknownAction
+}
+
+// mulligan lets a player keep their opening hand or shuffle it back and draw a new one
+func (e *Engine) mulligan(state *models.TableState, seat Seat, keep bool) (string, error) {
+	if Phase(state.Phase) != PhaseMulligan {
+		return "", ErrWrongPhase
+	}
+
+	s := sideOf(state, seat)
+	if *s.ready {
+		return "", ErrAlreadyReady
+	}
+
+	message := "kept the opening hand"
+	if !keep {
+		*s.deck = append(*s.deck, *s.hand...)
+		*s.hand = []uint{}
+		e.shuffle(*s.deck)
+		drawCards(s, HandSize)
+		message = fmt.Sprintf("took a mulligan and drew %d new cards", HandSize)
+	}
+	*s.ready = true
+
+	// The first turn starts once both players resolved their mulligan
+	if state.OwnersReady && state.RivalsReady {
+		owner := string(SeatOwner)
+		state.ActiveSeat = &owner
+		state.Turn = 1
+		state.Phase = string(PhaseDraw)
+	}
+
+	return message, nil
+}
+
+// draw moves the top card of the deck to the hand. A player who cannot draw loses.
+// Drawing starts the turn, so the turn start effects of the player's monsters run.
+func (e *Engine) draw(state *models.TableState, seat Seat) (string, error) {
+	if Phase(state.Phase) != PhaseDraw {
+		return "", ErrWrongPhase
+	}
+
+	s := sideOf(state, seat)
+	if len(*s.deck) == 0 {
+		finish(state, seat.Opponent())
+		return "could not draw from an empty deck and lost the match", nil
+	}
+
+	drawCards(s, 1)
+	state.Phase = string(PhaseMain)
+	message := "drew a card"
+
+	// Effects can knock out and promote monsters, so only the monsters still in the slot
+	// they started the turn in are triggered
+	var monsters [SlotCount]uint
+	for slot := range s.slots {
+		if len(*s.slots[slot]) > 0 {
+			monsters[slot] = (*s.slots[slot])[0]
+		}
+	}
+	for slot, cardID := range monsters {
+		stack := *s.slots[slot]
+		if cardID == 0 || len(stack) == 0 || stack[0] != cardID || Phase(state.Phase) == PhaseFinished {
+			continue
+		}
+
+		monster, err := e.card(cardID)
+		if err != nil {
+			return "", err
+		}
+		effects, err := e.trigger(state, seat, monster, effectscript.TriggerTurnStart, slot)
+		if err != nil {
+			return "", err
+		}
+		if effects != "" {
+			message += "; " + effects
+		}
+	}
+
+	return message, nil
+}
+
+// playMonster puts a monster from the hand into an empty slot
+func (e *Engine) playMonster(state *models.TableState, seat Seat, cardID uint, slot int) (string, error) {
+	if Phase(state.Phase) != PhaseMain {
+		return "", ErrWrongPhase
+	}
+	if slot < 0 || slot >= SlotCount {
+		return "", ErrInvalidSlot
+	}
+
+	s := sideOf(state, seat)
+	if len(*s.slots[slot]) > 0 {
+		return "", ErrSlotOccupied
+	}
+
+	card, err := e.handCard(s, cardID, models.CardTypeMonster)
+	if err != nil {
+		return "", err
+	}
+
+	removeCard(s.hand, cardID)
+	*s.slots[slot] = []uint{cardID}
+	hp := e.monsterHP(card)
+	*s.hp[slot] = &hp
+
+	message := fmt.Sprintf("played %s to %s", card.Name, slotName(slot))
+	effects, err := e.trigger(state, seat, card, effectscript.TriggerPlay, slot)
+	if err != nil {
+		return "", err
+	}
+	if effects != "" {
+		message += "; " + effects
+	}
+
+	return message, nil
+}
+
+// playSpell casts a spell from the hand: it goes to the graveyard and its effects run
+func (e *Engine) playSpell(state *models.TableState, seat Seat, cardID uint) (string, error) {
+	if Phase(state.Phase) != PhaseMain {
+		return "", ErrWrongPhase
+	}
+
+	s := sideOf(state, seat)
+	card, err := e.handCard(s, cardID, models.CardTypeSpell)
+	if err != nil {
+		return "", err
+	}
+
+	removeCard(s.hand, cardID)
+	*s.graveyard = append(*s.graveyard, cardID)
+
+	message := fmt.Sprintf("cast %s", card.Name)
+	effects, err := e.trigger(state, seat, card, effectscript.TriggerPlay, NoSource)
+	if err != nil {
+		return "", err
+	}
+	if effects != "" {
+		message += "; " + effects
+	}
+
+	return message, nil
+}
+
+// attachEnergy attaches an energy card from the hand to a monster in play, once per turn
+func (e *Engine) attachEnergy(state *models.TableState, seat Seat, cardID uint, slot int) (string, error) {
+	if Phase(state.Phase) != PhaseMain {
+		return "", ErrWrongPhase
+	}
+	if state.EnergyAttached {
+		return "", ErrEnergyAlreadyAttached
+	}
+	if slot < 0 || slot >= SlotCount {
+		return "", ErrInvalidSlot
+	}
+
+	s := sideOf(state, seat)
+	if len(*s.slots[slot]) == 0 {
+		return "", ErrSlotEmpty
+	}
+
+	card, err := e.handCard(s, cardID, models.CardTypeEnergy)
+	if err != nil {
+		return "", err
+	}
+
+	removeCard(s.hand, cardID)
+	*s.slots[slot] = append(*s.slots[slot], cardID)
+	state.EnergyAttached = true
+
+	message := fmt.Sprintf("attached %s to %s", card.Name, slotName(slot))
+	effects, err := e.trigger(state, seat, card, effectscript.TriggerAttach, slot)
+	if err != nil {
+		return "", err
+	}
+	if effects != "" {
+		message += "; " + effects
+	}
+
+	return message, nil
+}
+
+// attack resolves an attack from the active monster against the opponent's active monster
+func (e *Engine) attack(state *models.TableState, seat Seat) (string, error) {
+	if Phase(state.Phase) != PhaseMain {
+		return "", ErrWrongPhase
+	}
+
+	attacker := sideOf(state, seat)
+	defender := sideOf(state, seat.Opponent())
+	if len(*attacker.slots[ActiveSlot]) == 0 {
+		return "", ErrNoAttacker
+	}
+	if len(*defender.slots[ActiveSlot]) == 0 || *defender.hp[ActiveSlot] == nil {
+		return "", ErrNoTarget
+	}
+
+	monster, err := e.card((*attacker.slots[ActiveSlot])[0])
+	if err != nil {
+		return "", err
+	}
+	damage, err := e.damage(*attacker.slots[ActiveSlot])
+	if err != nil {
+		return "", err
+	}
+	state.Phase = string(PhaseAttack)
+
+	remaining := **defender.hp[ActiveSlot] - damage
+	*defender.hp[ActiveSlot] = &remaining
+	message := fmt.Sprintf("attacked for %d damage", damage)
+
+	if remaining <= 0 {
+		message += ", knocking out the opposing active monster"
+		*defender.graveyard = append(*defender.graveyard, *defender.slots[ActiveSlot]...)
+		*defender.slots[ActiveSlot] = []uint{}
+		*defender.hp[ActiveSlot] = nil
+
+		if !promoteBench(defender) {
+			finish(state, seat)
+			return message + " and winning the match", nil
+		}
+	}
+
+	// The attack effects of the monster run once the attack is resolved
+	effects, err := e.trigger(state, seat, monster, effectscript.TriggerAttack, ActiveSlot)
+	if err != nil {
+		return "", err
+	}
+	if effects != "" {
+		message += "; " + effects
+	}
+
+	// Attacking ends the main phase
+	if Phase(state.Phase) != PhaseFinished {
+		state.Phase = string(PhaseEnd)
+	}
+	return message, nil
+}
+
+// retreat swaps the active monster with a bench monster, discarding attached energies to pay its retreat cost
+func (e *Engine) retreat(state *models.TableState, seat Seat, slot int) (string, error) {
+	if Phase(state.Phase) != PhaseMain {
+		return "", ErrWrongPhase
+	}
+	if slot <= ActiveSlot || slot >= SlotCount {
+		return "", ErrInvalidSlot
+	}
+
+	s := sideOf(state, seat)
+	if len(*s.slots[ActiveSlot]) == 0 {
+		return "", ErrNoAttacker
+	}
+	if len(*s.slots[slot]) == 0 {
+		return "", ErrSlotEmpty
+	}
+
+	active := *s.slots[ActiveSlot]
+	monster, err := e.card(active[0])
+	if err != nil {
+		return "", err
+	}
+	if len(active)-1 < monster.RetreatCost {
+		return "", ErrNotEnoughEnergy
+	}
+
+	// The most recently attached energies are discarded first
+	kept := len(active) - monster.RetreatCost
+	*s.graveyard = append(*s.graveyard, active[kept:]...)
+	active = active[:kept]
+
+	*s.slots[ActiveSlot], *s.slots[slot] = *s.slots[slot], active
+	*s.hp[ActiveSlot], *s.hp[slot] = *s.hp[slot], *s.hp[ActiveSlot]
+
+	return fmt.Sprintf("retreated %s to %s, discarding %d energies", monster.Name, slotName(slot), monster.RetreatCost), nil
+}
+
+// endTurn passes the turn to the opponent
+func (e *Engine) endTurn(state *models.TableState, seat Seat) (string, error) {
+	if Phase(state.Phase) != PhaseMain && Phase(state.Phase) != PhaseEnd {
+		return "", ErrWrongPhase
+	}
+
+	next := string(seat.Opponent())
+	state.ActiveSeat = &next
+	state.Turn++
+	state.Phase = string(PhaseDraw)
+	state.EnergyAttached = false
+
+	return "ended the turn", nil
+}
+
+// handCard checks that a card is in the hand and has the expected type
+func (e *Engine) handCard(s side, cardID uint, cardType models.CardType) (*models.Card, error) {
+	if !containsCard(*s.hand, cardID) {
+		return nil, ErrCardNotInHand
+	}
+
+	card, err := e.Cards(int(cardID))
+	if err != nil {
+		return nil, fmt.Errorf("error loading card %d: %v", cardID, err)
+	}
+	if card == nil || card.Type != cardType {
+		return nil, ErrInvalidCard
+	}
+
+	return card, nil
+}
+
+// card loads a card that is already in play
+func (e *Engine) card(cardID uint) (*models.Card, error) {
+	card, err := e.Cards(int(cardID))
+	if err != nil {
+		return nil, fmt.Errorf("error loading card %d: %v", cardID, err)
+	}
+	if card == nil {
+		return nil, fmt.Errorf("card %d not found", cardID)
+	}
+	return card, nil
+}
+
+// monsterHP returns the starting HP of a monster
+func (e *Engine) monsterHP(card *models.Card) int {
+	if card.HP != nil {
+		return *card.HP
+	}
+	return DefaultHP
+}
+
+// damage computes the damage dealt by the monster stack in the active slot.
+// The energies attached under the monster must pay its attack cost.
+func (e *Engine) damage(stack []uint) (int, error) {
+	monster, err := e.card(stack[0])
+	if err != nil {
+		return 0, err
+	}
+
+	energies := make([]models.CardElement, 0, len(stack)-1)
+	for _, cardID := range stack[1:] {
+		energy, err := e.card(cardID)
+		if err != nil {
+			return 0, err
+		}
+		energies = append(energies, energy.Element)
+	}
+
+	if !monster.AttackCost.CoveredBy(energies) {
+		return 0, ErrNotEnoughEnergy
+	}
+
+	if monster.AttackDamage != nil {
+		return *monster.AttackDamage, nil
+	}
+	return BaseDamage + len(energies)*EnergyDamage, nil
+}
+
+func (e *Engine) shuffle(cards []uint) {
+	e.Shuffle(len(cards), func(i, j int) {
+		cards[i], cards[j] = cards[j], cards[i]
+	})
+}
+
+// finish ends the match with the given winner
+func finish(state *models.TableState, winner Seat) {
+	w := string(winner)
+	state.WinnerSeat = &w
+	state.Phase = string(PhaseFinished)
+	state.ActiveSeat = nil
+}
+
+// promoteBench moves the first bench monster to the empty active slot.
+// It returns false if there was no monster left to promote.
+func promoteBench(s side) bool {
+	for i := 1; i < SlotCount; i++ {
+		if len(*s.slots[i]) > 0 {
+			*s.slots[ActiveSlot] = *s.slots[i]
+			*s.hp[ActiveSlot] = *s.hp[i]
+			*s.slots[i] = []uint{}
+			*s.hp[i] = nil
+			return true
+		}
+	}
+	return false
+}
+
+// drawCards moves up to n cards from the top of the deck to the hand
+func drawCards(s side, n int) {
+	if n > len(*s.deck) {
+		n = len(*s.deck)
+	}
+	*s.hand = append(*s.hand, (*s.deck)[:n]...)
+	*s.deck = (*s.deck)[n:]
+}
+
+func containsCard(cards []uint, cardID uint) bool {
+	for _, id := range cards {
+		if id == cardID {
+			return true
+		}
+	}
+	return false
+}
+
+// removeCard removes a single copy of a card from a pile
+func removeCard(cards *[]uint, cardID uint) {
+	for i, id := range *cards {
+		if id == cardID {
+			*cards = append((*cards)[:i], (*cards)[i+1:]...)
+			return
+		}
+	}
+}
+
+func slotName(slot int) string {
+	if slot == ActiveSlot {
+		return "the active slot"
+	}
+	return fmt.Sprintf("bench slot %d", slot)
+}
@@ -0,0 +1,102 @@
+// Package game implements the server-authoritative match engine. Clients never
+// write table_state directly: they submit actions, the engine validates them
+// against the current state and only accepted actions are persisted.
+package game
+
+import "errors"
+
+// Phase represents the current step of a match
+type Phase string
+
+const (
+	PhaseSetup    Phase = "setup"
+	PhaseMulligan Phase = "mulligan"
+	PhaseDraw     Phase = "draw"
+	PhaseMain     Phase = "main"
+	PhaseAttack   Phase = "attack"
+	PhaseEnd      Phase = "end"
+	PhaseFinished Phase = "finished"
+)
+
+// Seat identifies one of the two players at a table
+type Seat string
+
+const (
+	SeatOwner Seat = "owner"
+	SeatRival Seat = "rival"
+)
+
+// Opponent returns the other seat
+func (s Seat) Opponent() Seat {
+	if s == SeatOwner {
+		return SeatRival
+	}
+	return SeatOwner
+}
+
+// ActionType represents the kind of action a player submits
+type ActionType string
+
+const (
+	ActionMulligan     ActionType = "mulligan"
+	ActionDraw         ActionType = "draw"
+	ActionPlayMonster  ActionType = "play_monster"
+	ActionPlaySpell    ActionType = "play_spell"
+	ActionAttachEnergy ActionType = "attach_energy"
+	ActionAttack       ActionType = "attack"
+	ActionRetreat      ActionType = "retreat"
+	ActionEndTurn      ActionType = "end_turn"
+	ActionConcede      ActionType = "concede"
+)
+
+// Action is a move submitted by a player
+type Action struct {
+	Type   ActionType `json:"type"`
+	CardID uint       `json:"card_id,omitempty"`
+	Slot   int        `json:"slot,omitempty"` // 0 is the active monster, 1-3 are bench slots; retreat swaps in this bench slot
+	Keep   bool       `json:"keep,omitempty"` // Only used by mulligan
+}
+
+// Rules of the match
+const (
+	HandSize     = 5
+	SlotCount    = 4 // Active monster plus three bench slots
+	ActiveSlot   = 0
+	DefaultHP    = 100 // HP of monsters without stats
+	BaseDamage   = 10  // Damage of monsters without an attack
+	EnergyDamage = 10  // Extra damage per attached energy for monsters without an attack
+)
+
+// RuleError reports an action rejected by the game rules
+type RuleError struct {
+	Reason string
+}
+
+func (e *RuleError) Error() string {
+	return e.Reason
+}
+
+// Rule violations returned by the engine
+var (
+	ErrMatchFinished         = &RuleError{"match is already finished"}
+	ErrNotYourTurn           = &RuleError{"it is not your turn"}
+	ErrWrongPhase            = &RuleError{"action not allowed in the current phase"}
+	ErrAlreadyReady          = &RuleError{"mulligan already resolved"}
+	ErrCardNotInHand         = &RuleError{"card is not in your hand"}
+	ErrInvalidCard           = &RuleError{"card cannot be used for this action"}
+	ErrInvalidSlot           = &RuleError{"invalid monster slot"}
+	ErrSlotOccupied          = &RuleError{"monster slot is already occupied"}
+	ErrSlotEmpty             = &RuleError{"monster slot is empty"}
+	ErrEnergyAlreadyAttached = &RuleError{"energy already attached this turn"}
+	ErrNoAttacker            = &RuleError{"you have no active monster"}
+	ErrNoTarget              = &RuleError{"opponent has no active monster"}
+	ErrNotEnoughEnergy       = &RuleError{"not enough energy attached"}
+	ErrUnknownAction         = &RuleError{"unknown action"}
+	ErrTimeExpired           = &RuleError{"time ran out, the match is over"}
+)
+
+// Errors returned when resolving a match rather than applying an action
+var (
+	ErrMatchNotStarted = errors.New("match has not started")
+	ErrNotSeated       = errors.New("user is not seated at this table")
+)
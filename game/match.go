@@ -0,0 +1,249 @@
+package game
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+)
+
+// Experience given to the players of a finished match
+const (
+	WinExperience  = 100
+	LossExperience = 25
+)
+
+// Matches runs the matches played at tables and persists their state
+type Matches struct {
+	Engine      *Engine
+	Tables      repository.TableRepository
+	TableStates repository.TableStateRepository
+	Decks       repository.DeckRepository
+	// Now tells the time of the match clocks; it defaults to the wall clock
+	Now func() time.Time
+
+	// locks serializes actions on the same table so concurrent requests cannot interleave.
+	// Tables share a fixed set of stripes so finished matches leave nothing behind. The locks
+	// only hold within this process; across server instances, the version of the saved state
+	// makes the later of two concurrent actions fail with models.ErrStaleTableState.
+	locks [tableLockStripes]sync.Mutex
+}
+
+// tableLockStripes is the number of mutexes the tables are spread over
+const tableLockStripes = 64
+
+// NewMatches creates the match runner backed by the given repositories
+func NewMatches(repos *repository.Repositories) *Matches {
+	return &Matches{
+		Engine:      NewEngine(repos.Cards, repos.Effects),
+		Tables:      repos.Tables,
+		TableStates: repos.TableStates,
+		Decks:       repos.Decks,
+	}
+}
+
+func (m *Matches) lockTable(tableID uint) func() {
+	mu := &m.locks[tableID%tableLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// StartMatch deals a new match for a table using both players' decks and persists its
+// initial state. Both clocks are set to the initial time of the table.
+func (m *Matches) StartMatch(tableID, ownersDeckID, rivalsDeckID uint) (*models.TableState, error) {
+	unlock := m.lockTable(tableID)
+	defer unlock()
+
+	existing, err := m.TableStates.GetTableStateByTableID(tableID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("match already started for table %d", tableID)
+	}
+
+	ownersDeck, err := m.expandDeck(ownersDeckID)
+	if err != nil {
+		return nil, err
+	}
+	rivalsDeck, err := m.expandDeck(rivalsDeckID)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &models.TableState{
+		TableID:      tableID,
+		OwnersDeckID: &ownersDeckID,
+		RivalsDeckID: &rivalsDeckID,
+	}
+	message := m.Engine.Setup(state, ownersDeck, rivalsDeck)
+	appendLog(state, "server", message)
+
+	clock, err := m.newClock(state, m.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := m.TableStates.StartTableState(state, clock); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// PerformAction applies an action submitted by a user to the match at a table.
+// The action is validated by the engine and only persisted if it was accepted. If the
+// player whose turn it is ran out of time, or the mulligan took longer than MulliganTime,
+// the match ends instead, the late player loses it, and the finished state is returned
+// with ErrTimeExpired.
+func (m *Matches) PerformAction(tableID, userID uint, action Action) (*models.TableState, Seat, error) {
+	seat, err := m.SeatForUser(tableID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	unlock := m.lockTable(tableID)
+	defer unlock()
+
+	state, err := m.TableStates.GetTableStateByTableID(tableID)
+	if err != nil {
+		return nil, seat, err
+	}
+	if state == nil {
+		return nil, seat, ErrMatchNotStarted
+	}
+
+	now := m.now()
+	clock, err := m.Tables.GetTableClock(tableID)
+	if err != nil {
+		return nil, seat, err
+	}
+	if clock != nil && Phase(state.Phase) != PhaseFinished {
+		if loser, ok := expired(clock, state, now); ok {
+			if err := m.timeOut(state, clock, loser, now); err != nil {
+				return nil, seat, err
+			}
+			return state, seat, ErrTimeExpired
+		}
+	}
+
+	// Log against the turn the action was taken in, not the one it may start
+	turn := state.Turn
+	message, err := m.Engine.Apply(state, seat, action)
+	if err != nil {
+		return nil, seat, err
+	}
+	appendLogAt(state, turn, string(seat), message)
+
+	if err := m.TableStates.UpdateTableState(state); err != nil {
+		return nil, seat, err
+	}
+
+	if clock != nil {
+		syncClock(clock, state, now)
+		if err := m.Tables.UpdateTableClock(clock); err != nil {
+			return nil, seat, err
+		}
+	}
+
+	return state, seat, nil
+}
+
+// FinishMatch settles a finished match: the table gets its winner and the prize and
+// experience are paid out. It is safe to call again, for example after a failed attempt,
+// since a table is only settled once. It returns nil if the match is still being played
+// or was already settled.
+func (m *Matches) FinishMatch(tableID uint) (*models.MatchResult, error) {
+	unlock := m.lockTable(tableID)
+	defer unlock()
+
+	state, err := m.TableStates.GetTableStateByTableID(tableID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, ErrMatchNotStarted
+	}
+	if Phase(state.Phase) != PhaseFinished || state.WinnerSeat == nil {
+		return nil, nil
+	}
+
+	ownerWon := Seat(*state.WinnerSeat) == SeatOwner
+	return m.Tables.FinishTable(tableID, ownerWon, models.MatchRewards{
+		WinnerExperience: WinExperience,
+		LoserExperience:  LossExperience,
+	})
+}
+
+// LoadMatch returns the match state of a table together with the seat of the requesting user
+func (m *Matches) LoadMatch(tableID, userID uint) (*models.TableState, Seat, error) {
+	seat, err := m.SeatForUser(tableID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	state, err := m.TableStates.GetTableStateByTableID(tableID)
+	if err != nil {
+		return nil, seat, err
+	}
+	if state == nil {
+		return nil, seat, ErrMatchNotStarted
+	}
+
+	return state, seat, nil
+}
+
+// SeatForUser resolves which seat a user occupies at a table
+func (m *Matches) SeatForUser(tableID, userID uint) (Seat, error) {
+	ownerID, rivalID, err := m.Tables.GetTablePlayers(tableID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotSeated
+		}
+		return "", err
+	}
+
+	if ownerID == userID {
+		return SeatOwner, nil
+	}
+	if rivalID != nil && *rivalID == userID {
+		return SeatRival, nil
+	}
+
+	return "", ErrNotSeated
+}
+
+// expandDeck turns the deck_cards rows of a deck into one card ID per copy
+func (m *Matches) expandDeck(deckID uint) ([]uint, error) {
+	deckCards, err := m.Decks.GetDeckCards(int(deckID))
+	if err != nil {
+		return nil, fmt.Errorf("error loading deck %d: %v", deckID, err)
+	}
+
+	var cards []uint
+	for _, deckCard := range deckCards {
+		for i := 0; i < deckCard.Number; i++ {
+			cards = append(cards, uint(deckCard.CardID))
+		}
+	}
+
+	return cards, nil
+}
+
+// appendLog adds a line for the current turn to the match log
+func appendLog(state *models.TableState, actor, message string) {
+	appendLogAt(state, state.Turn, actor, message)
+}
+
+func appendLogAt(state *models.TableState, turn int, actor, message string) {
+	line := fmt.Sprintf("[turn %d] %s: %s", turn, actor, message)
+	if strings.TrimSpace(state.Log) == "" {
+		state.Log = line
+		return
+	}
+	state.Log += "\n" + line
+}
@@ -0,0 +1,93 @@
+package game
+
+import (
+	"errors"
+	"testing"
+
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+)
+
+// racingStates lets another server instance act on a table right after its state is read
+type racingStates struct {
+	repository.TableStateRepository
+	race func()
+}
+
+func (r *racingStates) GetTableStateByTableID(tableID uint) (*models.TableState, error) {
+	state, err := r.TableStateRepository.GetTableStateByTableID(tableID)
+	if race := r.race; race != nil {
+		r.race = nil
+		race()
+	}
+	return state, err
+}
+
+// dealtTable seats two players at a new table of the store and deals their match
+func dealtTable(t *testing.T, repos *repository.Repositories) (tableID, ownerID, rivalID uint) {
+	t.Helper()
+	ownerID, rivalID = 1, 2
+	tableID, err := repos.Tables.CreateTable("C", "public", models.PrizeAura, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	if err := repos.Tables.CreateUserTable(ownerID, tableID, nil, 0); err != nil {
+		t.Fatalf("CreateUserTable: %v", err)
+	}
+	if joined, err := repos.Tables.JoinTable(tableID, rivalID, 0, nil); err != nil || !joined {
+		t.Fatalf("JoinTable = %v, %v", joined, err)
+	}
+	if _, err := NewMatches(repos).StartMatch(tableID, 0, 0); err != nil {
+		t.Fatalf("StartMatch: %v", err)
+	}
+	return tableID, ownerID, rivalID
+}
+
+func TestStartMatchWithoutTableLeavesNoState(t *testing.T) {
+	repos := repository.NewMemory().Repositories()
+
+	if _, err := NewMatches(repos).StartMatch(1, 0, 0); err == nil {
+		t.Fatal("StartMatch dealt a match for a table that does not exist")
+	}
+
+	state, err := repos.TableStates.GetTableStateByTableID(1)
+	if err != nil {
+		t.Fatalf("GetTableStateByTableID: %v", err)
+	}
+	if state != nil {
+		t.Errorf("StartMatch left a state behind: %+v", state)
+	}
+}
+
+func TestActionRacingAnotherInstance(t *testing.T) {
+	repos := repository.NewMemory().Repositories()
+	tableID, ownerID, rivalID := dealtTable(t, repos)
+
+	// Two instances share the store but not their table locks
+	matches := NewMatches(repos)
+	states := &racingStates{TableStateRepository: repos.TableStates}
+	matches.TableStates = states
+	states.race = func() {
+		if _, _, err := NewMatches(repos).PerformAction(tableID, rivalID, Action{Type: ActionMulligan, Keep: true}); err != nil {
+			t.Errorf("rival's mulligan on the other instance: %v", err)
+		}
+	}
+
+	_, _, err := matches.PerformAction(tableID, ownerID, Action{Type: ActionMulligan, Keep: true})
+	if !errors.Is(err, models.ErrStaleTableState) {
+		t.Fatalf("PerformAction on a stale state = %v, want ErrStaleTableState", err)
+	}
+
+	state, err := repos.TableStates.GetTableStateByTableID(tableID)
+	if err != nil {
+		t.Fatalf("GetTableStateByTableID: %v", err)
+	}
+	if !state.RivalsReady || state.OwnersReady {
+		t.Errorf("ready = owner %v, rival %v; want only the rival's mulligan saved", state.OwnersReady, state.RivalsReady)
+	}
+
+	// Sent again, the action applies to the state it missed
+	if _, _, err := matches.PerformAction(tableID, ownerID, Action{Type: ActionMulligan, Keep: true}); err != nil {
+		t.Fatalf("PerformAction sent again: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package game
+
+import "tcg-server-go/models"
+
+// SlotView is a monster slot as seen by a player
+type SlotView struct {
+	Cards []uint `json:"cards"` // Monster card first, followed by its attached cards
+	HP    *int   `json:"hp,omitempty"`
+}
+
+// BoardView is the public part of one seat's board
+type BoardView struct {
+	Active    SlotView   `json:"active"`
+	Bench     []SlotView `json:"bench"`
+	Graveyard []uint     `json:"graveyard"`
+	HandCount int        `json:"hand_count"`
+	DeckCount int        `json:"deck_count"`
+	Ready     bool       `json:"ready"`
+}
+
+// View is the match state as seen from one seat. It hides the opponent's hand and both decks.
+type View struct {
+	TableID    uint      `json:"table_id"`
+	Seat       Seat      `json:"seat"`
+	Phase      Phase     `json:"phase"`
+	Turn       int       `json:"turn"`
+	ActiveSeat *string   `json:"active_seat,omitempty"`
+	WinnerSeat *string   `json:"winner_seat,omitempty"`
+	Hand       []uint    `json:"hand"`
+	Own        BoardView `json:"own"`
+	Opponent   BoardView `json:"opponent"`
+	Log        string    `json:"log"`
+	// Clock is the time left of both players as of when the view was built
+	Clock *models.TableClock `json:"clock,omitempty"`
+}
+
+// ViewFor builds the view of a match state for the given seat
+func ViewFor(state *models.TableState, seat Seat) *View {
+	own := sideOf(state, seat)
+	return &View{
+		TableID:    state.TableID,
+		Seat:       seat,
+		Phase:      Phase(state.Phase),
+		Turn:       state.Turn,
+		ActiveSeat: state.ActiveSeat,
+		WinnerSeat: state.WinnerSeat,
+		Hand:       append([]uint{}, *own.hand...),
+		Own:        boardView(own),
+		Opponent:   boardView(sideOf(state, seat.Opponent())),
+		Log:        state.Log,
+	}
+}
+
+// ViewWithClock builds the view of a match state for the given seat, with its clock
+func ViewWithClock(state *models.TableState, seat Seat, clock *models.TableClock) *View {
+	view := ViewFor(state, seat)
+	view.Clock = clock
+	return view
+}
+
+func boardView(s side) BoardView {
+	board := BoardView{
+		Active:    SlotView{Cards: append([]uint{}, *s.slots[ActiveSlot]...), HP: *s.hp[ActiveSlot]},
+		Bench:     make([]SlotView, 0, SlotCount-1),
+		Graveyard: append([]uint{}, *s.graveyard...),
+		HandCount: len(*s.hand),
+		DeckCount: len(*s.deck),
+		Ready:     *s.ready,
+	}
+	for i := 1; i < SlotCount; i++ {
+		board.Bench = append(board.Bench, SlotView{Cards: append([]uint{}, *s.slots[i]...), HP: *s.hp[i]})
+	}
+	return board
+}
@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"tcg-server-go/effectscript"
+	"tcg-server-go/middleware"
+	"tcg-server-go/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// AdminCreateCardHandler adds a card to the catalogue
+func (h *Handler) AdminCreateCardHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var createReq models.CreateCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&createReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	// Card names identify cards to players, so they must be unique
+	existing, err := h.Repos.Cards.GetCardByName(createReq.Name)
+	if err != nil {
+		http.Error(w, "Error checking card name", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A card with this name already exists"})
+		return
+	}
+
+	card := &models.Card{
+		Name:         createReq.Name,
+		Type:         createReq.Type,
+		Legend:       createReq.Legend,
+		Element:      createReq.Element,
+		HP:           createReq.HP,
+		AttackName:   createReq.AttackName,
+		AttackDamage: createReq.AttackDamage,
+		AttackCost:   createReq.AttackCost,
+		RetreatCost:  createReq.RetreatCost,
+		Rarity:       createReq.Rarity,
+		SetCode:      createReq.SetCode,
+	}
+
+	audit, ok := auditEntry(w, principal, models.AuditActionCreate, models.AuditEntityCard, 0, nil)
+	if !ok {
+		return
+	}
+	if err := h.Repos.Cards.CreateCard(card, audit); err != nil {
+		http.Error(w, "Error creating card", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.CardResponse{
+		Card:    card,
+		Message: "Card created successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminUpdateCardHandler changes the fields of a card given in the request
+func (h *Handler) AdminUpdateCardHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid card ID", http.StatusBadRequest)
+		return
+	}
+
+	var updateReq models.UpdateCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&updateReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	before, err := h.Repos.Cards.GetCardByID(id)
+	if err != nil {
+		http.Error(w, "Error retrieving card", http.StatusInternalServerError)
+		return
+	}
+	if before == nil {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return
+	}
+
+	if updateReq.Name != nil && *updateReq.Name != before.Name {
+		existing, err := h.Repos.Cards.GetCardByName(*updateReq.Name)
+		if err != nil {
+			http.Error(w, "Error checking card name", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil && existing.ID != id {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "A card with this name already exists"})
+			return
+		}
+	}
+
+	audit, ok := auditEntry(w, principal, models.AuditActionUpdate, models.AuditEntityCard, id, before)
+	if !ok {
+		return
+	}
+	err = h.Repos.Cards.UpdateCardPartial(id, &updateReq, audit)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating card", http.StatusInternalServerError)
+		return
+	}
+
+	card, err := h.Repos.Cards.GetCardByID(id)
+	if err != nil || card == nil {
+		http.Error(w, "Error retrieving card", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.CardResponse{
+		Card:    card,
+		Message: "Card updated successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminDeleteCardHandler removes a card from the catalogue. Cards players still hold are
+// refused with a conflict, since deleting them would take those copies away.
+func (h *Handler) AdminDeleteCardHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid card ID", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.Repos.Cards.GetCardByID(id)
+	if err != nil {
+		http.Error(w, "Error retrieving card", http.StatusInternalServerError)
+		return
+	}
+	if before == nil {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return
+	}
+
+	audit, ok := auditEntry(w, principal, models.AuditActionDelete, models.AuditEntityCard, id, before)
+	if !ok {
+		return
+	}
+	err = h.Repos.Cards.DeleteCard(id, audit)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrCardInUse) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Players still hold this card: in a collection, a deck, a trade, a listing or a table stake"})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error deleting card", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Card deleted successfully"})
+}
+
+// AdminGetEffectsHandler lists every effect that has not been deleted
+func (h *Handler) AdminGetEffectsHandler(w http.ResponseWriter, r *http.Request) {
+	effects, err := h.Repos.Effects.GetAllEffects()
+	if err != nil {
+		http.Error(w, "Error retrieving effects", http.StatusInternalServerError)
+		return
+	}
+	if effects == nil {
+		effects = []models.Effect{}
+	}
+
+	response := models.EffectsResponse{
+		Effects: effects,
+		Message: "Effects retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminCreateEffectHandler adds an effect
+func (h *Handler) AdminCreateEffectHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var effectReq models.EffectRequest
+	if err := json.NewDecoder(r.Body).Decode(&effectReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&effectReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	script, ok := parseEffectScript(w, effectReq.Script)
+	if !ok {
+		return
+	}
+
+	audit, ok := auditEntry(w, principal, models.AuditActionCreate, models.AuditEntityEffect, 0, nil)
+	if !ok {
+		return
+	}
+	effect := &models.Effect{Description: effectReq.Description, Script: script}
+	if err := h.Repos.Effects.CreateEffect(effect, audit); err != nil {
+		http.Error(w, "Error creating effect", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.EffectResponse{
+		Effect:  effect,
+		Message: "Effect created successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminUpdateEffectHandler replaces the description and script of an effect
+func (h *Handler) AdminUpdateEffectHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid effect ID", http.StatusBadRequest)
+		return
+	}
+
+	var effectReq models.EffectRequest
+	if err := json.NewDecoder(r.Body).Decode(&effectReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&effectReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	before, err := h.Repos.Effects.GetEffectByID(id)
+	if err != nil {
+		http.Error(w, "Error retrieving effect", http.StatusInternalServerError)
+		return
+	}
+	if before == nil {
+		http.Error(w, "Effect not found", http.StatusNotFound)
+		return
+	}
+
+	script, ok := parseEffectScript(w, effectReq.Script)
+	if !ok {
+		return
+	}
+
+	effect := *before
+	effect.Description = effectReq.Description
+	effect.Script = script
+	audit, ok := auditEntry(w, principal, models.AuditActionUpdate, models.AuditEntityEffect, id, before)
+	if !ok {
+		return
+	}
+	err = h.Repos.Effects.UpdateEffect(&effect, audit)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Effect not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating effect", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.EffectResponse{
+		Effect:  &effect,
+		Message: "Effect updated successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminDeleteEffectHandler soft deletes an effect, which hides it from every card
+func (h *Handler) AdminDeleteEffectHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid effect ID", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.Repos.Effects.GetEffectByID(id)
+	if err != nil {
+		http.Error(w, "Error retrieving effect", http.StatusInternalServerError)
+		return
+	}
+	if before == nil {
+		http.Error(w, "Effect not found", http.StatusNotFound)
+		return
+	}
+
+	audit, ok := auditEntry(w, principal, models.AuditActionDelete, models.AuditEntityEffect, id, before)
+	if !ok {
+		return
+	}
+	if err := h.Repos.Effects.SoftDeleteEffect(id, audit); err != nil {
+		http.Error(w, "Error deleting effect", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Effect deleted successfully"})
+}
+
+// AdminAddCardEffectHandler gives an effect to a card
+func (h *Handler) AdminAddCardEffectHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	cardID, effectID, ok := h.cardEffectIDs(w, r)
+	if !ok {
+		return
+	}
+
+	effects, err := h.Repos.Effects.GetEffectsByCardID(cardID)
+	if err != nil {
+		http.Error(w, "Error retrieving card effects", http.StatusInternalServerError)
+		return
+	}
+	for _, effect := range effects {
+		if effect.ID == effectID {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "The card already has this effect"})
+			return
+		}
+	}
+
+	audit, ok := auditEntry(w, principal, models.AuditActionLink, models.AuditEntityCardEffect, cardID, nil)
+	if !ok {
+		return
+	}
+	if err := h.Repos.Effects.CreateCardEffect(cardID, effectID, audit); err != nil {
+		http.Error(w, "Error adding effect to card", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Effect added to card successfully"})
+}
+
+// AdminRemoveCardEffectHandler takes an effect away from a card
+func (h *Handler) AdminRemoveCardEffectHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	cardID, effectID, ok := h.cardEffectIDs(w, r)
+	if !ok {
+		return
+	}
+
+	link := models.CardEffect{CardID: cardID, EffectID: effectID}
+	audit, ok := auditEntry(w, principal, models.AuditActionUnlink, models.AuditEntityCardEffect, cardID, link)
+	if !ok {
+		return
+	}
+	if err := h.Repos.Effects.DeleteCardEffect(cardID, effectID, audit); err != nil {
+		http.Error(w, "Error removing effect from card", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Effect removed from card successfully"})
+}
+
+// AdminGetAuditLogHandler lists the changes made through the admin API, newest first,
+// optionally filtered by entity_type, entity_id and user_id
+func (h *Handler) AdminGetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		EntityType: query.Get("entity_type"),
+		Limit:      defaultAuditLimit,
+	}
+
+	for name, target := range map[string]*int{"entity_id": &filter.EntityID, "user_id": &filter.UserID} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				http.Error(w, name+" must be a positive number", http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	// Validate pagination
+	page := 1
+	if value := query.Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "page must be a positive number", http.StatusBadRequest)
+			return
+		}
+		page = parsed
+	}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxAuditLimit {
+			http.Error(w, "limit must be a number between 1 and "+strconv.Itoa(maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = parsed
+	}
+	filter.Offset = (page - 1) * filter.Limit
+
+	entries, total, err := h.Repos.Audit.GetAuditEntries(filter)
+	if err != nil {
+		http.Error(w, "Error retrieving audit log", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.AuditLogResponse{
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Limit:   filter.Limit,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// cardEffectIDs reads the card and effect of a card effect route, replying with an error
+// if either does not exist
+func (h *Handler) cardEffectIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+
+	cardID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid card ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	effectID, err := strconv.Atoi(vars["effectId"])
+	if err != nil {
+		http.Error(w, "Invalid effect ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	card, err := h.Repos.Cards.GetCardByID(cardID)
+	if err != nil {
+		http.Error(w, "Error retrieving card", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	if card == nil {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+
+	effect, err := h.Repos.Effects.GetEffectByID(effectID)
+	if err != nil {
+		http.Error(w, "Error retrieving effect", http.StatusInternalServerError)
+		return 0, 0, false
+	}
+	if effect == nil {
+		http.Error(w, "Effect not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+
+	return cardID, effectID, true
+}
+
+// parseEffectScript validates the script of an effect and returns it in the form it is
+// stored in. Effects may have no script. It responds with the problems of invalid scripts.
+func parseEffectScript(w http.ResponseWriter, raw json.RawMessage) (json.RawMessage, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, true
+	}
+
+	script, err := effectscript.Parse(raw)
+	var scriptErr *effectscript.Error
+	if errors.As(err, &scriptErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "Invalid effect script",
+			"problems": scriptErr.Problems,
+		})
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Error reading effect script", http.StatusBadRequest)
+		return nil, false
+	}
+
+	stored, err := json.Marshal(script)
+	if err != nil {
+		http.Error(w, "Error encoding effect script", http.StatusInternalServerError)
+		return nil, false
+	}
+	return stored, true
+}
+
+// auditEntry starts the audit entry of a change: who makes it and the value before it. The
+// repository method making the change adds the value after it and writes the entry in the
+// same transaction, so a change that cannot be audited fails with a server error.
+func auditEntry(w http.ResponseWriter, principal *middleware.Principal, action models.AuditAction, entityType string, entityID int, oldValue interface{}) (*models.AuditEntry, bool) {
+	userID := principal.UserID
+	entry := &models.AuditEntry{
+		UserID:     &userID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+	}
+
+	if oldValue != nil {
+		encoded, err := json.Marshal(oldValue)
+		if err != nil {
+			log.Printf("Failed to encode the audited %s %d: %v", entityType, entityID, err)
+			http.Error(w, "Error auditing change", http.StatusInternalServerError)
+			return nil, false
+		}
+		entry.OldValue = encoded
+	}
+
+	return entry, true
+}
@@ -2,14 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 
 	"tcg-server-go/auth"
-	"tcg-server-go/database"
+	"tcg-server-go/mailer"
 	"tcg-server-go/models"
 )
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var loginReq models.LoginRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
@@ -26,22 +29,28 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !auth.ValidateCredentials(loginReq.Email, loginReq.Password) {
+	if !auth.ValidateCredentials(h.Repos.Users, loginReq.Email, loginReq.Password) {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	token, err := auth.GenerateToken(loginReq.Email)
+	user, err := h.Repos.Users.GetUserByEmail(loginReq.Email)
+	if err != nil || user == nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := auth.IssueTokens(h.Repos, user)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models.LoginResponse{Token: token})
+	json.NewEncoder(w).Encode(tokens)
 }
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	var createReq models.CreateUserRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
@@ -59,7 +68,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user already exists
-	if auth.UserExists(createReq.Email) {
+	if auth.UserExists(h.Repos.Users, createReq.Email) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusConflict)
 		json.NewEncoder(w).Encode(map[string]string{"error": "User already exists"})
@@ -67,14 +76,17 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create the user
-	user, err := auth.CreateUser(&createReq)
+	user, err := auth.CreateUser(h.Repos, &createReq)
 	if err != nil {
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate token for the new user
-	token, err := auth.GenerateToken(user.Email)
+	// Email the validation code
+	h.sendVerificationEmail(user)
+
+	// Generate tokens for the new user
+	tokens, err := auth.IssueTokens(h.Repos, user)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
@@ -82,10 +94,79 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(models.LoginResponse{Token: token})
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and refresh token
+func (h *Handler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var refreshReq models.RefreshTokenRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&refreshReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&refreshReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	tokens, err := auth.RefreshTokens(h.Repos, refreshReq.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error refreshing token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
 }
 
-func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+// LogoutHandler revokes the access token of the Authorization header and the session of the
+// refresh token in the body. It does not require a valid access token, so clients can still
+// log out after their access token has expired.
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var logoutReq models.LogoutRequest
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&logoutReq); err != nil {
+			http.Error(w, "Error decoding request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var claims *models.Claims
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		claims, _ = auth.ValidateToken(authHeader[7:])
+	}
+
+	if claims == nil && logoutReq.RefreshToken == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A valid access token or a refresh token is required"})
+		return
+	}
+
+	if err := auth.Logout(h.Repos, claims, logoutReq.RefreshToken); err != nil {
+		http.Error(w, "Error logging out", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+func (h *Handler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 	var verifyReq models.VerifyEmailRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&verifyReq); err != nil {
@@ -103,7 +184,7 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the email
-	user, err := database.VerifyEmail(verifyReq.Email, verifyReq.ValidationCode)
+	user, err := h.Repos.Users.VerifyEmail(verifyReq.Email, verifyReq.ValidationCode)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -121,7 +202,7 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func ResendCodeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ResendCodeHandler(w http.ResponseWriter, r *http.Request) {
 	var resendReq models.ResendCodeRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&resendReq); err != nil {
@@ -139,7 +220,7 @@ func ResendCodeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Resend validation code
-	err := database.ResendValidationCode(resendReq.Email)
+	err := h.Repos.Users.ResendValidationCode(resendReq.Email)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -147,6 +228,14 @@ func ResendCodeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Email the new code
+	user, err := h.Repos.Users.GetUserByEmail(resendReq.Email)
+	if err != nil || user == nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+	h.sendVerificationEmail(user)
+
 	response := models.ResendCodeResponse{
 		Message: "Validation code sent successfully",
 	}
@@ -155,3 +244,108 @@ func ResendCodeHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// sendVerificationEmail sends a user their validation code. Failures are logged rather than
+// returned so registration still succeeds; the user can ask for the code again.
+func (h *Handler) sendVerificationEmail(user *models.User) {
+	if user.ValidationCode == nil {
+		return
+	}
+
+	message, err := mailer.VerificationEmail(user.Email, user.Name, *user.ValidationCode)
+	if err == nil {
+		err = h.Mailer.Send(message)
+	}
+	if err != nil {
+		log.Printf("Failed to send validation code to user %d: %v", user.ID, err)
+	}
+}
+
+// ForgotPasswordHandler emails a password reset token. It answers the same whether or not
+// the email is registered so it cannot be used to find out which emails have an account.
+func (h *Handler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var forgotReq models.ForgotPasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&forgotReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&forgotReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	user, err := h.Repos.Users.GetUserByEmail(forgotReq.Email)
+	if err != nil {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		return
+	}
+
+	if user != nil {
+		token, err := auth.CreatePasswordReset(h.Repos.PasswordResets, user.ID)
+		if err != nil {
+			http.Error(w, "Error creating password reset", http.StatusInternalServerError)
+			return
+		}
+
+		message, err := mailer.PasswordResetEmail(user.Email, user.Name, token, auth.ResetTokenTTL)
+		if err == nil {
+			err = h.Mailer.Send(message)
+		}
+		if err != nil {
+			log.Printf("Failed to send password reset to user %d: %v", user.ID, err)
+		}
+	}
+
+	response := models.PasswordResetResponse{
+		Message: "If the email is registered, a password reset token has been sent",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ResetPasswordHandler sets a new password with a reset token and revokes the user's tokens
+func (h *Handler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var resetReq models.ResetPasswordRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&resetReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&resetReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	err := auth.ResetPassword(h.Repos, resetReq.Token, resetReq.Password)
+	if errors.Is(err, auth.ErrInvalidResetToken) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.PasswordResetResponse{
+		Message: "Password reset successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -1,36 +1,168 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
-	"tcg-server-go/database"
 	"tcg-server-go/models"
 
 	"github.com/gorilla/mux"
 )
 
-// GetAllCardsHandler retrieves all cards
-func GetAllCardsHandler(w http.ResponseWriter, r *http.Request) {
-	cards, err := database.GetAllCards()
+const (
+	defaultCardLimit = 50
+	maxCardLimit     = 200
+)
+
+// GetAllCardsHandler queries the card catalogue a page at a time. Query parameters: type,
+// element, rarity and set (comma separated lists matching any of their values), min_hp,
+// max_hp, min_cost, max_cost, effect, q (full-text search on the name and legend), sort (id,
+// name, hp, attack or cost, with a leading - for descending order), limit, cursor and include.
+func (h *Handler) GetAllCardsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.CardFilter{
+		Search: query.Get("q"),
+		Sort:   query.Get("sort"),
+		Limit:  defaultCardLimit,
+	}
+
+	for _, value := range queryList(query, "type") {
+		if validate.Var(value, "oneof=Monster Spell Energy") != nil {
+			http.Error(w, "Invalid card type", http.StatusBadRequest)
+			return
+		}
+		filter.Types = append(filter.Types, models.CardType(value))
+	}
+	for _, value := range queryList(query, "element") {
+		if validate.Var(value, "oneof=Fire Water Wind Earth Neutral Holy Dark") != nil {
+			http.Error(w, "Invalid element", http.StatusBadRequest)
+			return
+		}
+		filter.Elements = append(filter.Elements, models.CardElement(value))
+	}
+	for _, value := range queryList(query, "rarity") {
+		if validate.Var(value, "oneof=Common Uncommon Rare Epic Legendary") != nil {
+			http.Error(w, "Invalid rarity", http.StatusBadRequest)
+			return
+		}
+		filter.Rarities = append(filter.Rarities, models.CardRarity(value))
+	}
+	for _, value := range queryList(query, "set") {
+		if len(value) > 10 {
+			http.Error(w, "Invalid set code", http.StatusBadRequest)
+			return
+		}
+		filter.Sets = append(filter.Sets, value)
+	}
+
+	ranges := map[string]**int{
+		"min_hp":   &filter.MinHP,
+		"max_hp":   &filter.MaxHP,
+		"min_cost": &filter.MinCost,
+		"max_cost": &filter.MaxCost,
+	}
+	for name, target := range ranges {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				http.Error(w, name+" must be a number of 0 or more", http.StatusBadRequest)
+				return
+			}
+			*target = &parsed
+		}
+	}
+
+	if filter.Search != "" && len(models.SearchWords(filter.Search)) == 0 {
+		http.Error(w, "q must contain letters or digits", http.StatusBadRequest)
+		return
+	}
+
+	if filter.Sort == "" {
+		filter.Sort = models.CardSortID
+	}
+	if _, _, ok := models.ParseCardSort(filter.Sort); !ok {
+		http.Error(w, "sort must be id, name, hp, attack or cost, with a leading - for descending order", http.StatusBadRequest)
+		return
+	}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxCardLimit {
+			http.Error(w, "limit must be a number between 1 and "+strconv.Itoa(maxCardLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeCardCursor(value)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		if cursor.Sort != filter.Sort {
+			http.Error(w, "cursor belongs to a query with a different sort", http.StatusBadRequest)
+			return
+		}
+		filter.After = cursor
+	}
+
+	includeEffects, ok := parseCardIncludes(w, r)
+	if !ok {
+		return
+	}
+
+	if value := query.Get("effect"); value != "" {
+		effectID, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid effect ID", http.StatusBadRequest)
+			return
+		}
+
+		effect, err := h.Repos.Effects.GetEffectByID(effectID)
+		if err != nil {
+			http.Error(w, "Error retrieving effect", http.StatusInternalServerError)
+			return
+		}
+		if effect == nil {
+			http.Error(w, "Effect not found", http.StatusNotFound)
+			return
+		}
+		filter.EffectID = effectID
+	}
+
+	cards, more, err := h.Repos.Cards.QueryCards(filter)
 	if err != nil {
 		http.Error(w, "Error retrieving cards", http.StatusInternalServerError)
 		return
 	}
 
-	response := models.CardsResponse{
+	if includeEffects && !h.embedEffects(w, cards) {
+		return
+	}
+
+	response := models.CardPageResponse{
 		Cards:   cards,
+		Limit:   filter.Limit,
 		Message: "Cards retrieved successfully",
 	}
+	if more {
+		next := encodeCardCursor(models.CardCursorFor(filter.Sort, cards[len(cards)-1]))
+		response.NextCursor = &next
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSONWithETag(w, r, response)
 }
 
 // GetCardByIDHandler retrieves a card by ID
-func GetCardByIDHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetCardByIDHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
@@ -40,7 +172,12 @@ func GetCardByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	card, err := database.GetCardByID(id)
+	includeEffects, ok := parseCardIncludes(w, r)
+	if !ok {
+		return
+	}
+
+	card, err := h.Repos.Cards.GetCardByID(id)
 	if err != nil {
 		http.Error(w, "Error retrieving card", http.StatusInternalServerError)
 		return
@@ -51,18 +188,20 @@ func GetCardByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if includeEffects && !h.embedEffects(w, []*models.Card{card}) {
+		return
+	}
+
 	response := models.CardResponse{
 		Card:    card,
 		Message: "Card retrieved successfully",
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSONWithETag(w, r, response)
 }
 
 // GetCardsByTypeHandler retrieves all cards of a specific type
-func GetCardsByTypeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetCardsByTypeHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	cardType := models.CardType(vars["type"])
 
@@ -72,12 +211,21 @@ func GetCardsByTypeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cards, err := database.GetCardsByType(cardType)
+	includeEffects, ok := parseCardIncludes(w, r)
+	if !ok {
+		return
+	}
+
+	cards, err := h.Repos.Cards.GetCardsByType(cardType)
 	if err != nil {
 		http.Error(w, "Error retrieving cards", http.StatusInternalServerError)
 		return
 	}
 
+	if includeEffects && !h.embedEffects(w, cards) {
+		return
+	}
+
 	response := models.CardsResponse{
 		Cards:   cards,
 		Message: "Cards retrieved successfully",
@@ -89,7 +237,7 @@ func GetCardsByTypeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetCardsByElementHandler retrieves all cards of a specific element
-func GetCardsByElementHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetCardsByElementHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	element := models.CardElement(vars["element"])
 
@@ -112,12 +260,21 @@ func GetCardsByElementHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cards, err := database.GetCardsByElement(element)
+	includeEffects, ok := parseCardIncludes(w, r)
+	if !ok {
+		return
+	}
+
+	cards, err := h.Repos.Cards.GetCardsByElement(element)
 	if err != nil {
 		http.Error(w, "Error retrieving cards", http.StatusInternalServerError)
 		return
 	}
 
+	if includeEffects && !h.embedEffects(w, cards) {
+		return
+	}
+
 	response := models.CardsResponse{
 		Cards:   cards,
 		Message: "Cards retrieved successfully",
@@ -129,19 +286,28 @@ func GetCardsByElementHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // SearchCardsHandler searches for cards by name
-func SearchCardsHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) SearchCardsHandler(w http.ResponseWriter, r *http.Request) {
 	searchTerm := r.URL.Query().Get("q")
 	if searchTerm == "" {
 		http.Error(w, "Search term is required", http.StatusBadRequest)
 		return
 	}
 
-	cards, err := database.SearchCards(searchTerm)
+	includeEffects, ok := parseCardIncludes(w, r)
+	if !ok {
+		return
+	}
+
+	cards, err := h.Repos.Cards.SearchCards(searchTerm)
 	if err != nil {
 		http.Error(w, "Error searching cards", http.StatusInternalServerError)
 		return
 	}
 
+	if includeEffects && !h.embedEffects(w, cards) {
+		return
+	}
+
 	response := models.CardsResponse{
 		Cards:   cards,
 		Message: "Cards found successfully",
@@ -151,3 +317,100 @@ func SearchCardsHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// parseCardIncludes reads the comma separated ?include= parameter of the card endpoints and
+// reports whether the effects of the cards were requested. Unknown values are rejected.
+func parseCardIncludes(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	includeEffects := false
+	for _, include := range strings.Split(r.URL.Query().Get("include"), ",") {
+		switch strings.TrimSpace(include) {
+		case "":
+		case "effects":
+			includeEffects = true
+		default:
+			http.Error(w, fmt.Sprintf("Unknown include: %s", include), http.StatusBadRequest)
+			return false, false
+		}
+	}
+	return includeEffects, true
+}
+
+// embedEffects loads the effects of every card in one query and attaches them. Cards without
+// effects are left as they are.
+func (h *Handler) embedEffects(w http.ResponseWriter, cards []*models.Card) bool {
+	cardIDs := make([]int, len(cards))
+	for i, card := range cards {
+		cardIDs[i] = card.ID
+	}
+
+	effects, err := h.Repos.Effects.GetEffectsByCardIDs(cardIDs)
+	if err != nil {
+		http.Error(w, "Error retrieving card effects", http.StatusInternalServerError)
+		return false
+	}
+
+	for _, card := range cards {
+		card.Effects = effects[card.ID]
+	}
+	return true
+}
+
+// queryList splits a comma separated query parameter, leaving out empty values
+func queryList(query url.Values, name string) []string {
+	values := []string{}
+	for _, value := range strings.Split(query.Get(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// encodeCardCursor turns the position of a card into the opaque cursor handed to clients
+func encodeCardCursor(cursor models.CardCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCardCursor reads a cursor made by encodeCardCursor
+func decodeCardCursor(value string) (*models.CardCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor models.CardCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
+	}
+	if _, _, ok := models.ParseCardSort(cursor.Sort); !ok || cursor.ID < 1 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// writeJSONWithETag writes a JSON response tagged with a hash of its body. A client that sends
+// the tag back in If-None-Match gets 304 Not Modified without the body while it still matches.
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"tcg-server-go/deckcode"
+	"tcg-server-go/models"
+)
+
+// ExportDeckHandler returns a deck of the authenticated user as a deck code and as a
+// plain-text card list
+func (h *Handler) ExportDeckHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	deckID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid deck ID", http.StatusBadRequest)
+		return
+	}
+
+	deck, err := h.Repos.Decks.GetDeckByID(deckID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving deck: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if deck == nil {
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	}
+	if deck.UserID != principal.UserID {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	deckCards, err := h.Repos.Decks.GetDeckCards(deckID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving deck cards: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.DeckExportResponse{
+		Export: &models.DeckExport{
+			DeckID: deck.ID,
+			Name:   deck.Name,
+			Format: deck.Format,
+			Code:   deckcode.Encode(deck.Format, deckCards),
+			List:   deckcode.FormatList(deckCards),
+		},
+		Message: "Deck exported successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ImportDeckHandler creates a deck from a deck code or a plain-text card list. When the deck
+// cannot be built, the response lists the cards that do not exist, or the cards the user
+// does not have enough copies of along with the other rules of the format it breaks.
+func (h *Handler) ImportDeckHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
+
+	var req models.ImportDeckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
+		return
+	}
+	if (req.Code == "") == (req.List == "") {
+		http.Error(w, "Exactly one of code and list is required", http.StatusBadRequest)
+		return
+	}
+
+	var deckCards []models.DeckCard
+	format := req.Format
+	if req.Code != "" {
+		shared, err := deckcode.Decode(req.Code)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Cannot import deck: %v", err), http.StatusBadRequest)
+			return
+		}
+		if format == "" {
+			format = shared.Format
+		}
+
+		cardIDs := make([]int, len(shared.Cards))
+		for i, deckCard := range shared.Cards {
+			cardIDs[i] = deckCard.CardID
+		}
+		cards, err := h.Repos.Cards.GetCardsByIDs(cardIDs)
+		if err != nil {
+			http.Error(w, "Error retrieving cards", http.StatusInternalServerError)
+			return
+		}
+
+		unknown := []int{}
+		for _, deckCard := range shared.Cards {
+			card, ok := cards[deckCard.CardID]
+			if !ok {
+				unknown = append(unknown, deckCard.CardID)
+				continue
+			}
+			deckCard.Card = card
+			deckCards = append(deckCards, deckCard)
+		}
+		if len(unknown) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":            "Cannot import deck: some of its cards do not exist",
+				"unknown_card_ids": unknown,
+			})
+			return
+		}
+	} else {
+		entries, err := deckcode.ParseList(req.List)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Cannot import deck: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		unknown := []string{}
+		for _, entry := range entries {
+			card, err := h.Repos.Cards.GetCardByName(entry.Name)
+			if err != nil {
+				http.Error(w, "Error retrieving card", http.StatusInternalServerError)
+				return
+			}
+			if card == nil {
+				unknown = append(unknown, entry.Name)
+				continue
+			}
+			deckCards = addDeckCard(deckCards, card, entry.Count)
+		}
+		if len(unknown) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":         "Cannot import deck: some of its cards do not exist",
+				"unknown_cards": unknown,
+			})
+			return
+		}
+	}
+	if format == "" {
+		format = models.DefaultFormat
+	}
+
+	cardIDs := make([]int, len(deckCards))
+	cardCounts := make([]int, len(deckCards))
+	for i, deckCard := range deckCards {
+		cardIDs[i], cardCounts[i] = deckCard.CardID, deckCard.Number
+	}
+
+	deck, err := h.Repos.Decks.CreateDeckWithValidation(userID, req.Name, format, cardIDs, cardCounts)
+	if err != nil {
+		var violationErr *models.DeckViolationError
+		if errors.As(err, &violationErr) {
+			missing, err := h.missingCards(userID, deckCards)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error checking your cards: %v", err), http.StatusInternalServerError)
+				return
+			}
+
+			message := "Cannot import deck: it breaks the rules of its format"
+			if len(missing) > 0 {
+				message = "Cannot import deck: you do not have all the required cards"
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":      message,
+				"missing":    missing,
+				"violations": violationErr.Violations,
+			})
+			return
+		}
+		if writeDeckError(w, "import", err) {
+			return
+		}
+		if strings.Contains(err.Error(), "deck limit reached") {
+			http.Error(w, fmt.Sprintf("Cannot import deck: %v", err.Error()), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error importing deck: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.DeckResponse{
+		Deck:    deck,
+		Message: "Deck imported successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// missingCards lists the cards of a deck the user does not have enough copies of
+func (h *Handler) missingCards(userID int, deckCards []models.DeckCard) ([]models.MissingCard, error) {
+	cardIDs := make([]int, len(deckCards))
+	for i, deckCard := range deckCards {
+		cardIDs[i] = deckCard.CardID
+	}
+	userCards, err := h.Repos.UserInfo.GetUserCardsByCardIDs(userID, cardIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []models.MissingCard{}
+	for _, deckCard := range deckCards {
+		owned := 0
+		if userCard, ok := userCards[deckCard.CardID]; ok {
+			owned = userCard.Amount
+		}
+		if owned < deckCard.Number {
+			missing = append(missing, models.MissingCard{
+				CardID: deckCard.CardID,
+				Name:   deckCard.Card.Name,
+				Needed: deckCard.Number,
+				Owned:  owned,
+			})
+		}
+	}
+	return missing, nil
+}
+
+// addDeckCard adds copies of a card to a deck, merging them with the copies already in it
+// since different names in a list can match the same card
+func addDeckCard(deckCards []models.DeckCard, card *models.Card, count int) []models.DeckCard {
+	for i := range deckCards {
+		if deckCards[i].CardID == card.ID {
+			deckCards[i].Number += count
+			return deckCards
+		}
+	}
+	return append(deckCards, models.DeckCard{CardID: card.ID, Number: count, Card: card})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"tcg-server-go/models"
+
+	"github.com/gorilla/mux"
+)
+
+// GetEffectsHandler lists the effects catalogue. Deleted effects are left out.
+func (h *Handler) GetEffectsHandler(w http.ResponseWriter, r *http.Request) {
+	effects, err := h.Repos.Effects.GetAllEffects()
+	if err != nil {
+		http.Error(w, "Error retrieving effects", http.StatusInternalServerError)
+		return
+	}
+	if effects == nil {
+		effects = []models.Effect{}
+	}
+
+	response := models.EffectsResponse{
+		Effects: effects,
+		Message: "Effects retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetEffectHandler retrieves an effect by ID. Deleted effects are not found.
+func (h *Handler) GetEffectHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid effect ID", http.StatusBadRequest)
+		return
+	}
+
+	effect, err := h.Repos.Effects.GetEffectByID(id)
+	if err != nil {
+		http.Error(w, "Error retrieving effect", http.StatusInternalServerError)
+		return
+	}
+	if effect == nil {
+		http.Error(w, "Effect not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.EffectResponse{
+		Effect:  effect,
+		Message: "Effect retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"testing"
+
+	"tcg-server-go/models"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	// verificationCode finds the code in a verification email
+	verificationCode = regexp.MustCompile(`verification code is: (\S+)`)
+	// resetToken finds the token in a password reset email, alone on its line
+	resetToken = regexp.MustCompile(`(?m)^([A-Za-z0-9_-]{32,})\r?$`)
+)
+
+// call sends a request through the router, fails unless it is answered with the status,
+// and decodes the JSON response into out if given
+func (s *testServer) call(t *testing.T, method, path, token, body string, status int, out interface{}) {
+	t.Helper()
+	rec := s.do(t, method, path, token, body)
+	if rec.Code != status {
+		t.Fatalf("%s %s = %d, want %d: %s", method, path, rec.Code, status, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %s: %v", method, path, rec.Body.String(), err)
+		}
+	}
+}
+
+// lastEmail returns the text of the last email the server sent
+func (s *testServer) lastEmail(t *testing.T, to string) string {
+	t.Helper()
+	sent := s.outbox.Sent()
+	if len(sent) == 0 {
+		t.Fatal("no email sent")
+	}
+	message := sent[len(sent)-1]
+	if message.To != to {
+		t.Fatalf("last email went to %s, want %s", message.To, to)
+	}
+	return message.Text
+}
+
+// routeTemplates lists every route of the router as "METHOD template"
+func routeTemplates(t *testing.T, router *mux.Router) []string {
+	t.Helper()
+	var routes []string
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // A subrouter
+		}
+		for _, method := range methods {
+			routes = append(routes, method+" "+template)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes
+}
+
+// TestEndpoints plays every endpoint of the API against the in-memory store, in the order a
+// player and an admin would use them, and checks that no route was left out
+func TestEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	_, adminToken := s.user(t, "Archivist", true)
+	owner, ownerToken := s.user(t, "Ownerone", false)
+	rival, rivalToken := s.user(t, "Rivaltwo", false)
+
+	var drakeID, sparkID, effectID int
+	var ownerDeckID, rivalDeckID int
+
+	t.Run("account", func(t *testing.T) {
+		s.call(t, "GET", "/health", "", "", http.StatusOK, nil)
+
+		s.call(t, "POST", "/register", "", `{"name": "Newcomer", "email": "newcomer@example.com", "password": "secret1"}`,
+			http.StatusCreated, nil)
+		s.call(t, "POST", "/resend-code", "", `{"email": "newcomer@example.com"}`, http.StatusOK, nil)
+		code := verificationCode.FindStringSubmatch(s.lastEmail(t, "newcomer@example.com"))
+		if code == nil {
+			t.Fatal("no code in the verification email")
+		}
+		s.call(t, "POST", "/verify-email", "", fmt.Sprintf(`{"email": "newcomer@example.com", "validation_code": %q}`, code[1]),
+			http.StatusOK, nil)
+
+		var tokens models.LoginResponse
+		s.call(t, "POST", "/login", "", `{"email": "newcomer@example.com", "password": "secret1"}`, http.StatusOK, &tokens)
+		s.call(t, "GET", "/api/validate", tokens.Token, "", http.StatusOK, nil)
+
+		var info models.UserInfoResponse
+		s.call(t, "GET", "/api/user-info", tokens.Token, "", http.StatusOK, &info)
+		if info.UserInfo == nil || info.UserInfo.Money != 100 {
+			t.Errorf("user info = %+v, want the starting money", info.UserInfo)
+		}
+
+		var refreshed models.LoginResponse
+		s.call(t, "POST", "/token/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, tokens.RefreshToken), http.StatusOK, &refreshed)
+		if refreshed.RefreshToken == tokens.RefreshToken {
+			t.Error("refresh did not rotate the refresh token")
+		}
+
+		s.call(t, "POST", "/forgot-password", "", `{"email": "newcomer@example.com"}`, http.StatusOK, nil)
+		token := resetToken.FindStringSubmatch(s.lastEmail(t, "newcomer@example.com"))
+		if token == nil {
+			t.Fatal("no token in the password reset email")
+		}
+		s.call(t, "POST", "/reset-password", "", fmt.Sprintf(`{"token": %q, "password": "secret2"}`, token[1]), http.StatusOK, nil)
+		s.call(t, "POST", "/login", "", `{"email": "newcomer@example.com", "password": "secret1"}`, http.StatusUnauthorized, nil)
+		s.call(t, "POST", "/login", "", `{"email": "newcomer@example.com", "password": "secret2"}`, http.StatusOK, &tokens)
+
+		s.call(t, "POST", "/logout", tokens.Token, fmt.Sprintf(`{"refresh_token": %q}`, tokens.RefreshToken), http.StatusOK, nil)
+		s.call(t, "GET", "/api/validate", tokens.Token, "", http.StatusUnauthorized, nil)
+	})
+
+	t.Run("catalogue", func(t *testing.T) {
+		var card models.CardResponse
+		s.call(t, "POST", "/admin/cards", adminToken,
+			`{"name": "Ember Drake", "type": "Monster", "legend": "Breathes embers", "element": "Fire", "hp": 80, "attack_name": "Singe", "attack_damage": 20, "attack_cost": {"Fire": 1}, "retreat_cost": 1}`,
+			http.StatusCreated, &card)
+		drakeID = card.Card.ID
+		s.call(t, "POST", "/admin/cards", adminToken,
+			`{"name": "Fire Spark", "type": "Energy", "legend": "One fire energy", "element": "Fire", "retreat_cost": 0}`,
+			http.StatusCreated, &card)
+		sparkID = card.Card.ID
+		s.call(t, "POST", "/admin/cards", adminToken,
+			`{"name": "Misprint", "type": "Spell", "legend": "Printed by mistake", "element": "Neutral", "retreat_cost": 0}`,
+			http.StatusCreated, &card)
+		misprintID := card.Card.ID
+
+		s.call(t, "PUT", fmt.Sprintf("/admin/cards/%d", drakeID), adminToken, `{"legend": "Breathes embers on the bench"}`, http.StatusOK, &card)
+		s.call(t, "PATCH", fmt.Sprintf("/admin/cards/%d", drakeID), adminToken, `{"rarity": "Common"}`, http.StatusOK, &card)
+		if card.Card.Legend != "Breathes embers on the bench" {
+			t.Errorf("legend = %q after the updates", card.Card.Legend)
+		}
+		s.call(t, "DELETE", fmt.Sprintf("/admin/cards/%d", misprintID), adminToken, "", http.StatusOK, nil)
+		s.call(t, "GET", fmt.Sprintf("/cards/%d", misprintID), "", "", http.StatusNotFound, nil)
+
+		var effect models.EffectResponse
+		s.call(t, "POST", "/admin/effects", adminToken,
+			`{"description": "Scorch the bench", "script": {"version": 1, "trigger": "on_attack", "target": {"side": "opponent", "slots": "bench"}, "operations": [{"op": "damage", "amount": 10}]}}`,
+			http.StatusCreated, &effect)
+		effectID = effect.Effect.ID
+		s.call(t, "PUT", fmt.Sprintf("/admin/effects/%d", effectID), adminToken, `{"description": "Scorch the whole bench"}`, http.StatusOK, nil)
+		s.call(t, "POST", "/admin/effects", adminToken, `{"description": "Never used"}`, http.StatusCreated, &effect)
+		s.call(t, "DELETE", fmt.Sprintf("/admin/effects/%d", effect.Effect.ID), adminToken, "", http.StatusOK, nil)
+
+		var effects models.EffectsResponse
+		s.call(t, "GET", "/admin/effects", adminToken, "", http.StatusOK, &effects)
+		if len(effects.Effects) != 1 {
+			t.Errorf("admin effects = %d, want only the live one", len(effects.Effects))
+		}
+		s.call(t, "GET", "/effects", "", "", http.StatusOK, &effects)
+		if len(effects.Effects) != 1 || effects.Effects[0].Description != "Scorch the whole bench" {
+			t.Errorf("effects = %+v, want the updated effect", effects.Effects)
+		}
+		s.call(t, "GET", fmt.Sprintf("/effects/%d", effectID), "", "", http.StatusOK, nil)
+
+		link := fmt.Sprintf("/admin/cards/%d/effects/%d", drakeID, effectID)
+		s.call(t, "POST", link, adminToken, "", http.StatusCreated, nil)
+		s.call(t, "GET", fmt.Sprintf("/cards/%d?include=effects", drakeID), "", "", http.StatusOK, &card)
+		if len(card.Card.Effects) != 1 {
+			t.Errorf("card effects = %+v, want the linked effect", card.Card.Effects)
+		}
+		s.call(t, "DELETE", link, adminToken, "", http.StatusOK, nil)
+		s.call(t, "POST", link, adminToken, "", http.StatusCreated, nil)
+
+		var page models.CardPageResponse
+		s.call(t, "GET", "/cards?sort=name", "", "", http.StatusOK, &page)
+		if len(page.Cards) != 2 || page.Cards[0].ID != drakeID {
+			t.Errorf("cards = %+v, want the drake then the spark", page.Cards)
+		}
+
+		var cards models.CardsResponse
+		s.call(t, "GET", "/cards/search?q=drake", "", "", http.StatusOK, &cards)
+		if len(cards.Cards) != 1 || cards.Cards[0].ID != drakeID {
+			t.Errorf("search = %+v, want the drake", cards.Cards)
+		}
+		s.call(t, "GET", "/cards/type/Energy", "", "", http.StatusOK, &cards)
+		if len(cards.Cards) != 1 || cards.Cards[0].ID != sparkID {
+			t.Errorf("energies = %+v, want the spark", cards.Cards)
+		}
+		s.call(t, "GET", "/cards/element/Fire", "", "", http.StatusOK, &cards)
+		if len(cards.Cards) != 2 {
+			t.Errorf("fire cards = %d, want 2", len(cards.Cards))
+		}
+
+		var audit models.AuditLogResponse
+		s.call(t, "GET", "/admin/audit?entity_type=card", adminToken, "", http.StatusOK, &audit)
+		if audit.Total != 6 {
+			t.Errorf("card audit entries = %d, want 3 creations, 2 updates and a deletion", audit.Total)
+		}
+	})
+
+	// Both players get a playset, with copies to spare beyond their deck
+	for _, user := range []*models.User{owner, rival} {
+		for _, cardID := range []int{drakeID, sparkID} {
+			if err := s.mem.AddOrUpdateUserCard(user.ID, cardID, 25); err != nil {
+				t.Fatalf("AddOrUpdateUserCard: %v", err)
+			}
+		}
+	}
+	deck := fmt.Sprintf(`"card_ids": [%d, %d], "card_count": [20, 20]`, drakeID, sparkID)
+
+	t.Run("collection", func(t *testing.T) {
+		var userCards models.UserCardsResponse
+		s.call(t, "GET", "/api/user-cards", ownerToken, "", http.StatusOK, &userCards)
+		if len(userCards.UserCards) != 2 {
+			t.Errorf("user cards = %d, want 2", len(userCards.UserCards))
+		}
+
+		var userCard models.UserCardResponse
+		s.call(t, "GET", fmt.Sprintf("/api/user-cards/%d", drakeID), ownerToken, "", http.StatusOK, &userCard)
+		if userCard.UserCard.Amount != 25 {
+			t.Errorf("drakes = %d, want 25", userCard.UserCard.Amount)
+		}
+
+		var collection models.CollectionResponse
+		s.call(t, "GET", "/api/collection", ownerToken, "", http.StatusOK, &collection)
+		if collection.Completion.Owned != 2 || collection.Completion.Total != 2 {
+			t.Errorf("completion = %+v, want the whole catalogue", collection.Completion)
+		}
+
+		// Cards players hold cannot be deleted from under them
+		s.call(t, "DELETE", fmt.Sprintf("/admin/cards/%d", drakeID), adminToken, "", http.StatusConflict, nil)
+		s.call(t, "GET", fmt.Sprintf("/cards/%d", drakeID), "", "", http.StatusOK, nil)
+	})
+
+	t.Run("decks", func(t *testing.T) {
+		var created models.DeckResponse
+		s.call(t, "POST", "/api/decks", ownerToken, `{"name": "Embers", `+deck+`}`, http.StatusCreated, &created)
+		ownerDeckID = created.Deck.ID
+		s.call(t, "POST", "/api/decks", rivalToken, `{"name": "Cinders", `+deck+`}`, http.StatusCreated, &created)
+		rivalDeckID = created.Deck.ID
+
+		s.call(t, "GET", "/api/decks", ownerToken, "", http.StatusOK, nil)
+		s.call(t, "GET", "/api/decks/limit", ownerToken, "", http.StatusOK, nil)
+		s.call(t, "GET", fmt.Sprintf("/api/decks/%d", ownerDeckID), ownerToken, "", http.StatusOK, nil)
+		s.call(t, "GET", fmt.Sprintf("/api/decks/%d", ownerDeckID), rivalToken, "", http.StatusForbidden, nil)
+		s.call(t, "GET", fmt.Sprintf("/api/decks/%d/cards", ownerDeckID), ownerToken, "", http.StatusOK, nil)
+
+		var validation models.DeckValidationResponse
+		s.call(t, "GET", fmt.Sprintf("/api/decks/%d/validation", ownerDeckID), ownerToken, "", http.StatusOK, &validation)
+		if !validation.Validation.Valid {
+			t.Errorf("validation = %+v, want a valid deck", validation.Validation)
+		}
+
+		var export models.DeckExportResponse
+		s.call(t, "GET", fmt.Sprintf("/api/decks/%d/export", ownerDeckID), ownerToken, "", http.StatusOK, &export)
+		s.call(t, "POST", "/api/decks/import", ownerToken, fmt.Sprintf(`{"name": "Imported", "code": %q}`, export.Export.Code),
+			http.StatusCreated, &created)
+		importedID := created.Deck.ID
+
+		s.call(t, "PUT", fmt.Sprintf("/api/decks/%d", importedID), ownerToken, `{"name": "Renamed", `+deck+`}`, http.StatusOK, &created)
+		if created.Deck.Name != "Renamed" {
+			t.Errorf("deck name = %q after the update", created.Deck.Name)
+		}
+		s.call(t, "DELETE", fmt.Sprintf("/api/decks/%d", importedID), ownerToken, "", http.StatusOK, nil)
+		s.call(t, "GET", fmt.Sprintf("/api/decks/%d", importedID), ownerToken, "", http.StatusNotFound, nil)
+	})
+
+	t.Run("formats", func(t *testing.T) {
+		var formats models.FormatsResponse
+		s.call(t, "GET", "/api/formats", ownerToken, "", http.StatusOK, &formats)
+		if len(formats.Formats) != 2 {
+			t.Errorf("formats = %d, want the 2 seeded ones", len(formats.Formats))
+		}
+		s.call(t, "GET", "/api/formats/standard", ownerToken, "", http.StatusOK, nil)
+
+		s.call(t, "PUT", "/admin/formats/casual", adminToken, `{"name": "Casual", "min_cards": 40}`, http.StatusCreated, nil)
+		var format models.FormatResponse
+		s.call(t, "PUT", "/admin/formats/casual/cards", adminToken, fmt.Sprintf(`{"card_limits": [{"card_id": %d, "limit": 1}]}`, drakeID),
+			http.StatusOK, &format)
+		if len(format.Format.CardLimits) != 1 {
+			t.Errorf("card limits = %+v, want the restricted drake", format.Format.CardLimits)
+		}
+		s.call(t, "GET", "/api/formats/casual", ownerToken, "", http.StatusOK, nil)
+	})
+
+	t.Run("store", func(t *testing.T) {
+		var pack models.PackResponse
+		s.call(t, "POST", "/admin/packs", adminToken,
+			`{"name": "Starter", "description": "One common card", "price": 30, "set_code": "BASE", "slots": [{"Common": 1}]}`,
+			http.StatusCreated, &pack)
+		packID := pack.Pack.ID
+		s.call(t, "PUT", fmt.Sprintf("/admin/packs/%d", packID), adminToken,
+			`{"name": "Starter", "description": "Two common cards", "price": 40, "set_code": "BASE", "slots": [{"Common": 1}, {"Common": 1}]}`,
+			http.StatusOK, nil)
+		s.call(t, "POST", "/admin/packs", adminToken,
+			`{"name": "Promo", "description": "Out of print", "price": 10, "set_code": "BASE", "slots": [{"Common": 1}]}`,
+			http.StatusCreated, &pack)
+		s.call(t, "DELETE", fmt.Sprintf("/admin/packs/%d", pack.Pack.ID), adminToken, "", http.StatusOK, nil)
+
+		var packs models.PacksResponse
+		s.call(t, "GET", "/api/store/packs", ownerToken, "", http.StatusOK, &packs)
+		if len(packs.Packs) != 1 || packs.Packs[0].Price != 40 {
+			t.Errorf("packs = %+v, want the updated starter only", packs.Packs)
+		}
+
+		var opening models.PackOpeningResponse
+		s.call(t, "POST", fmt.Sprintf("/api/store/packs/%d/open", packID), ownerToken, "", http.StatusOK, &opening)
+		if len(opening.Cards) != 2 || opening.Opening.MoneyLeft != 60 {
+			t.Errorf("opening = %+v with %d cards, want 2 cards for 40", opening.Opening, len(opening.Cards))
+		}
+	})
+
+	t.Run("tables", func(t *testing.T) {
+		var created struct {
+			TableID uint `json:"table_id"`
+		}
+		s.call(t, "POST", "/api/tables", ownerToken,
+			fmt.Sprintf(`{"category": "D", "privacy": "public", "prize": "aura", "deck_id": %d}`, ownerDeckID),
+			http.StatusCreated, &created)
+		table := fmt.Sprintf("/api/tables/%d", created.TableID)
+		s.call(t, "PUT", table, ownerToken, `{"category": "C"}`, http.StatusOK, nil)
+
+		var lobby struct {
+			Tables []models.LobbyTable `json:"tables"`
+		}
+		s.call(t, "GET", "/api/lobby?category=C", rivalToken, "", http.StatusOK, &lobby)
+		if len(lobby.Tables) != 1 || lobby.Tables[0].ID != created.TableID {
+			t.Errorf("lobby = %+v, want the owner's table", lobby.Tables)
+		}
+
+		s.call(t, "POST", table+"/join", rivalToken, fmt.Sprintf(`{"deck_id": %d}`, rivalDeckID), http.StatusOK, nil)
+		s.call(t, "GET", "/ws/tables/"+fmt.Sprint(created.TableID), "", "", http.StatusUnauthorized, nil)
+
+		var userTables struct {
+			Tables []UserTableResponse `json:"tables"`
+		}
+		s.call(t, "GET", "/api/tables", ownerToken, "", http.StatusOK, &userTables)
+		if len(userTables.Tables) != 1 || userTables.Tables[0].RivalID == nil {
+			t.Errorf("tables = %+v, want the table with its rival", userTables.Tables)
+		}
+
+		s.call(t, "GET", table+"/state", ownerToken, "", http.StatusOK, nil)
+		s.call(t, "POST", table+"/actions", rivalToken, `{"type": "concede"}`, http.StatusOK, nil)
+
+		var ratingResponse models.RatingResponse
+		s.call(t, "GET", "/api/rating", ownerToken, "", http.StatusOK, &ratingResponse)
+		if ratingResponse.Rating.Games != 1 || ratingResponse.Rating.Wins != 1 || len(ratingResponse.History) != 1 {
+			t.Errorf("rating = %+v, want the won match", ratingResponse)
+		}
+
+		var leaderboard models.LeaderboardResponse
+		s.call(t, "GET", "/leaderboard", "", "", http.StatusOK, &leaderboard)
+		if len(leaderboard.Entries) == 0 || leaderboard.Entries[0].UserID != owner.ID {
+			t.Errorf("leaderboard = %+v, want the owner first", leaderboard.Entries)
+		}
+	})
+
+	t.Run("matchmaking", func(t *testing.T) {
+		var status QueueStatusResponse
+		s.call(t, "POST", "/api/matchmaking/queue", ownerToken, fmt.Sprintf(`{"deck_id": %d, "category": "D"}`, ownerDeckID), http.StatusCreated, &status)
+		s.call(t, "GET", "/api/matchmaking/queue", ownerToken, "", http.StatusOK, &status)
+		if status.Status != "queued" {
+			t.Errorf("status = %q, want queued", status.Status)
+		}
+		s.call(t, "DELETE", "/api/matchmaking/queue", ownerToken, "", http.StatusOK, nil)
+		s.call(t, "GET", "/api/matchmaking/queue", ownerToken, "", http.StatusOK, &status)
+		if status.Status != "idle" {
+			t.Errorf("status = %q after leaving, want idle", status.Status)
+		}
+	})
+
+	t.Run("trades", func(t *testing.T) {
+		var trade models.TradeResponse
+		s.call(t, "POST", "/api/trades", ownerToken,
+			fmt.Sprintf(`{"recipient_id": %d, "offered_cards": [{"card_id": %d, "amount": 1}], "requested_money": 5}`, rival.ID, drakeID),
+			http.StatusCreated, &trade)
+		tradeID := trade.Trade.ID
+		s.call(t, "GET", fmt.Sprintf("/api/trades/%d", tradeID), rivalToken, "", http.StatusOK, nil)
+
+		s.call(t, "POST", fmt.Sprintf("/api/trades/%d/counter", tradeID), rivalToken, `{"offered_money": 3}`, http.StatusCreated, &trade)
+		s.call(t, "POST", fmt.Sprintf("/api/trades/%d/accept", trade.Trade.ID), ownerToken, "", http.StatusOK, &trade)
+		if trade.Trade.Status != models.TradeStatusAccepted {
+			t.Errorf("counter-offer status = %q, want accepted", trade.Trade.Status)
+		}
+
+		s.call(t, "POST", "/api/trades", ownerToken, fmt.Sprintf(`{"recipient_id": %d, "offered_money": 1}`, rival.ID), http.StatusCreated, &trade)
+		s.call(t, "POST", fmt.Sprintf("/api/trades/%d/decline", trade.Trade.ID), rivalToken, "", http.StatusOK, nil)
+		s.call(t, "POST", "/api/trades", ownerToken, fmt.Sprintf(`{"recipient_id": %d, "offered_money": 1}`, rival.ID), http.StatusCreated, &trade)
+		s.call(t, "POST", fmt.Sprintf("/api/trades/%d/cancel", trade.Trade.ID), ownerToken, "", http.StatusOK, nil)
+
+		var trades models.TradesResponse
+		s.call(t, "GET", "/api/trades", ownerToken, "", http.StatusOK, &trades)
+		if len(trades.Trades) != 4 {
+			t.Errorf("trades = %d, want the offer, its counter, and the declined and cancelled ones", len(trades.Trades))
+		}
+	})
+
+	t.Run("market", func(t *testing.T) {
+		var listing models.ListingResponse
+		s.call(t, "POST", "/api/market/listings", ownerToken, fmt.Sprintf(`{"card_id": %d, "amount": 2, "price": 20}`, sparkID),
+			http.StatusCreated, &listing)
+		listingID := listing.Listing.ID
+
+		var listings models.ListingsResponse
+		s.call(t, "GET", "/api/market/listings?sort=price", rivalToken, "", http.StatusOK, &listings)
+		if listings.Total != 1 {
+			t.Errorf("listings = %d, want 1", listings.Total)
+		}
+		s.call(t, "GET", fmt.Sprintf("/api/market/listings/%d", listingID), rivalToken, "", http.StatusOK, nil)
+		s.call(t, "POST", fmt.Sprintf("/api/market/listings/%d/buy", listingID), rivalToken, "", http.StatusOK, &listing)
+		if listing.Listing.Status != models.ListingStatusSold {
+			t.Errorf("listing status = %q, want sold", listing.Listing.Status)
+		}
+
+		var history models.PriceHistoryResponse
+		s.call(t, "GET", fmt.Sprintf("/api/market/cards/%d/history", sparkID), ownerToken, "", http.StatusOK, &history)
+		if history.CopiesSold != 2 || history.AverageUnitPrice != 10 {
+			t.Errorf("history = %+v, want 2 copies sold for 10 each", history)
+		}
+
+		s.call(t, "POST", "/api/market/listings", ownerToken, fmt.Sprintf(`{"card_id": %d, "amount": 1, "price": 50}`, sparkID),
+			http.StatusCreated, &listing)
+		s.call(t, "POST", fmt.Sprintf("/api/market/listings/%d/cancel", listing.Listing.ID), ownerToken, "", http.StatusOK, nil)
+	})
+
+	var missed []string
+	for _, route := range routeTemplates(t, s.router) {
+		if !s.hits[route] {
+			missed = append(missed, route)
+		}
+	}
+	sort.Strings(missed)
+	for _, route := range missed {
+		t.Errorf("route %s was not exercised", route)
+	}
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"tcg-server-go/middleware"
+	"tcg-server-go/models"
+)
+
+// formatCodePattern matches the codes formats can be saved under
+var formatCodePattern = regexp.MustCompile(`^[a-z0-9_-]{1,20}$`)
+
+// GetFormatsHandler lists the deck formats with their rules
+func (h *Handler) GetFormatsHandler(w http.ResponseWriter, r *http.Request) {
+	formats, err := h.Repos.Formats.GetFormats()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving formats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.FormatsResponse{
+		Formats: formats,
+		Message: "Formats retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetFormatHandler retrieves a deck format with its rules
+func (h *Handler) GetFormatHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := h.Repos.Formats.GetFormat(mux.Vars(r)["code"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving format: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if format == nil {
+		http.Error(w, "Format not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.FormatResponse{
+		Format:  format,
+		Message: "Format retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetDeckValidationHandler checks a deck of the authenticated user against its format and
+// lists the rules it breaks. The deck is marked valid or invalid accordingly.
+func (h *Handler) GetDeckValidationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	deckID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid deck ID", http.StatusBadRequest)
+		return
+	}
+
+	deck, err := h.Repos.Decks.GetDeckByID(deckID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving deck: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if deck == nil {
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	}
+	if deck.UserID != principal.UserID {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	validation, err := h.Repos.Formats.ValidateDeck(deckID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error validating deck: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if validation == nil {
+		http.Error(w, "Deck not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.DeckValidationResponse{
+		Validation: validation,
+		Message:    "Deck validated successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminSaveFormatHandler creates a format or replaces every rule of an existing one. The
+// decks of the format are checked against the new rules.
+func (h *Handler) AdminSaveFormatHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	code := mux.Vars(r)["code"]
+	if !formatCodePattern.MatchString(code) {
+		http.Error(w, "Format codes are 1 to 20 lowercase letters, digits, dashes or underscores", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SaveFormatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	validationErrors := ValidateStruct(&req)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	format := &models.DeckFormat{
+		Code:             code,
+		Name:             req.Name,
+		MinCards:         req.MinCards,
+		MaxCards:         req.MaxCards,
+		MaxCopies:        req.MaxCopies,
+		MinEnergyPercent: req.MinEnergyPercent,
+		MaxEnergyPercent: 100,
+		Sets:             req.Sets,
+		CardLimits:       req.CardLimits,
+	}
+	if req.MaxEnergyPercent != nil {
+		format.MaxEnergyPercent = *req.MaxEnergyPercent
+	}
+	if format.MaxCards != nil && *format.MaxCards < format.MinCards {
+		http.Error(w, "max_cards cannot be lower than min_cards", http.StatusBadRequest)
+		return
+	}
+	if format.MaxEnergyPercent < format.MinEnergyPercent {
+		http.Error(w, "max_energy_percent cannot be lower than min_energy_percent", http.StatusBadRequest)
+		return
+	}
+
+	h.saveFormat(w, principal, format)
+}
+
+// AdminSetFormatCardsHandler replaces the banned and restricted list of a format, keeping
+// its other rules. The decks of the format are checked against the new list.
+func (h *Handler) AdminSetFormatCardsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	format, err := h.Repos.Formats.GetFormat(mux.Vars(r)["code"])
+	if err != nil {
+		http.Error(w, "Error retrieving format", http.StatusInternalServerError)
+		return
+	}
+	if format == nil {
+		http.Error(w, "Format not found", http.StatusNotFound)
+		return
+	}
+
+	var req models.FormatCardLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	validationErrors := ValidateStruct(&req)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	format.CardLimits = req.CardLimits
+	h.saveFormat(w, principal, format)
+}
+
+// saveFormat saves a format after checking its banned and restricted cards exist, audits
+// the change and responds with the decks whose validity changed
+func (h *Handler) saveFormat(w http.ResponseWriter, principal *middleware.Principal, format *models.DeckFormat) {
+	for _, limit := range format.CardLimits {
+		card, err := h.Repos.Cards.GetCardByID(limit.CardID)
+		if err != nil {
+			http.Error(w, "Error retrieving card", http.StatusInternalServerError)
+			return
+		}
+		if card == nil {
+			http.Error(w, fmt.Sprintf("Card %d not found", limit.CardID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	before, err := h.Repos.Formats.GetFormat(format.Code)
+	if err != nil {
+		http.Error(w, "Error retrieving format", http.StatusInternalServerError)
+		return
+	}
+
+	status, message := http.StatusOK, "Format updated successfully"
+	var audit *models.AuditEntry
+	var ok bool
+	if before == nil {
+		status, message = http.StatusCreated, "Format created successfully"
+		audit, ok = auditEntry(w, principal, models.AuditActionCreate, models.AuditEntityFormat, 0, nil)
+	} else {
+		audit, ok = auditEntry(w, principal, models.AuditActionUpdate, models.AuditEntityFormat, before.ID, before)
+	}
+	if !ok {
+		return
+	}
+
+	revalidated, err := h.Repos.Formats.SaveFormat(format, audit)
+	if err != nil {
+		http.Error(w, "Error saving format", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.FormatResponse{
+		Format:      format,
+		Revalidated: revalidated,
+		Message:     message,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeDeckError responds to the deck errors caused by the request: the broken rules of
+// the format, with their details, or an unknown format. It reports whether it responded.
+func writeDeckError(w http.ResponseWriter, action string, err error) bool {
+	var violationErr *models.DeckViolationError
+	if errors.As(err, &violationErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      fmt.Sprintf("Cannot %s deck: it breaks the rules of its format", action),
+			"violations": violationErr.Violations,
+		})
+		return true
+	}
+	if errors.Is(err, models.ErrFormatNotFound) {
+		http.Error(w, fmt.Sprintf("Cannot %s deck: unknown format", action), http.StatusBadRequest)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"tcg-server-go/game"
+	"tcg-server-go/models"
+	"tcg-server-go/realtime"
+
+	"github.com/gorilla/mux"
+)
+
+// GetTableState returns the match state of a table as seen by the authenticated player
+func (h *Handler) GetTableState(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := uint(principal.UserID)
+
+	tableID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid table ID", http.StatusBadRequest)
+		return
+	}
+
+	state, seat, err := h.Matches.LoadMatch(uint(tableID), userID)
+	if err != nil {
+		writeGameError(w, err)
+		return
+	}
+
+	// Settle the match if a previous attempt did not get through
+	h.settleMatch(uint(tableID), state)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"state": game.ViewWithClock(state, seat, h.matchClock(uint(tableID))),
+	})
+}
+
+// PerformTableAction validates and applies a game action submitted by the authenticated player
+func (h *Handler) PerformTableAction(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := uint(principal.UserID)
+
+	tableID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid table ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse request body
+	var action game.Action
+	if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if action.Type == "" {
+		http.Error(w, "Action type is required", http.StatusBadRequest)
+		return
+	}
+
+	state, seat, err := h.Matches.PerformAction(uint(tableID), userID, action)
+	if errors.Is(err, game.ErrTimeExpired) {
+		// The action was too late, but the match did end on time
+		h.matchTimedOut(state)
+	}
+	if err != nil {
+		writeGameError(w, err)
+		return
+	}
+
+	// Push the new state to both players
+	h.publishMatchState(uint(tableID), state)
+	h.settleMatch(uint(tableID), state)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Action accepted",
+		"state":   game.ViewWithClock(state, seat, h.matchClock(uint(tableID))),
+	})
+}
+
+// matchTimedOut pushes the final state of a match lost on time and settles it
+func (h *Handler) matchTimedOut(state *models.TableState) {
+	h.publishMatchState(state.TableID, state)
+	h.settleMatch(state.TableID, state)
+}
+
+// matchClock returns the clock of a match as it stands now. Views are still served without
+// it if it cannot be loaded.
+func (h *Handler) matchClock(tableID uint) *models.TableClock {
+	clock, err := h.Matches.Clock(tableID)
+	if err != nil {
+		log.Printf("Failed to load clock of table %d: %v", tableID, err)
+		return nil
+	}
+	return clock
+}
+
+// settleMatch pays out the prize of a finished match and tells both players the result.
+// The action that finished the match is already saved, so failures are only logged and
+// settling is retried the next time the match is loaded.
+func (h *Handler) settleMatch(tableID uint, state *models.TableState) {
+	if game.Phase(state.Phase) != game.PhaseFinished {
+		return
+	}
+
+	result, err := h.Matches.FinishMatch(tableID)
+	if err != nil {
+		log.Printf("Failed to settle match at table %d: %v", tableID, err)
+		return
+	}
+	if result == nil {
+		return
+	}
+
+	h.Hub.Broadcast(tableID, realtime.Event{
+		Type: realtime.EventFinish,
+		Data: result,
+	})
+}
+
+// writeGameError maps engine errors to HTTP responses
+func writeGameError(w http.ResponseWriter, err error) {
+	var ruleErr *game.RuleError
+	switch {
+	case errors.As(err, &ruleErr):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": ruleErr.Reason})
+	case errors.Is(err, game.ErrNotSeated):
+		http.Error(w, "You are not playing at this table", http.StatusForbidden)
+	case errors.Is(err, game.ErrMatchNotStarted):
+		http.Error(w, "Match has not started", http.StatusNotFound)
+	case errors.Is(err, models.ErrStaleTableState):
+		http.Error(w, "The match changed while the action was applied, try again", http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("Error processing match: %v", err), http.StatusInternalServerError)
+	}
+}
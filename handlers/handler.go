@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"tcg-server-go/game"
+	"tcg-server-go/mailer"
+	"tcg-server-go/market"
+	"tcg-server-go/matchmaking"
+	"tcg-server-go/middleware"
+	"tcg-server-go/realtime"
+	"tcg-server-go/repository"
+	"tcg-server-go/store"
+)
+
+// Handler serves the HTTP API on top of the given repositories
+type Handler struct {
+	Repos       *repository.Repositories
+	Mailer      mailer.Mailer
+	Matches     *game.Matches
+	Hub         *realtime.Hub
+	Store       *store.Store
+	Market      market.Config
+	Matchmaking *matchmaking.Queue
+	Clocks      *game.ClockWatcher
+}
+
+// NewHandler creates the handlers with their own match runner, WebSocket hub, store,
+// matchmaking queue and match clock watcher, and the marketplace configured from the
+// environment. The queue and the clocks only work in the background once Start is called.
+func NewHandler(repos *repository.Repositories, mail mailer.Mailer) *Handler {
+	h := &Handler{
+		Repos:   repos,
+		Mailer:  mail,
+		Matches: game.NewMatches(repos),
+		Hub:     realtime.NewHub(),
+		Store:   store.New(repos),
+		Market:  market.GetConfig(),
+	}
+
+	h.Matchmaking = matchmaking.New(repos, h.Matches, matchmaking.Config{}, matchmaking.SystemClock{})
+	h.Matchmaking.Notify = h.notifyMatch
+	h.Matchmaking.Dropped = h.notifyDropped
+
+	h.Clocks = game.NewClockWatcher(h.Matches, time.Second)
+	h.Clocks.OnTimeout = h.matchTimedOut
+
+	return h
+}
+
+// Start runs the matchmaking queue and the match clock watcher in the background
+func (h *Handler) Start() {
+	h.Matchmaking.Start()
+	h.Clocks.Start()
+}
+
+// Stop ends the background work started by Start and waits for it to finish
+func (h *Handler) Stop() {
+	h.Matchmaking.Stop()
+	h.Clocks.Stop()
+}
+
+// currentUser returns the user authenticated by AuthMiddleware, replying 401 if there is none
+func currentUser(w http.ResponseWriter, r *http.Request) (*middleware.Principal, bool) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return principal, true
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"tcg-server-go/models"
+)
+
+const (
+	defaultLobbyLimit = 20
+	maxLobbyLimit     = 100
+)
+
+// GetLobby lists public tables waiting for a rival, with optional filters and pagination
+func (h *Handler) GetLobby(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.LobbyFilter{
+		Category: query.Get("category"),
+		Prize:    query.Get("prize"),
+		Limit:    defaultLobbyLimit,
+	}
+
+	// Validate category
+	if filter.Category != "" {
+		validCategories := map[string]bool{"S": true, "A": true, "B": true, "C": true, "D": true}
+		if !validCategories[filter.Category] {
+			http.Error(w, "Invalid category. Must be S, A, B, C, or D", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate prize
+	if filter.Prize != "" {
+		validPrizes := map[string]bool{"money": true, "card": true, "aura": true}
+		if !validPrizes[filter.Prize] {
+			http.Error(w, "Invalid prize. Must be 'money', 'card', or 'aura'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate amount range
+	if value := query.Get("min_amount"); value != "" {
+		minAmount, err := strconv.Atoi(value)
+		if err != nil || minAmount < 0 {
+			http.Error(w, "min_amount must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		filter.MinAmount = &minAmount
+	}
+
+	if value := query.Get("max_amount"); value != "" {
+		maxAmount, err := strconv.Atoi(value)
+		if err != nil || maxAmount < 0 {
+			http.Error(w, "max_amount must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		filter.MaxAmount = &maxAmount
+	}
+
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		http.Error(w, "min_amount cannot be greater than max_amount", http.StatusBadRequest)
+		return
+	}
+
+	// Validate pagination
+	page := 1
+	if value := query.Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "page must be a positive number", http.StatusBadRequest)
+			return
+		}
+		page = parsed
+	}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLobbyLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLobbyLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = parsed
+	}
+	filter.Offset = (page - 1) * filter.Limit
+
+	tables, total, err := h.Repos.Tables.GetOpenTables(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving lobby: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tables": tables,
+		"page":   page,
+		"limit":  filter.Limit,
+		"total":  total,
+	})
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"tcg-server-go/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultListingLimit = 20
+	maxListingLimit     = 100
+	defaultSalesLimit   = 50
+	maxSalesLimit       = 200
+)
+
+// CheckMarket makes sure the marketplace can pay its fees. MARKET_FEE_USER_ID, when set, must
+// name a user with game info to credit, or every sale would fail; it is checked at startup.
+func (h *Handler) CheckMarket() error {
+	if value := os.Getenv("MARKET_FEE_USER_ID"); value != "" && h.Market.FeeSink == 0 {
+		return fmt.Errorf("MARKET_FEE_USER_ID must be a user ID, got %q", value)
+	}
+	if h.Market.FeeSink == 0 {
+		return nil
+	}
+
+	user, err := h.Repos.Users.GetUserByID(h.Market.FeeSink)
+	if err != nil {
+		return fmt.Errorf("error retrieving the fee user: %v", err)
+	}
+	if user == nil {
+		return fmt.Errorf("MARKET_FEE_USER_ID %d does not name a user", h.Market.FeeSink)
+	}
+
+	info, err := h.Repos.UserInfo.GetUserInfoByUserID(h.Market.FeeSink)
+	if err != nil {
+		return fmt.Errorf("error retrieving the game info of the fee user: %v", err)
+	}
+	if info == nil {
+		return fmt.Errorf("MARKET_FEE_USER_ID %d has no game info to credit fees to", h.Market.FeeSink)
+	}
+	return nil
+}
+
+// SearchListingsHandler lists the active marketplace listings. Query parameters: card_id,
+// seller_id, element, rarity, min_price, max_price, sort (newest, price or -price), page and
+// limit.
+func (h *Handler) SearchListingsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.ListingFilter{
+		Element: models.CardElement(query.Get("element")),
+		Rarity:  models.CardRarity(query.Get("rarity")),
+		Sort:    query.Get("sort"),
+		Limit:   defaultListingLimit,
+	}
+
+	if filter.Element != "" && validate.Var(string(filter.Element), "oneof=Fire Water Wind Earth Neutral Holy Dark") != nil {
+		http.Error(w, "Invalid element", http.StatusBadRequest)
+		return
+	}
+	if filter.Rarity != "" && validate.Var(string(filter.Rarity), "oneof=Common Uncommon Rare Epic Legendary") != nil {
+		http.Error(w, "Invalid rarity", http.StatusBadRequest)
+		return
+	}
+
+	switch filter.Sort {
+	case "":
+		filter.Sort = models.ListingSortNewest
+	case models.ListingSortNewest, models.ListingSortPriceAsc, models.ListingSortPriceDesc:
+	default:
+		http.Error(w, "sort must be newest, price or -price", http.StatusBadRequest)
+		return
+	}
+
+	numbers := map[string]*int{
+		"card_id":   &filter.CardID,
+		"seller_id": &filter.SellerID,
+		"min_price": &filter.MinPrice,
+		"max_price": &filter.MaxPrice,
+	}
+	for name, target := range numbers {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				http.Error(w, name+" must be a positive number", http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	// Validate pagination
+	page := 1
+	if value := query.Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "page must be a positive number", http.StatusBadRequest)
+			return
+		}
+		page = parsed
+	}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxListingLimit {
+			http.Error(w, "limit must be a number between 1 and "+strconv.Itoa(maxListingLimit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = parsed
+	}
+	filter.Offset = (page - 1) * filter.Limit
+
+	listings, total, err := h.Repos.Market.SearchListings(filter)
+	if err != nil {
+		http.Error(w, "Error retrieving listings", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.ListingsResponse{
+		Listings: listings,
+		Total:    total,
+		Page:     page,
+		Limit:    filter.Limit,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateListingHandler puts copies of a card of the authenticated user up for sale. The
+// copies leave their collection until the listing is sold or cancelled.
+func (h *Handler) CreateListingHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var createReq models.CreateListingRequest
+	if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&createReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	card, err := h.Repos.Cards.GetCardByID(createReq.CardID)
+	if err != nil {
+		http.Error(w, "Error retrieving card", http.StatusInternalServerError)
+		return
+	}
+	if card == nil {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return
+	}
+
+	listing := &models.Listing{
+		SellerID: principal.UserID,
+		CardID:   createReq.CardID,
+		Amount:   createReq.Amount,
+		Price:    createReq.Price,
+	}
+	err = h.Repos.Market.CreateListing(listing)
+	switch {
+	case errors.Is(err, models.ErrNotEnoughCards), errors.Is(err, models.ErrBreaksDeck):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Error creating listing: %v", err), http.StatusInternalServerError)
+		return
+	}
+	listing.Card = card
+
+	writeListing(w, http.StatusCreated, listing, "Listing created successfully")
+}
+
+// GetListingHandler retrieves a listing, whatever its status
+func (h *Handler) GetListingHandler(w http.ResponseWriter, r *http.Request) {
+	listing, ok := h.loadListing(w, r)
+	if !ok {
+		return
+	}
+
+	writeListing(w, http.StatusOK, listing, "Listing retrieved successfully")
+}
+
+// BuyListingHandler buys a listing with the money of the authenticated user. The seller is
+// paid the price minus the marketplace fee.
+func (h *Handler) BuyListingHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	listing, ok := h.loadListing(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Repos.Market.BuyListing(listing.ID, principal.UserID, h.Market)
+	switch {
+	case errors.Is(err, models.ErrListingNotActive):
+		http.Error(w, "Listing is no longer active", http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrOwnListing):
+		http.Error(w, "You cannot buy your own listing", http.StatusBadRequest)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusPaymentRequired)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Not enough money to buy this listing"})
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Error buying listing: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.respondUpdatedListing(w, listing.ID, "Listing bought successfully")
+}
+
+// CancelListingHandler withdraws a listing of the authenticated user and returns its cards
+func (h *Handler) CancelListingHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	listing, ok := h.loadListing(w, r)
+	if !ok {
+		return
+	}
+	if listing.SellerID != principal.UserID {
+		http.Error(w, "Only the seller can cancel a listing", http.StatusForbidden)
+		return
+	}
+
+	cancelled, err := h.Repos.Market.CancelListing(listing.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error cancelling listing: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !cancelled {
+		http.Error(w, "Listing is no longer active", http.StatusConflict)
+		return
+	}
+
+	h.respondUpdatedListing(w, listing.ID, "Listing cancelled successfully")
+}
+
+// GetPriceHistoryHandler lists the latest marketplace sales of a card with their average
+// price per copy
+func (h *Handler) GetPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	cardID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid card ID", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSalesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSalesLimit {
+			http.Error(w, "limit must be a number between 1 and "+strconv.Itoa(maxSalesLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	card, err := h.Repos.Cards.GetCardByID(cardID)
+	if err != nil {
+		http.Error(w, "Error retrieving card", http.StatusInternalServerError)
+		return
+	}
+	if card == nil {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return
+	}
+
+	sales, err := h.Repos.Market.GetCardSales(cardID, limit)
+	if err != nil {
+		http.Error(w, "Error retrieving price history", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.PriceHistoryResponse{
+		CardID:  cardID,
+		Sales:   sales,
+		Message: "Price history retrieved successfully",
+	}
+
+	// Weigh each sale by the copies it sold
+	revenue := 0
+	for _, sale := range sales {
+		response.CopiesSold += sale.Amount
+		revenue += sale.Price
+	}
+	if response.CopiesSold > 0 {
+		response.AverageUnitPrice = float64(revenue) / float64(response.CopiesSold)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// loadListing reads the listing of the request, writing an error response if there is none
+func (h *Handler) loadListing(w http.ResponseWriter, r *http.Request) (*models.Listing, bool) {
+	listingID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid listing ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	listing, err := h.Repos.Market.GetListingByID(listingID)
+	if err != nil {
+		http.Error(w, "Error retrieving listing", http.StatusInternalServerError)
+		return nil, false
+	}
+	if listing == nil {
+		http.Error(w, "Listing not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return listing, true
+}
+
+// respondUpdatedListing writes a listing after it changed status
+func (h *Handler) respondUpdatedListing(w http.ResponseWriter, listingID int, message string) {
+	listing, err := h.Repos.Market.GetListingByID(listingID)
+	if err != nil || listing == nil {
+		http.Error(w, "Error retrieving listing", http.StatusInternalServerError)
+		return
+	}
+
+	writeListing(w, http.StatusOK, listing, message)
+}
+
+func writeListing(w http.ResponseWriter, status int, listing *models.Listing, message string) {
+	response := models.ListingResponse{
+		Listing: listing,
+		Message: message,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"strconv"
+	"testing"
+
+	"tcg-server-go/models"
+)
+
+func TestCheckMarket(t *testing.T) {
+	s := newTestServer(t)
+	banker, _ := s.user(t, "Banker", false)
+	bare := &models.User{Name: "Bare", Email: "bare@example.com", Password: "secret1"}
+	if err := s.repos.Users.CreateUser(bare); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		env   string
+		valid bool
+	}{
+		{name: "not set", env: "", valid: true},
+		{name: "user with game info", env: strconv.Itoa(banker.ID), valid: true},
+		{name: "not a number", env: "bank"},
+		{name: "not positive", env: "-1"},
+		{name: "unknown user", env: "999"},
+		{name: "user without game info", env: strconv.Itoa(bare.ID)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MARKET_FEE_USER_ID", tt.env)
+			h := NewHandler(s.repos, s.outbox)
+
+			if err := h.CheckMarket(); (err == nil) != tt.valid {
+				t.Errorf("CheckMarket = %v, want valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"tcg-server-go/game"
+	"tcg-server-go/matchmaking"
+	"tcg-server-go/realtime"
+)
+
+// QueueRequest represents the request body for joining the matchmaking queue
+type QueueRequest struct {
+	DeckID   uint   `json:"deck_id"`
+	Category string `json:"category"`
+}
+
+// QueueStatusResponse represents where the authenticated user stands in matchmaking
+type QueueStatusResponse struct {
+	Status string             `json:"status"` // idle, queued, matching or matched
+	Entry  *matchmaking.Entry `json:"entry,omitempty"`
+	Window *float64           `json:"window,omitempty"` // Rating difference currently accepted
+	Match  *matchmaking.Match `json:"match,omitempty"`
+}
+
+// JoinQueueHandler puts the authenticated user in the matchmaking queue with a deck and a
+// table category. The match is made in the background.
+func (h *Handler) JoinQueueHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := uint(principal.UserID)
+
+	// Parse request body
+	var req QueueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.DeckID == 0 || req.Category == "" {
+		http.Error(w, "deck_id and category are required", http.StatusBadRequest)
+		return
+	}
+
+	validCategories := map[string]bool{"S": true, "A": true, "B": true, "C": true, "D": true}
+	if !validCategories[req.Category] {
+		http.Error(w, "Invalid category. Must be S, A, B, C, or D", http.StatusBadRequest)
+		return
+	}
+
+	// The rating of the player must allow the category
+	if status, message := h.checkTableCategory(userID, req.Category); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// Validate the deck the player will play with
+	if status, message := h.checkTableDeck(userID, req.DeckID); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	userRating, err := h.Repos.Ratings.GetUserRating(principal.UserID)
+	if err != nil {
+		http.Error(w, "Error retrieving rating", http.StatusInternalServerError)
+		return
+	}
+
+	entry, err := h.Matchmaking.Enqueue(matchmaking.Entry{
+		UserID:   userID,
+		DeckID:   req.DeckID,
+		Category: req.Category,
+		Rating:   userRating.Rating,
+	})
+	if err != nil {
+		if errors.Is(err, matchmaking.ErrAlreadyQueued) || errors.Is(err, matchmaking.ErrMatchFound) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error joining queue: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	window := h.Matchmaking.Window(entry)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(QueueStatusResponse{
+		Status: "queued",
+		Entry:  &entry,
+		Window: &window,
+	})
+}
+
+// GetQueueStatusHandler tells the authenticated user whether they are waiting for a match
+// and returns the last match they got
+func (h *Handler) GetQueueStatusHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	entry, matching, match := h.Matchmaking.Status(uint(principal.UserID))
+
+	response := QueueStatusResponse{Status: "idle", Entry: entry, Match: match}
+	switch {
+	case entry != nil:
+		window := h.Matchmaking.Window(*entry)
+		response.Status = "queued"
+		response.Window = &window
+	case matching:
+		response.Status = "matching"
+	case match != nil:
+		response.Status = "matched"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// LeaveQueueHandler takes the authenticated user out of the matchmaking queue
+func (h *Handler) LeaveQueueHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Matchmaking.Leave(uint(principal.UserID)); err != nil {
+		switch {
+		case errors.Is(err, matchmaking.ErrNotQueued):
+			http.Error(w, "You are not in the matchmaking queue", http.StatusNotFound)
+		case errors.Is(err, matchmaking.ErrMatchFound):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		default:
+			http.Error(w, fmt.Sprintf("Error leaving queue: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Left the matchmaking queue",
+	})
+}
+
+// notifyMatch tells both players of a match made by the queue where to play, on every
+// WebSocket they have open, and pushes the dealt state to the table
+func (h *Handler) notifyMatch(match matchmaking.Match) {
+	for _, player := range []struct {
+		userID uint
+		seat   game.Seat
+	}{
+		{match.OwnerID, game.SeatOwner},
+		{match.RivalID, game.SeatRival},
+	} {
+		h.Hub.Notify(player.userID, realtime.Event{
+			Type:    realtime.EventMatched,
+			TableID: match.TableID,
+			Seat:    string(player.seat),
+			Data:    match,
+		})
+	}
+
+	if match.State != nil {
+		h.publishMatchState(match.TableID, match.State)
+	}
+}
+
+// notifyDropped tells a player the queue gave up seating them, and why, on every WebSocket
+// they have open
+func (h *Handler) notifyDropped(entry matchmaking.Entry, err error) {
+	message := "Could not create your table, please queue again"
+	var deckErr *matchmaking.DeckError
+	if errors.As(err, &deckErr) && deckErr.UserID == entry.UserID {
+		message = fmt.Sprintf("Your deck %s, queue again with another deck", deckErr.Reason)
+	}
+
+	h.Hub.Notify(entry.UserID, realtime.Event{
+		Type: realtime.EventDropped,
+		Data: map[string]interface{}{
+			"entry": entry,
+			"error": message,
+		},
+	})
+}
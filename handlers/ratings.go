@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"tcg-server-go/models"
+)
+
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 100
+
+	defaultRatingHistoryLimit = 20
+	maxRatingHistoryLimit     = 100
+)
+
+// GetLeaderboardHandler lists the players of the ranked ladder by rating, with pagination
+func (h *Handler) GetLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Validate pagination
+	page := 1
+	if value := query.Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, "page must be a positive number", http.StatusBadRequest)
+			return
+		}
+		page = parsed
+	}
+
+	limit := defaultLeaderboardLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLeaderboardLimit {
+			http.Error(w, "limit must be a number between 1 and "+strconv.Itoa(maxLeaderboardLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	entries, total, err := h.Repos.Ratings.GetLeaderboard(limit, (page-1)*limit)
+	if err != nil {
+		http.Error(w, "Error retrieving leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.LeaderboardResponse{
+		Entries: entries,
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetRatingHandler returns the rating of the authenticated user with their latest rating changes
+func (h *Handler) GetRatingHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultRatingHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxRatingHistoryLimit {
+			http.Error(w, "limit must be a number between 1 and "+strconv.Itoa(maxRatingHistoryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	userRating, err := h.Repos.Ratings.GetUserRating(principal.UserID)
+	if err != nil {
+		http.Error(w, "Error retrieving rating", http.StatusInternalServerError)
+		return
+	}
+
+	history, err := h.Repos.Ratings.GetRatingHistory(principal.UserID, limit)
+	if err != nil {
+		http.Error(w, "Error retrieving rating history", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.RatingResponse{
+		Rating:  *userRating,
+		History: history,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -1,52 +1,130 @@
 package handlers
 
 import (
+	"tcg-server-go/mailer"
 	"tcg-server-go/middleware"
+	"tcg-server-go/repository"
 
 	"github.com/gorilla/mux"
 )
 
-func SetupRoutes() *mux.Router {
+// SetupRoutes registers every endpoint, served on top of the given repositories and mailer.
+// It also returns the handlers, whose background work the caller starts and stops.
+func SetupRoutes(repos *repository.Repositories, mail mailer.Mailer) (*mux.Router, *Handler) {
+	h := NewHandler(repos, mail)
 	r := mux.NewRouter()
 
-	r.HandleFunc("/login", LoginHandler).Methods("POST")
-	r.HandleFunc("/register", RegisterHandler).Methods("POST")
-	r.HandleFunc("/verify-email", VerifyEmailHandler).Methods("POST")
-	r.HandleFunc("/resend-code", ResendCodeHandler).Methods("POST")
+	r.HandleFunc("/login", h.LoginHandler).Methods("POST")
+	r.HandleFunc("/register", h.RegisterHandler).Methods("POST")
+	r.HandleFunc("/verify-email", h.VerifyEmailHandler).Methods("POST")
+	r.HandleFunc("/resend-code", h.ResendCodeHandler).Methods("POST")
+	r.HandleFunc("/forgot-password", h.ForgotPasswordHandler).Methods("POST")
+	r.HandleFunc("/reset-password", h.ResetPasswordHandler).Methods("POST")
+	r.HandleFunc("/token/refresh", h.RefreshTokenHandler).Methods("POST")
+	r.HandleFunc("/logout", h.LogoutHandler).Methods("POST")
 	r.HandleFunc("/health", HealthHandler).Methods("GET")
 
 	protected := r.PathPrefix("/api").Subrouter()
-	protected.Use(middleware.AuthMiddleware)
+	protected.Use(middleware.AuthMiddleware(repos.Users, repos.Tokens))
 	protected.HandleFunc("/validate", ValidateTokenHandler).Methods("GET")
 
 	// User Info endpoint (read-only, requires authentication)
-	protected.HandleFunc("/user-info", GetUserInfoHandler).Methods("GET")
+	protected.HandleFunc("/user-info", h.GetUserInfoHandler).Methods("GET")
 
 	// User Cards endpoints (requires authentication)
-	protected.HandleFunc("/user-cards", GetUserCardsHandler).Methods("GET")
-	protected.HandleFunc("/user-cards/{id}", GetUserCardHandler).Methods("GET")
+	protected.HandleFunc("/user-cards", h.GetUserCardsHandler).Methods("GET")
+	protected.HandleFunc("/user-cards/{id}", h.GetUserCardHandler).Methods("GET")
+	protected.HandleFunc("/collection", h.GetCollectionHandler).Methods("GET")
 
 	// Deck endpoints (requires authentication)
-	protected.HandleFunc("/decks", GetDecksHandler).Methods("GET")
-	protected.HandleFunc("/decks", CreateDeckHandler).Methods("POST")
-	protected.HandleFunc("/decks/limit", GetDeckLimitHandler).Methods("GET")
-	protected.HandleFunc("/decks/{id}", GetDeckHandler).Methods("GET")
-	protected.HandleFunc("/decks/{id}/cards", GetDeckWithCardsHandler).Methods("GET")
-	protected.HandleFunc("/decks/{id}", UpdateDeckHandler).Methods("PUT")
-	protected.HandleFunc("/decks/{id}", DeleteDeckHandler).Methods("DELETE")
+	protected.HandleFunc("/decks", h.GetDecksHandler).Methods("GET")
+	protected.HandleFunc("/decks", h.CreateDeckHandler).Methods("POST")
+	protected.HandleFunc("/decks/limit", h.GetDeckLimitHandler).Methods("GET")
+	protected.HandleFunc("/decks/import", h.ImportDeckHandler).Methods("POST")
+	protected.HandleFunc("/decks/{id}", h.GetDeckHandler).Methods("GET")
+	protected.HandleFunc("/decks/{id}/cards", h.GetDeckWithCardsHandler).Methods("GET")
+	protected.HandleFunc("/decks/{id}/validation", h.GetDeckValidationHandler).Methods("GET")
+	protected.HandleFunc("/decks/{id}/export", h.ExportDeckHandler).Methods("GET")
+	protected.HandleFunc("/decks/{id}", h.UpdateDeckHandler).Methods("PUT")
+	protected.HandleFunc("/decks/{id}", h.DeleteDeckHandler).Methods("DELETE")
+
+	// Deck format endpoints (requires authentication)
+	protected.HandleFunc("/formats", h.GetFormatsHandler).Methods("GET")
+	protected.HandleFunc("/formats/{code}", h.GetFormatHandler).Methods("GET")
+
+	// Live table events (authenticates with the token during the handshake)
+	r.HandleFunc("/ws/tables/{id}", h.TableSocketHandler).Methods("GET")
 
 	// Card endpoints (public access for reading only)
-	r.HandleFunc("/cards", GetAllCardsHandler).Methods("GET")
-	r.HandleFunc("/cards/search", SearchCardsHandler).Methods("GET")
-	r.HandleFunc("/cards/type/{type}", GetCardsByTypeHandler).Methods("GET")
-	r.HandleFunc("/cards/element/{element}", GetCardsByElementHandler).Methods("GET")
-	r.HandleFunc("/cards/{id}", GetCardByIDHandler).Methods("GET")
+	r.HandleFunc("/cards", h.GetAllCardsHandler).Methods("GET")
+	r.HandleFunc("/cards/search", h.SearchCardsHandler).Methods("GET")
+	r.HandleFunc("/cards/type/{type}", h.GetCardsByTypeHandler).Methods("GET")
+	r.HandleFunc("/cards/element/{element}", h.GetCardsByElementHandler).Methods("GET")
+	r.HandleFunc("/cards/{id}", h.GetCardByIDHandler).Methods("GET")
+	r.HandleFunc("/effects", h.GetEffectsHandler).Methods("GET")
+	r.HandleFunc("/effects/{id}", h.GetEffectHandler).Methods("GET")
+
+	// Leaderboard endpoint (public access)
+	r.HandleFunc("/leaderboard", h.GetLeaderboardHandler).Methods("GET")
 
 	// Table endpoints (protected, requires authentication)
-	protected.HandleFunc("/tables", CreateTable).Methods("POST")
-	protected.HandleFunc("/tables", GetUserTables).Methods("GET")
-	protected.HandleFunc("/tables/{id}", UpdateTable).Methods("PUT")
-	protected.HandleFunc("/tables/{id}/time", UpdateUserTableTime).Methods("PUT")
+	protected.HandleFunc("/tables", h.CreateTable).Methods("POST")
+	protected.HandleFunc("/tables", h.GetUserTables).Methods("GET")
+	protected.HandleFunc("/tables/{id}", h.UpdateTable).Methods("PUT")
+	protected.HandleFunc("/tables/{id}/join", h.JoinTable).Methods("POST")
+
+	// Lobby endpoint (protected, requires authentication)
+	protected.HandleFunc("/lobby", h.GetLobby).Methods("GET")
+	protected.HandleFunc("/tables/{id}/state", h.GetTableState).Methods("GET")
+	protected.HandleFunc("/tables/{id}/actions", h.PerformTableAction).Methods("POST")
+
+	// Matchmaking endpoints (requires authentication)
+	protected.HandleFunc("/matchmaking/queue", h.JoinQueueHandler).Methods("POST")
+	protected.HandleFunc("/matchmaking/queue", h.GetQueueStatusHandler).Methods("GET")
+	protected.HandleFunc("/matchmaking/queue", h.LeaveQueueHandler).Methods("DELETE")
+
+	// Ranked ladder endpoint (requires authentication)
+	protected.HandleFunc("/rating", h.GetRatingHandler).Methods("GET")
+
+	// Store endpoints (requires authentication)
+	protected.HandleFunc("/store/packs", h.GetPacksHandler).Methods("GET")
+	protected.HandleFunc("/store/packs/{id}/open", h.OpenPackHandler).Methods("POST")
+
+	// Trade endpoints (requires authentication)
+	protected.HandleFunc("/trades", h.CreateTradeHandler).Methods("POST")
+	protected.HandleFunc("/trades", h.GetTradesHandler).Methods("GET")
+	protected.HandleFunc("/trades/{id}", h.GetTradeHandler).Methods("GET")
+	protected.HandleFunc("/trades/{id}/counter", h.CounterTradeHandler).Methods("POST")
+	protected.HandleFunc("/trades/{id}/accept", h.AcceptTradeHandler).Methods("POST")
+	protected.HandleFunc("/trades/{id}/decline", h.DeclineTradeHandler).Methods("POST")
+	protected.HandleFunc("/trades/{id}/cancel", h.CancelTradeHandler).Methods("POST")
+
+	// Marketplace endpoints (requires authentication)
+	protected.HandleFunc("/market/listings", h.SearchListingsHandler).Methods("GET")
+	protected.HandleFunc("/market/listings", h.CreateListingHandler).Methods("POST")
+	protected.HandleFunc("/market/listings/{id}", h.GetListingHandler).Methods("GET")
+	protected.HandleFunc("/market/listings/{id}/buy", h.BuyListingHandler).Methods("POST")
+	protected.HandleFunc("/market/listings/{id}/cancel", h.CancelListingHandler).Methods("POST")
+	protected.HandleFunc("/market/cards/{id}/history", h.GetPriceHistoryHandler).Methods("GET")
+
+	// Admin endpoints (requires authentication and the admin role)
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.AuthMiddleware(repos.Users, repos.Tokens), middleware.RequireRole(middleware.RoleAdmin))
+	admin.HandleFunc("/cards", h.AdminCreateCardHandler).Methods("POST")
+	admin.HandleFunc("/cards/{id}", h.AdminUpdateCardHandler).Methods("PUT", "PATCH")
+	admin.HandleFunc("/cards/{id}", h.AdminDeleteCardHandler).Methods("DELETE")
+	admin.HandleFunc("/cards/{id}/effects/{effectId}", h.AdminAddCardEffectHandler).Methods("POST")
+	admin.HandleFunc("/cards/{id}/effects/{effectId}", h.AdminRemoveCardEffectHandler).Methods("DELETE")
+	admin.HandleFunc("/effects", h.AdminGetEffectsHandler).Methods("GET")
+	admin.HandleFunc("/effects", h.AdminCreateEffectHandler).Methods("POST")
+	admin.HandleFunc("/effects/{id}", h.AdminUpdateEffectHandler).Methods("PUT")
+	admin.HandleFunc("/effects/{id}", h.AdminDeleteEffectHandler).Methods("DELETE")
+	admin.HandleFunc("/packs", h.AdminCreatePackHandler).Methods("POST")
+	admin.HandleFunc("/packs/{id}", h.AdminUpdatePackHandler).Methods("PUT")
+	admin.HandleFunc("/packs/{id}", h.AdminDeletePackHandler).Methods("DELETE")
+	admin.HandleFunc("/formats/{code}", h.AdminSaveFormatHandler).Methods("PUT")
+	admin.HandleFunc("/formats/{code}/cards", h.AdminSetFormatCardsHandler).Methods("PUT")
+	admin.HandleFunc("/audit", h.AdminGetAuditLogHandler).Methods("GET")
 
-	return r
+	return r, h
 }
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"tcg-server-go/auth"
+	"tcg-server-go/middleware"
+	"tcg-server-go/models"
+
+	"github.com/gorilla/mux"
+)
+
+// routeVariable matches the variables of a route template, such as {id}
+var routeVariable = regexp.MustCompile(`\{[^}]+\}`)
+
+// protectedRoute is a route of the API with its variables filled in
+type protectedRoute struct {
+	method string
+	path   string
+}
+
+// protectedRoutes lists every route under a prefix. Variables are set to 1, which names
+// nothing in an empty store.
+func protectedRoutes(t *testing.T, router *mux.Router, prefix string) []protectedRoute {
+	t.Helper()
+	var routes []protectedRoute
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, prefix+"/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // A subrouter
+		}
+		for _, method := range methods {
+			routes = append(routes, protectedRoute{method: method, path: routeVariable.ReplaceAllString(template, "1")})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) == 0 {
+		t.Fatalf("no routes under %s", prefix)
+	}
+	return routes
+}
+
+// refusedByMiddleware reports whether a response is a 403 of the auth middleware rather
+// than of a handler, such as one refusing to update the table of another player
+func refusedByMiddleware(rec *httptest.ResponseRecorder) bool {
+	if rec.Code != http.StatusForbidden {
+		return false
+	}
+	var response struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return response.Error == middleware.ErrEmailNotVerified.Error() ||
+		strings.HasPrefix(response.Error, "This resource requires the")
+}
+
+func TestRoutesRequireAuthentication(t *testing.T) {
+	s := newTestServer(t)
+	user, userToken := s.user(t, "Player", false)
+	_, adminToken := s.user(t, "Administrator", true)
+
+	// A token of a user who has not verified their email
+	unverified := &models.User{Name: "Unverified", Email: "unverified@example.com", Password: "secret1"}
+	if err := s.repos.Users.CreateUser(unverified); err != nil {
+		t.Fatal(err)
+	}
+	unverifiedToken, err := auth.GenerateToken(unverified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A token issued before the last password change
+	stale := &models.User{Name: "Stale", Email: "stale@example.com", Password: "secret1", ValidatedAt: &time.Time{}}
+	if err := s.repos.Users.CreateUser(stale); err != nil {
+		t.Fatal(err)
+	}
+	staleToken, err := auth.GenerateToken(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repos.Users.UpdatePassword(stale.ID, "secret2"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		prefix  string
+		token   string
+		spoof   bool // Also claim to be the user with the X-User-ID header
+		allowed bool // Whether the request gets past authentication
+		status  int  // Status of refused requests
+	}{
+		{name: "no token", prefix: "/api", status: http.StatusUnauthorized},
+		{name: "spoofed user header", prefix: "/api", spoof: true, status: http.StatusUnauthorized},
+		{name: "invalid token", prefix: "/api", token: "not-a-token", spoof: true, status: http.StatusUnauthorized},
+		{name: "revoked token", prefix: "/api", token: staleToken, status: http.StatusUnauthorized},
+		{name: "unverified email", prefix: "/api", token: unverifiedToken, status: http.StatusForbidden},
+		{name: "valid token", prefix: "/api", token: userToken, allowed: true},
+		{name: "no token", prefix: "/admin", status: http.StatusUnauthorized},
+		{name: "spoofed user header", prefix: "/admin", spoof: true, status: http.StatusUnauthorized},
+		{name: "not an admin", prefix: "/admin", token: userToken, status: http.StatusForbidden},
+		{name: "admin token", prefix: "/admin", token: adminToken, allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix+" "+tt.name, func(t *testing.T) {
+			for _, route := range protectedRoutes(t, s.router, tt.prefix) {
+				req, _ := http.NewRequest(route.method, route.path, strings.NewReader("{}"))
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				if tt.spoof {
+					req.Header.Set("X-User-ID", "1")
+				}
+				rec := s.serve(req)
+
+				if tt.allowed {
+					if rec.Code == http.StatusUnauthorized || refusedByMiddleware(rec) {
+						t.Errorf("%s %s = %d %s, want it past authentication", route.method, route.path, rec.Code, rec.Body)
+					}
+					continue
+				}
+				if rec.Code != tt.status {
+					t.Errorf("%s %s = %d, want %d", route.method, route.path, rec.Code, tt.status)
+				}
+				if tt.status == http.StatusForbidden && !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+					t.Errorf("%s %s answered 403 with %q, want JSON", route.method, route.path, rec.Header().Get("Content-Type"))
+				}
+			}
+		})
+	}
+
+	// The handlers act for the user of the token, whatever the headers claim
+	req, _ := http.NewRequest("GET", "/api/user-info", nil)
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	req.Header.Set("X-User-ID", "2")
+	rec := s.serve(req)
+	var response struct {
+		UserInfo models.UserInfo `json:"user_info"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || response.UserInfo.UserID != user.ID {
+		t.Errorf("GET /api/user-info = %d, user %d; want user %d", rec.Code, response.UserInfo.UserID, user.ID)
+	}
+}
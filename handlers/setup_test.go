@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tcg-server-go/auth"
+	"tcg-server-go/mailer"
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+
+	"github.com/gorilla/mux"
+)
+
+// testServer is the router of the API backed by an in-memory store, with an outbox
+// catching the emails it sends
+type testServer struct {
+	mem     *repository.Memory
+	repos   *repository.Repositories
+	outbox  *mailer.Outbox
+	router  *mux.Router
+	handler *Handler
+
+	mu   sync.Mutex
+	hits map[string]bool // Routes served, as "METHOD template"
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	mem := repository.NewMemory()
+	repos := mem.Repositories()
+	outbox := mailer.NewOutbox(t.TempDir(), mailer.DefaultFrom)
+	router, handler := SetupRoutes(repos, outbox)
+	return &testServer{mem: mem, repos: repos, outbox: outbox, router: router, handler: handler, hits: make(map[string]bool)}
+}
+
+// user creates a user with a verified email, and the admin role if asked, and returns them
+// with an access token
+func (s *testServer) user(t *testing.T, name string, admin bool) (*models.User, string) {
+	t.Helper()
+	now := time.Now()
+	user := &models.User{Name: name, Email: strings.ToLower(name) + "@example.com", Password: "secret1", ValidatedAt: &now}
+	if err := s.repos.Users.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser(%s): %v", name, err)
+	}
+	if _, err := s.repos.UserInfo.CreateDefaultUserInfo(user.ID); err != nil {
+		t.Fatalf("CreateDefaultUserInfo(%s): %v", name, err)
+	}
+	if admin {
+		if err := s.mem.SetUserRole(user.ID, models.RoleAdmin); err != nil {
+			t.Fatalf("SetUserRole(%s): %v", name, err)
+		}
+		user.Role = models.RoleAdmin
+	}
+
+	token, err := auth.GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken(%s): %v", name, err)
+	}
+	return user, token
+}
+
+// do sends a request through the router, with the token as bearer if there is one
+func (s *testServer) do(t *testing.T, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return s.serve(req)
+}
+
+// serve sends a prepared request through the router and records the route it matched
+func (s *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	var match mux.RouteMatch
+	if s.router.Match(req, &match) && match.Route != nil {
+		if template, err := match.Route.GetPathTemplate(); err == nil {
+			s.mu.Lock()
+			s.hits[req.Method+" "+template] = true
+			s.mu.Unlock()
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// table seats two players at a new table and deals their match. Neither has a deck, so the
+// match starts with empty hands.
+func (s *testServer) table(t *testing.T, owner, rival *models.User) uint {
+	t.Helper()
+	tableID, err := s.repos.Tables.CreateTable("C", "public", models.PrizeAura, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	if err := s.repos.Tables.CreateUserTable(uint(owner.ID), tableID, nil, 0); err != nil {
+		t.Fatalf("CreateUserTable: %v", err)
+	}
+	if joined, err := s.repos.Tables.JoinTable(tableID, uint(rival.ID), 0, nil); err != nil || !joined {
+		t.Fatalf("JoinTable = %v, %v", joined, err)
+	}
+	if _, err := s.handler.Matches.StartMatch(tableID, 0, 0); err != nil {
+		t.Fatalf("StartMatch: %v", err)
+	}
+	return tableID
+}
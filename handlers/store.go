@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"tcg-server-go/models"
+	"tcg-server-go/store"
+
+	"github.com/gorilla/mux"
+)
+
+// GetPacksHandler lists the booster packs sold in the store
+func (h *Handler) GetPacksHandler(w http.ResponseWriter, r *http.Request) {
+	packs, err := h.Repos.Packs.GetPacks()
+	if err != nil {
+		http.Error(w, "Error retrieving packs", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.PacksResponse{
+		Packs:   packs,
+		Message: "Packs retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// OpenPackHandler buys a booster pack with the money of the authenticated user and adds the
+// pulled cards to their collection
+func (h *Handler) OpenPackHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	packID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid pack ID", http.StatusBadRequest)
+		return
+	}
+
+	opening, cards, err := h.Store.OpenPack(principal.UserID, packID)
+	switch {
+	case errors.Is(err, store.ErrPackNotFound):
+		http.Error(w, "Pack not found", http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrInsufficientFunds):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusPaymentRequired)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Not enough money to buy this pack"})
+		return
+	case errors.Is(err, store.ErrEmptyPack):
+		http.Error(w, "This pack cannot be opened right now", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Error opening pack", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.PackOpeningResponse{
+		Opening: opening,
+		Cards:   cards,
+		Message: "Pack opened successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminCreatePackHandler adds a booster pack to the store
+func (h *Handler) AdminCreatePackHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	packReq, ok := decodePackRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if h.packNameTaken(w, packReq.Name, 0) {
+		return
+	}
+
+	pack := &models.Pack{
+		Name:        packReq.Name,
+		Description: packReq.Description,
+		Price:       packReq.Price,
+		SetCode:     packReq.SetCode,
+		Slots:       packReq.Slots,
+	}
+	audit, ok := auditEntry(w, principal, models.AuditActionCreate, models.AuditEntityPack, 0, nil)
+	if !ok {
+		return
+	}
+	if err := h.Repos.Packs.CreatePack(pack, audit); err != nil {
+		http.Error(w, "Error creating pack", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.PackResponse{
+		Pack:    pack,
+		Message: "Pack created successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminUpdatePackHandler replaces the name, description, price, set and slots of a pack.
+// Packs already opened keep the cards they gave.
+func (h *Handler) AdminUpdatePackHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid pack ID", http.StatusBadRequest)
+		return
+	}
+
+	packReq, ok := decodePackRequest(w, r)
+	if !ok {
+		return
+	}
+
+	before, err := h.Repos.Packs.GetPackByID(id)
+	if err != nil {
+		http.Error(w, "Error retrieving pack", http.StatusInternalServerError)
+		return
+	}
+	if before == nil {
+		http.Error(w, "Pack not found", http.StatusNotFound)
+		return
+	}
+
+	if packReq.Name != before.Name && h.packNameTaken(w, packReq.Name, id) {
+		return
+	}
+
+	pack := *before
+	pack.Name = packReq.Name
+	pack.Description = packReq.Description
+	pack.Price = packReq.Price
+	pack.SetCode = packReq.SetCode
+	pack.Slots = packReq.Slots
+	audit, ok := auditEntry(w, principal, models.AuditActionUpdate, models.AuditEntityPack, id, before)
+	if !ok {
+		return
+	}
+	err = h.Repos.Packs.UpdatePack(&pack, audit)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Pack not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating pack", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.PackResponse{
+		Pack:    &pack,
+		Message: "Pack updated successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// AdminDeletePackHandler takes a pack off the store. It is soft deleted so the openings
+// of the pack are kept.
+func (h *Handler) AdminDeletePackHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid pack ID", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.Repos.Packs.GetPackByID(id)
+	if err != nil {
+		http.Error(w, "Error retrieving pack", http.StatusInternalServerError)
+		return
+	}
+	if before == nil {
+		http.Error(w, "Pack not found", http.StatusNotFound)
+		return
+	}
+
+	audit, ok := auditEntry(w, principal, models.AuditActionDelete, models.AuditEntityPack, id, before)
+	if !ok {
+		return
+	}
+	if err := h.Repos.Packs.SoftDeletePack(id, audit); err != nil {
+		http.Error(w, "Error deleting pack", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Pack deleted successfully"})
+}
+
+// decodePackRequest reads and validates the pack in the body of a request, responding with
+// the problems of invalid packs
+func decodePackRequest(w http.ResponseWriter, r *http.Request) (*models.PackRequest, bool) {
+	var packReq models.PackRequest
+	if err := json.NewDecoder(r.Body).Decode(&packReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	validationErrors := ValidateStruct(&packReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return nil, false
+	}
+
+	return &packReq, true
+}
+
+// packNameTaken reports whether another pack than id, deleted or not, has a name, and
+// responds if so
+func (h *Handler) packNameTaken(w http.ResponseWriter, name string, id int) bool {
+	existing, err := h.Repos.Packs.GetPackByName(name)
+	if err != nil {
+		http.Error(w, "Error checking pack name", http.StatusInternalServerError)
+		return true
+	}
+	if existing != nil && existing.ID != id {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A pack with this name already exists"})
+		return true
+	}
+	return false
+}
@@ -1,14 +1,20 @@
 package handlers
 
 import (
-	"database/sql"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
-	"tcg-server-go/database"
+	"tcg-server-go/game"
+	"tcg-server-go/models"
+	"tcg-server-go/rating"
+	"tcg-server-go/realtime"
 
 	"github.com/gorilla/mux"
 )
@@ -20,29 +26,41 @@ type CreateTableRequest struct {
 	Password *string `json:"password,omitempty"`
 	Prize    string  `json:"prize"`
 	Amount   *int    `json:"amount,omitempty"`
+	DeckID   uint    `json:"deck_id"`
+	// StakeCardID is the card the owner stakes, required when the prize is a card
+	StakeCardID *int `json:"stake_card_id,omitempty"`
+	// InitialTime is the seconds on each player's clock; the table is untimed without it
+	InitialTime   *int `json:"initial_time,omitempty"`
+	TimeIncrement int  `json:"time_increment,omitempty"` // Seconds added when a turn ends
 }
 
 // UpdateTableRequest represents the request body for updating a table
 type UpdateTableRequest struct {
-	Category string  `json:"category,omitempty"`
-	Privacy  string  `json:"privacy,omitempty"`
-	Password *string `json:"password,omitempty"`
-	Prize    string  `json:"prize,omitempty"`
-	Amount   *int    `json:"amount,omitempty"`
+	Category    string  `json:"category,omitempty"`
+	Privacy     string  `json:"privacy,omitempty"`
+	Password    *string `json:"password,omitempty"`
+	Prize       string  `json:"prize,omitempty"`
+	Amount      *int    `json:"amount,omitempty"`
+	StakeCardID *int    `json:"stake_card_id,omitempty"`
+	// InitialTime of 0 makes the table untimed
+	InitialTime   *int `json:"initial_time,omitempty"`
+	TimeIncrement *int `json:"time_increment,omitempty"`
 }
 
 // TableResponse represents the response for table operations
 type TableResponse struct {
-	ID         uint    `json:"id"`
-	Category   string  `json:"category"`
-	Privacy    string  `json:"privacy"`
-	Password   *string `json:"password,omitempty"`
-	Prize      string  `json:"prize"`
-	Amount     *int    `json:"amount,omitempty"`
-	Winner     *bool   `json:"winner,omitempty"`
-	CreatedAt  string  `json:"created_at"`
-	UpdatedAt  string  `json:"updated_at"`
-	FinishedAt *string `json:"finished_at,omitempty"`
+	ID            uint       `json:"id"`
+	Category      string     `json:"category"`
+	Privacy       string     `json:"privacy"`
+	Password      *string    `json:"password,omitempty"`
+	Prize         string     `json:"prize"`
+	Amount        *int       `json:"amount,omitempty"`
+	InitialTime   *int       `json:"initial_time,omitempty"`
+	TimeIncrement int        `json:"time_increment"`
+	Winner        *bool      `json:"winner,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
 }
 
 // UserTableResponse represents the response for user table operations
@@ -52,6 +70,7 @@ type UserTableResponse struct {
 	RivalID    *uint         `json:"rival_id,omitempty"`
 	TableID    uint          `json:"table_id"`
 	Time       int           `json:"time"`
+	StakeCard  *int          `json:"stake_card_id,omitempty"`
 	Table      TableResponse `json:"table"`
 	UserName   string        `json:"user_name"`
 	UserEmail  string        `json:"user_email"`
@@ -59,14 +78,48 @@ type UserTableResponse struct {
 	RivalEmail *string       `json:"rival_email,omitempty"`
 }
 
+// newUserTableResponse builds the response of a user table; table passwords are not exposed
+func newUserTableResponse(userTable models.UserTable) UserTableResponse {
+	response := UserTableResponse{
+		ID:        userTable.ID,
+		UserID:    userTable.UserID,
+		RivalID:   userTable.RivalID,
+		TableID:   userTable.TableID,
+		Time:      userTable.Time,
+		StakeCard: userTable.StakeCardID,
+		UserName:  userTable.User.Name,
+		UserEmail: userTable.User.Email,
+		Table: TableResponse{
+			ID:            userTable.Table.ID,
+			Category:      userTable.Table.Category,
+			Privacy:       userTable.Table.Privacy,
+			Prize:         userTable.Table.Prize,
+			Amount:        userTable.Table.Amount,
+			InitialTime:   userTable.Table.InitialTime,
+			TimeIncrement: userTable.Table.TimeIncrement,
+			Winner:        userTable.Table.Winner,
+			CreatedAt:     userTable.Table.CreatedAt,
+			UpdatedAt:     userTable.Table.UpdatedAt,
+			FinishedAt:    userTable.Table.FinishedAt,
+		},
+	}
+
+	if userTable.Rival != nil {
+		response.RivalName = &userTable.Rival.Name
+		response.RivalEmail = &userTable.Rival.Email
+	}
+
+	return response
+}
+
 // CreateTable creates a new table and associates it with the logged-in user
-func CreateTable(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(uint)
+func (h *Handler) CreateTable(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := uint(principal.UserID)
 
 	// Parse request body
 	var req CreateTableRequest
@@ -76,8 +129,8 @@ func CreateTable(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate required fields
-	if req.Category == "" || req.Privacy == "" || req.Prize == "" {
-		http.Error(w, "Category, privacy, and prize are required", http.StatusBadRequest)
+	if req.Category == "" || req.Privacy == "" || req.Prize == "" || req.DeckID == 0 {
+		http.Error(w, "Category, privacy, prize, and deck_id are required", http.StatusBadRequest)
 		return
 	}
 
@@ -116,24 +169,58 @@ func CreateTable(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Create table
-	result, err := database.CreateTable(req.Category, req.Privacy, req.Prize, req.Password, req.Amount)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creating table: %v", err), http.StatusInternalServerError)
+	// Private tables are not listed, so their password is the only way to join them
+	if req.Privacy == "private" && (req.Password == nil || *req.Password == "") {
+		http.Error(w, "Private tables require a password", http.StatusBadRequest)
 		return
 	}
 
-	// Get the table ID
-	tableID, err := (*result).LastInsertId()
-	if err != nil {
-		http.Error(w, "Error getting table ID", http.StatusInternalServerError)
+	if req.Amount != nil && *req.Amount < 0 {
+		http.Error(w, "Amount must be a positive number", http.StatusBadRequest)
 		return
 	}
 
-	// Create user table association with rival_id as null
-	err = database.CreateUserTable(uint(userID), uint(tableID), nil)
+	if status, message := checkTimeControl(req.InitialTime, req.TimeIncrement); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// The rating of the owner must allow the category
+	if status, message := h.checkTableCategory(userID, req.Category); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// Validate the deck the owner will play with
+	if status, message := h.checkTableDeck(userID, req.DeckID); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// The owner must be able to put up their stake
+	stake := &models.Table{Prize: req.Prize, Amount: req.Amount}
+	if status, message := h.checkTableStake(userID, stake, req.StakeCardID); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// Create the table with the owner seated and rival_id as null
+	settings := models.TableSettings{
+		Category:      req.Category,
+		Privacy:       req.Privacy,
+		Password:      req.Password,
+		Prize:         req.Prize,
+		Amount:        req.Amount,
+		InitialTime:   req.InitialTime,
+		TimeIncrement: req.TimeIncrement,
+	}
+	if req.Prize == models.PrizeCard {
+		settings.StakeCardID = req.StakeCardID
+	}
+
+	tableID, err := h.Repos.Tables.OpenTable(userID, req.DeckID, settings)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creating user table association: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error creating table: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -147,13 +234,13 @@ func CreateTable(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateTable updates table parameters (only if user is owner and table is waiting for rival)
-func UpdateTable(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, ok := r.Context().Value("user_id").(uint)
+func (h *Handler) UpdateTable(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := uint(principal.UserID)
 
 	// Get table ID from URL
 	pathParts := strings.Split(r.URL.Path, "/")
@@ -170,7 +257,7 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user is the owner of the table
-	isOwner, err := database.IsTableOwner(userID, uint(tableID))
+	isOwner, err := h.Repos.Tables.IsTableOwner(userID, uint(tableID))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error checking table ownership: %v", err), http.StatusInternalServerError)
 		return
@@ -182,7 +269,7 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if table is waiting for rival
-	isWaiting, err := database.IsTableWaitingForRival(uint(tableID))
+	isWaiting, err := h.Repos.Tables.IsTableWaitingForRival(uint(tableID))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error checking table status: %v", err), http.StatusInternalServerError)
 		return
@@ -201,26 +288,21 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current table data to merge with updates
-	row, err := database.GetTableByID(uint(tableID))
+	table, err := h.Repos.Tables.GetTableByID(uint(tableID))
 	if err != nil {
 		http.Error(w, "Error retrieving table", http.StatusInternalServerError)
 		return
 	}
 
-	var currentCategory, currentPrivacy, currentPrize string
-	var currentPassword *string
-	var currentAmount *int
-	var currentWinner *bool
-	var currentCreatedAt, currentUpdatedAt string
-	var currentFinishedAt *string
-
-	err = row.Scan(&tableID, &currentCategory, &currentPrivacy, &currentPassword, &currentPrize, &currentAmount,
-		&currentWinner, &currentCreatedAt, &currentUpdatedAt, &currentFinishedAt)
-	if err != nil {
-		http.Error(w, "Error reading table data", http.StatusInternalServerError)
+	if table == nil {
+		http.Error(w, "Table not found", http.StatusNotFound)
 		return
 	}
 
+	currentCategory, currentPrivacy, currentPrize := table.Category, table.Privacy, table.Prize
+	currentPassword, currentAmount := table.Password, table.Amount
+	currentInitialTime, currentIncrement := table.InitialTime, table.TimeIncrement
+
 	// Merge updates with current values
 	if req.Category != "" {
 		validCategories := map[string]bool{"S": true, "A": true, "B": true, "C": true, "D": true}
@@ -228,6 +310,10 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid category. Must be S, A, B, C, or D", http.StatusBadRequest)
 			return
 		}
+		if status, message := h.checkTableCategory(userID, req.Category); status != 0 {
+			http.Error(w, message, status)
+			return
+		}
 		currentCategory = req.Category
 	}
 
@@ -263,6 +349,11 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 		currentPassword = req.Password
 	}
 
+	if currentPrivacy == "private" && (currentPassword == nil || *currentPassword == "") {
+		http.Error(w, "Private tables require a password", http.StatusBadRequest)
+		return
+	}
+
 	if req.Amount != nil {
 		if *req.Amount < 0 {
 			http.Error(w, "Amount must be a positive number", http.StatusBadRequest)
@@ -271,8 +362,66 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 		currentAmount = req.Amount
 	}
 
-	// Update table
-	err = database.UpdateTable(uint(tableID), currentCategory, currentPrivacy, currentPrize, currentPassword, currentAmount)
+	if req.InitialTime != nil {
+		currentInitialTime = req.InitialTime
+		if *req.InitialTime == 0 {
+			currentInitialTime = nil
+		}
+	}
+	if req.TimeIncrement != nil {
+		currentIncrement = *req.TimeIncrement
+	}
+	if currentInitialTime == nil {
+		currentIncrement = 0
+	}
+	if status, message := checkTimeControl(currentInitialTime, currentIncrement); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// Keep the stake card unless a new one is chosen, and drop it if the prize is no longer a card
+	stakeCardID := req.StakeCardID
+	if stakeCardID == nil {
+		userTables, err := h.Repos.Tables.GetUserTablesByUserID(userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error retrieving user tables: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, ut := range userTables {
+			if ut.TableID == uint(tableID) {
+				stakeCardID = ut.StakeCardID
+				break
+			}
+		}
+	}
+	if currentPrize != models.PrizeCard {
+		stakeCardID = nil
+	}
+
+	stake := &models.Table{Prize: currentPrize, Amount: currentAmount}
+	if status, message := h.checkTableStake(userID, stake, stakeCardID); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// Update the table, its stake card and its time control together
+	err = h.Repos.Tables.UpdateTable(uint(tableID), models.TableSettings{
+		Category:      currentCategory,
+		Privacy:       currentPrivacy,
+		Password:      currentPassword,
+		Prize:         currentPrize,
+		Amount:        currentAmount,
+		StakeCardID:   stakeCardID,
+		InitialTime:   currentInitialTime,
+		TimeIncrement: currentIncrement,
+	})
+	if errors.Is(err, models.ErrTableTaken) {
+		// A rival joined since the table was checked
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "A rival joined the table, it can no longer be updated"})
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error updating table: %v", err), http.StatusInternalServerError)
 		return
@@ -287,160 +436,312 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetUserTables retrieves all tables for the logged-in user
-func GetUserTables(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, ok := r.Context().Value("user_id").(uint)
+func (h *Handler) GetUserTables(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := uint(principal.UserID)
 
 	// Get user tables
-	rows, err := database.GetUserTablesByUserID(userID)
+	userTables, err := h.Repos.Tables.GetUserTablesByUserID(userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving user tables: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var userTables []UserTableResponse
-	for rows.Next() {
-		var ut UserTableResponse
-		var rivalName, rivalEmail sql.NullString
-
-		err := rows.Scan(
-			&ut.ID, &ut.UserID, &ut.RivalID, &ut.TableID, &ut.Time,
-			&ut.UserName, &ut.UserEmail,
-			&rivalName, &rivalEmail,
-			&ut.Table.Category, &ut.Table.Privacy, &ut.Table.Prize, &ut.Table.Amount, &ut.Table.Winner,
-			&ut.Table.CreatedAt, &ut.Table.UpdatedAt, &ut.Table.FinishedAt,
-		)
-		if err != nil {
-			http.Error(w, "Error reading table data", http.StatusInternalServerError)
-			return
-		}
-
-		// Handle nullable rival fields
-		if rivalName.Valid {
-			ut.RivalName = &rivalName.String
-		}
-		if rivalEmail.Valid {
-			ut.RivalEmail = &rivalEmail.String
-		}
-
-		userTables = append(userTables, ut)
+	var response []UserTableResponse
+	for _, userTable := range userTables {
+		response = append(response, newUserTableResponse(userTable))
 	}
 
 	// Return response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"tables": userTables,
+		"tables": response,
 	})
 }
 
-// UpdateUserTableTimeRequest represents the request for updating user table time
-type UpdateUserTableTimeRequest struct {
-	Time int `json:"time"`
+// JoinTableRequest represents the request body for joining a table as rival
+type JoinTableRequest struct {
+	DeckID   uint    `json:"deck_id"`
+	Password *string `json:"password,omitempty"`
+	// StakeCardID is the card the rival stakes, required when the prize is a card
+	StakeCardID *int `json:"stake_card_id,omitempty"`
 }
 
-// UpdateUserTableTime updates the time field for a user table
-func UpdateUserTableTime(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, ok := r.Context().Value("user_id").(uint)
+// JoinTable seats the logged-in user as rival of a table waiting for one and starts the match
+func (h *Handler) JoinTable(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	userID := uint(principal.UserID)
 
 	// Get table ID from URL parameters
-	vars := mux.Vars(r)
-	tableIDStr, ok := vars["id"]
-	if !ok {
-		http.Error(w, "Table ID is required", http.StatusBadRequest)
-		return
-	}
-
-	tableID, err := strconv.ParseUint(tableIDStr, 10, 32)
+	tableID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
 	if err != nil {
 		http.Error(w, "Invalid table ID", http.StatusBadRequest)
 		return
 	}
 
 	// Parse request body
-	var req UpdateUserTableTimeRequest
+	var req JoinTableRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Validate time value
-	if req.Time < 0 {
-		http.Error(w, "Time must be a non-negative number", http.StatusBadRequest)
+	if req.DeckID == 0 {
+		http.Error(w, "deck_id is required", http.StatusBadRequest)
 		return
 	}
 
-	// Check if user is associated with this table
-	isOwner, err := database.IsTableOwner(userID, uint(tableID))
+	// Validate password format if provided
+	if req.Password != nil {
+		if len(*req.Password) > 10 {
+			http.Error(w, "Password must be 10 characters or less", http.StatusBadRequest)
+			return
+		}
+		for _, char := range *req.Password {
+			if char < '0' || char > '9' {
+				http.Error(w, "Password must contain only numeric characters", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	// Get table data
+	table, err := h.Repos.Tables.GetTableByID(uint(tableID))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error checking table ownership: %v", err), http.StatusInternalServerError)
+		http.Error(w, "Error retrieving table", http.StatusInternalServerError)
 		return
 	}
 
-	if !isOwner {
-		http.Error(w, "You can only update time for your own tables", http.StatusForbidden)
+	if table == nil {
+		http.Error(w, "Table not found", http.StatusNotFound)
 		return
 	}
 
-	// Get the user table ID (we need to find the user table record)
-	// For now, we'll use a simple approach - you might want to add a function to get user table by user and table IDs
-	rows, err := database.GetUserTablesByUserID(userID)
+	if table.FinishedAt != nil {
+		http.Error(w, "Table is already finished", http.StatusConflict)
+		return
+	}
+
+	// Check the owner is not joining their own table
+	ownerID, rivalID, err := h.Repos.Tables.GetTablePlayers(uint(tableID))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error retrieving user tables: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error checking table players: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var userTableID uint
-	found := false
-	for rows.Next() {
-		var ut UserTableResponse
-		var rivalName, rivalEmail sql.NullString
+	if ownerID == userID {
+		http.Error(w, "You cannot join your own table", http.StatusForbidden)
+		return
+	}
 
-		err := rows.Scan(
-			&ut.ID, &ut.UserID, &ut.RivalID, &ut.TableID, &ut.Time,
-			&ut.UserName, &ut.UserEmail,
-			&rivalName, &rivalEmail,
-			&ut.Table.Category, &ut.Table.Privacy, &ut.Table.Prize, &ut.Table.Amount, &ut.Table.Winner,
-			&ut.Table.CreatedAt, &ut.Table.UpdatedAt, &ut.Table.FinishedAt,
-		)
-		if err != nil {
-			http.Error(w, "Error reading table data", http.StatusInternalServerError)
+	if rivalID != nil {
+		http.Error(w, "Table already has a rival", http.StatusConflict)
+		return
+	}
+
+	// Private tables and tables with a password can only be joined with the right password
+	if table.Password != nil || table.Privacy == "private" {
+		if table.Password == nil || req.Password == nil ||
+			subtle.ConstantTimeCompare([]byte(*table.Password), []byte(*req.Password)) != 1 {
+			http.Error(w, "Invalid table password", http.StatusForbidden)
 			return
 		}
+	}
 
-		if ut.TableID == uint(tableID) {
-			userTableID = ut.ID
-			found = true
-			break
-		}
+	// The rating of the rival must allow the category
+	if status, message := h.checkTableCategory(userID, table.Category); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	// Validate the deck the rival will play with
+	if status, message := h.checkTableDeck(userID, req.DeckID); status != 0 {
+		http.Error(w, message, status)
+		return
 	}
 
-	if !found {
-		http.Error(w, "Table not found or you don't have access to it", http.StatusNotFound)
+	// Check the rival can put up their stake before taking the seat
+	if status, message := h.checkTableStake(userID, table, req.StakeCardID); status != 0 {
+		http.Error(w, message, status)
 		return
 	}
 
-	// Update the time
-	err = database.UpdateUserTableTime(userTableID, req.Time)
+	ownerDeckID, _, err := h.Repos.Tables.GetTableDecks(uint(tableID))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating table time: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Error retrieving table decks: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	if ownerDeckID == nil {
+		http.Error(w, "Table owner has no deck selected", http.StatusConflict)
+		return
+	}
+
+	// Take the seat and put both stakes in escrow; this fails if another player joined first
+	var stakeCardID *int
+	if table.Prize == models.PrizeCard {
+		stakeCardID = req.StakeCardID
+	}
+	joined, err := h.Repos.Tables.JoinTable(uint(tableID), userID, req.DeckID, stakeCardID)
+	if err != nil {
+		writeStakeError(w, err)
+		return
+	}
+
+	if !joined {
+		http.Error(w, "Table already has a rival", http.StatusConflict)
+		return
+	}
+
+	// Deal the match with both decks
+	state, err := h.Matches.StartMatch(uint(tableID), *ownerDeckID, req.DeckID)
+	if err != nil {
+		// Give the seat back so the table does not get stuck without a match
+		if releaseErr := h.Repos.Tables.ReleaseTableSeat(uint(tableID), userID); releaseErr != nil {
+			log.Printf("Failed to release seat of user %d at table %d: %v", userID, tableID, releaseErr)
+		}
+		http.Error(w, fmt.Sprintf("Error starting match: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Let the owner know the rival sat down and push the dealt state
+	h.Hub.Broadcast(uint(tableID), realtime.Event{
+		Type: realtime.EventJoin,
+		Seat: string(game.SeatRival),
+		Data: map[string]interface{}{"user_id": userID},
+	})
+	h.publishMatchState(uint(tableID), state)
+
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Table time updated successfully",
-		"time":    req.Time,
+		"message":  "Joined table successfully",
+		"table_id": tableID,
+		"state":    game.ViewFor(state, game.SeatRival),
 	})
 }
+
+// checkTableCategory verifies that the rating of a user allows them to play at tables of a
+// category. Players may play up but not below their rating band, so high-rated players
+// cannot farm low categories. It returns a zero status if the category is allowed.
+func (h *Handler) checkTableCategory(userID uint, category string) (int, string) {
+	userRating, err := h.Repos.Ratings.GetUserRating(int(userID))
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Sprintf("Error retrieving rating: %v", err)
+	}
+
+	glicko := rating.Rating{Rating: userRating.Rating, Deviation: userRating.Deviation, Volatility: userRating.Volatility}
+	if !rating.CanPlay(glicko, category) {
+		return http.StatusForbidden, fmt.Sprintf("Your rating places you in category %s; you cannot play at category %s tables",
+			userRating.Category, category)
+	}
+
+	return 0, ""
+}
+
+// checkTimeControl validates the time control of a table, in seconds; a nil initial time
+// means the table is untimed and cannot have an increment. It returns a zero status if the
+// time control is valid.
+func checkTimeControl(initialTime *int, increment int) (int, string) {
+	if initialTime == nil {
+		if increment != 0 {
+			return http.StatusBadRequest, "Time increment requires an initial time"
+		}
+		return 0, ""
+	}
+
+	if *initialTime < game.MinInitialTime || *initialTime > game.MaxInitialTime {
+		return http.StatusBadRequest, fmt.Sprintf("Initial time must be between %d and %d seconds",
+			game.MinInitialTime, game.MaxInitialTime)
+	}
+	if increment < 0 || increment > game.MaxIncrement {
+		return http.StatusBadRequest, fmt.Sprintf("Time increment must be between 0 and %d seconds", game.MaxIncrement)
+	}
+
+	return 0, ""
+}
+
+// checkTableStake verifies that a user can put up the stake of a table: enough money for a
+// money prize, or enough spare copies of their stake card for a card prize. It returns a
+// zero status if the stake can be covered.
+func (h *Handler) checkTableStake(userID uint, table *models.Table, stakeCardID *int) (int, string) {
+	amount := table.PrizeAmount()
+
+	switch table.Prize {
+	case models.PrizeMoney:
+		if amount == 0 {
+			return 0, ""
+		}
+		info, err := h.Repos.UserInfo.GetUserInfoByUserID(int(userID))
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("Error retrieving user info: %v", err)
+		}
+		if info == nil || info.Money < amount {
+			return http.StatusPaymentRequired, fmt.Sprintf("Not enough money to stake %d", amount)
+		}
+
+	case models.PrizeCard:
+		if stakeCardID == nil {
+			return http.StatusBadRequest, "stake_card_id is required when the prize is a card"
+		}
+		userCard, err := h.Repos.UserInfo.GetUserCardByUserAndCard(int(userID), *stakeCardID)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Sprintf("Error retrieving user card: %v", err)
+		}
+		if userCard == nil || userCard.Amount < amount {
+			return http.StatusConflict, fmt.Sprintf("You need %d copies of card %d to stake", amount, *stakeCardID)
+		}
+	}
+
+	return 0, ""
+}
+
+// writeStakeError maps the errors of putting stakes in escrow to HTTP responses
+func writeStakeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	message := fmt.Sprintf("Error joining table: %v", err)
+	switch {
+	case errors.Is(err, models.ErrOwnerStake):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, models.ErrInsufficientFunds):
+		status, message = http.StatusPaymentRequired, err.Error()
+	case errors.Is(err, models.ErrNotEnoughCards), errors.Is(err, models.ErrBreaksDeck):
+		status, message = http.StatusConflict, err.Error()
+	}
+
+	if status == http.StatusInternalServerError {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// checkTableDeck verifies that a deck belongs to the user and is valid for play.
+// It returns a zero status if the deck can be used.
+func (h *Handler) checkTableDeck(userID, deckID uint) (int, string) {
+	deck, err := h.Repos.Decks.GetDeckByID(int(deckID))
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Sprintf("Error retrieving deck: %v", err)
+	}
+
+	if deck == nil || deck.UserID != int(userID) {
+		return http.StatusBadRequest, "Deck not found"
+	}
+
+	if !deck.Valid {
+		return http.StatusBadRequest, "Deck is not valid for play"
+	}
+
+	return 0, ""
+}
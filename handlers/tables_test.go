@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+)
+
+// racingTables lets a rival join a table right after the handler checked it was waiting
+type racingTables struct {
+	repository.TableRepository
+	race func()
+}
+
+func (r *racingTables) IsTableWaitingForRival(tableID uint) (bool, error) {
+	waiting, err := r.TableRepository.IsTableWaitingForRival(tableID)
+	if race := r.race; race != nil {
+		r.race = nil
+		race()
+	}
+	return waiting, err
+}
+
+func TestUpdateTableRacingRival(t *testing.T) {
+	s := newTestServer(t)
+	owner, ownerToken := s.user(t, "Owner", false)
+	rival, _ := s.user(t, "Rival", false)
+
+	tableID, err := s.repos.Tables.CreateTable("C", "public", models.PrizeAura, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	if err := s.repos.Tables.CreateUserTable(uint(owner.ID), tableID, nil, 0); err != nil {
+		t.Fatalf("CreateUserTable: %v", err)
+	}
+
+	tables := &racingTables{TableRepository: s.repos.Tables}
+	s.repos.Tables = tables
+	tables.race = func() {
+		if joined, err := tables.TableRepository.JoinTable(tableID, uint(rival.ID), 0, nil); err != nil || !joined {
+			t.Errorf("JoinTable = %v, %v", joined, err)
+		}
+	}
+
+	rec := s.do(t, "PUT", fmt.Sprintf("/api/tables/%d", tableID), ownerToken, `{"category":"B"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("PUT a table a rival joined = %d %s, want %d", rec.Code, rec.Body.String(), http.StatusConflict)
+	}
+
+	table, err := s.repos.Tables.GetTableByID(tableID)
+	if err != nil {
+		t.Fatalf("GetTableByID: %v", err)
+	}
+	if table.Category != "C" {
+		t.Errorf("category = %q, want the table left as the rival joined it", table.Category)
+	}
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tcg-server-go/models"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultTradeExpiry is how long a trade stays open when the proposer does not choose
+const defaultTradeExpiry = 48 * time.Hour
+
+// CreateTradeHandler proposes a trade from the authenticated user to another player
+func (h *Handler) CreateTradeHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var createReq models.CreateTradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&createReq)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	if createReq.RecipientID == principal.UserID {
+		http.Error(w, "You cannot trade with yourself", http.StatusBadRequest)
+		return
+	}
+
+	recipient, err := h.Repos.Users.GetUserByID(createReq.RecipientID)
+	if err != nil {
+		http.Error(w, "Error retrieving recipient", http.StatusInternalServerError)
+		return
+	}
+	if recipient == nil {
+		http.Error(w, "Recipient not found", http.StatusNotFound)
+		return
+	}
+
+	if status, message := h.checkTradeTerms(principal.UserID, &createReq.TradeTerms); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	trade := newTrade(principal.UserID, createReq.RecipientID, &createReq.TradeTerms)
+	if err := h.Repos.Trades.CreateTrade(trade); err != nil {
+		http.Error(w, fmt.Sprintf("Error creating trade: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeTrade(w, http.StatusCreated, trade, "Trade proposed successfully")
+}
+
+// GetTradesHandler lists the trades the authenticated user proposed or received, optionally
+// filtered by ?status=
+func (h *Handler) GetTradesHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	status := models.TradeStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.TradeStatusPending, models.TradeStatusAccepted, models.TradeStatusDeclined,
+		models.TradeStatusCancelled, models.TradeStatusCountered, models.TradeStatusExpired:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repos.Trades.ExpireTrades(); err != nil {
+		http.Error(w, "Error expiring trades", http.StatusInternalServerError)
+		return
+	}
+
+	trades, err := h.Repos.Trades.GetTradesByUserID(principal.UserID, status)
+	if err != nil {
+		http.Error(w, "Error retrieving trades", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.TradesResponse{
+		Trades:  trades,
+		Message: "Trades retrieved successfully",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetTradeHandler retrieves a trade of the authenticated user
+func (h *Handler) GetTradeHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	trade, ok := h.loadTrade(w, r, principal.UserID)
+	if !ok {
+		return
+	}
+
+	writeTrade(w, http.StatusOK, trade, "Trade retrieved successfully")
+}
+
+// CounterTradeHandler answers a trade received by the authenticated user with new terms. The
+// original trade is closed and the counter-offer goes back to its proposer.
+func (h *Handler) CounterTradeHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	trade, ok := h.loadTrade(w, r, principal.UserID)
+	if !ok {
+		return
+	}
+	if trade.RecipientID != principal.UserID {
+		http.Error(w, "Only the recipient can counter a trade", http.StatusForbidden)
+		return
+	}
+	if trade.Status != models.TradeStatusPending {
+		http.Error(w, "Trade is no longer pending", http.StatusConflict)
+		return
+	}
+
+	var terms models.TradeTerms
+	if err := json.NewDecoder(r.Body).Decode(&terms); err != nil {
+		http.Error(w, "Error decoding request", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request
+	validationErrors := ValidateStruct(&terms)
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidationResponse{Errors: validationErrors})
+		return
+	}
+
+	if status, message := h.checkTradeTerms(principal.UserID, &terms); status != 0 {
+		http.Error(w, message, status)
+		return
+	}
+
+	counter := newTrade(principal.UserID, trade.ProposerID, &terms)
+	countered, err := h.Repos.Trades.CounterTrade(trade.ID, counter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error countering trade: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !countered {
+		http.Error(w, "Trade is no longer pending", http.StatusConflict)
+		return
+	}
+
+	writeTrade(w, http.StatusCreated, counter, "Counter-offer proposed successfully")
+}
+
+// AcceptTradeHandler completes a trade received by the authenticated user, exchanging the
+// cards and money of both players
+func (h *Handler) AcceptTradeHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	trade, ok := h.loadTrade(w, r, principal.UserID)
+	if !ok {
+		return
+	}
+	if trade.RecipientID != principal.UserID {
+		http.Error(w, "Only the recipient can accept a trade", http.StatusForbidden)
+		return
+	}
+
+	err := h.Repos.Trades.AcceptTrade(trade.ID)
+	switch {
+	case errors.Is(err, models.ErrTradeNotPending):
+		http.Error(w, "Trade is no longer pending", http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrTradeExpired):
+		http.Error(w, "Trade has expired", http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrInsufficientFunds), errors.Is(err, models.ErrNotEnoughCards),
+		errors.Is(err, models.ErrBreaksDeck):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Error accepting trade: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.respondResolvedTrade(w, trade.ID, "Trade accepted successfully")
+}
+
+// DeclineTradeHandler refuses a trade received by the authenticated user
+func (h *Handler) DeclineTradeHandler(w http.ResponseWriter, r *http.Request) {
+	h.resolveTrade(w, r, models.TradeStatusDeclined)
+}
+
+// CancelTradeHandler withdraws a trade proposed by the authenticated user
+func (h *Handler) CancelTradeHandler(w http.ResponseWriter, r *http.Request) {
+	h.resolveTrade(w, r, models.TradeStatusCancelled)
+}
+
+// resolveTrade closes a pending trade without exchanging anything. Only the recipient can
+// decline and only the proposer can cancel.
+func (h *Handler) resolveTrade(w http.ResponseWriter, r *http.Request, status models.TradeStatus) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	trade, ok := h.loadTrade(w, r, principal.UserID)
+	if !ok {
+		return
+	}
+	if status == models.TradeStatusDeclined && trade.RecipientID != principal.UserID {
+		http.Error(w, "Only the recipient can decline a trade", http.StatusForbidden)
+		return
+	}
+	if status == models.TradeStatusCancelled && trade.ProposerID != principal.UserID {
+		http.Error(w, "Only the proposer can cancel a trade", http.StatusForbidden)
+		return
+	}
+
+	resolved, err := h.Repos.Trades.ResolveTrade(trade.ID, status)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error updating trade: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !resolved {
+		http.Error(w, "Trade is no longer pending", http.StatusConflict)
+		return
+	}
+
+	h.respondResolvedTrade(w, trade.ID, fmt.Sprintf("Trade %s successfully", status))
+}
+
+// loadTrade reads the trade of the request, expiring old trades first, and writes an error
+// response unless the user takes part in it
+func (h *Handler) loadTrade(w http.ResponseWriter, r *http.Request, userID int) (*models.Trade, bool) {
+	tradeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid trade ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if err := h.Repos.Trades.ExpireTrades(); err != nil {
+		http.Error(w, "Error expiring trades", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	trade, err := h.Repos.Trades.GetTradeByID(tradeID)
+	if err != nil {
+		http.Error(w, "Error retrieving trade", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Trades of other players are reported as missing rather than forbidden
+	if trade == nil || (trade.ProposerID != userID && trade.RecipientID != userID) {
+		http.Error(w, "Trade not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return trade, true
+}
+
+// checkTradeTerms validates the exchange proposed by a user, who gives the offered side. It
+// returns the status and message of the error response, or 0 if the terms are valid.
+func (h *Handler) checkTradeTerms(userID int, terms *models.TradeTerms) (int, string) {
+	if len(terms.OfferedCards) == 0 && terms.OfferedMoney == 0 &&
+		len(terms.RequestedCards) == 0 && terms.RequestedMoney == 0 {
+		return http.StatusBadRequest, "A trade must exchange cards or money"
+	}
+
+	sides := map[string][]models.TradeCard{
+		models.TradeSideOffered:   terms.OfferedCards,
+		models.TradeSideRequested: terms.RequestedCards,
+	}
+	for _, side := range []string{models.TradeSideOffered, models.TradeSideRequested} {
+		seen := make(map[int]bool, len(sides[side]))
+		for _, tradeCard := range sides[side] {
+			if seen[tradeCard.CardID] {
+				return http.StatusBadRequest, fmt.Sprintf("Card %d is listed twice in the %s cards", tradeCard.CardID, side)
+			}
+			seen[tradeCard.CardID] = true
+
+			card, err := h.Repos.Cards.GetCardByID(tradeCard.CardID)
+			if err != nil {
+				return http.StatusInternalServerError, "Error retrieving card"
+			}
+			if card == nil {
+				return http.StatusBadRequest, fmt.Sprintf("Card %d not found", tradeCard.CardID)
+			}
+		}
+	}
+
+	// The proposer must own what they offer now; both sides are checked again on acceptance
+	for _, tradeCard := range terms.OfferedCards {
+		userCard, err := h.Repos.UserInfo.GetUserCardByUserAndCard(userID, tradeCard.CardID)
+		if err != nil {
+			return http.StatusInternalServerError, "Error retrieving user cards"
+		}
+		if userCard == nil || userCard.Amount < tradeCard.Amount {
+			return http.StatusBadRequest, fmt.Sprintf("You do not own %d copies of card %d", tradeCard.Amount, tradeCard.CardID)
+		}
+	}
+
+	if terms.OfferedMoney > 0 {
+		userInfo, err := h.Repos.UserInfo.GetUserInfoByUserID(userID)
+		if err != nil {
+			return http.StatusInternalServerError, "Error retrieving user info"
+		}
+		if userInfo == nil || userInfo.Money < terms.OfferedMoney {
+			return http.StatusBadRequest, "You do not have enough money for this offer"
+		}
+	}
+
+	return 0, ""
+}
+
+// respondResolvedTrade writes a trade after it changed status
+func (h *Handler) respondResolvedTrade(w http.ResponseWriter, tradeID int, message string) {
+	trade, err := h.Repos.Trades.GetTradeByID(tradeID)
+	if err != nil || trade == nil {
+		http.Error(w, "Error retrieving trade", http.StatusInternalServerError)
+		return
+	}
+
+	writeTrade(w, http.StatusOK, trade, message)
+}
+
+// newTrade builds a pending trade from the terms chosen by its proposer
+func newTrade(proposerID, recipientID int, terms *models.TradeTerms) *models.Trade {
+	expiry := defaultTradeExpiry
+	if terms.ExpiresInHours > 0 {
+		expiry = time.Duration(terms.ExpiresInHours) * time.Hour
+	}
+
+	trade := &models.Trade{
+		ProposerID:     proposerID,
+		RecipientID:    recipientID,
+		OfferedCards:   terms.OfferedCards,
+		OfferedMoney:   terms.OfferedMoney,
+		RequestedCards: terms.RequestedCards,
+		RequestedMoney: terms.RequestedMoney,
+		ExpiresAt:      time.Now().Add(expiry),
+	}
+	if trade.OfferedCards == nil {
+		trade.OfferedCards = []models.TradeCard{}
+	}
+	if trade.RequestedCards == nil {
+		trade.RequestedCards = []models.TradeCard{}
+	}
+	return trade
+}
+
+func writeTrade(w http.ResponseWriter, status int, trade *models.Trade, message string) {
+	response := models.TradeResponse{
+		Trade:   trade,
+		Message: message,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
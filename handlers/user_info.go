@@ -3,27 +3,26 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 
-	"tcg-server-go/database"
 	"tcg-server-go/models"
 
 	"github.com/gorilla/mux"
 )
 
 // GetUserInfoHandler retrieves user info for the authenticated user
-func GetUserInfoHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from middleware
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+func (h *Handler) GetUserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
+	userID := principal.UserID
 
-	userInfo, err := database.GetUserInfoByUserID(userID)
+	userInfo, err := h.Repos.UserInfo.GetUserInfoByUserID(userID)
 	if err != nil {
 		http.Error(w, "Error retrieving user info", http.StatusInternalServerError)
 		return
@@ -31,7 +30,7 @@ func GetUserInfoHandler(w http.ResponseWriter, r *http.Request) {
 
 	if userInfo == nil {
 		// Create default user info if it doesn't exist
-		userInfo, err = database.CreateDefaultUserInfo(userID)
+		userInfo, err = h.Repos.UserInfo.CreateDefaultUserInfo(userID)
 		if err != nil {
 			http.Error(w, "Error creating user info", http.StatusInternalServerError)
 			return
@@ -51,11 +50,15 @@ func GetUserInfoHandler(w http.ResponseWriter, r *http.Request) {
 // User Cards Handlers
 
 // GetUserCardsHandler retrieves all cards for the authenticated user
-func GetUserCardsHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) GetUserCardsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
-	userCards, err := database.GetUserCardsByUserID(userID)
+	userCards, err := h.Repos.UserInfo.GetUserCardsByUserID(userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving user cards: %v", err), http.StatusInternalServerError)
 		return
@@ -72,9 +75,13 @@ func GetUserCardsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetUserCardHandler retrieves a specific user card by ID
-func GetUserCardHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) GetUserCardHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	// Get card ID from URL parameters
 	vars := mux.Vars(r)
@@ -85,7 +92,7 @@ func GetUserCardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userCard, err := database.GetUserCardByUserAndCard(userID, cardID)
+	userCard, err := h.Repos.UserInfo.GetUserCardByUserAndCard(userID, cardID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving user card: %v", err), http.StatusInternalServerError)
 		return
@@ -106,14 +113,99 @@ func GetUserCardHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetCollectionHandler lists the whole catalogue with the copies the authenticated user owns,
+// the copies their decks need and the copies free to trade, with how complete the collection
+// is overall, per set and per element. Query parameters: status (all, owned or missing), set
+// and element; they only narrow the listed cards, not the completion.
+func (h *Handler) GetCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && status != "all" && status != "owned" && status != "missing" {
+		http.Error(w, "status must be all, owned or missing", http.StatusBadRequest)
+		return
+	}
+	set := query.Get("set")
+	element := models.CardElement(query.Get("element"))
+	if element != "" && validate.Var(string(element), "oneof=Fire Water Wind Earth Neutral Holy Dark") != nil {
+		http.Error(w, "Invalid element", http.StatusBadRequest)
+		return
+	}
+
+	collection, err := h.Repos.UserInfo.GetCollection(principal.UserID)
+	if err != nil {
+		http.Error(w, "Error retrieving collection", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.CollectionResponse{
+		Cards:    []models.CollectionCard{},
+		Sets:     make(map[string]*models.Completion),
+		Elements: make(map[models.CardElement]*models.Completion),
+		Message:  "Collection retrieved successfully",
+	}
+	for _, collectionCard := range collection {
+		card := collectionCard.Card
+		if response.Sets[card.SetCode] == nil {
+			response.Sets[card.SetCode] = &models.Completion{}
+		}
+		if response.Elements[card.Element] == nil {
+			response.Elements[card.Element] = &models.Completion{}
+		}
+
+		owned := collectionCard.Owned > 0
+		for _, completion := range []*models.Completion{&response.Completion, response.Sets[card.SetCode], response.Elements[card.Element]} {
+			completion.Total++
+			if owned {
+				completion.Owned++
+			}
+		}
+
+		switch {
+		case status == "owned" && !owned, status == "missing" && owned:
+			continue
+		case set != "" && card.SetCode != set, element != "" && card.Element != element:
+			continue
+		}
+		response.Cards = append(response.Cards, collectionCard)
+	}
+
+	setPercent(&response.Completion)
+	for _, completion := range response.Sets {
+		setPercent(completion)
+	}
+	for _, completion := range response.Elements {
+		setPercent(completion)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// setPercent fills in the share of the cards owned, rounded to one decimal
+func setPercent(completion *models.Completion) {
+	if completion.Total > 0 {
+		completion.Percent = math.Round(float64(completion.Owned)*1000/float64(completion.Total)) / 10
+	}
+}
+
 // Deck Handlers
 
 // GetDecksHandler retrieves all decks for the authenticated user
-func GetDecksHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) GetDecksHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
-	decks, err := database.GetDecksByUserID(userID)
+	decks, err := h.Repos.Decks.GetDecksByUserID(userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving decks: %v", err), http.StatusInternalServerError)
 		return
@@ -130,9 +222,13 @@ func GetDecksHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetDeckHandler retrieves a specific deck by ID
-func GetDeckHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) GetDeckHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	// Get deck ID from URL parameters
 	vars := mux.Vars(r)
@@ -143,7 +239,7 @@ func GetDeckHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deck, err := database.GetDeckByID(deckID)
+	deck, err := h.Repos.Decks.GetDeckByID(deckID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving deck: %v", err), http.StatusInternalServerError)
 		return
@@ -171,9 +267,13 @@ func GetDeckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetDeckWithCardsHandler retrieves a deck with all its cards
-func GetDeckWithCardsHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) GetDeckWithCardsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	// Get deck ID from URL parameters
 	vars := mux.Vars(r)
@@ -184,7 +284,7 @@ func GetDeckWithCardsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deck, err := database.GetDeckByID(deckID)
+	deck, err := h.Repos.Decks.GetDeckByID(deckID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving deck: %v", err), http.StatusInternalServerError)
 		return
@@ -202,7 +302,7 @@ func GetDeckWithCardsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get deck cards
-	deckCards, err := database.GetDeckCards(deckID)
+	deckCards, err := h.Repos.Decks.GetDeckCards(deckID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving deck cards: %v", err), http.StatusInternalServerError)
 		return
@@ -224,9 +324,13 @@ func GetDeckWithCardsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // CreateDeckHandler creates a new deck with validation
-func CreateDeckHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) CreateDeckHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	var req models.CreateDeckRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -247,14 +351,13 @@ func CreateDeckHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create deck with validation
-	deck, err := database.CreateDeckWithValidation(userID, req.Name, req.CardIDs, req.CardCount)
+	format := req.Format
+	if format == "" {
+		format = models.DefaultFormat
+	}
+	deck, err := h.Repos.Decks.CreateDeckWithValidation(userID, req.Name, format, req.CardIDs, req.CardCount)
 	if err != nil {
-		if err.Error() == "user does not have all required cards" {
-			http.Error(w, "Cannot create deck: you do not have all the required cards", http.StatusBadRequest)
-			return
-		}
-		if strings.Contains(err.Error(), "deck must have at least 40 cards") {
-			http.Error(w, "Cannot create deck: deck must have at least 40 cards", http.StatusBadRequest)
+		if writeDeckError(w, "create", err) {
 			return
 		}
 		if strings.Contains(err.Error(), "deck limit reached") {
@@ -276,9 +379,13 @@ func CreateDeckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteDeckHandler deletes a deck
-func DeleteDeckHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) DeleteDeckHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	// Get deck ID from URL parameters
 	vars := mux.Vars(r)
@@ -290,7 +397,7 @@ func DeleteDeckHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if deck exists and belongs to user
-	deck, err := database.GetDeckByID(deckID)
+	deck, err := h.Repos.Decks.GetDeckByID(deckID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error checking deck: %v", err), http.StatusInternalServerError)
 		return
@@ -305,7 +412,7 @@ func DeleteDeckHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete deck
-	err = database.DeleteDeck(deckID)
+	err = h.Repos.Decks.DeleteDeck(deckID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error deleting deck: %v", err), http.StatusInternalServerError)
 		return
@@ -321,26 +428,30 @@ func DeleteDeckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetDeckLimitHandler retrieves deck limit information for the authenticated user
-func GetDeckLimitHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) GetDeckLimitHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	// Get current decks
-	currentDecks, err := database.GetDecksByUserID(userID)
+	currentDecks, err := h.Repos.Decks.GetDecksByUserID(userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving decks: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Get deck limit
-	deckLimit, err := database.GetUserDeckLimit(userID)
+	deckLimit, err := h.Repos.Decks.GetUserDeckLimit(userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error calculating deck limit: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Get user info for level
-	userInfo, err := database.GetUserInfoByUserID(userID)
+	userInfo, err := h.Repos.UserInfo.GetUserInfoByUserID(userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error retrieving user info: %v", err), http.StatusInternalServerError)
 		return
@@ -360,9 +471,13 @@ func GetDeckLimitHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateDeckHandler updates a deck
-func UpdateDeckHandler(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context (set by auth middleware)
-	userID := r.Context().Value("user_id").(int)
+func (h *Handler) UpdateDeckHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	// Get deck ID from URL parameters
 	vars := mux.Vars(r)
@@ -393,7 +508,8 @@ func UpdateDeckHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update deck
-	deck, err := database.UpdateDeck(deckID, userID, req.Name, req.CardIDs, req.CardCount)
+	// An empty format keeps the format of the deck
+	deck, err := h.Repos.Decks.UpdateDeck(deckID, userID, req.Name, req.Format, req.CardIDs, req.CardCount)
 	if err != nil {
 		// Handle specific error cases
 		if strings.Contains(err.Error(), "deck not found") {
@@ -408,8 +524,7 @@ func UpdateDeckHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Cannot update deck while in an active game", http.StatusConflict)
 			return
 		}
-		if strings.Contains(err.Error(), "invalid deck composition") {
-			http.Error(w, "Invalid deck composition", http.StatusBadRequest)
+		if writeDeckError(w, "update", err) {
 			return
 		}
 		http.Error(w, fmt.Sprintf("Error updating deck: %v", err), http.StatusInternalServerError)
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tcg-server-go/game"
+	"tcg-server-go/middleware"
+	"tcg-server-go/models"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// TableSocketHandler upgrades the connection of a player seated at a table to a WebSocket
+// that receives join/leave, state and chat events. Browsers cannot set headers on a
+// WebSocket handshake, so the token may also be passed as the "token" query parameter.
+func (h *Handler) TableSocketHandler(w http.ResponseWriter, r *http.Request) {
+	tokenString := r.URL.Query().Get("token")
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		tokenString = authHeader[7:]
+	}
+
+	principal, status, err := middleware.Authenticate(h.Repos.Users, h.Repos.Tokens, tokenString)
+	if err != nil {
+		middleware.WriteAuthError(w, status, err)
+		return
+	}
+
+	tableID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid table ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := uint(principal.UserID)
+	seat, err := h.Matches.SeatForUser(uint(tableID), userID)
+	if err != nil {
+		if errors.Is(err, game.ErrNotSeated) {
+			http.Error(w, "You are not playing at this table", http.StatusForbidden)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Error checking table seat: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Send the current state on connect if the match already started
+	var initial interface{}
+	state, _, err := h.Matches.LoadMatch(uint(tableID), userID)
+	if err != nil && !errors.Is(err, game.ErrMatchNotStarted) {
+		http.Error(w, fmt.Sprintf("Error loading match: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if state != nil {
+		initial = game.ViewWithClock(state, seat, h.matchClock(uint(tableID)))
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied to the client
+		log.Printf("WebSocket upgrade failed for table %d: %v", tableID, err)
+		return
+	}
+
+	h.Hub.Serve(conn, uint(tableID), userID, string(seat), initial)
+}
+
+// publishMatchState pushes the new state of a match to every player connected to its table
+func (h *Handler) publishMatchState(tableID uint, state *models.TableState) {
+	clock := h.matchClock(tableID)
+	h.Hub.PublishState(tableID, func(seat string) interface{} {
+		return game.ViewWithClock(state, game.Seat(seat), clock)
+	})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tcg-server-go/realtime"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsEvent is an event as received by a client
+type wsEvent struct {
+	Type    string                 `json:"type"`
+	TableID uint                   `json:"table_id"`
+	Seat    string                 `json:"seat"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// dialTable opens the socket of a table with the token as query parameter
+func dialTable(t *testing.T, server *httptest.Server, tableID uint, token string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	url := fmt.Sprintf("ws%s/ws/tables/%d", strings.TrimPrefix(server.URL, "http"), tableID)
+	if token != "" {
+		url += "?token=" + token
+	}
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+// expectEvent reads the next event of a connection and checks its type and seat
+func expectEvent(t *testing.T, conn *websocket.Conn, eventType, seat string) wsEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event wsEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("waiting for %s event: %v", eventType, err)
+	}
+	if event.Type != eventType || event.Seat != seat {
+		t.Fatalf("got %s event of seat %q, want %s of seat %q: %+v", event.Type, event.Seat, eventType, seat, event)
+	}
+	return event
+}
+
+func TestTableSocket(t *testing.T) {
+	s := newTestServer(t)
+	owner, ownerToken := s.user(t, "Owner", false)
+	rival, rivalToken := s.user(t, "Rival", false)
+	_, strangerToken := s.user(t, "Stranger", false)
+	tableID := s.table(t, owner, rival)
+
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	// The handshake is refused without a valid token of a seated player
+	spoofed := http.Header{"X-User-ID": []string{fmt.Sprint(owner.ID)}}
+	for _, tt := range []struct {
+		name   string
+		token  string
+		header http.Header
+		status int
+	}{
+		{"no token", "", nil, http.StatusUnauthorized},
+		{"spoofed user header", "", spoofed, http.StatusUnauthorized},
+		{"invalid token", "not-a-token", nil, http.StatusUnauthorized},
+		{"not seated", strangerToken, nil, http.StatusForbidden},
+	} {
+		conn, resp, err := dialTable(t, server, tableID, tt.token, tt.header)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s: handshake succeeded", tt.name)
+			continue
+		}
+		if resp == nil || resp.StatusCode != tt.status {
+			t.Errorf("%s: handshake failed with %v, want status %d", tt.name, resp, tt.status)
+		}
+	}
+
+	// Each player is told about their own join and gets the full state of the match
+	ownerConn, _, err := dialTable(t, server, tableID, ownerToken, nil)
+	if err != nil {
+		t.Fatalf("owner handshake: %v", err)
+	}
+	defer ownerConn.Close()
+	expectEvent(t, ownerConn, realtime.EventJoin, "owner")
+	state := expectEvent(t, ownerConn, realtime.EventState, "owner")
+	if state.Data["phase"] != "mulligan" || state.Data["seat"] != "owner" {
+		t.Errorf("initial state = %v, want the owner's view of the mulligan", state.Data)
+	}
+
+	// The token can also be sent as a bearer header
+	rivalConn, _, err := dialTable(t, server, tableID, "", http.Header{"Authorization": []string{"Bearer " + rivalToken}})
+	if err != nil {
+		t.Fatalf("rival handshake: %v", err)
+	}
+	expectEvent(t, ownerConn, realtime.EventJoin, "rival")
+	expectEvent(t, rivalConn, realtime.EventJoin, "rival")
+	expectEvent(t, rivalConn, realtime.EventState, "rival")
+
+	// Actions push only the fields that changed: the log, and the side of the owner who is
+	// now ready, as seen from each seat
+	rec := s.do(t, "POST", fmt.Sprintf("/api/tables/%d/actions", tableID), ownerToken, `{"type": "mulligan", "keep": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("mulligan = %d %s", rec.Code, rec.Body)
+	}
+	for _, tt := range []struct {
+		conn  *websocket.Conn
+		seat  string
+		field string
+	}{
+		{ownerConn, "owner", "own"},
+		{rivalConn, "rival", "opponent"},
+	} {
+		diff := expectEvent(t, tt.conn, realtime.EventStateDiff, tt.seat)
+		if len(diff.Data) != 2 || diff.Data["log"] == nil || diff.Data[tt.field] == nil {
+			t.Errorf("%s diff = %v, want only log and %s", tt.seat, diff.Data, tt.field)
+		}
+	}
+
+	// Chat reaches both seats
+	if err := rivalConn.WriteJSON(map[string]string{"type": "chat", "message": " good luck "}); err != nil {
+		t.Fatalf("sending chat: %v", err)
+	}
+	for _, conn := range []*websocket.Conn{ownerConn, rivalConn} {
+		chat := expectEvent(t, conn, realtime.EventChat, "rival")
+		if chat.Data["message"] != "good luck" || chat.Data["user_id"] != float64(rival.ID) {
+			t.Errorf("chat = %v", chat.Data)
+		}
+	}
+
+	// Invalid messages are only answered to their sender
+	rivalConn.WriteJSON(map[string]string{"type": "chat", "message": ""})
+	expectEvent(t, rivalConn, realtime.EventError, "rival")
+
+	// The other player is told when a player leaves
+	rivalConn.Close()
+	expectEvent(t, ownerConn, realtime.EventLeave, "rival")
+}
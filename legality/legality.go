@@ -0,0 +1,96 @@
+// Package legality checks decks against the building rules of their format: deck size,
+// copies per card, the share of energies, banned and restricted cards and the sets in
+// rotation. Every broken rule is reported, so players can fix a deck in one go.
+package legality
+
+import (
+	"fmt"
+	"sort"
+
+	"tcg-server-go/models"
+)
+
+// Check returns the rules of a format a deck breaks, or none if the deck is legal. Every
+// entry must have its card loaded; entries without one are reported as unknown cards.
+func Check(format *models.DeckFormat, cards []models.DeckCard) []models.DeckViolation {
+	violations := []models.DeckViolation{}
+
+	// The same card may be listed more than once
+	counts := make(map[int]int)
+	loaded := make(map[int]*models.Card)
+	for _, deckCard := range cards {
+		counts[deckCard.CardID] += deckCard.Number
+		if deckCard.Card != nil {
+			loaded[deckCard.CardID] = deckCard.Card
+		}
+	}
+
+	cardIDs := make([]int, 0, len(counts))
+	total, energies := 0, 0
+	for cardID, count := range counts {
+		cardIDs = append(cardIDs, cardID)
+		total += count
+		if card := loaded[cardID]; card != nil && card.Type == models.CardTypeEnergy {
+			energies += count
+		}
+	}
+	sort.Ints(cardIDs)
+
+	if total < format.MinCards {
+		violations = append(violations, violation(models.RuleMinCards, nil,
+			"deck must have at least %d cards, it has %d", format.MinCards, total))
+	}
+	if format.MaxCards != nil && total > *format.MaxCards {
+		violations = append(violations, violation(models.RuleMaxCards, nil,
+			"deck must have at most %d cards, it has %d", *format.MaxCards, total))
+	}
+
+	limits := make(map[int]int, len(format.CardLimits))
+	for _, limit := range format.CardLimits {
+		limits[limit.CardID] = limit.Limit
+	}
+	legalSets := make(map[string]bool, len(format.Sets))
+	for _, set := range format.Sets {
+		legalSets[set] = true
+	}
+
+	for _, cardID := range cardIDs {
+		id := cardID
+		count := counts[cardID]
+		card := loaded[cardID]
+		if card == nil {
+			violations = append(violations, violation(models.RuleUnknownCard, &id, "card %d does not exist", cardID))
+			continue
+		}
+
+		if limit, ok := limits[cardID]; ok && limit == 0 {
+			violations = append(violations, violation(models.RuleBanned, &id, "%s is banned in %s", card.Name, format.Name))
+		} else if ok && count > limit {
+			violations = append(violations, violation(models.RuleRestricted, &id,
+				"%s is restricted in %s: %d allowed, the deck has %d", card.Name, format.Name, limit, count))
+		} else if format.MaxCopies != nil && card.Type != models.CardTypeEnergy && count > *format.MaxCopies {
+			violations = append(violations, violation(models.RuleMaxCopies, &id,
+				"at most %d copies of %s are allowed, the deck has %d", *format.MaxCopies, card.Name, count))
+		}
+
+		if len(legalSets) > 0 && !legalSets[card.SetCode] {
+			violations = append(violations, violation(models.RuleSetRotation, &id,
+				"%s is from set %s, which is not legal in %s", card.Name, card.SetCode, format.Name))
+		}
+	}
+
+	if total > 0 {
+		percent := float64(energies) * 100 / float64(total)
+		if percent < float64(format.MinEnergyPercent) || percent > float64(format.MaxEnergyPercent) {
+			violations = append(violations, violation(models.RuleEnergyRatio, nil,
+				"energies must be between %d%% and %d%% of the deck, they are %.1f%%",
+				format.MinEnergyPercent, format.MaxEnergyPercent, percent))
+		}
+	}
+
+	return violations
+}
+
+func violation(rule string, cardID *int, format string, args ...interface{}) models.DeckViolation {
+	return models.DeckViolation{Rule: rule, CardID: cardID, Message: fmt.Sprintf(format, args...)}
+}
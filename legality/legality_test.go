@@ -0,0 +1,89 @@
+package legality
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"tcg-server-go/models"
+)
+
+func TestCheck(t *testing.T) {
+	maxCards, maxCopies := 8, 2
+	format := &models.DeckFormat{
+		Name:             "Test",
+		MinCards:         4,
+		MaxCards:         &maxCards,
+		MaxCopies:        &maxCopies,
+		MinEnergyPercent: 25,
+		MaxEnergyPercent: 75,
+		Sets:             []string{"S1"},
+		CardLimits:       []models.FormatCardLimit{{CardID: 3, Limit: 0}, {CardID: 4, Limit: 1}},
+	}
+
+	cards := map[int]*models.Card{
+		1: {ID: 1, Name: "Drake", Type: models.CardTypeMonster, SetCode: "S1"},
+		2: {ID: 2, Name: "Golem", Type: models.CardTypeMonster, SetCode: "S1"},
+		3: {ID: 3, Name: "Banned Dragon", Type: models.CardTypeMonster, SetCode: "S1"},
+		4: {ID: 4, Name: "Restricted Wyrm", Type: models.CardTypeMonster, SetCode: "S1"},
+		5: {ID: 5, Name: "Fire Energy", Type: models.CardTypeEnergy, SetCode: "S1"},
+		6: {ID: 6, Name: "Old Drake", Type: models.CardTypeMonster, SetCode: "S0"},
+	}
+	// deck lists entries as card ID and copies; card 99 does not exist
+	deck := func(entries ...[2]int) []models.DeckCard {
+		deckCards := make([]models.DeckCard, len(entries))
+		for i, entry := range entries {
+			deckCards[i] = models.DeckCard{CardID: entry[0], Number: entry[1], Card: cards[entry[0]]}
+		}
+		return deckCards
+	}
+
+	// RuleNotOwned is checked against the collection of the player, not by Check
+	tests := []struct {
+		name  string
+		cards []models.DeckCard
+		want  []string // Broken rules, followed by the card they are about
+	}{
+		{name: "legal", cards: deck([2]int{1, 2}, [2]int{5, 2})},
+		{name: "min cards", cards: deck([2]int{1, 1}, [2]int{5, 1}), want: []string{models.RuleMinCards}},
+		{name: "max cards", cards: deck([2]int{1, 2}, [2]int{2, 2}, [2]int{5, 5}), want: []string{models.RuleMaxCards}},
+		{name: "max copies", cards: deck([2]int{1, 3}, [2]int{5, 3}), want: []string{models.RuleMaxCopies + " 1"}},
+		{name: "energies have no max copies", cards: deck([2]int{1, 2}, [2]int{5, 6})},
+		{name: "banned", cards: deck([2]int{3, 1}, [2]int{1, 1}, [2]int{5, 2}), want: []string{models.RuleBanned + " 3"}},
+		{name: "restricted", cards: deck([2]int{4, 2}, [2]int{5, 2}), want: []string{models.RuleRestricted + " 4"}},
+		{name: "restricted at its limit", cards: deck([2]int{4, 1}, [2]int{1, 1}, [2]int{5, 2})},
+		{name: "energy ratio", cards: deck([2]int{1, 2}, [2]int{2, 2}, [2]int{5, 1}), want: []string{models.RuleEnergyRatio}},
+		{name: "set rotation", cards: deck([2]int{6, 1}, [2]int{1, 1}, [2]int{5, 2}), want: []string{models.RuleSetRotation + " 6"}},
+		{name: "unknown card", cards: deck([2]int{99, 1}, [2]int{1, 1}, [2]int{5, 2}), want: []string{models.RuleUnknownCard + " 99"}},
+
+		{name: "duplicated entry", cards: deck([2]int{1, 2}, [2]int{5, 3}, [2]int{1, 1}), want: []string{models.RuleMaxCopies + " 1"}},
+		{name: "banned before max copies", cards: deck([2]int{3, 3}, [2]int{5, 3}), want: []string{models.RuleBanned + " 3"}},
+		{name: "restricted before max copies", cards: deck([2]int{4, 3}, [2]int{5, 3}), want: []string{models.RuleRestricted + " 4"}},
+		{
+			name:  "every rule reported",
+			cards: deck([2]int{3, 1}, [2]int{6, 1}, [2]int{99, 1}),
+			want:  []string{models.RuleMinCards, models.RuleBanned + " 3", models.RuleSetRotation + " 6", models.RuleUnknownCard + " 99", models.RuleEnergyRatio},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, violation := range Check(format, tt.cards) {
+				rule := violation.Rule
+				if violation.CardID != nil {
+					rule = fmt.Sprintf("%s %d", rule, *violation.CardID)
+				}
+				got = append(got, rule)
+			}
+
+			want := tt.want
+			if want == nil {
+				want = []string{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Check = %q, want %q", got, want)
+			}
+		})
+	}
+}
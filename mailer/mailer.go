@@ -0,0 +1,137 @@
+// Package mailer sends the emails of the server, such as verification codes, through
+// a pluggable transport: SMTP in production or an outbox for local development and tests.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultFrom is the sender address used when MAIL_FROM is not set
+const DefaultFrom = "TCG Server <no-reply@tcg-server.local>"
+
+// Message is an email with a plain text body and an optional HTML alternative
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(message *Message) error
+}
+
+// Config holds the mail transport configuration
+type Config struct {
+	Transport    string // "smtp" or "outbox"
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	OutboxDir    string // Empty logs messages instead of writing them to files
+}
+
+// GetConfig returns the mail configuration from environment variables
+func GetConfig() Config {
+	config := Config{
+		Transport:    os.Getenv("MAIL_TRANSPORT"),
+		From:         getEnv("MAIL_FROM", DefaultFrom),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		OutboxDir:    os.Getenv("MAIL_OUTBOX_DIR"),
+	}
+
+	// Use SMTP as soon as a server is configured
+	if config.Transport == "" {
+		config.Transport = "outbox"
+		if config.SMTPHost != "" {
+			config.Transport = "smtp"
+		}
+	}
+
+	return config
+}
+
+// New creates the mailer selected by the configuration
+func New(config Config) (Mailer, error) {
+	switch config.Transport {
+	case "smtp":
+		if config.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail transport")
+		}
+		return NewSMTP(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.From), nil
+	case "outbox":
+		return NewOutbox(config.OutboxDir, config.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport: %s", config.Transport)
+	}
+}
+
+// Encode builds the MIME representation of a message sent from an address
+func (m *Message) Encode(from string) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	if err := writePart(parts, "text/plain", m.Text); err != nil {
+		return nil, err
+	}
+	if m.HTML != "" {
+		if err := writePart(parts, "text/html", m.HTML); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	fmt.Fprintf(&encoded, "From: %s\r\n", from)
+	fmt.Fprintf(&encoded, "To: %s\r\n", m.To)
+	fmt.Fprintf(&encoded, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&encoded, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&encoded, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&encoded, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	encoded.Write(body.Bytes())
+
+	return encoded.Bytes(), nil
+}
+
+func writePart(parts *multipart.Writer, contentType, content string) error {
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	writer := quotedprintable.NewWriter(part)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// validHeader rejects values that could inject extra headers into a message
+func validHeader(value string) bool {
+	return !strings.ContainsAny(value, "\r\n")
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
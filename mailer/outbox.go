@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox keeps the messages it is asked to send instead of delivering them. Messages are
+// written as .eml files when a directory is set, or logged otherwise, and can be read back
+// with Sent, which makes it the mailer for local development and tests.
+type Outbox struct {
+	dir  string
+	from string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+// NewOutbox creates an outbox writing to a directory, or logging if dir is empty
+func NewOutbox(dir, from string) *Outbox {
+	return &Outbox{dir: dir, from: from}
+}
+
+// Send stores a message in the outbox
+func (o *Outbox) Send(message *Message) error {
+	if !validHeader(message.To) || !validHeader(message.Subject) {
+		return fmt.Errorf("invalid email header")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.dir == "" {
+		log.Printf("Outbox email to %s: %s\n%s", message.To, message.Subject, message.Text)
+	} else {
+		encoded, err := message.Encode(o.from)
+		if err != nil {
+			return fmt.Errorf("error encoding email: %v", err)
+		}
+
+		if err := os.MkdirAll(o.dir, 0o755); err != nil {
+			return fmt.Errorf("error creating outbox directory: %v", err)
+		}
+
+		name := fmt.Sprintf("%s-%03d.eml", time.Now().Format("20060102T150405.000000000"), len(o.sent)+1)
+		if err := os.WriteFile(filepath.Join(o.dir, name), encoded, 0o644); err != nil {
+			return fmt.Errorf("error writing email to outbox: %v", err)
+		}
+	}
+
+	o.sent = append(o.sent, *message)
+	return nil
+}
+
+// Sent returns the messages stored so far, oldest first
+func (o *Outbox) Sent() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	sent := make([]Message, len(o.sent))
+	copy(sent, o.sent)
+	return sent
+}
@@ -0,0 +1,123 @@
+package mailer
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when a message cannot be queued without blocking
+	ErrQueueFull = errors.New("mail queue is full")
+	// ErrQueueClosed is returned when sending through a queue that was closed
+	ErrQueueClosed = errors.New("mail queue is closed")
+)
+
+// QueueConfig tunes a Queue; zero values use the defaults
+type QueueConfig struct {
+	Workers     int           // Messages sent concurrently (default 2)
+	Size        int           // Messages waiting to be sent (default 100)
+	MaxAttempts int           // Attempts per message before it is dropped (default 5)
+	Backoff     time.Duration // Wait before the first retry, doubled on each retry (default 2s)
+}
+
+// Queue is a Mailer that sends messages in the background through another mailer,
+// retrying failed deliveries, so requests never wait for the mail server
+type Queue struct {
+	mailer Mailer
+	config QueueConfig
+	jobs   chan *Message
+
+	mu      sync.RWMutex // Guards closed against sends on a closed channel
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// NewQueue starts the workers of a queue delivering through a mailer
+func NewQueue(mailer Mailer, config QueueConfig) *Queue {
+	if config.Workers <= 0 {
+		config.Workers = 2
+	}
+	if config.Size <= 0 {
+		config.Size = 100
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 2 * time.Second
+	}
+
+	q := &Queue{
+		mailer: mailer,
+		config: config,
+		jobs:   make(chan *Message, config.Size),
+	}
+
+	for i := 0; i < config.Workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+// Send queues a message without blocking
+func (q *Queue) Send(message *Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	queued := *message
+	select {
+	case q.jobs <- &queued:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits until the queued ones were delivered or dropped
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	q.workers.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+
+	for message := range q.jobs {
+		q.deliver(message)
+	}
+}
+
+// deliver sends a message, retrying with exponential backoff until it succeeds or runs out of attempts
+func (q *Queue) deliver(message *Message) {
+	backoff := q.config.Backoff
+	for attempt := 1; ; attempt++ {
+		err := q.mailer.Send(message)
+		if err == nil {
+			return
+		}
+
+		if attempt == q.config.MaxAttempts {
+			log.Printf("Giving up on email to %s after %d attempts: %v", message.To, attempt, err)
+			return
+		}
+
+		log.Printf("Failed to send email to %s (attempt %d of %d), retrying in %s: %v",
+			message.To, attempt, q.config.MaxAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
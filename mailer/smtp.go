@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTP sends messages through an SMTP server, upgrading to TLS when the server supports it
+type SMTP struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP creates a mailer for an SMTP server. Authentication is only used when a username is set.
+func NewSMTP(host, port, username, password, from string) *SMTP {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTP{
+		addr: net.JoinHostPort(host, port),
+		host: host,
+		auth: auth,
+		from: from,
+	}
+}
+
+// Send delivers a message to the SMTP server
+func (s *SMTP) Send(message *Message) error {
+	if !validHeader(message.To) || !validHeader(message.Subject) {
+		return fmt.Errorf("invalid email header")
+	}
+
+	sender, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %v", err)
+	}
+	recipient, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %v", err)
+	}
+
+	encoded, err := message.Encode(s.from)
+	if err != nil {
+		return fmt.Errorf("error encoding email: %v", err)
+	}
+
+	if err := smtp.SendMail(s.addr, s.auth, sender.Address, []string{recipient.Address}, encoded); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*
+var templateFiles embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/*.html"))
+)
+
+// Render builds a message from the templates of an email. The first line of the text
+// template is the subject, the rest is the plain text body, and the HTML template is
+// the HTML alternative. HTML values are escaped by html/template.
+func Render(name, to string, data interface{}) (*Message, error) {
+	var text bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return nil, fmt.Errorf("error rendering %s email: %v", name, err)
+	}
+
+	var html bytes.Buffer
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return nil, fmt.Errorf("error rendering %s email: %v", name, err)
+	}
+
+	subject, body, _ := strings.Cut(text.String(), "\n")
+
+	return &Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject),
+		Text:    strings.TrimLeft(body, "\n"),
+		HTML:    html.String(),
+	}, nil
+}
+
+// VerificationData fills the verification email
+type VerificationData struct {
+	Name string
+	Code string
+}
+
+// VerificationEmail builds the email carrying the validation code of a user
+func VerificationEmail(to, name, code string) (*Message, error) {
+	return Render("verification", to, VerificationData{Name: name, Code: code})
+}
+
+// PasswordResetData fills the password reset email
+type PasswordResetData struct {
+	Name      string
+	Token     string
+	ExpiresIn string
+}
+
+// PasswordResetEmail builds the email carrying a password reset token valid for ttl
+func PasswordResetEmail(to, name, token string, ttl time.Duration) (*Message, error) {
+	return Render("password_reset", to, PasswordResetData{Name: name, Token: token, ExpiresIn: formatDuration(ttl)})
+}
+
+// formatDuration writes a duration in words, such as "1 hour" or "30 minutes"
+func formatDuration(d time.Duration) string {
+	amount, unit := int(d/time.Minute), "minute"
+	if d%time.Hour == 0 {
+		amount, unit = int(d/time.Hour), "hour"
+	}
+	if amount == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", amount, unit)
+}
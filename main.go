@@ -8,6 +8,8 @@ import (
 
 	"tcg-server-go/database"
 	"tcg-server-go/handlers"
+	"tcg-server-go/mailer"
+	"tcg-server-go/repository"
 )
 
 func main() {
@@ -17,12 +19,52 @@ func main() {
 	}
 	defer database.Close()
 
-	// Create database tables
-	if err := database.CreateTables(); err != nil {
-		log.Fatal("Failed to create database tables:", err)
+	// Run the migrate subcommand instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal("Migration failed:", err)
+		}
+		return
 	}
 
-	router := handlers.SetupRoutes()
+	// Run the role subcommand instead of the server, on an up to date schema
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		if _, err := database.MigrateUp(); err != nil {
+			log.Fatal("Failed to migrate database:", err)
+		}
+		if err := runRole(os.Args[2:]); err != nil {
+			log.Fatal("Role change failed:", err)
+		}
+		return
+	}
+
+	// Bring the database schema up to date
+	applied, err := database.MigrateUp()
+	if err != nil {
+		log.Fatal("Failed to migrate database:", err)
+	}
+	log.Printf("Applied %d database migrations", len(applied))
+
+	// Send emails in the background so requests never wait for the mail server
+	mailConfig := mailer.GetConfig()
+	transport, err := mailer.New(mailConfig)
+	if err != nil {
+		log.Fatal("Failed to configure mail:", err)
+	}
+	log.Printf("Sending email through the %s transport", mailConfig.Transport)
+	mailQueue := mailer.NewQueue(transport, mailer.QueueConfig{})
+	defer mailQueue.Close()
+
+	router, h := handlers.SetupRoutes(repository.NewSQL(), mailQueue)
+
+	// Refuse to start rather than fail every marketplace sale
+	if err := h.CheckMarket(); err != nil {
+		log.Fatal("Invalid marketplace configuration:", err)
+	}
+
+	// Pair queued players and end matches lost on time in the background
+	h.Start()
+	defer h.Stop()
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -35,24 +77,57 @@ func main() {
 	fmt.Println("  POST /verify-email - Email verification")
 	fmt.Println("  POST /resend-code - Resend validation code")
 	fmt.Println("  POST /login - User authentication")
+	fmt.Println("  POST /token/refresh - Exchange a refresh token for new tokens")
+	fmt.Println("  POST /logout - Revoke the access and refresh tokens")
 	fmt.Println("  GET  /health - Server health check")
 	fmt.Println("  GET  /api/validate - Token validation (requires authentication)")
 	fmt.Println("  GET  /api/user-info - Get user game info (requires authentication)")
 	fmt.Println("  GET  /api/user-cards - Get user's card inventory (requires authentication)")
 	fmt.Println("  GET  /api/user-cards/{id} - Get specific user card (requires authentication)")
+	fmt.Println("  GET  /api/collection - Owned and missing cards with completion stats (requires authentication)")
 	fmt.Println("  GET  /api/decks - Get user's decks (requires authentication)")
 	fmt.Println("  POST /api/decks - Create new deck (requires authentication)")
 	fmt.Println("  GET  /api/decks/limit - Get deck limit information (requires authentication)")
 	fmt.Println("  GET  /api/decks/{id} - Get specific deck (requires authentication)")
 	fmt.Println("  GET  /api/decks/{id}/cards - Get deck with cards (requires authentication)")
+	fmt.Println("  GET  /api/decks/{id}/validation - Check a deck against its format (requires authentication)")
+	fmt.Println("  GET  /api/decks/{id}/export - Export a deck as a deck code and card list (requires authentication)")
+	fmt.Println("  POST /api/decks/import - Create a deck from a deck code or card list (requires authentication)")
+	fmt.Println("  GET  /api/formats - List deck formats (requires authentication)")
+	fmt.Println("  GET  /api/formats/{code} - Get a deck format (requires authentication)")
 	fmt.Println("  DELETE /api/decks/{id} - Delete deck (requires authentication)")
+	fmt.Println("  GET  /api/store/packs - List booster packs (requires authentication)")
+	fmt.Println("  POST /api/store/packs/{id}/open - Buy and open a booster pack (requires authentication)")
+	fmt.Println("  GET  /api/trades - List your trades (requires authentication)")
+	fmt.Println("  POST /api/trades - Propose a trade to another player (requires authentication)")
+	fmt.Println("  GET  /api/trades/{id} - Get a trade (requires authentication)")
+	fmt.Println("  POST /api/trades/{id}/counter|accept|decline|cancel - Answer a trade (requires authentication)")
+	fmt.Println("  GET  /api/market/listings - Search marketplace listings (requires authentication)")
+	fmt.Println("  POST /api/market/listings - List cards for sale (requires authentication)")
+	fmt.Println("  GET  /api/market/listings/{id} - Get a listing (requires authentication)")
+	fmt.Println("  POST /api/market/listings/{id}/buy|cancel - Buy or cancel a listing (requires authentication)")
+	fmt.Println("  GET  /api/market/cards/{id}/history - Card price history (requires authentication)")
+	fmt.Println("  POST /api/matchmaking/queue - Queue for a match with a deck and category (requires authentication)")
+	fmt.Println("  GET  /api/matchmaking/queue - Your matchmaking status (requires authentication)")
+	fmt.Println("  DELETE /api/matchmaking/queue - Leave the matchmaking queue (requires authentication)")
+	fmt.Println("  GET  /leaderboard - Ranked ladder by rating")
+	fmt.Println("  GET  /api/rating - Your rating and rating history (requires authentication)")
 	fmt.Println("")
 	fmt.Println("Card Management (Read-only):")
-	fmt.Println("  GET  /cards - Get all cards")
-	fmt.Println("  GET  /cards/search?q=<term> - Search cards by name")
+	fmt.Println("  GET  /cards - Query cards with filters, sorting and cursor pagination")
+	fmt.Println("  GET  /cards/search?q=<term> - Search card names and legends")
 	fmt.Println("  GET  /cards/type/{type} - Get cards by type (Monster/Spell/Energy)")
 	fmt.Println("  GET  /cards/element/{element} - Get cards by element")
 	fmt.Println("  GET  /cards/{id} - Get card by ID")
+	fmt.Println("  GET  /effects - Get the effects catalogue")
+	fmt.Println("  GET  /effects/{id} - Get effect by ID")
+	fmt.Println("")
+	fmt.Println("Administration (requires the admin role):")
+	fmt.Println("  POST/PUT/DELETE /admin/cards - Manage cards")
+	fmt.Println("  GET/POST/PUT/DELETE /admin/effects - Manage effects")
+	fmt.Println("  PUT  /admin/formats/{code} - Create or replace a deck format")
+	fmt.Println("  PUT  /admin/formats/{code}/cards - Replace the banned and restricted list of a format")
+	fmt.Println("  GET  /admin/audit - Audit trail of admin changes")
 
 	log.Fatal(http.ListenAndServe(":"+port, router))
 }
@@ -0,0 +1,37 @@
+// Package market holds the rules of the card marketplace that do not depend on storage.
+package market
+
+import (
+	"os"
+	"strconv"
+)
+
+// DefaultFeePercent is the part of each sale kept by the marketplace when not configured
+const DefaultFeePercent = 5
+
+// Config sets the fee of the marketplace and where it goes
+type Config struct {
+	FeePercent int // Of the price of each sale, rounded down
+	FeeSink    int // User credited with the fees; 0 takes them out of the economy
+}
+
+// GetConfig returns the marketplace configuration from environment variables
+func GetConfig() Config {
+	config := Config{
+		FeePercent: DefaultFeePercent,
+	}
+
+	if value, err := strconv.Atoi(os.Getenv("MARKET_FEE_PERCENT")); err == nil && value >= 0 && value <= 100 {
+		config.FeePercent = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("MARKET_FEE_USER_ID")); err == nil && value > 0 {
+		config.FeeSink = value
+	}
+
+	return config
+}
+
+// Fee returns the fee kept on a sale at the given price
+func (c Config) Fee(price int) int {
+	return price * c.FeePercent / 100
+}
@@ -0,0 +1,532 @@
+// Package matchmaking pairs players waiting in a queue by rating and seats them at a new
+// table. The rating difference a player accepts widens the longer they wait, so nobody
+// waits forever for a close opponent.
+//
+// A pair that cannot be seated goes back to the queue. If the deck of a player can no
+// longer be played, retrying cannot help: that player is dropped from the queue and the
+// other one keeps their place. Any other failure is retried with a backoff, and both
+// players are dropped once the pair failed MaxAttempts times.
+package matchmaking
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"tcg-server-go/game"
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+)
+
+var (
+	ErrAlreadyQueued = errors.New("already in the matchmaking queue")
+	ErrNotQueued     = errors.New("not in the matchmaking queue")
+	ErrMatchFound    = errors.New("a match was already found")
+)
+
+// Clock tells the time; tests use a ManualClock to control how long players have waited
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock is a Clock that only moves when advanced
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock creates a manual clock stopped at the given time
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Config tunes a Queue; zero values use the defaults
+type Config struct {
+	Interval   time.Duration // Between matching passes (default 2s)
+	Window     float64       // Rating difference accepted as soon as a player queues (default 100)
+	Widen      float64       // Added to the window for every WidenEvery waited (default 50)
+	WidenEvery time.Duration // default 10s
+	MaxWindow  float64       // Widest window (default 800)
+	ResultTTL  time.Duration // How long players can look up the match they got (default 10m)
+
+	RetryBackoff time.Duration // Before a pair that failed to be seated is paired again, doubled on every failure (default Interval)
+	MaxAttempts  int           // Failures of a pair before both players are dropped (default 3)
+}
+
+// Entry is a player waiting for a match
+type Entry struct {
+	UserID   uint      `json:"user_id"`
+	DeckID   uint      `json:"deck_id"`
+	Category string    `json:"category"`
+	Rating   float64   `json:"rating"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// Match is a pairing made by the queue. The player who waited longest owns the table.
+type Match struct {
+	TableID   uint               `json:"table_id"`
+	Category  string             `json:"category"`
+	OwnerID   uint               `json:"owner_id"`
+	RivalID   uint               `json:"rival_id"`
+	MatchedAt time.Time          `json:"matched_at"`
+	State     *models.TableState `json:"-"` // Dealt state of the match
+}
+
+// DeckError is returned when the deck a player queued with can no longer be played: it
+// was deleted or became invalid while they waited
+type DeckError struct {
+	UserID uint
+	DeckID uint
+	Reason string
+}
+
+func (e *DeckError) Error() string {
+	return fmt.Sprintf("deck %d of player %d %s", e.DeckID, e.UserID, e.Reason)
+}
+
+// failure counts the failed attempts to seat a pair
+type failure struct {
+	attempts int
+	retryAt  time.Time // The pair is not paired again before
+}
+
+// Queue holds the players waiting for a match and pairs them in the background
+type Queue struct {
+	Tables  repository.TableRepository
+	Decks   repository.DeckRepository
+	Matches *game.Matches
+	// Notify is called for every match made, after its table was created and dealt
+	Notify func(match Match)
+	// Dropped is called for every player taken out of the queue because they could not be
+	// seated, with the error of the last attempt
+	Dropped func(entry Entry, err error)
+
+	config Config
+	clock  Clock
+
+	mu       sync.Mutex
+	entries  map[uint]*Entry      // By user ID
+	matching map[uint]bool        // Players whose table is being created
+	results  map[uint]Match       // Latest match of each player
+	failures map[[2]uint]*failure // By pair, see pairKey
+
+	started   bool // Guarded by mu
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// New creates an empty queue that seats players through the given repositories. Matching
+// passes only run once Start is called; tests can call RunOnce instead.
+func New(repos *repository.Repositories, matches *game.Matches, config Config, clock Clock) *Queue {
+	if config.Interval <= 0 {
+		config.Interval = 2 * time.Second
+	}
+	if config.Window <= 0 {
+		config.Window = 100
+	}
+	if config.Widen <= 0 {
+		config.Widen = 50
+	}
+	if config.WidenEvery <= 0 {
+		config.WidenEvery = 10 * time.Second
+	}
+	if config.MaxWindow <= 0 {
+		config.MaxWindow = 800
+	}
+	if config.ResultTTL <= 0 {
+		config.ResultTTL = 10 * time.Minute
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = config.Interval
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+	if clock == nil {
+		clock = SystemClock{}
+	}
+
+	return &Queue{
+		Tables:   repos.Tables,
+		Decks:    repos.Decks,
+		Matches:  matches,
+		config:   config,
+		clock:    clock,
+		entries:  make(map[uint]*Entry),
+		matching: make(map[uint]bool),
+		results:  make(map[uint]Match),
+		failures: make(map[[2]uint]*failure),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs matching passes in the background until Stop is called
+func (q *Queue) Start() {
+	q.startOnce.Do(func() {
+		q.mu.Lock()
+		q.started = true
+		q.mu.Unlock()
+
+		go func() {
+			defer close(q.done)
+
+			ticker := time.NewTicker(q.config.Interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					q.RunOnce()
+				case <-q.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop ends the background passes and waits for the current one to finish
+func (q *Queue) Stop() {
+	q.stopOnce.Do(func() {
+		close(q.stop)
+	})
+
+	q.mu.Lock()
+	started := q.started
+	q.mu.Unlock()
+	if started {
+		<-q.done
+	}
+}
+
+// Enqueue adds a player to the queue. The time they joined is taken from the clock.
+func (q *Queue) Enqueue(entry Entry) (Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.entries[entry.UserID]; ok {
+		return Entry{}, ErrAlreadyQueued
+	}
+	if q.matching[entry.UserID] {
+		return Entry{}, ErrMatchFound
+	}
+
+	entry.QueuedAt = q.clock.Now()
+	queued := entry
+	q.entries[entry.UserID] = &queued
+	delete(q.results, entry.UserID)
+	return entry, nil
+}
+
+// Leave removes a player from the queue. It fails with ErrMatchFound if their table is
+// already being created.
+func (q *Queue) Leave(userID uint) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.matching[userID] {
+		return ErrMatchFound
+	}
+	if _, ok := q.entries[userID]; !ok {
+		return ErrNotQueued
+	}
+
+	delete(q.entries, userID)
+	q.forget(userID)
+	return nil
+}
+
+// Status returns the entry of a player still waiting, whether their table is being
+// created, and the latest match they got
+func (q *Queue) Status(userID uint) (*Entry, bool, *Match) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var entry *Entry
+	if queued, ok := q.entries[userID]; ok {
+		found := *queued
+		entry = &found
+	}
+
+	var match *Match
+	if result, ok := q.results[userID]; ok {
+		match = &result
+	}
+
+	return entry, q.matching[userID], match
+}
+
+// Window returns the rating difference a waiting player currently accepts
+func (q *Queue) Window(entry Entry) float64 {
+	return q.window(entry, q.clock.Now())
+}
+
+func (q *Queue) window(entry Entry, now time.Time) float64 {
+	waited := now.Sub(entry.QueuedAt)
+	if waited < 0 {
+		waited = 0
+	}
+
+	steps := float64(waited / q.config.WidenEvery)
+	return math.Min(q.config.Window+steps*q.config.Widen, q.config.MaxWindow)
+}
+
+// RunOnce makes one matching pass: it pairs the waiting players it can and seats each
+// pair at a new table. It returns the matches made.
+func (q *Queue) RunOnce() []Match {
+	pairs := q.pair()
+
+	matches := []Match{}
+	for _, pair := range pairs {
+		match, err := q.seat(pair[0], pair[1])
+
+		var dropped []Entry
+		q.mu.Lock()
+		delete(q.matching, pair[0].UserID)
+		delete(q.matching, pair[1].UserID)
+		if err != nil {
+			log.Printf("Failed to seat matched players %d and %d: %v", pair[0].UserID, pair[1].UserID, err)
+			dropped = q.requeue(pair, err)
+		} else {
+			q.results[match.OwnerID] = match
+			q.results[match.RivalID] = match
+			q.forget(match.OwnerID)
+			q.forget(match.RivalID)
+		}
+		q.mu.Unlock()
+
+		if err == nil {
+			matches = append(matches, match)
+			if q.Notify != nil {
+				q.Notify(match)
+			}
+		}
+		for _, entry := range dropped {
+			log.Printf("Dropped player %d from the matchmaking queue: %v", entry.UserID, err)
+			if q.Dropped != nil {
+				q.Dropped(entry, err)
+			}
+		}
+	}
+
+	return matches
+}
+
+// requeue puts the players of a pair that could not be seated back where they were in the
+// queue, except those it drops, which it returns. It must be called with mu held.
+func (q *Queue) requeue(pair [2]Entry, err error) []Entry {
+	var dropped []Entry
+
+	var deckErr *DeckError
+	if errors.As(err, &deckErr) {
+		// Only the player whose deck is gone leaves; the pair itself did nothing wrong
+		for _, entry := range pair {
+			if entry.UserID == deckErr.UserID {
+				dropped = append(dropped, entry)
+				q.forget(entry.UserID)
+			} else {
+				requeued := entry
+				q.entries[entry.UserID] = &requeued
+			}
+		}
+		return dropped
+	}
+
+	key := pairKey(pair[0].UserID, pair[1].UserID)
+	failed := q.failures[key]
+	if failed == nil {
+		failed = &failure{}
+		q.failures[key] = failed
+	}
+	failed.attempts++
+
+	if failed.attempts >= q.config.MaxAttempts {
+		for _, entry := range pair {
+			dropped = append(dropped, entry)
+			q.forget(entry.UserID)
+		}
+		return dropped
+	}
+
+	failed.retryAt = q.clock.Now().Add(q.config.RetryBackoff << uint(failed.attempts-1))
+	for _, entry := range pair {
+		requeued := entry
+		q.entries[entry.UserID] = &requeued
+	}
+	return nil
+}
+
+// forget clears the failures of every pair of a player. It must be called with mu held.
+func (q *Queue) forget(userID uint) {
+	for key := range q.failures {
+		if key[0] == userID || key[1] == userID {
+			delete(q.failures, key)
+		}
+	}
+}
+
+// pairKey identifies a pair whatever the order of its players
+func pairKey(a, b uint) [2]uint {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]uint{a, b}
+}
+
+// pair takes the players that can be matched out of the queue. Players are served in the
+// order they joined, each with the closest rated player of their category within their
+// window; since they waited longest their window is also the widest of the two. A pair
+// that failed to be seated is skipped until its backoff has passed.
+func (q *Queue) pair() [][2]Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.clock.Now()
+	for userID, result := range q.results {
+		if now.Sub(result.MatchedAt) > q.config.ResultTTL {
+			delete(q.results, userID)
+		}
+	}
+
+	waiting := make([]*Entry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		waiting = append(waiting, entry)
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		if !waiting[i].QueuedAt.Equal(waiting[j].QueuedAt) {
+			return waiting[i].QueuedAt.Before(waiting[j].QueuedAt)
+		}
+		return waiting[i].UserID < waiting[j].UserID
+	})
+
+	paired := make(map[uint]bool)
+	pairs := [][2]Entry{}
+	for i, entry := range waiting {
+		if paired[entry.UserID] {
+			continue
+		}
+
+		window := q.window(*entry, now)
+		var best *Entry
+		bestDiff := 0.0
+		for _, candidate := range waiting[i+1:] {
+			if paired[candidate.UserID] || candidate.Category != entry.Category {
+				continue
+			}
+			if failed := q.failures[pairKey(entry.UserID, candidate.UserID)]; failed != nil && now.Before(failed.retryAt) {
+				continue
+			}
+			diff := math.Abs(entry.Rating - candidate.Rating)
+			if diff <= window && (best == nil || diff < bestDiff) {
+				best, bestDiff = candidate, diff
+			}
+		}
+
+		if best != nil {
+			paired[entry.UserID], paired[best.UserID] = true, true
+			pairs = append(pairs, [2]Entry{*entry, *best})
+		}
+	}
+
+	for _, pair := range pairs {
+		for _, entry := range pair {
+			delete(q.entries, entry.UserID)
+			q.matching[entry.UserID] = true
+		}
+	}
+
+	return pairs
+}
+
+// seat creates the table of a pair, seats both players with their decks and deals the match.
+// If any step fails the table is deleted again: it is private, so nobody else could ever
+// join it. Decks are checked first, since they may have changed while the players waited.
+func (q *Queue) seat(owner, rival Entry) (Match, error) {
+	for _, entry := range []Entry{owner, rival} {
+		if err := q.checkDeck(entry); err != nil {
+			return Match{}, err
+		}
+	}
+
+	tableID, err := q.Tables.CreateTable(owner.Category, "private", models.PrizeAura, nil, nil)
+	if err != nil {
+		return Match{}, err
+	}
+
+	state, err := q.deal(tableID, owner, rival)
+	if err != nil {
+		if deleteErr := q.Tables.DeleteTable(tableID); deleteErr != nil {
+			log.Printf("Failed to delete table %d of unseated players: %v", tableID, deleteErr)
+		}
+		return Match{}, err
+	}
+
+	return Match{
+		TableID:   tableID,
+		Category:  owner.Category,
+		OwnerID:   owner.UserID,
+		RivalID:   rival.UserID,
+		MatchedAt: q.clock.Now(),
+		State:     state,
+	}, nil
+}
+
+// checkDeck returns a DeckError if the deck of a queued player can no longer be played
+func (q *Queue) checkDeck(entry Entry) error {
+	deck, err := q.Decks.GetDeckByID(int(entry.DeckID))
+	if err != nil {
+		return fmt.Errorf("error retrieving deck %d: %v", entry.DeckID, err)
+	}
+
+	if deck == nil || deck.UserID != int(entry.UserID) {
+		return &DeckError{UserID: entry.UserID, DeckID: entry.DeckID, Reason: "was deleted"}
+	}
+	if !deck.Valid {
+		return &DeckError{UserID: entry.UserID, DeckID: entry.DeckID, Reason: "is not valid for play"}
+	}
+	return nil
+}
+
+// deal seats both players of a pair at their new table and deals the match
+func (q *Queue) deal(tableID uint, owner, rival Entry) (*models.TableState, error) {
+	if err := q.Tables.CreateUserTable(owner.UserID, tableID, nil, owner.DeckID); err != nil {
+		return nil, err
+	}
+
+	joined, err := q.Tables.JoinTable(tableID, rival.UserID, rival.DeckID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !joined {
+		return nil, fmt.Errorf("could not seat rival at table %d", tableID)
+	}
+
+	return q.Matches.StartMatch(tableID, owner.DeckID, rival.DeckID)
+}
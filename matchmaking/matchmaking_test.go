@@ -0,0 +1,436 @@
+package matchmaking
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"tcg-server-go/game"
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var testConfig = Config{Window: 100, Widen: 50, WidenEvery: 10 * time.Second, MaxWindow: 300}
+
+func newTestQueue(config Config) (*Queue, *ManualClock, *repository.Repositories) {
+	repos := repository.NewMemory().Repositories()
+	clock := NewManualClock(testStart)
+	q := New(repos, game.NewMatches(repos), config, clock)
+	q.Decks = queuedDecks{repos.Decks, make(map[int]bool)}
+	return q, clock, repos
+}
+
+func enqueue(t *testing.T, q *Queue, userID uint, category string, rating float64) Entry {
+	t.Helper()
+	entry, err := q.Enqueue(Entry{UserID: userID, DeckID: userID, Category: category, Rating: rating})
+	if err != nil {
+		t.Fatalf("Enqueue(%d): %v", userID, err)
+	}
+	return entry
+}
+
+// queuedDecks has a valid deck for every test player, with their user ID, until it is removed
+type queuedDecks struct {
+	repository.DeckRepository
+	removed map[int]bool
+}
+
+func (d queuedDecks) GetDeckByID(id int) (*models.Deck, error) {
+	if d.removed[id] {
+		return nil, nil
+	}
+	return &models.Deck{ID: id, UserID: id, Name: "Queued", Valid: true}, nil
+}
+
+// failingTables fails to seat the rival of every table
+type failingTables struct {
+	repository.TableRepository
+}
+
+func (failingTables) JoinTable(tableID, rivalID, rivalDeckID uint, rivalStakeCardID *int) (bool, error) {
+	return false, errors.New("seat taken")
+}
+
+// blockingTables holds every pass in JoinTable until released
+type blockingTables struct {
+	repository.TableRepository
+	joining chan struct{}
+	release chan struct{}
+}
+
+func (b blockingTables) JoinTable(tableID, rivalID, rivalDeckID uint, rivalStakeCardID *int) (bool, error) {
+	b.joining <- struct{}{}
+	<-b.release
+	return b.TableRepository.JoinTable(tableID, rivalID, rivalDeckID, rivalStakeCardID)
+}
+
+func TestWindowWidens(t *testing.T) {
+	q, clock, _ := newTestQueue(testConfig)
+	entry := enqueue(t, q, 1, "C", 1500)
+
+	tests := []struct {
+		advance time.Duration
+		window  float64
+	}{
+		{0, 100},
+		{9 * time.Second, 100},
+		{time.Second, 150}, // 10s waited
+		{10 * time.Second, 200},
+		{15 * time.Second, 250}, // 35s waited
+		{5 * time.Second, 300},  // MaxWindow reached
+		{time.Hour, 300},
+	}
+
+	for _, tt := range tests {
+		clock.Advance(tt.advance)
+		waited := clock.Now().Sub(testStart)
+		if got := q.Window(entry); got != tt.window {
+			t.Errorf("Window after %v = %v, want %v", waited, got, tt.window)
+		}
+	}
+}
+
+func TestRunOncePairsOnceTheWindowWidens(t *testing.T) {
+	q, clock, _ := newTestQueue(testConfig)
+	enqueue(t, q, 1, "C", 1500)
+	clock.Advance(time.Second)
+	enqueue(t, q, 2, "C", 1640)
+
+	if matches := q.RunOnce(); len(matches) != 0 {
+		t.Fatalf("matched %d pairs 140 points apart with a window of 100", len(matches))
+	}
+
+	// Player 1 waited 10s and accepts 150 points; player 2 still accepts 100, but the
+	// player who waited longest picks
+	clock.Advance(9 * time.Second)
+	matches := q.RunOnce()
+	if len(matches) != 1 {
+		t.Fatalf("RunOnce made %d matches, want 1", len(matches))
+	}
+
+	match := matches[0]
+	if match.OwnerID != 1 || match.RivalID != 2 || match.Category != "C" {
+		t.Errorf("match = owner %d, rival %d, category %s; want 1, 2, C", match.OwnerID, match.RivalID, match.Category)
+	}
+	if match.State == nil || match.State.Phase != "mulligan" {
+		t.Errorf("the match was not dealt: %+v", match.State)
+	}
+
+	for _, userID := range []uint{1, 2} {
+		entry, matching, result := q.Status(userID)
+		if entry != nil || matching || result == nil || result.TableID != match.TableID {
+			t.Errorf("Status(%d) = %v, %v, %v; want the match only", userID, entry, matching, result)
+		}
+	}
+}
+
+func TestRunOnceStopsWideningAtMaxWindow(t *testing.T) {
+	q, clock, _ := newTestQueue(testConfig)
+	enqueue(t, q, 1, "C", 1500)
+	enqueue(t, q, 2, "C", 1850)
+
+	clock.Advance(24 * time.Hour)
+	if matches := q.RunOnce(); len(matches) != 0 {
+		t.Fatalf("matched players 350 points apart with a MaxWindow of 300")
+	}
+
+	for _, userID := range []uint{1, 2} {
+		if entry, _, _ := q.Status(userID); entry == nil {
+			t.Errorf("player %d left the queue", userID)
+		}
+	}
+}
+
+func TestRunOncePairsWithinCategory(t *testing.T) {
+	q, _, _ := newTestQueue(testConfig)
+	enqueue(t, q, 1, "S", 1500)
+	enqueue(t, q, 2, "A", 1500)
+	enqueue(t, q, 3, "S", 1590)
+	enqueue(t, q, 4, "A", 1520)
+	enqueue(t, q, 5, "S", 1550)
+	enqueue(t, q, 6, "B", 1500)
+
+	matches := q.RunOnce()
+	if len(matches) != 2 {
+		t.Fatalf("RunOnce made %d matches, want 2", len(matches))
+	}
+
+	// Player 1 gets the closest rated player of S, and player 2 the only other A player
+	got := map[uint]uint{}
+	for _, match := range matches {
+		got[match.OwnerID] = match.RivalID
+	}
+	if got[1] != 5 || got[2] != 4 {
+		t.Errorf("pairs = %v, want 1 with 5 and 2 with 4", got)
+	}
+
+	for _, userID := range []uint{3, 6} {
+		if entry, _, _ := q.Status(userID); entry == nil {
+			t.Errorf("player %d without an opponent of their category left the queue", userID)
+		}
+	}
+}
+
+func TestRunOnceRequeuesFailedSeat(t *testing.T) {
+	q, clock, repos := newTestQueue(testConfig)
+	first := enqueue(t, q, 1, "C", 1500)
+	clock.Advance(time.Second)
+	second := enqueue(t, q, 2, "C", 1510)
+
+	q.Tables = failingTables{repos.Tables}
+	if matches := q.RunOnce(); len(matches) != 0 {
+		t.Fatalf("RunOnce made %d matches with a failing seat", len(matches))
+	}
+
+	for _, queued := range []Entry{first, second} {
+		entry, matching, result := q.Status(queued.UserID)
+		if entry == nil || matching || result != nil {
+			t.Fatalf("Status(%d) = %v, %v, %v; want back in the queue", queued.UserID, entry, matching, result)
+		}
+		if !entry.QueuedAt.Equal(queued.QueuedAt) {
+			t.Errorf("player %d lost their place: queued at %v, want %v", queued.UserID, entry.QueuedAt, queued.QueuedAt)
+		}
+	}
+
+	// The table of the failed pair is gone
+	if table, err := repos.Tables.GetTableByID(1); err != nil || table != nil {
+		t.Errorf("GetTableByID(1) = %v, %v; want the table deleted", table, err)
+	}
+
+	// The pair backs off for RetryBackoff, which defaults to the interval
+	q.Tables = repos.Tables
+	if matches := q.RunOnce(); len(matches) != 0 {
+		t.Fatalf("RunOnce paired the failed pair again right away")
+	}
+	clock.Advance(2 * time.Second)
+	if matches := q.RunOnce(); len(matches) != 1 {
+		t.Errorf("RunOnce made %d matches once seating works, want 1", len(matches))
+	}
+}
+
+func TestRunOnceBacksOffAndDropsFailingPair(t *testing.T) {
+	config := testConfig
+	config.RetryBackoff = time.Second
+	config.MaxAttempts = 3
+	q, clock, repos := newTestQueue(config)
+	q.Tables = failingTables{repos.Tables}
+
+	var dropped []Entry
+	q.Dropped = func(entry Entry, err error) {
+		dropped = append(dropped, entry)
+	}
+
+	enqueue(t, q, 1, "C", 1500)
+	enqueue(t, q, 2, "C", 1510)
+
+	// The backoff doubles after every failure: 1s, then 2s
+	for attempt, backoff := range []time.Duration{time.Second, 2 * time.Second} {
+		q.RunOnce()
+		if len(dropped) != 0 {
+			t.Fatalf("attempt %d dropped %v", attempt+1, dropped)
+		}
+
+		clock.Advance(backoff - time.Millisecond)
+		q.RunOnce()
+		for _, userID := range []uint{1, 2} {
+			if entry, matching, _ := q.Status(userID); entry == nil || matching {
+				t.Fatalf("Status(%d) = %v, %v during the backoff; want queued", userID, entry, matching)
+			}
+		}
+		clock.Advance(time.Millisecond)
+	}
+
+	// The third failure gives up on both players
+	q.RunOnce()
+	if len(dropped) != 2 {
+		t.Fatalf("dropped %v after MaxAttempts, want both players", dropped)
+	}
+	for _, userID := range []uint{1, 2} {
+		if entry, matching, result := q.Status(userID); entry != nil || matching || result != nil {
+			t.Errorf("Status(%d) = %v, %v, %v; want out of the queue", userID, entry, matching, result)
+		}
+	}
+
+	// Queueing again starts over
+	q.Tables = repos.Tables
+	enqueue(t, q, 1, "C", 1500)
+	enqueue(t, q, 2, "C", 1510)
+	if matches := q.RunOnce(); len(matches) != 1 {
+		t.Errorf("RunOnce made %d matches after queueing again, want 1", len(matches))
+	}
+}
+
+func TestRunOncePairsOthersDuringBackoff(t *testing.T) {
+	q, clock, repos := newTestQueue(testConfig)
+	q.Tables = failingTables{repos.Tables}
+	enqueue(t, q, 1, "C", 1500)
+	clock.Advance(time.Second)
+	enqueue(t, q, 2, "C", 1510)
+	q.RunOnce()
+
+	q.Tables = repos.Tables
+	enqueue(t, q, 3, "C", 1520)
+	matches := q.RunOnce()
+	if len(matches) != 1 || matches[0].OwnerID != 1 || matches[0].RivalID != 3 {
+		t.Fatalf("RunOnce during the backoff = %+v, want player 1 matched with 3", matches)
+	}
+	if entry, _, _ := q.Status(2); entry == nil {
+		t.Errorf("player 2 left the queue")
+	}
+}
+
+func TestRunOnceDropsPlayerWithUnplayableDeck(t *testing.T) {
+	q, clock, repos := newTestQueue(testConfig)
+	first := enqueue(t, q, 1, "C", 1500)
+	clock.Advance(time.Second)
+	enqueue(t, q, 2, "C", 1510)
+
+	var dropped []Entry
+	var dropErr error
+	q.Dropped = func(entry Entry, err error) {
+		dropped = append(dropped, entry)
+		dropErr = err
+	}
+
+	// Player 2 deletes their deck while waiting
+	q.Decks.(queuedDecks).removed[2] = true
+	if matches := q.RunOnce(); len(matches) != 0 {
+		t.Fatalf("RunOnce made %d matches with a deleted deck", len(matches))
+	}
+
+	var deckErr *DeckError
+	if len(dropped) != 1 || dropped[0].UserID != 2 || !errors.As(dropErr, &deckErr) || deckErr.DeckID != 2 {
+		t.Fatalf("dropped %v with %v; want player 2 with a DeckError", dropped, dropErr)
+	}
+	if entry, matching, _ := q.Status(2); entry != nil || matching {
+		t.Errorf("Status(2) = %v, %v; want out of the queue", entry, matching)
+	}
+
+	// The other player keeps their place and no table was created
+	entry, matching, _ := q.Status(1)
+	if entry == nil || matching || !entry.QueuedAt.Equal(first.QueuedAt) {
+		t.Errorf("Status(1) = %v, %v; want queued at %v", entry, matching, first.QueuedAt)
+	}
+	if table, err := repos.Tables.GetTableByID(1); err != nil || table != nil {
+		t.Errorf("GetTableByID(1) = %v, %v; want no table", table, err)
+	}
+
+	// And is matched with the next player right away
+	enqueue(t, q, 3, "C", 1490)
+	if matches := q.RunOnce(); len(matches) != 1 || matches[0].RivalID != 3 {
+		t.Errorf("RunOnce = %+v, want player 1 matched with 3", matches)
+	}
+}
+
+func TestEnqueueAndLeaveDuringPass(t *testing.T) {
+	q, clock, repos := newTestQueue(testConfig)
+	enqueue(t, q, 1, "C", 1500)
+	clock.Advance(time.Second)
+	enqueue(t, q, 2, "C", 1500)
+	enqueue(t, q, 3, "S", 2000)
+
+	tables := blockingTables{repos.Tables, make(chan struct{}), make(chan struct{})}
+	q.Tables = tables
+
+	done := make(chan []Match)
+	go func() {
+		done <- q.RunOnce()
+	}()
+	<-tables.joining
+
+	// Players being seated can neither leave nor queue again
+	for _, userID := range []uint{1, 2} {
+		if err := q.Leave(userID); !errors.Is(err, ErrMatchFound) {
+			t.Errorf("Leave(%d) while seating = %v, want ErrMatchFound", userID, err)
+		}
+		if _, err := q.Enqueue(Entry{UserID: userID, Category: "C"}); !errors.Is(err, ErrMatchFound) {
+			t.Errorf("Enqueue(%d) while seating = %v, want ErrMatchFound", userID, err)
+		}
+		if _, matching, _ := q.Status(userID); !matching {
+			t.Errorf("Status(%d) is not matching while seating", userID)
+		}
+	}
+
+	// The rest of the queue is not held up
+	if err := q.Leave(3); err != nil {
+		t.Errorf("Leave(3) while seating another pair = %v", err)
+	}
+	enqueue(t, q, 4, "C", 1500)
+
+	close(tables.release)
+	matches := <-done
+	if len(matches) != 1 || matches[0].OwnerID != 1 || matches[0].RivalID != 2 {
+		t.Fatalf("RunOnce = %+v, want 1 against 2", matches)
+	}
+
+	if entry, _, _ := q.Status(3); entry != nil {
+		t.Errorf("player 3 is still queued after leaving")
+	}
+	if entry, matching, _ := q.Status(4); entry == nil || matching {
+		t.Errorf("player 4 who queued during the pass is not waiting")
+	}
+}
+
+func TestConcurrentEnqueueLeaveAndPasses(t *testing.T) {
+	q, clock, _ := newTestQueue(testConfig)
+
+	stop := make(chan struct{})
+	passes := make(chan []Match)
+	go func() {
+		made := []Match{}
+		for {
+			select {
+			case <-stop:
+				passes <- made
+				return
+			default:
+				made = append(made, q.RunOnce()...)
+				clock.Advance(time.Second)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				userID := uint(worker*1000 + j%5 + 1)
+				q.Enqueue(Entry{UserID: userID, Category: "C", Rating: float64(1500 + j%3)})
+				if j%3 == 0 {
+					q.Leave(userID)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	made := <-passes
+
+	// Everyone ends up either waiting or matched; nobody is stuck being seated
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 5; j++ {
+			userID := uint(i*1000 + j + 1)
+			if _, matching, _ := q.Status(userID); matching {
+				t.Errorf("player %d is still being seated after the last pass", userID)
+			}
+		}
+	}
+
+	tables := map[uint]string{}
+	for _, match := range made {
+		if match.OwnerID == match.RivalID {
+			t.Errorf("player %d was matched against themselves", match.OwnerID)
+		}
+		key := fmt.Sprintf("%d-%d", match.OwnerID, match.RivalID)
+		if previous, ok := tables[match.TableID]; ok {
+			t.Errorf("table %d was given to %s and %s", match.TableID, previous, key)
+		}
+		tables[match.TableID] = key
+	}
+}
@@ -2,61 +2,129 @@ package middleware
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
 	"strings"
 
 	"tcg-server-go/auth"
-	"tcg-server-go/database"
+	"tcg-server-go/repository"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization token required", http.StatusUnauthorized)
-			return
-		}
-
-		if len(authHeader) < 7 || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := authHeader[7:]
-
-		claims, err := auth.ValidateToken(tokenString)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		// Get user from database to check validation status
-		user, err := database.GetUserByID(claims.UserID)
-		if err != nil {
-			http.Error(w, "Error retrieving user", http.StatusInternalServerError)
-			return
-		}
-
-		if user == nil {
-			http.Error(w, "User not found", http.StatusUnauthorized)
-			return
-		}
-
-		// Check if user's email has been validated
-		if user.ValidatedAt == nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusForbidden)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "Email not verified. Please verify your email before accessing this resource.",
-			})
-			return
-		}
-
-		// Set user information in headers for downstream handlers
-		r.Header.Set("X-User-ID", strconv.Itoa(claims.UserID))
-		r.Header.Set("X-User-Email", claims.Email)
-
-		next.ServeHTTP(w, r)
-	})
+// ErrEmailNotVerified is returned by Authenticate for users that have not verified their email
+var ErrEmailNotVerified = errors.New("Email not verified. Please verify your email before accessing this resource.")
+
+// Authenticate resolves a bearer token to the principal of a valid, unrevoked token of a
+// user with a verified email. On failure it returns the HTTP status to answer with.
+func Authenticate(users repository.UserRepository, tokens repository.TokenRepository, tokenString string) (*Principal, int, error) {
+	if tokenString == "" {
+		return nil, http.StatusUnauthorized, errors.New("Authorization token required")
+	}
+
+	claims, err := auth.ValidateToken(tokenString)
+	if err != nil {
+		return nil, http.StatusUnauthorized, errors.New("Invalid token")
+	}
+
+	// Tokens are revoked by their jti on logout
+	revoked, err := tokens.IsAccessTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("Error checking token")
+	}
+	if revoked {
+		return nil, http.StatusUnauthorized, errors.New("Token has been revoked")
+	}
+
+	// Get user from database to check validation status
+	user, err := users.GetUserByID(claims.UserID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("Error retrieving user")
+	}
+
+	if user == nil {
+		return nil, http.StatusUnauthorized, errors.New("User not found")
+	}
+
+	// Tokens issued before a password change are revoked
+	if claims.TokenVersion != user.TokenVersion {
+		return nil, http.StatusUnauthorized, errors.New("Token has been revoked")
+	}
+
+	// Check if user's email has been validated
+	if user.ValidatedAt == nil {
+		return nil, http.StatusForbidden, ErrEmailNotVerified
+	}
+
+	// Roles come from the stored user rather than the token so revoking a role takes
+	// effect right away.
+	principal := &Principal{
+		UserID: user.ID,
+		Email:  user.Email,
+		Roles:  []string{RoleUser},
+	}
+	if user.Role != "" && user.Role != RoleUser {
+		principal.Roles = append(principal.Roles, user.Role)
+	}
+	return principal, http.StatusOK, nil
+}
+
+// WriteAuthError answers a request that failed Authenticate. Forbidden responses are JSON
+// so clients can tell an unverified account apart from a bad token.
+func WriteAuthError(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusForbidden {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// AuthMiddleware requires a valid, unrevoked token of a user with a verified email
+func AuthMiddleware(users repository.UserRepository, tokens repository.TokenRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Authorization token required", http.StatusUnauthorized)
+				return
+			}
+
+			if len(authHeader) < 7 || !strings.HasPrefix(authHeader, "Bearer ") {
+				http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+				return
+			}
+
+			principal, status, err := Authenticate(users, tokens, authHeader[7:])
+			if err != nil {
+				WriteAuthError(w, status, err)
+				return
+			}
+
+			// Pass the authenticated user to downstream handlers
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// RequireRole only lets through principals that have been granted a role. It must run
+// after AuthMiddleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !principal.HasRole(role) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "This resource requires the " + role + " role"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+
+	"tcg-server-go/models"
+)
+
+const (
+	// RoleUser is the role of every authenticated user
+	RoleUser = models.RoleUser
+	// RoleAdmin is granted to users that manage the card catalogue
+	RoleAdmin = models.RoleAdmin
+)
+
+// Principal is the authenticated user of a request
+type Principal struct {
+	UserID int
+	Email  string
+	Roles  []string
+}
+
+// HasRole reports whether the principal has been granted a role
+func (p *Principal) HasRole(role string) bool {
+	for _, granted := range p.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// contextKey is unexported so no other package can read or overwrite the values stored under it
+type contextKey int
+
+const principalKey contextKey = iota
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the principal set by AuthMiddleware, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(*Principal)
+	return principal, ok && principal != nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditFilter holds the optional filters and pagination for listing audit entries
+type AuditFilter struct {
+	EntityType string
+	EntityID   int
+	UserID     int
+	Limit      int
+	Offset     int
+}
+
+// AuditAction is a kind of change recorded in the audit log
+type AuditAction string
+
+const (
+	AuditActionCreate AuditAction = "create"
+	AuditActionUpdate AuditAction = "update"
+	AuditActionDelete AuditAction = "delete"
+	AuditActionLink   AuditAction = "link"   // An effect was added to a card
+	AuditActionUnlink AuditAction = "unlink" // An effect was removed from a card
+)
+
+// Audited entity types
+const (
+	AuditEntityCard       = "card"
+	AuditEntityEffect     = "effect"
+	AuditEntityCardEffect = "card_effect"
+	AuditEntityFormat     = "format"
+	AuditEntityPack       = "pack"
+)
+
+// AuditEntry records who changed an entity and its value before and after the change
+type AuditEntry struct {
+	ID         int             `json:"id" db:"id"`
+	UserID     *int            `json:"user_id" db:"user_id"` // Nil once the user is deleted
+	Action     AuditAction     `json:"action" db:"action"`
+	EntityType string          `json:"entity_type" db:"entity_type"`
+	EntityID   int             `json:"entity_id" db:"entity_id"`
+	OldValue   json.RawMessage `json:"old_value,omitempty" db:"old_value"`
+	NewValue   json.RawMessage `json:"new_value,omitempty" db:"new_value"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AuditLogResponse represents a page of the audit log
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	Limit   int          `json:"limit"`
+}
@@ -1,9 +1,17 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 )
 
+// ErrCardInUse is returned when deleting a card players still hold: in their collection, a
+// deck, a trade, a market listing or a table stake
+var ErrCardInUse = errors.New("card is still held by players")
+
 // CardType represents the type of card
 type CardType string
 
@@ -26,31 +34,126 @@ const (
 	CardElementDark    CardElement = "Dark"
 )
 
+// CardRarity represents how rare a card is
+type CardRarity string
+
+const (
+	CardRarityCommon    CardRarity = "Common"
+	CardRarityUncommon  CardRarity = "Uncommon"
+	CardRarityRare      CardRarity = "Rare"
+	CardRarityEpic      CardRarity = "Epic"
+	CardRarityLegendary CardRarity = "Legendary"
+)
+
+// DefaultSetCode is the set assigned to cards created without one
+const DefaultSetCode = "BASE"
+
+// EnergyCost is the number of energies of each element needed to pay a cost.
+// Neutral requirements can be paid with energies of any element.
+type EnergyCost map[CardElement]int
+
+// Total returns the number of energies needed to pay the cost
+func (c EnergyCost) Total() int {
+	total := 0
+	for _, amount := range c {
+		total += amount
+	}
+	return total
+}
+
+// CoveredBy checks if the given attached energy elements pay the cost
+func (c EnergyCost) CoveredBy(energies []CardElement) bool {
+	available := make(map[CardElement]int)
+	for _, element := range energies {
+		available[element]++
+	}
+
+	spare := len(energies)
+	for element, amount := range c {
+		if element == CardElementNeutral {
+			continue
+		}
+		if available[element] < amount {
+			return false
+		}
+		spare -= amount
+	}
+
+	return spare >= c[CardElementNeutral]
+}
+
+// Value stores the cost as JSON
+func (c EnergyCost) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan reads a JSON cost from the database
+func (c *EnergyCost) Scan(value interface{}) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("unsupported energy cost type %T", value)
+	}
+	return json.Unmarshal(raw, c)
+}
+
 // Card represents a card in the game
 type Card struct {
-	ID        int         `json:"id" db:"id"`
-	Name      string      `json:"name" db:"name"`
-	Type      CardType    `json:"type" db:"type"`
-	Legend    string      `json:"legend" db:"legend"`
-	Element   CardElement `json:"element" db:"element"`
-	CreatedAt time.Time   `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at" db:"updated_at"`
+	ID           int         `json:"id" db:"id"`
+	Name         string      `json:"name" db:"name"`
+	Type         CardType    `json:"type" db:"type"`
+	Legend       string      `json:"legend" db:"legend"`
+	Element      CardElement `json:"element" db:"element"`
+	HP           *int        `json:"hp" db:"hp"`                       // Monsters only
+	AttackName   *string     `json:"attack_name" db:"attack_name"`     // Monsters only
+	AttackDamage *int        `json:"attack_damage" db:"attack_damage"` // Monsters only
+	AttackCost   EnergyCost  `json:"attack_cost" db:"attack_cost"`     // Energies needed to attack
+	RetreatCost  int         `json:"retreat_cost" db:"retreat_cost"`   // Energies discarded to retreat
+	Rarity       CardRarity  `json:"rarity" db:"rarity"`
+	SetCode      string      `json:"set_code" db:"set_code"`
+	CreatedAt    time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at" db:"updated_at"`
+	Effects      []Effect    `json:"effects,omitempty"` // Only loaded when requested with ?include=effects
 }
 
 // CreateCardRequest represents the data needed to create a card
 type CreateCardRequest struct {
-	Name    string      `json:"name" validate:"required,min=1"`
-	Type    CardType    `json:"type" validate:"required,oneof=Monster Spell Energy"`
-	Legend  string      `json:"legend" validate:"required"`
-	Element CardElement `json:"element" validate:"required,oneof=Fire Water Wind Earth Neutral Holy Dark"`
+	Name         string      `json:"name" validate:"required,min=1"`
+	Type         CardType    `json:"type" validate:"required,oneof=Monster Spell Energy"`
+	Legend       string      `json:"legend" validate:"required"`
+	Element      CardElement `json:"element" validate:"required,oneof=Fire Water Wind Earth Neutral Holy Dark"`
+	HP           *int        `json:"hp,omitempty" validate:"omitempty,min=1"`
+	AttackName   *string     `json:"attack_name,omitempty" validate:"omitempty,min=1,max=100"`
+	AttackDamage *int        `json:"attack_damage,omitempty" validate:"omitempty,min=0"`
+	AttackCost   EnergyCost  `json:"attack_cost,omitempty" validate:"omitempty,dive,keys,oneof=Fire Water Wind Earth Neutral Holy Dark,endkeys,min=1"`
+	RetreatCost  int         `json:"retreat_cost" validate:"min=0"`
+	Rarity       CardRarity  `json:"rarity,omitempty" validate:"omitempty,oneof=Common Uncommon Rare Epic Legendary"`
+	SetCode      string      `json:"set_code,omitempty" validate:"omitempty,min=1,max=10"`
 }
 
 // UpdateCardRequest represents the data needed to update a card
 type UpdateCardRequest struct {
-	Name    *string      `json:"name,omitempty" validate:"omitempty,min=1"`
-	Type    *CardType    `json:"type,omitempty" validate:"omitempty,oneof=Monster Spell Energy"`
-	Legend  *string      `json:"legend,omitempty" validate:"omitempty"`
-	Element *CardElement `json:"element,omitempty" validate:"omitempty,oneof=Fire Water Wind Earth Neutral Holy Dark"`
+	Name         *string      `json:"name,omitempty" validate:"omitempty,min=1"`
+	Type         *CardType    `json:"type,omitempty" validate:"omitempty,oneof=Monster Spell Energy"`
+	Legend       *string      `json:"legend,omitempty" validate:"omitempty"`
+	Element      *CardElement `json:"element,omitempty" validate:"omitempty,oneof=Fire Water Wind Earth Neutral Holy Dark"`
+	HP           *int         `json:"hp,omitempty" validate:"omitempty,min=1"`
+	AttackName   *string      `json:"attack_name,omitempty" validate:"omitempty,min=1,max=100"`
+	AttackDamage *int         `json:"attack_damage,omitempty" validate:"omitempty,min=0"`
+	AttackCost   *EnergyCost  `json:"attack_cost,omitempty" validate:"omitempty"`
+	RetreatCost  *int         `json:"retreat_cost,omitempty" validate:"omitempty,min=0"`
+	Rarity       *CardRarity  `json:"rarity,omitempty" validate:"omitempty,oneof=Common Uncommon Rare Epic Legendary"`
+	SetCode      *string      `json:"set_code,omitempty" validate:"omitempty,min=1,max=10"`
 }
 
 // CardResponse represents the response for card operations
@@ -64,3 +167,11 @@ type CardsResponse struct {
 	Cards   []*Card `json:"cards"`
 	Message string  `json:"message"`
 }
+
+// CardPageResponse represents a page of a card query
+type CardPageResponse struct {
+	Cards      []*Card `json:"cards"`
+	NextCursor *string `json:"next_cursor"` // Passed as ?cursor= to get the next page; null on the last page
+	Limit      int     `json:"limit"`
+	Message    string  `json:"message"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Sort keys of a card query; a leading "-" sorts in descending order
+const (
+	CardSortID     = "id"
+	CardSortName   = "name"
+	CardSortHP     = "hp"
+	CardSortAttack = "attack"
+	CardSortCost   = "cost"
+)
+
+// CardFilter holds the filters, order and page of a card query. Every filter is optional and
+// they are all combined; a list matches any of its values.
+type CardFilter struct {
+	Types    []CardType
+	Elements []CardElement
+	Rarities []CardRarity
+	Sets     []string
+	MinHP    *int
+	MaxHP    *int
+	MinCost  *int // Total energies of the attack cost
+	MaxCost  *int
+	EffectID int
+	Search   string // Full-text search on the name and legend
+	Sort     string
+	Limit    int
+	After    *CardCursor // Only cards after this position are returned
+}
+
+// CardCursor is the position of a card in a sorted card query: the value of its sort key,
+// and its ID to break ties
+type CardCursor struct {
+	Sort   string `json:"s"`
+	Number int    `json:"n,omitempty"`
+	Text   string `json:"t,omitempty"`
+	ID     int    `json:"id"`
+}
+
+// ParseCardSort splits a sort into its key and direction. It reports false for unknown keys.
+func ParseCardSort(sort string) (string, bool, bool) {
+	key := strings.TrimPrefix(sort, "-")
+	switch key {
+	case CardSortID, CardSortName, CardSortHP, CardSortAttack, CardSortCost:
+		return key, key != sort, true
+	}
+	return key, key != sort, false
+}
+
+// CardCursorFor returns the position of a card in a query with the given sort
+func CardCursorFor(sort string, card *Card) CardCursor {
+	cursor := CardCursor{Sort: sort, ID: card.ID}
+	key, _, _ := ParseCardSort(sort)
+	switch key {
+	case CardSortID:
+		cursor.Number = card.ID
+	case CardSortName:
+		cursor.Text = card.Name
+	case CardSortHP:
+		if card.HP != nil {
+			cursor.Number = *card.HP
+		}
+	case CardSortAttack:
+		if card.AttackDamage != nil {
+			cursor.Number = *card.AttackDamage
+		}
+	case CardSortCost:
+		cursor.Number = card.AttackCost.Total()
+	}
+	return cursor
+}
+
+// After reports whether the position comes after another one in the order of its sort
+func (c CardCursor) After(other CardCursor) bool {
+	key, desc, _ := ParseCardSort(c.Sort)
+
+	compare := c.Number - other.Number
+	if key == CardSortName {
+		compare = strings.Compare(strings.ToLower(c.Text), strings.ToLower(other.Text))
+	}
+	if desc {
+		compare = -compare
+	}
+
+	if compare != 0 {
+		return compare > 0
+	}
+	return c.ID > other.ID
+}
+
+// SearchWords splits a search into lowercase words. Everything but letters and digits
+// separates words, so the operators of boolean full-text mode never reach the query.
+func SearchWords(search string) []string {
+	return strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
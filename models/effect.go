@@ -1,16 +1,36 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 // Effect represents an effect that can be applied to cards
 type Effect struct {
-	ID          int        `json:"id" db:"id"`
-	Description string     `json:"description" db:"description"`
-	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
-	DeletedAt   *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	ID          int             `json:"id" db:"id"`
+	Description string          `json:"description" db:"description"`
+	Script      json.RawMessage `json:"script,omitempty" db:"script"` // Run by the match engine; see the effectscript package
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
+	DeletedAt   *time.Time      `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// EffectRequest represents the data needed to create or update an effect
+type EffectRequest struct {
+	Description string          `json:"description" validate:"required,min=1"`
+	Script      json.RawMessage `json:"script,omitempty"` // Effects without a script only describe the card
+}
+
+// EffectResponse represents the response for effect operations
+type EffectResponse struct {
+	Effect  *Effect `json:"effect"`
+	Message string  `json:"message"`
+}
+
+// EffectsResponse represents the response for multiple effects
+type EffectsResponse struct {
+	Effects []Effect `json:"effects"`
+	Message string   `json:"message"`
 }
 
 // CardEffect represents the relationship between cards and effects
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFormatNotFound is returned when a deck uses a format that does not exist
+var ErrFormatNotFound = errors.New("deck format not found")
+
+// DeckViolationError is returned when a deck breaks the rules of its format or uses cards
+// the user does not own
+type DeckViolationError struct {
+	Violations []DeckViolation
+}
+
+func (e *DeckViolationError) Error() string {
+	return fmt.Sprintf("deck breaks %d rules of its format", len(e.Violations))
+}
+
+// DefaultFormat is the format of decks created without one
+const DefaultFormat = "unlimited"
+
+// DeckFormat is a set of deck building rules. Nil limits are not enforced.
+type DeckFormat struct {
+	ID               int               `json:"id" db:"id"`
+	Code             string            `json:"code" db:"code"`
+	Name             string            `json:"name" db:"name"`
+	MinCards         int               `json:"min_cards" db:"min_cards"`
+	MaxCards         *int              `json:"max_cards,omitempty" db:"max_cards"`
+	MaxCopies        *int              `json:"max_copies,omitempty" db:"max_copies"` // Per card, energies excluded
+	MinEnergyPercent int               `json:"min_energy_percent" db:"min_energy_percent"`
+	MaxEnergyPercent int               `json:"max_energy_percent" db:"max_energy_percent"`
+	Sets             []string          `json:"sets"`        // Legal sets; every set is legal when empty
+	CardLimits       []FormatCardLimit `json:"card_limits"` // Banned and restricted cards
+	CreatedAt        time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// FormatCardLimit caps the copies of a card a deck of a format may hold: 0 bans the card
+// and 1 restricts it
+type FormatCardLimit struct {
+	CardID int `json:"card_id" db:"card_id" validate:"required,min=1"`
+	Limit  int `json:"limit" db:"card_limit" validate:"min=0"`
+}
+
+// Deck rules a violation can break
+const (
+	RuleMinCards    = "min_cards"
+	RuleMaxCards    = "max_cards"
+	RuleMaxCopies   = "max_copies"
+	RuleBanned      = "banned"
+	RuleRestricted  = "restricted"
+	RuleEnergyRatio = "energy_ratio"
+	RuleSetRotation = "set_rotation"
+	RuleUnknownCard = "unknown_card"
+	RuleNotOwned    = "not_owned"
+)
+
+// DeckViolation is a deck building rule a deck breaks
+type DeckViolation struct {
+	Rule    string `json:"rule"`
+	CardID  *int   `json:"card_id,omitempty"`
+	Message string `json:"message"`
+}
+
+// DeckValidation is the result of checking a deck against its format
+type DeckValidation struct {
+	DeckID     int             `json:"deck_id"`
+	Format     string          `json:"format"`
+	Valid      bool            `json:"valid"`
+	Violations []DeckViolation `json:"violations"`
+}
+
+// SaveFormatRequest represents the rules of a format created or replaced by an admin
+type SaveFormatRequest struct {
+	Name             string            `json:"name" validate:"required,min=1,max=100"`
+	MinCards         int               `json:"min_cards" validate:"min=1"`
+	MaxCards         *int              `json:"max_cards,omitempty" validate:"omitempty,min=1"`
+	MaxCopies        *int              `json:"max_copies,omitempty" validate:"omitempty,min=1"`
+	MinEnergyPercent int               `json:"min_energy_percent" validate:"min=0,max=100"`
+	MaxEnergyPercent *int              `json:"max_energy_percent,omitempty" validate:"omitempty,min=0,max=100"`
+	Sets             []string          `json:"sets" validate:"omitempty,dive,min=1,max=10"`
+	CardLimits       []FormatCardLimit `json:"card_limits" validate:"omitempty,dive"`
+}
+
+// FormatCardLimitsRequest represents a new banned and restricted list of a format
+type FormatCardLimitsRequest struct {
+	CardLimits []FormatCardLimit `json:"card_limits" validate:"dive"`
+}
+
+// FormatResponse represents a format, with the decks whose validity changed when it was saved
+type FormatResponse struct {
+	Format      *DeckFormat      `json:"format"`
+	Revalidated []DeckValidation `json:"revalidated,omitempty"`
+	Message     string           `json:"message"`
+}
+
+// FormatsResponse represents the list of formats
+type FormatsResponse struct {
+	Formats []DeckFormat `json:"formats"`
+	Message string       `json:"message"`
+}
+
+// DeckValidationResponse represents the validation of a deck
+type DeckValidationResponse struct {
+	Validation *DeckValidation `json:"validation"`
+	Message    string          `json:"message"`
+}
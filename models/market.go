@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrListingNotActive is returned when a listing has already been sold or cancelled
+	ErrListingNotActive = errors.New("listing is no longer active")
+	// ErrOwnListing is returned when a seller tries to buy their own listing
+	ErrOwnListing = errors.New("cannot buy your own listing")
+)
+
+// Listing sort orders
+const (
+	ListingSortNewest    = "newest"
+	ListingSortPriceAsc  = "price"
+	ListingSortPriceDesc = "-price"
+)
+
+// ListingFilter holds the optional filters, order and pagination for searching active listings
+type ListingFilter struct {
+	CardID   int
+	SellerID int
+	Element  CardElement
+	Rarity   CardRarity
+	MinPrice int
+	MaxPrice int
+	Sort     string
+	Limit    int
+	Offset   int
+}
+
+// ListingStatus represents the state of a marketplace listing
+type ListingStatus string
+
+const (
+	ListingStatusActive    ListingStatus = "active"
+	ListingStatusSold      ListingStatus = "sold"
+	ListingStatusCancelled ListingStatus = "cancelled"
+)
+
+// Listing offers copies of a card on the marketplace for a fixed price. The copies are held
+// in escrow, out of the seller's collection, while the listing is active.
+type Listing struct {
+	ID        int           `json:"id" db:"id"`
+	SellerID  int           `json:"seller_id" db:"seller_id"`
+	CardID    int           `json:"card_id" db:"card_id"`
+	Amount    int           `json:"amount" db:"amount"`
+	Price     int           `json:"price" db:"price"` // For all the copies
+	Status    ListingStatus `json:"status" db:"status"`
+	BuyerID   *int          `json:"buyer_id,omitempty" db:"buyer_id"`
+	Fee       int           `json:"fee" db:"fee"` // Kept by the marketplace when sold
+	SoldAt    *time.Time    `json:"sold_at,omitempty" db:"sold_at"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
+	Card      *Card         `json:"card,omitempty"`
+}
+
+// CreateListingRequest represents the data needed to list cards for sale
+type CreateListingRequest struct {
+	CardID int `json:"card_id" validate:"required,min=1"`
+	Amount int `json:"amount" validate:"required,min=1,max=99"`
+	Price  int `json:"price" validate:"required,min=1"`
+}
+
+// ListingResponse represents the response for listing operations
+type ListingResponse struct {
+	Listing *Listing `json:"listing"`
+	Message string   `json:"message"`
+}
+
+// ListingsResponse represents a page of marketplace listings
+type ListingsResponse struct {
+	Listings []Listing `json:"listings"`
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	Limit    int       `json:"limit"`
+}
+
+// Sale is a sold listing in the price history of a card
+type Sale struct {
+	ListingID int       `json:"listing_id" db:"id"`
+	Amount    int       `json:"amount" db:"amount"`
+	Price     int       `json:"price" db:"price"`
+	UnitPrice float64   `json:"unit_price"`
+	SoldAt    time.Time `json:"sold_at" db:"sold_at"`
+}
+
+// PriceHistoryResponse represents the recent sales of a card, newest first
+type PriceHistoryResponse struct {
+	CardID           int     `json:"card_id"`
+	Sales            []Sale  `json:"sales"`
+	CopiesSold       int     `json:"copies_sold"`
+	AverageUnitPrice float64 `json:"average_unit_price"`
+	Message          string  `json:"message"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RarityWeights maps each rarity to its relative chance of being pulled in a pack slot
+type RarityWeights map[CardRarity]int
+
+// PackSlots holds the rarity weights of each card in a pack
+type PackSlots []RarityWeights
+
+// Value stores the slots as JSON
+func (s PackSlots) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan reads JSON slots from the database
+func (s *PackSlots) Scan(value interface{}) error {
+	return scanJSON(value, s)
+}
+
+// CardIDs is a list of card IDs stored as JSON
+type CardIDs []int
+
+// Value stores the IDs as JSON
+func (c CardIDs) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan reads JSON IDs from the database
+func (c *CardIDs) Scan(value interface{}) error {
+	return scanJSON(value, c)
+}
+
+// scanJSON decodes a JSON column into dest
+func scanJSON(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", value)
+	}
+}
+
+// Pack is a booster pack sold in the store
+type Pack struct {
+	ID          int        `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	Description string     `json:"description" db:"description"`
+	Price       int        `json:"price" db:"price"`
+	SetCode     string     `json:"set_code" db:"set_code"` // The pack draws from the cards of this set
+	Slots       PackSlots  `json:"slots" db:"slots"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// PackRequest represents the request to create or replace a pack
+type PackRequest struct {
+	Name        string    `json:"name" validate:"required,min=1,max=100"`
+	Description string    `json:"description" validate:"required"`
+	Price       int       `json:"price" validate:"min=1"`
+	SetCode     string    `json:"set_code" validate:"required,max=10"`
+	Slots       PackSlots `json:"slots" validate:"required,min=1,dive,min=1,dive,keys,oneof=Common Uncommon Rare Epic Legendary,endkeys,min=1"`
+}
+
+// PackResponse represents the response for pack operations
+type PackResponse struct {
+	Pack    *Pack  `json:"pack"`
+	Message string `json:"message"`
+}
+
+// PackOpening records a pack bought by a user and the cards it contained
+type PackOpening struct {
+	ID        int       `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	PackID    int       `json:"pack_id" db:"pack_id"`
+	Price     int       `json:"price" db:"price"`
+	Seed      int64     `json:"seed,string" db:"seed"` // Replaying the roll with this seed gives the same cards
+	CardIDs   CardIDs   `json:"card_ids" db:"card_ids"`
+	MoneyLeft int       `json:"money_left" db:"-"` // Money of the user after paying
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// PacksResponse represents the store catalogue
+type PacksResponse struct {
+	Packs   []Pack `json:"packs"`
+	Message string `json:"message"`
+}
+
+// PackOpeningResponse represents the result of opening a pack
+type PackOpeningResponse struct {
+	Opening *PackOpening `json:"opening"`
+	Cards   []*Card      `json:"cards"` // Pulled cards in slot order, repeated if pulled twice
+	Message string       `json:"message"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Rating is the Glicko-2 rating of a user on the ranked ladder
+type Rating struct {
+	UserID     int        `json:"user_id"`
+	Rating     float64    `json:"rating"`
+	Deviation  float64    `json:"deviation"`
+	Volatility float64    `json:"volatility"`
+	Games      int        `json:"games"`
+	Wins       int        `json:"wins"`
+	Category   string     `json:"category"` // Lowest table category the user may play
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// RatingChange is a row of the rating history: how a finished match changed the rating of one of its players
+type RatingChange struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	TableID      uint      `json:"table_id"`
+	OpponentID   *int      `json:"opponent_id"` // Nil once the opponent is deleted
+	Won          bool      `json:"won"`
+	RatingBefore float64   `json:"rating_before"`
+	RatingAfter  float64   `json:"rating_after"`
+	Deviation    float64   `json:"deviation"`
+	Volatility   float64   `json:"volatility"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RatingResponse represents the rating of a user with their latest rating changes
+type RatingResponse struct {
+	Rating  Rating         `json:"rating"`
+	History []RatingChange `json:"history"`
+}
+
+// LeaderboardEntry is a player on the ranked ladder
+type LeaderboardEntry struct {
+	Rank      int     `json:"rank"`
+	UserID    int     `json:"user_id"`
+	Name      string  `json:"name"`
+	Rating    float64 `json:"rating"`
+	Deviation float64 `json:"deviation"`
+	Games     int     `json:"games"`
+	Wins      int     `json:"wins"`
+	Category  string  `json:"category"`
+}
+
+// LeaderboardResponse represents a page of the ranked ladder
+type LeaderboardResponse struct {
+	Entries []LeaderboardEntry `json:"entries"`
+	Total   int                `json:"total"`
+	Page    int                `json:"page"`
+	Limit   int                `json:"limit"`
+}
@@ -1,31 +1,151 @@
 package models
 
 import (
+	"errors"
 	"time"
 )
 
+var (
+	// ErrOwnerStake is returned, wrapping the reason, when the owner of a table can no longer
+	// put up their stake as a rival joins
+	ErrOwnerStake = errors.New("table owner cannot cover the stake")
+	// ErrStaleTableState is returned when a match state is saved after another action
+	// changed it since it was read
+	ErrStaleTableState = errors.New("table state was changed by another action")
+	// ErrTableTaken is returned when changing a table a rival has joined
+	ErrTableTaken = errors.New("table already has a rival")
+)
+
+// MatchRewards is the experience given to the players of a finished match
+type MatchRewards struct {
+	WinnerExperience int
+	LoserExperience  int
+}
+
+// LobbyFilter holds the optional filters and pagination for listing open tables
+type LobbyFilter struct {
+	Category  string
+	Prize     string
+	MinAmount *int
+	MaxAmount *int
+	Limit     int
+	Offset    int
+}
+
+// TableSettings are what the owner of a table chooses for it: the table itself, the card
+// they stake on a card prize and the time control
+type TableSettings struct {
+	Category    string
+	Privacy     string
+	Password    *string
+	Prize       string
+	Amount      *int
+	StakeCardID *int // Only for card prizes
+	// InitialTime is the seconds on each player's clock, nil for untimed tables
+	InitialTime   *int
+	TimeIncrement int
+}
+
+// Prizes played for at a table
+const (
+	PrizeMoney = "money"
+	PrizeCard  = "card"
+	PrizeAura  = "aura"
+)
+
+// Table is a match between its owner and a rival. Winner is true when the owner won and
+// false when the rival won; it is set with FinishedAt when the match ends.
 type Table struct {
-	ID         uint       `json:"id"`
-	Category   string     `json:"category"`
-	Privacy    string     `json:"privacy"`
-	Password   *string    `json:"password,omitempty"`
-	Prize      string     `json:"prize"`
-	Amount     *int       `json:"amount,omitempty"`
-	Winner     *bool      `json:"winner,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
-	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ID       uint    `json:"id"`
+	Category string  `json:"category"`
+	Privacy  string  `json:"privacy"`
+	Password *string `json:"password,omitempty"`
+	Prize    string  `json:"prize"`
+	Amount   *int    `json:"amount,omitempty"`
+	// InitialTime is the seconds on each player's clock, nil for untimed tables
+	InitialTime   *int       `json:"initial_time,omitempty"`
+	TimeIncrement int        `json:"time_increment"` // Seconds added when a player's turn ends
+	Winner        *bool      `json:"winner,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
 }
 
 type UserTable struct {
-	ID      uint  `json:"id"`
-	UserID  uint  `json:"user_id"`
-	RivalID *uint `json:"rival_id,omitempty"`
-	TableID uint  `json:"table_id"`
-	Time    int   `json:"time"`
-	User    User  `json:"user,omitempty"`
-	Rival   *User `json:"rival,omitempty"`
-	Table   Table `json:"table,omitempty"`
+	ID          uint  `json:"id"`
+	UserID      uint  `json:"user_id"`
+	RivalID     *uint `json:"rival_id,omitempty"`
+	TableID     uint  `json:"table_id"`
+	Time        int   `json:"time"`
+	OwnerDeckID *uint `json:"owner_deck_id,omitempty"`
+	RivalDeckID *uint `json:"rival_deck_id,omitempty"`
+	StakeCardID *int  `json:"stake_card_id,omitempty"` // Staked by the owner on card prizes
+	User        User  `json:"user,omitempty"`
+	Rival       *User `json:"rival,omitempty"`
+	Table       Table `json:"table,omitempty"`
+}
+
+// PrizeAmount returns what each player puts up for the prize of the table: the money or
+// copies of their stake card, which go to the winner, or the aura the winner gains
+func (t *Table) PrizeAmount() int {
+	if t.Amount != nil && *t.Amount > 0 {
+		return *t.Amount
+	}
+	if t.Prize == PrizeMoney {
+		return 0 // Friendly match
+	}
+	return 1
+}
+
+// TableClock is the chess clock of the match at a table. Only the time of the player whose
+// turn it is runs; it is charged to them when their turn ends, and the increment is added.
+type TableClock struct {
+	TableID   uint       `json:"table_id"`
+	OwnerTime *int       `json:"owner_time_ms,omitempty"` // Milliseconds left, nil on untimed tables
+	RivalTime *int       `json:"rival_time_ms,omitempty"`
+	Increment int        `json:"increment"`         // Seconds
+	Running   *string    `json:"running,omitempty"` // Seat whose time is running
+	ChargedAt *time.Time `json:"charged_at,omitempty"`
+	StartedAt time.Time  `json:"started_at"` // When the match was dealt
+	Elapsed   int        `json:"elapsed"`    // Seconds played, kept in user_tables.time
+}
+
+// TableStake is the money or cards a player put in escrow when the match at a table started
+type TableStake struct {
+	UserID int  `json:"user_id"`
+	Money  int  `json:"money,omitempty"`
+	CardID *int `json:"card_id,omitempty"`
+	Amount int  `json:"amount,omitempty"` // Copies of the card
+}
+
+// MatchResult is the settlement of a finished match: the stakes of both players go to the
+// winner, along with any aura, and both players gain experience and a new rating
+type MatchResult struct {
+	TableID          uint           `json:"table_id"`
+	Prize            string         `json:"prize"`
+	WinnerID         int            `json:"winner_id"`
+	LoserID          int            `json:"loser_id"`
+	Stakes           []TableStake   `json:"stakes"`
+	Aura             int            `json:"aura,omitempty"`
+	WinnerExperience int            `json:"winner_experience"`
+	LoserExperience  int            `json:"loser_experience"`
+	Ratings          []RatingChange `json:"ratings"`
+	FinishedAt       time.Time      `json:"finished_at"`
+}
+
+// LobbyTable is a public table waiting for a rival, as listed in the lobby
+type LobbyTable struct {
+	ID            uint      `json:"id"`
+	Category      string    `json:"category"`
+	Prize         string    `json:"prize"`
+	Amount        *int      `json:"amount,omitempty"`
+	InitialTime   *int      `json:"initial_time,omitempty"`
+	TimeIncrement int       `json:"time_increment"`
+	HasPassword   bool      `json:"has_password"`
+	OwnerID       uint      `json:"owner_id"`
+	OwnerName     string    `json:"owner_name"`
+	OwnerLevel    int       `json:"owner_level"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 type TableState struct {
@@ -52,6 +172,18 @@ type TableState struct {
 	RivalsBenchMonster2HP *int      `json:"rivals_bench_monster_2_hp,omitempty"`
 	RivalsBenchMonster3HP *int      `json:"rivals_bench_monster_3_hp,omitempty"`
 	RivalsGraveyard       []uint    `json:"rivals_graveyard"`
+	OwnersHand            []uint    `json:"owners_hand"`
+	OwnersDeck            []uint    `json:"owners_deck"`
+	RivalsHand            []uint    `json:"rivals_hand"`
+	RivalsDeck            []uint    `json:"rivals_deck"`
+	OwnersReady           bool      `json:"owners_ready"`
+	RivalsReady           bool      `json:"rivals_ready"`
+	Phase                 string    `json:"phase"`
+	Turn                  int       `json:"turn"`
+	ActiveSeat            *string   `json:"active_seat,omitempty"`
+	EnergyAttached        bool      `json:"energy_attached"`
+	WinnerSeat            *string   `json:"winner_seat,omitempty"`
+	Version               int       `json:"version"` // Bumped on every save, see ErrStaleTableState
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
 }
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTradeNotPending is returned when a trade has already been answered
+	ErrTradeNotPending = errors.New("trade is no longer pending")
+	// ErrTradeExpired is returned when a trade is answered after it expired
+	ErrTradeExpired = errors.New("trade has expired")
+)
+
+// TradeStatus represents the state of a trade offer
+type TradeStatus string
+
+const (
+	TradeStatusPending   TradeStatus = "pending"
+	TradeStatusAccepted  TradeStatus = "accepted"
+	TradeStatusDeclined  TradeStatus = "declined"
+	TradeStatusCancelled TradeStatus = "cancelled"
+	TradeStatusCountered TradeStatus = "countered" // Answered with a counter-offer
+	TradeStatusExpired   TradeStatus = "expired"
+)
+
+// Sides of the cards of a trade
+const (
+	TradeSideOffered   = "offered"   // Given by the proposer
+	TradeSideRequested = "requested" // Given by the recipient
+)
+
+// TradeCard is a number of copies of a card given in a trade
+type TradeCard struct {
+	CardID int `json:"card_id" db:"card_id" validate:"required,min=1"`
+	Amount int `json:"amount" db:"amount" validate:"required,min=1"`
+}
+
+// Trade is an offer from the proposer to give cards and money to the recipient in exchange
+// for cards and money of the recipient
+type Trade struct {
+	ID             int         `json:"id" db:"id"`
+	ProposerID     int         `json:"proposer_id" db:"proposer_id"`
+	RecipientID    int         `json:"recipient_id" db:"recipient_id"`
+	OfferedCards   []TradeCard `json:"offered_cards"`
+	OfferedMoney   int         `json:"offered_money" db:"offered_money"`
+	RequestedCards []TradeCard `json:"requested_cards"`
+	RequestedMoney int         `json:"requested_money" db:"requested_money"`
+	Status         TradeStatus `json:"status" db:"status"`
+	CounterOfID    *int        `json:"counter_of_id,omitempty" db:"counter_of_id"` // The offer this one answers
+	ExpiresAt      time.Time   `json:"expires_at" db:"expires_at"`
+	ResolvedAt     *time.Time  `json:"resolved_at,omitempty" db:"resolved_at"`
+	CreatedAt      time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// TradeTerms represents the cards and money exchanged by a trade or counter-offer
+type TradeTerms struct {
+	OfferedCards   []TradeCard `json:"offered_cards" validate:"omitempty,dive"`
+	OfferedMoney   int         `json:"offered_money" validate:"min=0"`
+	RequestedCards []TradeCard `json:"requested_cards" validate:"omitempty,dive"`
+	RequestedMoney int         `json:"requested_money" validate:"min=0"`
+	ExpiresInHours int         `json:"expires_in_hours,omitempty" validate:"omitempty,min=1,max=168"`
+}
+
+// CreateTradeRequest represents the data needed to propose a trade
+type CreateTradeRequest struct {
+	RecipientID int `json:"recipient_id" validate:"required,min=1"`
+	TradeTerms
+}
+
+// TradeResponse represents the response for trade operations
+type TradeResponse struct {
+	Trade   *Trade `json:"trade"`
+	Message string `json:"message"`
+}
+
+// TradesResponse represents the response for multiple trades
+type TradesResponse struct {
+	Trades  []Trade `json:"trades"`
+	Message string  `json:"message"`
+}
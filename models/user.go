@@ -12,16 +12,26 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"` // Short-lived access token
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds until the access token expires
 }
 
 type ValidateResponse struct {
 	Message string `json:"message"`
 }
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
+	UserID       int    `json:"user_id"`
+	Email        string `json:"email"`
+	TokenVersion int    `json:"token_version"` // Must match the user's token version, see User.TokenVersion
+	Role         string `json:"role"`          // For clients; the server checks the role stored on the user
 	jwt.RegisteredClaims
 }
 
@@ -33,6 +43,8 @@ type User struct {
 	ValidationCode          *string    `json:"-" db:"validation_code"`
 	ValidationCodeExpiresAt *time.Time `json:"-" db:"validation_code_expires_at"`
 	ValidatedAt             *time.Time `json:"validated_at" db:"validated_at"`
+	TokenVersion            int        `json:"-" db:"token_version"` // Bumped on password changes to revoke issued tokens
+	Role                    string     `json:"role" db:"role"`
 	CreatedAt               time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt               time.Time  `json:"updated_at" db:"updated_at"`
 	DeletedAt               *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
@@ -66,3 +78,19 @@ type ResendCodeRequest struct {
 type ResendCodeResponse struct {
 	Message string `json:"message"`
 }
+
+// ForgotPasswordRequest represents the request to email a password reset token
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest represents the request to set a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6,alphanum"`
+}
+
+// PasswordResetResponse represents the response of the password reset endpoints
+type PasswordResetResponse struct {
+	Message string `json:"message"`
+}
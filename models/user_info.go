@@ -1,9 +1,20 @@
 package models
 
 import (
+	"errors"
 	"time"
 )
 
+var (
+	// ErrInsufficientFunds is returned when a user does not have the money they would spend
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrNotEnoughCards is returned when a user does not own the copies they would give away
+	ErrNotEnoughCards = errors.New("not enough copies of the card")
+	// ErrBreaksDeck is returned when giving cards away would leave a saved deck with more
+	// copies of a card than its owner has
+	ErrBreaksDeck = errors.New("would break a saved deck")
+)
+
 // UserInfo represents game information for a user account
 type UserInfo struct {
 	ID         int       `json:"id" db:"id"`
@@ -11,6 +22,7 @@ type UserInfo struct {
 	Level      int       `json:"level" db:"level"`
 	Experience int       `json:"experience" db:"experience"`
 	Money      int       `json:"money" db:"money"`
+	Aura       int       `json:"aura" db:"aura"` // Won at tables with an aura prize
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -59,17 +71,43 @@ type UserCardsResponse struct {
 	Message   string     `json:"message"`
 }
 
+// CollectionCard is a card of the catalogue with the copies a user has of it
+type CollectionCard struct {
+	Card     *Card `json:"card"`
+	Owned    int   `json:"owned"`
+	InDecks  int   `json:"in_decks"` // Decks share copies, so this is the most copies any one deck uses
+	Tradable int   `json:"tradable"` // Copies that can be traded or sold without breaking a deck
+}
+
+// Completion counts the cards of a group a user has at least one copy of
+type Completion struct {
+	Owned   int     `json:"owned"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+// CollectionResponse represents a user's collection measured against the whole catalogue
+type CollectionResponse struct {
+	Cards      []CollectionCard            `json:"cards"`
+	Completion Completion                  `json:"completion"`
+	Sets       map[string]*Completion      `json:"sets"`
+	Elements   map[CardElement]*Completion `json:"elements"`
+	Message    string                      `json:"message"`
+}
+
 // Deck represents a user's card deck
 type Deck struct {
 	ID     int    `json:"id" db:"id"`
 	UserID int    `json:"user_id" db:"user_id"`
 	Name   string `json:"name" db:"name"`
+	Format string `json:"format" db:"format"`
 	Valid  bool   `json:"valid" db:"valid"`
 }
 
 // CreateDeckRequest represents the data needed to create a deck
 type CreateDeckRequest struct {
 	Name      string `json:"name" validate:"required,min=1,max=100"`
+	Format    string `json:"format,omitempty" validate:"omitempty,max=20"` // Defaults to DefaultFormat
 	CardIDs   []int  `json:"card_ids" validate:"required,min=1"`
 	CardCount []int  `json:"card_count" validate:"required,min=1"`
 }
@@ -77,10 +115,43 @@ type CreateDeckRequest struct {
 // UpdateDeckRequest represents the data needed to update a deck
 type UpdateDeckRequest struct {
 	Name      string `json:"name" validate:"required,min=1,max=100"`
+	Format    string `json:"format,omitempty" validate:"omitempty,max=20"` // Keeps the current format if empty
 	CardIDs   []int  `json:"card_ids" validate:"required,min=1"`
 	CardCount []int  `json:"card_count" validate:"required,min=1"`
 }
 
+// ImportDeckRequest represents a deck shared by another player, as a deck code or as a
+// plain-text card list. Exactly one of them must be given.
+type ImportDeckRequest struct {
+	Name   string `json:"name" validate:"required,min=1,max=100"`
+	Format string `json:"format,omitempty" validate:"omitempty,max=20"` // Defaults to the format of the code
+	Code   string `json:"code,omitempty" validate:"omitempty,max=2048"`
+	List   string `json:"list,omitempty" validate:"omitempty,max=20000"`
+}
+
+// DeckExport represents a deck in the formats players share decks in
+type DeckExport struct {
+	DeckID int    `json:"deck_id"`
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Code   string `json:"code"`
+	List   string `json:"list"`
+}
+
+// DeckExportResponse represents the response for a deck export
+type DeckExportResponse struct {
+	Export  *DeckExport `json:"export"`
+	Message string      `json:"message"`
+}
+
+// MissingCard is a card of an imported deck the user does not have enough copies of
+type MissingCard struct {
+	CardID int    `json:"card_id"`
+	Name   string `json:"name"`
+	Needed int    `json:"needed"`
+	Owned  int    `json:"owned"`
+}
+
 // DeckResponse represents the response for deck operations
 type DeckResponse struct {
 	Deck    *Deck  `json:"deck"`
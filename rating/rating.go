@@ -0,0 +1,158 @@
+// Package rating implements the Glicko-2 rating system used for the ranked ladder, and the
+// rating bands that decide which table categories a player may play.
+package rating
+
+import "math"
+
+// Starting values of a player that has not played a ranked match yet
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+)
+
+const (
+	// tau constrains how much the volatility can change after a match
+	tau = 0.5
+	// scale converts between the Glicko and Glicko-2 scales
+	scale = 173.7178
+	// epsilon is the convergence tolerance of the volatility iteration
+	epsilon = 0.000001
+)
+
+// Rating is the skill estimate of a player
+type Rating struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+// Default returns the rating of a new player
+func Default() Rating {
+	return Rating{
+		Rating:     DefaultRating,
+		Deviation:  DefaultDeviation,
+		Volatility: DefaultVolatility,
+	}
+}
+
+// Update returns the new rating of a player after a match against an opponent, treating
+// the match as a rating period of its own. score is 1 for a win and 0 for a loss.
+func Update(player, opponent Rating, score float64) Rating {
+	return period(player, []outcome{{opponent: opponent, score: score}})
+}
+
+// outcome is the result of one match of a rating period
+type outcome struct {
+	opponent Rating
+	score    float64
+}
+
+// period returns the new rating of a player after the matches of a rating period, following
+// the steps of the Glicko-2 paper
+func period(player Rating, outcomes []outcome) Rating {
+	mu := (player.Rating - DefaultRating) / scale
+	phi := player.Deviation / scale
+
+	var vInverse, improvement float64
+	for _, o := range outcomes {
+		muJ := (o.opponent.Rating - DefaultRating) / scale
+		phiJ := o.opponent.Deviation / scale
+
+		g := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+		expected := 1 / (1 + math.Exp(-g*(mu-muJ)))
+		vInverse += g * g * expected * (1 - expected)
+		improvement += g * (o.score - expected)
+	}
+	v := 1 / vInverse
+	delta := v * improvement
+
+	sigma := volatility(phi, player.Volatility, v, delta)
+
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*improvement
+
+	return Rating{
+		Rating:     scale*newMu + DefaultRating,
+		Deviation:  math.Min(scale*newPhi, DefaultDeviation),
+		Volatility: sigma,
+	}
+}
+
+// volatility finds the new volatility with the Illinois algorithm of the Glicko-2 paper
+func volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
+
+// Categories lists the table categories from the lowest to the highest
+var Categories = []string{"D", "C", "B", "A", "S"}
+
+// bands holds the conservative rating needed for each category above D
+var bands = map[string]float64{
+	"C": 1300,
+	"B": 1500,
+	"A": 1700,
+	"S": 1900,
+}
+
+// Category returns the band of a rating: the lowest table category the player may play.
+// It uses the conservative rating (two deviations below the rating), so new players start
+// in D and only move up once the ladder is confident about their skill.
+func Category(r Rating) string {
+	conservative := r.Rating - 2*r.Deviation
+
+	category := Categories[0]
+	for _, candidate := range Categories[1:] {
+		if conservative >= bands[candidate] {
+			category = candidate
+		}
+	}
+	return category
+}
+
+// CanPlay reports whether a player with the given rating may play at a table of a category.
+// Players may always play up, but not below their band.
+func CanPlay(r Rating, category string) bool {
+	return rank(category) >= rank(Category(r))
+}
+
+func rank(category string) int {
+	for i, candidate := range Categories {
+		if candidate == category {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,151 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+// glickman is the player of the worked example of Glickman's Glicko-2 paper
+var glickman = Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+
+func TestPeriod(t *testing.T) {
+	tests := []struct {
+		name     string
+		player   Rating
+		outcomes []outcome
+		want     Rating
+	}{
+		{
+			name:   "example of the Glicko-2 paper",
+			player: glickman,
+			outcomes: []outcome{
+				{opponent: Rating{Rating: 1400, Deviation: 30, Volatility: 0.06}, score: 1},
+				{opponent: Rating{Rating: 1550, Deviation: 100, Volatility: 0.06}, score: 0},
+				{opponent: Rating{Rating: 1700, Deviation: 300, Volatility: 0.06}, score: 0},
+			},
+			want: Rating{Rating: 1464.06, Deviation: 151.52, Volatility: 0.05999},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := period(tt.player, tt.outcomes)
+			if math.Abs(got.Rating-tt.want.Rating) > 0.01 ||
+				math.Abs(got.Deviation-tt.want.Deviation) > 0.01 ||
+				math.Abs(got.Volatility-tt.want.Volatility) > 0.00001 {
+				t.Errorf("period = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	strong := Rating{Rating: 2200, Deviation: 50, Volatility: 0.06}
+	settled := Rating{Rating: 1500, Deviation: 50, Volatility: 0.06}
+
+	tests := []struct {
+		name     string
+		player   Rating
+		opponent Rating
+		score    float64
+		up       bool // Whether the rating goes up
+		volatile bool // Whether the volatility goes up
+	}{
+		{name: "new player wins", player: Default(), opponent: Default(), score: 1, up: true},
+		{name: "new player loses", player: Default(), opponent: Default(), score: 0},
+		{name: "expected win", player: strong, opponent: settled, score: 1, up: true},
+		{name: "upset win", player: settled, opponent: strong, score: 1, up: true, volatile: true},
+		{name: "upset loss", player: strong, opponent: settled, score: 0, volatile: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Update(tt.player, tt.opponent, tt.score)
+			if up := got.Rating > tt.player.Rating; up != tt.up {
+				t.Errorf("rating %.2f -> %.2f, want up = %v", tt.player.Rating, got.Rating, tt.up)
+			}
+			if got.Deviation > DefaultDeviation {
+				t.Errorf("deviation = %.2f, above the deviation of a new player", got.Deviation)
+			}
+			if volatile := got.Volatility > tt.player.Volatility; volatile != tt.volatile {
+				t.Errorf("volatility %.5f -> %.5f, want up = %v", tt.player.Volatility, got.Volatility, tt.volatile)
+			}
+
+			// A single match is a rating period of its own
+			if period := period(tt.player, []outcome{{opponent: tt.opponent, score: tt.score}}); period != got {
+				t.Errorf("Update = %+v, period = %+v", got, period)
+			}
+		})
+	}
+}
+
+func TestVolatility(t *testing.T) {
+	tests := []struct {
+		name                 string
+		phi, sigma, v, delta float64
+		want                 float64
+	}{
+		// Steps 3 and 4 of the example of the Glicko-2 paper
+		{name: "example of the Glicko-2 paper", phi: 1.1513, sigma: 0.06, v: 1.7785, delta: -0.4834, want: 0.05999},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := volatility(tt.phi, tt.sigma, tt.v, tt.delta); math.Abs(got-tt.want) > 0.00001 {
+				t.Errorf("volatility = %.6f, want %.5f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategory(t *testing.T) {
+	tests := []struct {
+		rating    float64
+		deviation float64
+		want      string
+	}{
+		{rating: DefaultRating, deviation: DefaultDeviation, want: "D"},
+		{rating: 1299.99, want: "D"},
+		{rating: 1300, want: "C"},
+		{rating: 1499.99, want: "C"},
+		{rating: 1500, want: "B"},
+		{rating: 1699.99, want: "B"},
+		{rating: 1700, want: "A"},
+		{rating: 1899.99, want: "A"},
+		{rating: 1900, want: "S"},
+		{rating: 2000, deviation: 50, want: "S"},
+		{rating: 2000, deviation: 50.01, want: "A"},
+	}
+
+	for _, tt := range tests {
+		r := Rating{Rating: tt.rating, Deviation: tt.deviation, Volatility: DefaultVolatility}
+		if got := Category(r); got != tt.want {
+			t.Errorf("Category(%.2f, deviation %.2f) = %q, want %q", tt.rating, tt.deviation, got, tt.want)
+		}
+	}
+}
+
+func TestCanPlay(t *testing.T) {
+	tests := []struct {
+		rating   float64
+		category string
+		want     bool
+	}{
+		{rating: 1299.99, category: "D", want: true},
+		{rating: 1299.99, category: "S", want: true},
+		{rating: 1300, category: "D", want: false},
+		{rating: 1300, category: "C", want: true},
+		{rating: 1700, category: "B", want: false},
+		{rating: 1700, category: "A", want: true},
+		{rating: 1900, category: "A", want: false},
+		{rating: 1900, category: "S", want: true},
+		{rating: 1900, category: "X", want: false},
+	}
+
+	for _, tt := range tests {
+		r := Rating{Rating: tt.rating, Volatility: DefaultVolatility}
+		if got := CanPlay(r, tt.category); got != tt.want {
+			t.Errorf("CanPlay(%.2f, %q) = %v, want %v", tt.rating, tt.category, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong message from the peer
+	pongWait = 60 * time.Second
+	// Send pings to peer with this period, must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+	// Maximum message size allowed from peer
+	maxMessageSize = 4096
+	// Maximum length of a chat message
+	maxChatLength = 500
+	// Number of outgoing messages buffered per client
+	sendBufferSize = 32
+)
+
+// Client is a WebSocket connection of a player seated at a table
+type Client struct {
+	hub     *Hub
+	conn    *websocket.Conn
+	send    chan []byte
+	tableID uint
+	userID  uint
+	seat    string
+
+	mu        sync.Mutex                 // Guards state
+	state     map[string]json.RawMessage // Last view sent to the client
+	closeOnce sync.Once
+}
+
+// incomingMessage is a message sent by a client
+type incomingMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// Serve registers a connection for a seat at a table and pumps messages until the
+// connection is closed. The initial view, if any, is sent as a full state event.
+func (h *Hub) Serve(conn *websocket.Conn, tableID, userID uint, seat string, initial interface{}) {
+	client := &Client{
+		hub:     h,
+		conn:    conn,
+		send:    make(chan []byte, sendBufferSize),
+		tableID: tableID,
+		userID:  userID,
+		seat:    seat,
+	}
+
+	h.register(client)
+	h.Broadcast(tableID, Event{Type: EventJoin, Seat: seat})
+
+	if initial != nil {
+		if fields, err := encodeView(initial); err == nil {
+			h.sendState(client, fields)
+		}
+	}
+
+	go client.writePump()
+	client.readPump()
+
+	if h.unregister(client) {
+		h.Broadcast(tableID, Event{Type: EventLeave, Seat: seat})
+	}
+}
+
+// readPump reads chat messages from the connection until it fails or is closed
+func (c *Client) readPump() {
+	defer c.close()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var message incomingMessage
+		if err := c.conn.ReadJSON(&message); err != nil {
+			switch err.(type) {
+			case *json.SyntaxError, *json.UnmarshalTypeError:
+				c.sendError("invalid message")
+				continue
+			}
+			return
+		}
+
+		switch message.Type {
+		case EventChat:
+			text := strings.TrimSpace(message.Message)
+			if text == "" || len(text) > maxChatLength {
+				c.sendError("chat messages must be between 1 and 500 characters")
+				continue
+			}
+			c.hub.Broadcast(c.tableID, Event{
+				Type: EventChat,
+				Seat: c.seat,
+				Data: map[string]interface{}{"user_id": c.userID, "message": text},
+			})
+		default:
+			c.sendError("unknown message type")
+		}
+	}
+}
+
+// writePump writes queued messages and pings to the connection
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the channel
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendError queues an error event for this client only
+func (c *Client) sendError(reason string) {
+	message, err := json.Marshal(Event{
+		Type:    EventError,
+		TableID: c.tableID,
+		Seat:    c.seat,
+		Data:    map[string]string{"error": reason},
+		SentAt:  time.Now(),
+	})
+	if err == nil {
+		c.hub.deliver(c, message)
+	}
+}
+
+// close closes the underlying connection, which ends both pumps
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		c.conn.Close()
+	})
+}
@@ -0,0 +1,244 @@
+// Package realtime pushes live table events to the players seated at a table
+// over WebSocket connections.
+package realtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Event types sent to clients
+const (
+	EventJoin      = "join"
+	EventLeave     = "leave"
+	EventState     = "state"
+	EventStateDiff = "state_diff"
+	EventChat      = "chat"
+	EventFinish    = "finish"
+	EventMatched   = "matched"
+	EventDropped   = "dropped"
+	EventError     = "error"
+)
+
+// Event is a message pushed to the clients of a table
+type Event struct {
+	Type    string      `json:"type"`
+	TableID uint        `json:"table_id"`
+	Seat    string      `json:"seat,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	SentAt  time.Time   `json:"sent_at"`
+}
+
+// ViewFunc builds the state view of a table for a seat
+type ViewFunc func(seat string) interface{}
+
+// Hub keeps track of the connected clients of every table and fans out events to them
+type Hub struct {
+	mu    sync.RWMutex
+	rooms map[uint]map[*Client]bool
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{
+		rooms: make(map[uint]map[*Client]bool),
+	}
+}
+
+// register adds a client to the room of its table
+func (h *Hub) register(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[client.tableID]
+	if !ok {
+		room = make(map[*Client]bool)
+		h.rooms[client.tableID] = room
+	}
+	room[client] = true
+}
+
+// unregister removes a client from its room and closes its send channel.
+// It returns false if the client was already removed.
+func (h *Hub) unregister(client *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[client.tableID]
+	if !ok || !room[client] {
+		return false
+	}
+
+	delete(room, client)
+	close(client.send)
+	if len(room) == 0 {
+		delete(h.rooms, client.tableID)
+	}
+	return true
+}
+
+// clients returns a snapshot of the clients connected to a table
+func (h *Hub) clients(tableID uint) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	room := h.rooms[tableID]
+	clients := make([]*Client, 0, len(room))
+	for client := range room {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// ConnectedSeats returns the seats that currently have at least one open connection to a table
+func (h *Hub) ConnectedSeats(tableID uint) []string {
+	seen := make(map[string]bool)
+	seats := []string{}
+	for _, client := range h.clients(tableID) {
+		if !seen[client.seat] {
+			seen[client.seat] = true
+			seats = append(seats, client.seat)
+		}
+	}
+	return seats
+}
+
+// Broadcast sends an event to every client connected to a table
+func (h *Hub) Broadcast(tableID uint, event Event) {
+	event.TableID = tableID
+	event.SentAt = time.Now()
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event for table %d: %v", event.Type, tableID, err)
+		return
+	}
+
+	for _, client := range h.clients(tableID) {
+		h.deliver(client, message)
+	}
+}
+
+// Notify sends an event to every connection of a user, whatever table it is open on
+func (h *Hub) Notify(userID uint, event Event) {
+	event.SentAt = time.Now()
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event for user %d: %v", event.Type, userID, err)
+		return
+	}
+
+	h.mu.RLock()
+	clients := []*Client{}
+	for _, room := range h.rooms {
+		for client := range room {
+			if client.userID == userID {
+				clients = append(clients, client)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		h.deliver(client, message)
+	}
+}
+
+// PublishState sends each client of a table the fields of its view that changed since the
+// last state it received. Clients that never received a state get the full view.
+func (h *Hub) PublishState(tableID uint, view ViewFunc) {
+	views := make(map[string]map[string]json.RawMessage)
+
+	for _, client := range h.clients(tableID) {
+		current, ok := views[client.seat]
+		if !ok {
+			var err error
+			current, err = encodeView(view(client.seat))
+			if err != nil {
+				log.Printf("Error encoding state of table %d: %v", tableID, err)
+				return
+			}
+			views[client.seat] = current
+		}
+
+		h.sendState(client, current)
+	}
+}
+
+// sendState sends a client either its full view or the fields that changed since its last one.
+// The client's last state is locked for the whole exchange so diffs always apply to what it received.
+func (h *Hub) sendState(client *Client, current map[string]json.RawMessage) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	event := Event{Type: EventState, TableID: client.tableID, Seat: client.seat, SentAt: time.Now()}
+	if client.state != nil {
+		event.Type = EventStateDiff
+		event.Data = diffFields(client.state, current)
+	} else {
+		event.Data = current
+	}
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding state event for table %d: %v", client.tableID, err)
+		return
+	}
+
+	if h.deliver(client, message) {
+		client.state = current
+	}
+}
+
+// encodeView converts a view into its top level JSON fields
+func encodeView(view interface{}) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(view)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// deliver queues a message for a client without blocking. Clients that cannot keep up
+// are disconnected so a slow reader never stalls the rest of the table.
+func (h *Hub) deliver(client *Client, message []byte) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if !h.rooms[client.tableID][client] {
+		return false
+	}
+
+	select {
+	case client.send <- message:
+		return true
+	default:
+		go client.close()
+		return false
+	}
+}
+
+// diffFields returns the top level fields of current whose value differs from previous
+func diffFields(previous, current map[string]json.RawMessage) map[string]json.RawMessage {
+	diff := make(map[string]json.RawMessage)
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || !bytes.Equal(old, value) {
+			diff[key] = value
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			diff[key] = json.RawMessage("null")
+		}
+	}
+	return diff
+}
@@ -0,0 +1,2894 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tcg-server-go/legality"
+	"tcg-server-go/market"
+	"tcg-server-go/models"
+	"tcg-server-go/rating"
+)
+
+// Memory implements every repository in memory. It mirrors the behavior of the MariaDB
+// queries, including their error messages, so handlers can be exercised without a database.
+type Memory struct {
+	mu sync.Mutex
+
+	users          map[int]*models.User
+	passwordResets []passwordReset
+	refreshTokens  map[int]*models.RefreshToken
+	revokedTokens  map[string]time.Time     // Expiry by jti
+	userInfo       map[int]*models.UserInfo // By user ID
+	userCards      map[int]*models.UserCard
+	cards          map[int]*models.Card
+	decks          map[int]*models.Deck
+	deckCards      map[int][]models.DeckCard // By deck ID
+	tables         map[uint]*models.Table
+	userTables     map[uint]*models.UserTable
+	tableStates    map[uint]*models.TableState  // By table ID
+	tableStakes    map[uint][]models.TableStake // Stakes in escrow by table ID
+	tableClocks    map[uint]models.TableClock   // By table ID
+	effects        map[int]*models.Effect
+	cardEffects    []models.CardEffect
+	auditLog       []models.AuditEntry
+	packs          map[int]*models.Pack
+	packOpenings   []models.PackOpening
+	trades         map[int]*models.Trade
+	listings       map[int]*models.Listing
+	ratings        map[int]*models.Rating // By user ID
+	ratingHistory  []models.RatingChange
+	formats        map[string]*models.DeckFormat // By code
+
+	sequences map[string]int // Last ID used by each table
+}
+
+// passwordReset is a row of the password_resets table
+type passwordReset struct {
+	userID    int
+	tokenHash string
+	expiresAt time.Time
+	used      bool
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	m := &Memory{
+		users:         make(map[int]*models.User),
+		refreshTokens: make(map[int]*models.RefreshToken),
+		revokedTokens: make(map[string]time.Time),
+		userInfo:      make(map[int]*models.UserInfo),
+		userCards:     make(map[int]*models.UserCard),
+		cards:         make(map[int]*models.Card),
+		decks:         make(map[int]*models.Deck),
+		deckCards:     make(map[int][]models.DeckCard),
+		tables:        make(map[uint]*models.Table),
+		userTables:    make(map[uint]*models.UserTable),
+		tableStates:   make(map[uint]*models.TableState),
+		tableStakes:   make(map[uint][]models.TableStake),
+		tableClocks:   make(map[uint]models.TableClock),
+		effects:       make(map[int]*models.Effect),
+		packs:         make(map[int]*models.Pack),
+		trades:        make(map[int]*models.Trade),
+		listings:      make(map[int]*models.Listing),
+		ratings:       make(map[int]*models.Rating),
+		formats:       make(map[string]*models.DeckFormat),
+		sequences:     make(map[string]int),
+	}
+	m.seedFormats()
+	return m
+}
+
+// seedFormats adds the formats the deck_formats migration creates
+func (m *Memory) seedFormats() {
+	maxCards, maxCopies := 60, 4
+	now := time.Now()
+	for _, format := range []models.DeckFormat{
+		{Code: models.DefaultFormat, Name: "Unlimited", MinCards: 40, MaxEnergyPercent: 100},
+		{Code: "standard", Name: "Standard", MinCards: 40, MaxCards: &maxCards, MaxCopies: &maxCopies,
+			MinEnergyPercent: 10, MaxEnergyPercent: 50},
+	} {
+		format.ID = m.nextID("deck_formats")
+		format.Sets, format.CardLimits = []string{}, []models.FormatCardLimit{}
+		format.CreatedAt, format.UpdatedAt = now, now
+		m.formats[format.Code] = copyFormat(&format)
+	}
+}
+
+// Repositories returns the store as the repositories used by the server
+func (m *Memory) Repositories() *Repositories {
+	return &Repositories{
+		Users:          m,
+		PasswordResets: m,
+		Tokens:         m,
+		UserInfo:       m,
+		Cards:          m,
+		Decks:          m,
+		Tables:         m,
+		TableStates:    m,
+		Effects:        m,
+		Audit:          m,
+		Packs:          m,
+		Trades:         m,
+		Market:         m,
+		Ratings:        m,
+		Formats:        m,
+	}
+}
+
+// nextID returns the next auto increment ID of a table
+func (m *Memory) nextID(table string) int {
+	m.sequences[table]++
+	return m.sequences[table]
+}
+
+// UserRepository
+
+func (m *Memory) CreateUser(user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findUserByEmail(user.Email) != nil {
+		return fmt.Errorf("duplicate email: %s", user.Email)
+	}
+
+	validationCode := generateValidationCode()
+	expiresAt := time.Now().Add(24 * time.Hour)
+	user.ValidationCode = &validationCode
+	user.ValidationCodeExpiresAt = &expiresAt
+
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.Role = models.RoleUser
+	user.ID = m.nextID("users")
+
+	stored := *user
+	m.users[user.ID] = &stored
+	return nil
+}
+
+func (m *Memory) GetUserByEmail(email string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user := m.findUserByEmail(email); user != nil {
+		found := *user
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetUserByID(id int) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, nil
+	}
+	found := *user
+	return &found, nil
+}
+
+func (m *Memory) EmailExists(email string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) VerifyEmail(email, validationCode string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.findUserByEmail(email)
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if user.ValidatedAt != nil {
+		return nil, fmt.Errorf("email already verified")
+	}
+	if user.ValidationCode == nil || *user.ValidationCode != validationCode {
+		return nil, fmt.Errorf("invalid validation code")
+	}
+	if user.ValidationCodeExpiresAt != nil && time.Now().After(*user.ValidationCodeExpiresAt) {
+		return nil, fmt.Errorf("validation code has expired")
+	}
+
+	now := time.Now()
+	user.ValidatedAt = &now
+	user.UpdatedAt = now
+	user.ValidationCode = nil
+	user.ValidationCodeExpiresAt = nil
+
+	verified := *user
+	return &verified, nil
+}
+
+func (m *Memory) ResendValidationCode(email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := m.findUserByEmail(email)
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+	if user.ValidatedAt != nil {
+		return fmt.Errorf("email already verified")
+	}
+
+	validationCode := generateValidationCode()
+	expiresAt := time.Now().Add(24 * time.Hour)
+	user.ValidationCode = &validationCode
+	user.ValidationCodeExpiresAt = &expiresAt
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *Memory) UpdatePassword(userID int, hashedPassword string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	user.Password = hashedPassword
+	user.TokenVersion++
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *Memory) SetUserRole(userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	return nil
+}
+
+// findUserByEmail returns the stored user that is not deleted; the email column is case insensitive
+func (m *Memory) findUserByEmail(email string) *models.User {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) && user.DeletedAt == nil {
+			return user
+		}
+	}
+	return nil
+}
+
+// generateValidationCode generates a random 6-character validation code
+func generateValidationCode() string {
+	bytes := make([]byte, 3)
+	rand.Read(bytes)
+	return strings.ToUpper(hex.EncodeToString(bytes))
+}
+
+// PasswordResetRepository
+
+func (m *Memory) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return fmt.Errorf("error creating password reset: user %d does not exist", userID)
+	}
+	for _, reset := range m.passwordResets {
+		if reset.tokenHash == tokenHash {
+			return fmt.Errorf("error creating password reset: duplicate token")
+		}
+	}
+
+	m.passwordResets = append(m.passwordResets, passwordReset{userID: userID, tokenHash: tokenHash, expiresAt: expiresAt})
+	return nil
+}
+
+func (m *Memory) ConsumePasswordReset(tokenHash string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userID := 0
+	for _, reset := range m.passwordResets {
+		if reset.tokenHash == tokenHash && !reset.used && reset.expiresAt.After(time.Now()) {
+			userID = reset.userID
+		}
+	}
+	if userID == 0 {
+		return 0, nil
+	}
+
+	// Use up every outstanding token of the user
+	for i := range m.passwordResets {
+		if m.passwordResets[i].userID == userID {
+			m.passwordResets[i].used = true
+		}
+	}
+	return userID, nil
+}
+
+// TokenRepository
+
+func (m *Memory) CreateRefreshToken(token *models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertRefreshToken(token)
+}
+
+func (m *Memory) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, token := range m.refreshTokens {
+		if token.TokenHash == tokenHash {
+			result := *token
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) RotateRefreshToken(id int, next *models.RefreshToken) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refreshTokens[id]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+
+	if err := m.insertRefreshToken(next); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	token.UsedAt = &now
+	return true, nil
+}
+
+func (m *Memory) RevokeRefreshTokenFamily(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range m.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RevokeUserRefreshTokens(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range m.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for revoked, revokedUntil := range m.revokedTokens {
+		if !revokedUntil.After(now) {
+			delete(m.revokedTokens, revoked)
+		}
+	}
+
+	if _, ok := m.revokedTokens[jti]; !ok {
+		m.revokedTokens[jti] = expiresAt
+	}
+	return nil
+}
+
+func (m *Memory) IsAccessTokenRevoked(jti string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.revokedTokens[jti]
+	return ok, nil
+}
+
+// insertRefreshToken stores a refresh token, enforcing the foreign key and the unique hash
+func (m *Memory) insertRefreshToken(token *models.RefreshToken) error {
+	if _, ok := m.users[token.UserID]; !ok {
+		return fmt.Errorf("error creating refresh token: user %d does not exist", token.UserID)
+	}
+	for _, existing := range m.refreshTokens {
+		if existing.TokenHash == token.TokenHash {
+			return fmt.Errorf("error creating refresh token: duplicate token")
+		}
+	}
+
+	token.ID = m.nextID("refresh_tokens")
+	token.CreatedAt = time.Now()
+
+	stored := *token
+	m.refreshTokens[token.ID] = &stored
+	return nil
+}
+
+// UserInfoRepository
+
+func (m *Memory) GetUserInfoByUserID(userID int) (*models.UserInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if info, ok := m.userInfo[userID]; ok {
+		found := *info
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) CreateDefaultUserInfo(userID int) (*models.UserInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.userInfo[userID]; ok {
+		return nil, fmt.Errorf("duplicate user info for user %d", userID)
+	}
+
+	now := time.Now()
+	info := &models.UserInfo{
+		ID:         m.nextID("user_info"),
+		UserID:     userID,
+		Level:      1,
+		Experience: 0,
+		Money:      100, // Starting money
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	m.userInfo[userID] = info
+
+	created := *info
+	return &created, nil
+}
+
+func (m *Memory) AddExperience(userID int, experienceToAdd int) (*models.UserInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.addExperience(userID, experienceToAdd)
+}
+
+func (m *Memory) addExperience(userID int, experienceToAdd int) (*models.UserInfo, error) {
+	info, ok := m.userInfo[userID]
+	if !ok {
+		return nil, fmt.Errorf("user info not found")
+	}
+
+	info.Experience += experienceToAdd
+	info.UpdatedAt = time.Now()
+
+	// Check for level up (simple formula: 1000 exp per level)
+	if info.Experience >= info.Level*1000 {
+		info.Level++
+		info.Money += info.Level * 100
+	}
+
+	updated := *info
+	return &updated, nil
+}
+
+func (m *Memory) AddMoney(userID int, amount int) (*models.UserInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, ok := m.userInfo[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	info.Money += amount
+	info.UpdatedAt = time.Now()
+
+	updated := *info
+	return &updated, nil
+}
+
+func (m *Memory) SpendMoney(userID int, amount int) (*models.UserInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, ok := m.userInfo[userID]
+	if !ok {
+		return nil, fmt.Errorf("user info not found")
+	}
+	if info.Money < amount {
+		return nil, fmt.Errorf("%w: required %d, available %d", models.ErrInsufficientFunds, amount, info.Money)
+	}
+
+	info.Money -= amount
+	info.UpdatedAt = time.Now()
+
+	updated := *info
+	return &updated, nil
+}
+
+func (m *Memory) GetUserCardByUserAndCard(userID, cardID int) (*models.UserCard, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if userCard := m.findUserCard(userID, cardID); userCard != nil {
+		return m.withCard(*userCard), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetUserCardsByCardIDs(userID int, cardIDs []int) (map[int]*models.UserCard, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userCards := make(map[int]*models.UserCard)
+	for _, cardID := range cardIDs {
+		if userCard := m.findUserCard(userID, cardID); userCard != nil {
+			userCards[cardID] = m.withCard(*userCard)
+		}
+	}
+	return userCards, nil
+}
+
+func (m *Memory) GetUserCardsByUserID(userID int) ([]models.UserCard, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var userCards []models.UserCard
+	for _, userCard := range m.userCards {
+		if userCard.UserID == userID {
+			userCards = append(userCards, *m.withCard(*userCard))
+		}
+	}
+
+	sort.Slice(userCards, func(i, j int) bool {
+		return userCards[i].Card.Name < userCards[j].Card.Name
+	})
+	return userCards, nil
+}
+
+func (m *Memory) GetCollection(userID int) ([]models.CollectionCard, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	needed := make(map[int]int)
+	for deckID, deck := range m.decks {
+		if deck.UserID != userID {
+			continue
+		}
+		for _, deckCard := range m.deckCards[deckID] {
+			if deckCard.Number > needed[deckCard.CardID] {
+				needed[deckCard.CardID] = deckCard.Number
+			}
+		}
+	}
+
+	collection := []models.CollectionCard{}
+	for _, card := range m.sortedCards() {
+		collectionCard := models.CollectionCard{Card: cloneCard(card), InDecks: needed[card.ID]}
+		if userCard := m.findUserCard(userID, card.ID); userCard != nil {
+			collectionCard.Owned = userCard.Amount
+		}
+		if collectionCard.Owned > collectionCard.InDecks {
+			collectionCard.Tradable = collectionCard.Owned - collectionCard.InDecks
+		}
+		collection = append(collection, collectionCard)
+	}
+	return collection, nil
+}
+
+func (m *Memory) AddOrUpdateUserCard(userID, cardID, amount int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cards[cardID]; !ok {
+		return fmt.Errorf("card %d does not exist", cardID)
+	}
+
+	m.addUserCard(userID, cardID, amount, time.Now())
+	return nil
+}
+
+// addUserCard adds copies of a card to the collection of a user
+func (m *Memory) addUserCard(userID, cardID, amount int, now time.Time) {
+	if userCard := m.findUserCard(userID, cardID); userCard != nil {
+		userCard.Amount += amount
+		userCard.UpdatedAt = now
+		return
+	}
+
+	id := m.nextID("user_cards")
+	m.userCards[id] = &models.UserCard{
+		ID:        id,
+		UserID:    userID,
+		CardID:    cardID,
+		Amount:    amount,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// checkTakeUserCards checks a user can give copies of a card away: they own them and keep
+// enough copies for their saved decks
+func (m *Memory) checkTakeUserCards(userID, cardID, amount int) error {
+	owned := 0
+	if userCard := m.findUserCard(userID, cardID); userCard != nil {
+		owned = userCard.Amount
+	}
+	if owned < amount {
+		return fmt.Errorf("%w: card %d", models.ErrNotEnoughCards, cardID)
+	}
+
+	remaining := owned - amount
+	deckIDs := make([]int, 0, len(m.decks))
+	for deckID, deck := range m.decks {
+		if deck.UserID == userID {
+			deckIDs = append(deckIDs, deckID)
+		}
+	}
+	sort.Ints(deckIDs)
+	for _, deckID := range deckIDs {
+		for _, deckCard := range m.deckCards[deckID] {
+			if deckCard.CardID == cardID && deckCard.Number > remaining {
+				return fmt.Errorf("%w: deck %q needs %d copies of card %d",
+					models.ErrBreaksDeck, m.decks[deckID].Name, deckCard.Number, cardID)
+			}
+		}
+	}
+	return nil
+}
+
+// takeUserCards removes copies of a card checked with checkTakeUserCards
+func (m *Memory) takeUserCards(userID, cardID, amount int, now time.Time) {
+	userCard := m.findUserCard(userID, cardID)
+	userCard.Amount -= amount
+	userCard.UpdatedAt = now
+	if userCard.Amount == 0 {
+		delete(m.userCards, userCard.ID)
+	}
+}
+
+func (m *Memory) findUserCard(userID, cardID int) *models.UserCard {
+	for _, userCard := range m.userCards {
+		if userCard.UserID == userID && userCard.CardID == cardID {
+			return userCard
+		}
+	}
+	return nil
+}
+
+// withCard returns a copy of a user card joined with its card, as the SQL queries do
+func (m *Memory) withCard(userCard models.UserCard) *models.UserCard {
+	if card, ok := m.cards[userCard.CardID]; ok {
+		userCard.Card = cloneCard(card)
+	}
+	return &userCard
+}
+
+// CardRepository
+
+func (m *Memory) CreateCard(card *models.Card, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	card.CreatedAt = now
+	card.UpdatedAt = now
+	if card.Rarity == "" {
+		card.Rarity = models.CardRarityCommon
+	}
+	if card.SetCode == "" {
+		card.SetCode = models.DefaultSetCode
+	}
+	card.ID = m.nextID("cards")
+
+	audit.EntityID = card.ID
+	if err := m.writeAudit(audit, card); err != nil {
+		return err
+	}
+	m.cards[card.ID] = cloneCard(card)
+	return nil
+}
+
+func (m *Memory) GetCardByID(id int) (*models.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if card, ok := m.cards[id]; ok {
+		return cloneCard(card), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetCardsByIDs(ids []int) (map[int]*models.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cards := make(map[int]*models.Card)
+	for _, id := range ids {
+		if card, ok := m.cards[id]; ok {
+			cards[id] = cloneCard(card)
+		}
+	}
+	return cards, nil
+}
+
+func (m *Memory) GetCardByName(name string) (*models.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, card := range m.sortedCards() {
+		if strings.EqualFold(card.Name, name) {
+			return cloneCard(card), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetAllCards() ([]*models.Card, error) {
+	return m.filterCards(func(*models.Card) bool { return true }), nil
+}
+
+func (m *Memory) GetCardsByType(cardType models.CardType) ([]*models.Card, error) {
+	return m.filterCards(func(card *models.Card) bool { return card.Type == cardType }), nil
+}
+
+func (m *Memory) GetCardsByElement(element models.CardElement) ([]*models.Card, error) {
+	return m.filterCards(func(card *models.Card) bool { return card.Element == element }), nil
+}
+
+func (m *Memory) GetCardsBySet(setCode string) ([]*models.Card, error) {
+	return m.filterCards(func(card *models.Card) bool { return card.SetCode == setCode }), nil
+}
+
+func (m *Memory) SearchCards(searchTerm string) ([]*models.Card, error) {
+	words := models.SearchWords(searchTerm)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	cards := m.filterCards(func(card *models.Card) bool {
+		return matchesSearch(card, words)
+	})
+
+	sort.SliceStable(cards, func(i, j int) bool {
+		return cards[i].Name < cards[j].Name
+	})
+	return cards, nil
+}
+
+func (m *Memory) QueryCards(filter models.CardFilter) ([]*models.Card, bool, error) {
+	var words []string
+	if filter.Search != "" {
+		if words = models.SearchWords(filter.Search); len(words) == 0 {
+			return []*models.Card{}, false, nil
+		}
+	}
+	sortKey := filter.Sort
+	if _, _, ok := models.ParseCardSort(sortKey); !ok {
+		sortKey = models.CardSortID
+	}
+
+	types, elements, rarities, sets := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, cardType := range filter.Types {
+		types[string(cardType)] = true
+	}
+	for _, element := range filter.Elements {
+		elements[string(element)] = true
+	}
+	for _, rarity := range filter.Rarities {
+		rarities[string(rarity)] = true
+	}
+	for _, set := range filter.Sets {
+		sets[set] = true
+	}
+
+	cards := m.filterCards(func(card *models.Card) bool {
+		switch {
+		case len(types) > 0 && !types[string(card.Type)],
+			len(elements) > 0 && !elements[string(card.Element)],
+			len(rarities) > 0 && !rarities[string(card.Rarity)],
+			len(sets) > 0 && !sets[card.SetCode]:
+			return false
+		case filter.MinHP != nil && (card.HP == nil || *card.HP < *filter.MinHP),
+			filter.MaxHP != nil && (card.HP == nil || *card.HP > *filter.MaxHP),
+			filter.MinCost != nil && card.AttackCost.Total() < *filter.MinCost,
+			filter.MaxCost != nil && card.AttackCost.Total() > *filter.MaxCost:
+			return false
+		case filter.EffectID != 0 && !m.hasEffect(card.ID, filter.EffectID):
+			return false
+		case words != nil && !matchesSearch(card, words):
+			return false
+		case filter.After != nil && !models.CardCursorFor(sortKey, card).After(*filter.After):
+			return false
+		}
+		return true
+	})
+
+	sort.SliceStable(cards, func(i, j int) bool {
+		return models.CardCursorFor(sortKey, cards[j]).After(models.CardCursorFor(sortKey, cards[i]))
+	})
+
+	more := len(cards) > filter.Limit
+	if more {
+		cards = cards[:filter.Limit]
+	}
+	if cards == nil {
+		cards = []*models.Card{}
+	}
+	return cards, more, nil
+}
+
+// hasEffect reports whether a card has an effect that has not been deleted. The caller must
+// hold m.mu.
+func (m *Memory) hasEffect(cardID, effectID int) bool {
+	if effect, ok := m.effects[effectID]; !ok || effect.DeletedAt != nil {
+		return false
+	}
+	for _, cardEffect := range m.cardEffects {
+		if cardEffect.CardID == cardID && cardEffect.EffectID == effectID {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSearch reports whether the name or legend of a card has a word starting with each
+// of the given words, like the full-text search of the database
+func matchesSearch(card *models.Card, words []string) bool {
+	cardWords := append(models.SearchWords(card.Name), models.SearchWords(card.Legend)...)
+	for _, word := range words {
+		found := false
+		for _, cardWord := range cardWords {
+			if strings.HasPrefix(cardWord, word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Memory) UpdateCardPartial(id int, req *models.UpdateCardRequest, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.cards[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	card := cloneCard(stored)
+	if req.Name != nil {
+		card.Name = *req.Name
+	}
+	if req.Type != nil {
+		card.Type = *req.Type
+	}
+	if req.Legend != nil {
+		card.Legend = *req.Legend
+	}
+	if req.Element != nil {
+		card.Element = *req.Element
+	}
+	if req.HP != nil {
+		hp := *req.HP
+		card.HP = &hp
+	}
+	if req.AttackName != nil {
+		attackName := *req.AttackName
+		card.AttackName = &attackName
+	}
+	if req.AttackDamage != nil {
+		attackDamage := *req.AttackDamage
+		card.AttackDamage = &attackDamage
+	}
+	if req.AttackCost != nil {
+		// An empty cost is stored as NULL
+		card.AttackCost = nil
+		for element, amount := range *req.AttackCost {
+			if card.AttackCost == nil {
+				card.AttackCost = make(models.EnergyCost)
+			}
+			card.AttackCost[element] = amount
+		}
+	}
+	if req.RetreatCost != nil {
+		card.RetreatCost = *req.RetreatCost
+	}
+	if req.Rarity != nil {
+		card.Rarity = *req.Rarity
+	}
+	if req.SetCode != nil {
+		card.SetCode = *req.SetCode
+	}
+	card.UpdatedAt = time.Now()
+
+	if err := m.writeAudit(audit, card); err != nil {
+		return err
+	}
+	m.cards[id] = card
+	return nil
+}
+
+// DeleteCard removes a card nobody holds, along with its effects and format limits
+func (m *Memory) DeleteCard(id int, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cards[id]; !ok {
+		return sql.ErrNoRows
+	}
+	if m.cardHeld(id) {
+		return models.ErrCardInUse
+	}
+	if err := m.writeAudit(audit, nil); err != nil {
+		return err
+	}
+	delete(m.cards, id)
+
+	kept := m.cardEffects[:0]
+	for _, cardEffect := range m.cardEffects {
+		if cardEffect.CardID != id {
+			kept = append(kept, cardEffect)
+		}
+	}
+	m.cardEffects = kept
+	for _, format := range m.formats {
+		limits := format.CardLimits[:0]
+		for _, limit := range format.CardLimits {
+			if limit.CardID != id {
+				limits = append(limits, limit)
+			}
+		}
+		format.CardLimits = limits
+	}
+	return nil
+}
+
+// cardHeld reports whether players hold copies of a card, like cardReferencesQuery
+func (m *Memory) cardHeld(cardID int) bool {
+	for _, userCard := range m.userCards {
+		if userCard.CardID == cardID {
+			return true
+		}
+	}
+	for _, deckCards := range m.deckCards {
+		for _, deckCard := range deckCards {
+			if deckCard.CardID == cardID {
+				return true
+			}
+		}
+	}
+	for _, trade := range m.trades {
+		for _, tradeCard := range append(append([]models.TradeCard{}, trade.OfferedCards...), trade.RequestedCards...) {
+			if tradeCard.CardID == cardID {
+				return true
+			}
+		}
+	}
+	for _, listing := range m.listings {
+		if listing.CardID == cardID {
+			return true
+		}
+	}
+	for _, stakes := range m.tableStakes {
+		for _, stake := range stakes {
+			if stake.CardID != nil && *stake.CardID == cardID {
+				return true
+			}
+		}
+	}
+	for _, userTable := range m.userTables {
+		if userTable.StakeCardID != nil && *userTable.StakeCardID == cardID {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCards returns copies of the cards that match, ordered by ID
+func (m *Memory) filterCards(match func(card *models.Card) bool) []*models.Card {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var cards []*models.Card
+	for _, card := range m.sortedCards() {
+		if match(card) {
+			cards = append(cards, cloneCard(card))
+		}
+	}
+	return cards
+}
+
+func (m *Memory) sortedCards() []*models.Card {
+	cards := make([]*models.Card, 0, len(m.cards))
+	for _, card := range m.cards {
+		cards = append(cards, card)
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].ID < cards[j].ID
+	})
+	return cards
+}
+
+func cloneCard(card *models.Card) *models.Card {
+	clone := *card
+	if card.AttackCost != nil {
+		clone.AttackCost = make(models.EnergyCost, len(card.AttackCost))
+		for element, amount := range card.AttackCost {
+			clone.AttackCost[element] = amount
+		}
+	}
+	return &clone
+}
+
+// DeckRepository
+
+func (m *Memory) GetDeckByID(id int) (*models.Deck, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if deck, ok := m.decks[id]; ok {
+		found := *deck
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetDecksByUserID(userID int) ([]models.Deck, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.userDecks(userID), nil
+}
+
+func (m *Memory) GetDeckCards(deckID int) ([]models.DeckCard, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deckCards []models.DeckCard
+	for _, deckCard := range m.deckCards[deckID] {
+		if card, ok := m.cards[deckCard.CardID]; ok {
+			deckCard.Card = cloneCard(card)
+			deckCards = append(deckCards, deckCard)
+		}
+	}
+
+	sort.Slice(deckCards, func(i, j int) bool {
+		return deckCards[i].Card.Name < deckCards[j].Card.Name
+	})
+	return deckCards, nil
+}
+
+func (m *Memory) GetUserDeckLimit(userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deckLimit(userID)
+}
+
+func (m *Memory) CreateDeckWithValidation(userID int, name, format string, cardIDs []int, cardCounts []int) (*models.Deck, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deckLimit, err := m.deckLimit(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.userDecks(userID)) >= deckLimit {
+		return nil, fmt.Errorf("deck limit reached: you can only have %d decks", deckLimit)
+	}
+
+	if format == "" {
+		format = models.DefaultFormat
+	}
+
+	violations, err := m.validateDeck(userID, format, cardIDs, cardCounts)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		return nil, &models.DeckViolationError{Violations: violations}
+	}
+
+	deck := &models.Deck{ID: m.nextID("decks"), UserID: userID, Name: name, Format: format, Valid: true}
+	m.decks[deck.ID] = deck
+	m.setDeckCards(deck.ID, cardIDs, cardCounts)
+
+	created := *deck
+	return &created, nil
+}
+
+func (m *Memory) UpdateDeck(deckID int, userID int, name, format string, cardIDs []int, cardCounts []int) (*models.Deck, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deck, ok := m.decks[deckID]
+	if !ok {
+		return nil, fmt.Errorf("deck not found")
+	}
+	if deck.UserID != userID {
+		return nil, fmt.Errorf("deck does not belong to user")
+	}
+
+	for _, userTable := range m.userTables {
+		playing := int(userTable.UserID) == userID || (userTable.RivalID != nil && int(*userTable.RivalID) == userID)
+		if table := m.tables[userTable.TableID]; playing && table != nil && table.FinishedAt == nil {
+			return nil, fmt.Errorf("cannot update deck while in an active game")
+		}
+	}
+
+	if format == "" {
+		format = deck.Format
+	}
+
+	violations, err := m.validateDeck(userID, format, cardIDs, cardCounts)
+	if err != nil {
+		return nil, fmt.Errorf("error validating deck: %w", err)
+	}
+	if len(violations) > 0 {
+		return nil, &models.DeckViolationError{Violations: violations}
+	}
+
+	deck.Name = name
+	deck.Format = format
+	deck.Valid = true
+	m.setDeckCards(deckID, cardIDs, cardCounts)
+
+	updated := *deck
+	return &updated, nil
+}
+
+func (m *Memory) DeleteDeck(deckID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.decks, deckID)
+	delete(m.deckCards, deckID)
+	return nil
+}
+
+// userDecks returns copies of the decks of a user ordered by name
+func (m *Memory) userDecks(userID int) []models.Deck {
+	var decks []models.Deck
+	for _, deck := range m.decks {
+		if deck.UserID == userID {
+			decks = append(decks, *deck)
+		}
+	}
+	sort.Slice(decks, func(i, j int) bool {
+		return decks[i].Name < decks[j].Name
+	})
+	return decks
+}
+
+func (m *Memory) deckLimit(userID int) (int, error) {
+	info, ok := m.userInfo[userID]
+	if !ok {
+		return 0, fmt.Errorf("user info not found")
+	}
+	return 3 + info.Level/25, nil
+}
+
+// validateDeck checks a deck against its format and the user's cards, like database.ValidateDeckCreation
+func (m *Memory) validateDeck(userID int, formatCode string, cardIDs []int, cardCounts []int) ([]models.DeckViolation, error) {
+	if len(cardIDs) != len(cardCounts) {
+		return nil, fmt.Errorf("card_ids and card_count arrays must have the same length")
+	}
+
+	format, ok := m.formats[formatCode]
+	if !ok {
+		return nil, models.ErrFormatNotFound
+	}
+
+	deckCards := make([]models.DeckCard, 0, len(cardIDs))
+	for i, cardID := range cardIDs {
+		deckCard := models.DeckCard{CardID: cardID, Number: cardCounts[i]}
+		if card, ok := m.cards[cardID]; ok {
+			deckCard.Card = cloneCard(card)
+		}
+		deckCards = append(deckCards, deckCard)
+	}
+
+	return m.checkDeckCards(userID, format, deckCards), nil
+}
+
+// checkDeckCards returns the rules of the format and the ownership checks the cards break,
+// like database.checkDeck
+func (m *Memory) checkDeckCards(userID int, format *models.DeckFormat, deckCards []models.DeckCard) []models.DeckViolation {
+	violations := legality.Check(format, deckCards)
+
+	counts := make(map[int]int)
+	order := []int{}
+	for _, deckCard := range deckCards {
+		if deckCard.Card == nil {
+			continue // Reported as an unknown card
+		}
+		if _, ok := counts[deckCard.CardID]; !ok {
+			order = append(order, deckCard.CardID)
+		}
+		counts[deckCard.CardID] += deckCard.Number
+	}
+
+	for _, cardID := range order {
+		owned := 0
+		if userCard := m.findUserCard(userID, cardID); userCard != nil {
+			owned = userCard.Amount
+		}
+		if owned < counts[cardID] {
+			id := cardID
+			violations = append(violations, models.DeckViolation{
+				Rule:    models.RuleNotOwned,
+				CardID:  &id,
+				Message: fmt.Sprintf("you have %d of the %d copies of %s", owned, counts[cardID], m.cards[cardID].Name),
+			})
+		}
+	}
+
+	return violations
+}
+
+// savedDeckCards returns the cards of a saved deck with their card loaded
+func (m *Memory) savedDeckCards(deckID int) []models.DeckCard {
+	deckCards := []models.DeckCard{}
+	for _, deckCard := range m.deckCards[deckID] {
+		if card, ok := m.cards[deckCard.CardID]; ok {
+			deckCard.Card = cloneCard(card)
+			deckCards = append(deckCards, deckCard)
+		}
+	}
+	return deckCards
+}
+
+func (m *Memory) setDeckCards(deckID int, cardIDs []int, cardCounts []int) {
+	deckCards := []models.DeckCard{}
+	for i, cardID := range cardIDs {
+		if cardCounts[i] > 0 {
+			deckCards = append(deckCards, models.DeckCard{DeckID: deckID, CardID: cardID, Number: cardCounts[i]})
+		}
+	}
+	m.deckCards[deckID] = deckCards
+}
+
+// TableRepository
+
+func (m *Memory) CreateTable(category, privacy, prize string, password *string, amount *int) (uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	table := &models.Table{
+		ID:        uint(m.nextID("tables")),
+		Category:  category,
+		Privacy:   privacy,
+		Password:  password,
+		Prize:     prize,
+		Amount:    amount,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.tables[table.ID] = table
+	return table.ID, nil
+}
+
+func (m *Memory) CreateUserTable(userID, tableID uint, rivalID *uint, ownerDeckID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tables[tableID]; !ok {
+		return fmt.Errorf("error creating user table: table %d does not exist", tableID)
+	}
+
+	userTable := &models.UserTable{
+		ID:          uint(m.nextID("user_tables")),
+		UserID:      userID,
+		RivalID:     rivalID,
+		TableID:     tableID,
+		OwnerDeckID: &ownerDeckID,
+	}
+	m.userTables[userTable.ID] = userTable
+	return nil
+}
+
+func (m *Memory) OpenTable(ownerID, ownerDeckID uint, settings models.TableSettings) (uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	table := &models.Table{
+		ID:            uint(m.nextID("tables")),
+		Category:      settings.Category,
+		Privacy:       settings.Privacy,
+		Password:      settings.Password,
+		Prize:         settings.Prize,
+		Amount:        copyInt(settings.Amount),
+		InitialTime:   copyInt(settings.InitialTime),
+		TimeIncrement: settings.TimeIncrement,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	m.tables[table.ID] = table
+
+	userTable := &models.UserTable{
+		ID:          uint(m.nextID("user_tables")),
+		UserID:      ownerID,
+		TableID:     table.ID,
+		OwnerDeckID: &ownerDeckID,
+		StakeCardID: copyInt(settings.StakeCardID),
+	}
+	m.userTables[userTable.ID] = userTable
+	return table.ID, nil
+}
+
+func (m *Memory) GetTableByID(id uint) (*models.Table, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if table, ok := m.tables[id]; ok {
+		found := *table
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetUserTablesByUserID(userID uint) ([]models.UserTable, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var userTables []models.UserTable
+	for _, userTable := range m.sortedUserTables() {
+		if userTable.UserID != userID && (userTable.RivalID == nil || *userTable.RivalID != userID) {
+			continue
+		}
+
+		joined := *userTable
+		if table, ok := m.tables[userTable.TableID]; ok {
+			joined.Table = *table
+		}
+		if user, ok := m.users[int(userTable.UserID)]; ok {
+			joined.User = models.User{ID: user.ID, Name: user.Name, Email: user.Email}
+		}
+		if userTable.RivalID != nil {
+			if rival, ok := m.users[int(*userTable.RivalID)]; ok {
+				joined.Rival = &models.User{ID: rival.ID, Name: rival.Name, Email: rival.Email}
+			}
+		}
+		userTables = append(userTables, joined)
+	}
+
+	return userTables, nil
+}
+
+func (m *Memory) UpdateTable(id uint, settings models.TableSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	table, ok := m.tables[id]
+	userTable := m.findUserTable(id)
+	if !ok || userTable == nil || userTable.RivalID != nil {
+		return models.ErrTableTaken
+	}
+
+	table.Category = settings.Category
+	table.Privacy = settings.Privacy
+	table.Prize = settings.Prize
+	table.Password = settings.Password
+	table.Amount = copyInt(settings.Amount)
+	table.InitialTime = copyInt(settings.InitialTime)
+	table.TimeIncrement = settings.TimeIncrement
+	table.UpdatedAt = time.Now()
+	userTable.StakeCardID = copyInt(settings.StakeCardID)
+	return nil
+}
+
+func (m *Memory) GetTableClock(tableID uint) (*models.TableClock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userTable := m.findUserTable(tableID)
+	table := m.tables[tableID]
+	if userTable == nil || table == nil {
+		return nil, nil
+	}
+
+	clock := copyClock(m.tableClocks[tableID])
+	clock.TableID = tableID
+	clock.Increment = table.TimeIncrement
+	clock.StartedAt = table.CreatedAt
+	if state, ok := m.tableStates[tableID]; ok {
+		clock.StartedAt = state.CreatedAt
+	}
+	clock.Elapsed = userTable.Time
+	return &clock, nil
+}
+
+func (m *Memory) UpdateTableClock(clock *models.TableClock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setTableClock(clock)
+	return nil
+}
+
+// setTableClock saves a clock on the seat of the table owner, like the user_tables row
+// it is stored in; tables without one have nowhere to keep it
+func (m *Memory) setTableClock(clock *models.TableClock) {
+	userTable := m.findUserTable(clock.TableID)
+	if userTable == nil {
+		return
+	}
+
+	m.tableClocks[clock.TableID] = copyClock(*clock)
+	userTable.Time = clock.Elapsed
+}
+
+func (m *Memory) GetExpiredClocks(now, dealtBefore time.Time) ([]uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tableIDs := []uint{}
+	for tableID, clock := range m.tableClocks {
+		table := m.tables[tableID]
+		if table == nil || table.FinishedAt != nil {
+			continue
+		}
+
+		state := m.tableStates[tableID]
+		if state != nil && state.Phase == "mulligan" && clock.OwnerTime != nil && !state.CreatedAt.After(dealtBefore) {
+			tableIDs = append(tableIDs, tableID)
+			continue
+		}
+
+		if clock.Running == nil || clock.ChargedAt == nil {
+			continue
+		}
+
+		left := clock.OwnerTime
+		if *clock.Running == "rival" {
+			left = clock.RivalTime
+		}
+		if left != nil && !clock.ChargedAt.Add(time.Duration(*left)*time.Millisecond).After(now) {
+			tableIDs = append(tableIDs, tableID)
+		}
+	}
+
+	sort.Slice(tableIDs, func(i, j int) bool { return tableIDs[i] < tableIDs[j] })
+	return tableIDs, nil
+}
+
+func (m *Memory) IsTableOwner(userID, tableID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userTable := m.findUserTable(tableID)
+	return userTable != nil && userTable.UserID == userID && userTable.RivalID == nil, nil
+}
+
+func (m *Memory) IsTableWaitingForRival(tableID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userTable := m.findUserTable(tableID)
+	return userTable != nil && userTable.RivalID == nil, nil
+}
+
+func (m *Memory) GetTablePlayers(tableID uint) (uint, *uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userTable := m.findUserTable(tableID)
+	if userTable == nil {
+		return 0, nil, sql.ErrNoRows
+	}
+	return userTable.UserID, copyUint(userTable.RivalID), nil
+}
+
+func (m *Memory) GetTableDecks(tableID uint) (*uint, *uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userTable := m.findUserTable(tableID)
+	if userTable == nil {
+		return nil, nil, fmt.Errorf("error getting table decks: %v", sql.ErrNoRows)
+	}
+	return copyUint(userTable.OwnerDeckID), copyUint(userTable.RivalDeckID), nil
+}
+
+func (m *Memory) JoinTable(tableID, rivalID, rivalDeckID uint, rivalStakeCardID *int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userTable := m.findUserTable(tableID)
+	table := m.tables[tableID]
+	if userTable == nil || table == nil || userTable.RivalID != nil || userTable.UserID == rivalID {
+		return false, nil
+	}
+
+	ownerID := int(userTable.UserID)
+	amount := table.PrizeAmount()
+	var stakes []models.TableStake
+	switch {
+	case table.Prize == models.PrizeMoney && amount > 0:
+		for _, userID := range []int{ownerID, int(rivalID)} {
+			info, ok := m.userInfo[userID]
+			if !ok {
+				return false, fmt.Errorf("user info not found")
+			}
+			if info.Money < amount {
+				err := fmt.Errorf("%w: required %d, available %d", models.ErrInsufficientFunds, amount, info.Money)
+				if userID == ownerID {
+					return false, fmt.Errorf("%w: %v", models.ErrOwnerStake, err)
+				}
+				return false, err
+			}
+			stakes = append(stakes, models.TableStake{UserID: userID, Money: amount})
+		}
+
+	case table.Prize == models.PrizeCard:
+		if userTable.StakeCardID == nil {
+			return false, fmt.Errorf("%w: no stake card chosen", models.ErrOwnerStake)
+		}
+		if rivalStakeCardID == nil {
+			return false, fmt.Errorf("%w: no stake card chosen", models.ErrNotEnoughCards)
+		}
+		if err := m.checkTakeUserCards(ownerID, *userTable.StakeCardID, amount); err != nil {
+			return false, fmt.Errorf("%w: %v", models.ErrOwnerStake, err)
+		}
+		if err := m.checkTakeUserCards(int(rivalID), *rivalStakeCardID, amount); err != nil {
+			return false, err
+		}
+		stakes = []models.TableStake{
+			{UserID: ownerID, CardID: copyInt(userTable.StakeCardID), Amount: amount},
+			{UserID: int(rivalID), CardID: copyInt(rivalStakeCardID), Amount: amount},
+		}
+	}
+
+	now := time.Now()
+	for _, stake := range stakes {
+		if stake.Money > 0 {
+			m.userInfo[stake.UserID].Money -= stake.Money
+			m.userInfo[stake.UserID].UpdatedAt = now
+		}
+		if stake.CardID != nil {
+			m.takeUserCards(stake.UserID, *stake.CardID, stake.Amount, now)
+		}
+	}
+	m.tableStakes[tableID] = stakes
+
+	userTable.RivalID = &rivalID
+	userTable.RivalDeckID = &rivalDeckID
+	return true, nil
+}
+
+func (m *Memory) ReleaseTableSeat(tableID, rivalID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userTable := m.findUserTable(tableID)
+	if userTable != nil && userTable.RivalID != nil && *userTable.RivalID == rivalID {
+		userTable.RivalID = nil
+		userTable.RivalDeckID = nil
+
+		now := time.Now()
+		for _, stake := range m.tableStakes[tableID] {
+			m.payTableStake(stake, stake.UserID, now)
+		}
+		delete(m.tableStakes, tableID)
+	}
+	return nil
+}
+
+func (m *Memory) DeleteTable(tableID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, userTable := range m.userTables {
+		if userTable.TableID == tableID {
+			delete(m.userTables, id)
+		}
+	}
+	delete(m.tables, tableID)
+	delete(m.tableStates, tableID)
+	delete(m.tableStakes, tableID)
+	delete(m.tableClocks, tableID)
+	return nil
+}
+
+func (m *Memory) FinishTable(tableID uint, ownerWon bool, rewards models.MatchRewards) (*models.MatchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userTable := m.findUserTable(tableID)
+	table := m.tables[tableID]
+	if userTable == nil || table == nil {
+		return nil, fmt.Errorf("table not found")
+	}
+	if table.FinishedAt != nil {
+		return nil, nil
+	}
+	if userTable.RivalID == nil {
+		return nil, fmt.Errorf("table %d has no rival", tableID)
+	}
+
+	now := time.Now()
+	table.Winner = &ownerWon
+	table.FinishedAt = &now
+	table.UpdatedAt = now
+
+	result := &models.MatchResult{
+		TableID:          tableID,
+		Prize:            table.Prize,
+		WinnerID:         int(userTable.UserID),
+		LoserID:          int(*userTable.RivalID),
+		Stakes:           append([]models.TableStake{}, m.tableStakes[tableID]...),
+		WinnerExperience: rewards.WinnerExperience,
+		LoserExperience:  rewards.LoserExperience,
+		FinishedAt:       now,
+	}
+	if !ownerWon {
+		result.WinnerID, result.LoserID = result.LoserID, result.WinnerID
+	}
+
+	for _, userID := range []int{result.WinnerID, result.LoserID} {
+		if _, ok := m.userInfo[userID]; !ok {
+			return nil, fmt.Errorf("user info not found")
+		}
+	}
+
+	for _, stake := range result.Stakes {
+		m.payTableStake(stake, result.WinnerID, now)
+	}
+	delete(m.tableStakes, tableID)
+
+	if table.Prize == models.PrizeAura {
+		result.Aura = table.PrizeAmount()
+		m.userInfo[result.WinnerID].Aura += result.Aura
+	}
+
+	m.addExperience(result.WinnerID, rewards.WinnerExperience)
+	m.addExperience(result.LoserID, rewards.LoserExperience)
+
+	result.Ratings = m.updateRatings(tableID, result.WinnerID, result.LoserID, now)
+
+	return result, nil
+}
+
+// payTableStake gives a stake held in escrow to a user
+func (m *Memory) payTableStake(stake models.TableStake, userID int, now time.Time) {
+	if info, ok := m.userInfo[userID]; ok && stake.Money > 0 {
+		info.Money += stake.Money
+		info.UpdatedAt = now
+	}
+	if stake.CardID != nil && stake.Amount > 0 {
+		m.addUserCard(userID, *stake.CardID, stake.Amount, now)
+	}
+}
+
+func (m *Memory) GetOpenTables(filter models.LobbyFilter) ([]models.LobbyTable, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matches := []models.LobbyTable{}
+	for _, userTable := range m.userTables {
+		table := m.tables[userTable.TableID]
+		owner := m.users[int(userTable.UserID)]
+		if table == nil || owner == nil || userTable.RivalID != nil {
+			continue
+		}
+		if table.Privacy != "public" || table.FinishedAt != nil {
+			continue
+		}
+		if filter.Category != "" && table.Category != filter.Category {
+			continue
+		}
+		if filter.Prize != "" && table.Prize != filter.Prize {
+			continue
+		}
+		if filter.MinAmount != nil && (table.Amount == nil || *table.Amount < *filter.MinAmount) {
+			continue
+		}
+		if filter.MaxAmount != nil && (table.Amount == nil || *table.Amount > *filter.MaxAmount) {
+			continue
+		}
+
+		level := 1
+		if info, ok := m.userInfo[owner.ID]; ok {
+			level = info.Level
+		}
+
+		matches = append(matches, models.LobbyTable{
+			ID:            table.ID,
+			Category:      table.Category,
+			Prize:         table.Prize,
+			Amount:        table.Amount,
+			InitialTime:   table.InitialTime,
+			TimeIncrement: table.TimeIncrement,
+			HasPassword:   table.Password != nil,
+			OwnerID:       userTable.UserID,
+			OwnerName:     owner.Name,
+			OwnerLevel:    level,
+			CreatedAt:     table.CreatedAt,
+		})
+	}
+
+	// Newest first
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].CreatedAt.Equal(matches[j].CreatedAt) {
+			return matches[i].CreatedAt.After(matches[j].CreatedAt)
+		}
+		return matches[i].ID > matches[j].ID
+	})
+
+	total := len(matches)
+	if filter.Offset >= total {
+		return []models.LobbyTable{}, total, nil
+	}
+	end := filter.Offset + filter.Limit
+	if end > total {
+		end = total
+	}
+	return matches[filter.Offset:end], total, nil
+}
+
+// findUserTable returns the seats of a table
+func (m *Memory) findUserTable(tableID uint) *models.UserTable {
+	for _, userTable := range m.sortedUserTables() {
+		if userTable.TableID == tableID {
+			return userTable
+		}
+	}
+	return nil
+}
+
+func (m *Memory) sortedUserTables() []*models.UserTable {
+	userTables := make([]*models.UserTable, 0, len(m.userTables))
+	for _, userTable := range m.userTables {
+		userTables = append(userTables, userTable)
+	}
+	sort.Slice(userTables, func(i, j int) bool {
+		return userTables[i].ID < userTables[j].ID
+	})
+	return userTables
+}
+
+func copyUint(value *uint) *uint {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+func copyInt(value *int) *int {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+// copyClock copies a clock so callers cannot change the stored one
+func copyClock(clock models.TableClock) models.TableClock {
+	clock.OwnerTime = copyInt(clock.OwnerTime)
+	clock.RivalTime = copyInt(clock.RivalTime)
+	if clock.Running != nil {
+		running := *clock.Running
+		clock.Running = &running
+	}
+	if clock.ChargedAt != nil {
+		chargedAt := *clock.ChargedAt
+		clock.ChargedAt = &chargedAt
+	}
+	return clock
+}
+
+// TableStateRepository
+
+func (m *Memory) CreateTableState(tableState *models.TableState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.createTableState(tableState)
+}
+
+func (m *Memory) StartTableState(tableState *models.TableState, clock *models.TableClock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.createTableState(tableState); err != nil {
+		return err
+	}
+	m.setTableClock(clock)
+	return nil
+}
+
+func (m *Memory) createTableState(tableState *models.TableState) error {
+	if _, ok := m.tableStates[tableState.TableID]; ok {
+		return fmt.Errorf("error creating table state: duplicate state for table %d", tableState.TableID)
+	}
+
+	if tableState.Phase == "" {
+		tableState.Phase = "setup"
+	}
+	now := time.Now()
+	tableState.CreatedAt = now
+	tableState.UpdatedAt = now
+	tableState.ID = uint(m.nextID("table_state"))
+
+	stored, err := cloneTableState(tableState)
+	if err != nil {
+		return err
+	}
+	m.tableStates[tableState.TableID] = stored
+	return nil
+}
+
+func (m *Memory) GetTableStateByTableID(tableID uint) (*models.TableState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tableState, ok := m.tableStates[tableID]; ok {
+		return cloneTableState(tableState)
+	}
+	return nil, nil
+}
+
+func (m *Memory) UpdateTableState(tableState *models.TableState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.tableStates[tableState.TableID]
+	if !ok {
+		return fmt.Errorf("table state not found")
+	}
+	if current.ID != tableState.ID || current.Version != tableState.Version {
+		return models.ErrStaleTableState
+	}
+
+	tableState.Version++
+	tableState.UpdatedAt = time.Now()
+	stored, err := cloneTableState(tableState)
+	if err != nil {
+		tableState.Version--
+		return err
+	}
+	m.tableStates[tableState.TableID] = stored
+	return nil
+}
+
+// cloneTableState deep copies a state so callers never share slices with the store
+func cloneTableState(tableState *models.TableState) (*models.TableState, error) {
+	encoded, err := json.Marshal(tableState)
+	if err != nil {
+		return nil, fmt.Errorf("error copying table state: %v", err)
+	}
+
+	var clone models.TableState
+	if err := json.Unmarshal(encoded, &clone); err != nil {
+		return nil, fmt.Errorf("error copying table state: %v", err)
+	}
+	return &clone, nil
+}
+
+// EffectRepository
+
+func (m *Memory) CreateEffect(effect *models.Effect, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	effect.ID = m.nextID("effects")
+	effect.CreatedAt = now
+	effect.UpdatedAt = now
+
+	audit.EntityID = effect.ID
+	if err := m.writeAudit(audit, effect); err != nil {
+		return err
+	}
+
+	stored := *effect
+	stored.Script = append(json.RawMessage(nil), effect.Script...)
+	m.effects[effect.ID] = &stored
+	return nil
+}
+
+func (m *Memory) UpdateEffect(effect *models.Effect, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.effects[effect.ID]
+	if !ok || stored.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	effect.UpdatedAt = time.Now()
+	if err := m.writeAudit(audit, effect); err != nil {
+		return err
+	}
+	stored.Description = effect.Description
+	stored.Script = append(json.RawMessage(nil), effect.Script...)
+	stored.UpdatedAt = effect.UpdatedAt
+	return nil
+}
+
+func (m *Memory) GetEffectByID(id int) (*models.Effect, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if effect, ok := m.effects[id]; ok && effect.DeletedAt == nil {
+		found := *effect
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetAllEffects() ([]models.Effect, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var effects []models.Effect
+	for _, effect := range m.effects {
+		if effect.DeletedAt == nil {
+			effects = append(effects, *effect)
+		}
+	}
+	sortEffects(effects)
+	return effects, nil
+}
+
+func (m *Memory) GetEffectsByCardID(cardID int) ([]models.Effect, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var effects []models.Effect
+	for _, cardEffect := range m.cardEffects {
+		if effect, ok := m.effects[cardEffect.EffectID]; ok && cardEffect.CardID == cardID && effect.DeletedAt == nil {
+			effects = append(effects, *effect)
+		}
+	}
+	sortEffects(effects)
+	return effects, nil
+}
+
+func (m *Memory) GetEffectsByCardIDs(cardIDs []int) (map[int][]models.Effect, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[int]bool, len(cardIDs))
+	for _, cardID := range cardIDs {
+		wanted[cardID] = true
+	}
+
+	effects := make(map[int][]models.Effect)
+	for _, cardEffect := range m.cardEffects {
+		if effect, ok := m.effects[cardEffect.EffectID]; ok && wanted[cardEffect.CardID] && effect.DeletedAt == nil {
+			effects[cardEffect.CardID] = append(effects[cardEffect.CardID], *effect)
+		}
+	}
+	for cardID := range effects {
+		sortEffects(effects[cardID])
+	}
+	return effects, nil
+}
+
+func (m *Memory) GetCardsByEffectID(effectID int) ([]*models.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var cards []*models.Card
+	for _, card := range m.sortedCards() {
+		for _, cardEffect := range m.cardEffects {
+			if cardEffect.CardID == card.ID && cardEffect.EffectID == effectID {
+				cards = append(cards, cloneCard(card))
+				break
+			}
+		}
+	}
+	return cards, nil
+}
+
+func (m *Memory) CreateCardEffect(cardID, effectID int, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.cards[cardID]; !ok {
+		return fmt.Errorf("error creating card effect: card %d does not exist", cardID)
+	}
+	if _, ok := m.effects[effectID]; !ok {
+		return fmt.Errorf("error creating card effect: effect %d does not exist", effectID)
+	}
+	for _, cardEffect := range m.cardEffects {
+		if cardEffect.CardID == cardID && cardEffect.EffectID == effectID {
+			return fmt.Errorf("error creating card effect: duplicate entry")
+		}
+	}
+
+	link := models.CardEffect{CardID: cardID, EffectID: effectID}
+	if err := m.writeAudit(audit, link); err != nil {
+		return err
+	}
+	m.cardEffects = append(m.cardEffects, link)
+	return nil
+}
+
+func (m *Memory) DeleteCardEffect(cardID, effectID int, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writeAudit(audit, nil); err != nil {
+		return err
+	}
+
+	for i, cardEffect := range m.cardEffects {
+		if cardEffect.CardID == cardID && cardEffect.EffectID == effectID {
+			m.cardEffects = append(m.cardEffects[:i], m.cardEffects[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SoftDeleteEffect(id int, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writeAudit(audit, nil); err != nil {
+		return err
+	}
+
+	if effect, ok := m.effects[id]; ok && effect.DeletedAt == nil {
+		now := time.Now()
+		effect.DeletedAt = &now
+		effect.UpdatedAt = now
+	}
+	return nil
+}
+
+func sortEffects(effects []models.Effect) {
+	sort.Slice(effects, func(i, j int) bool {
+		return effects[i].ID < effects[j].ID
+	})
+}
+
+// PackRepository
+
+func (m *Memory) CreatePack(pack *models.Pack, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	pack.ID = m.nextID("packs")
+	pack.CreatedAt = now
+	pack.UpdatedAt = now
+
+	audit.EntityID = pack.ID
+	if err := m.writeAudit(audit, pack); err != nil {
+		return err
+	}
+
+	stored := *pack
+	m.packs[pack.ID] = &stored
+	return nil
+}
+
+func (m *Memory) GetPacks() ([]models.Pack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	packs := []models.Pack{}
+	for _, pack := range m.packs {
+		if pack.DeletedAt == nil {
+			packs = append(packs, *pack)
+		}
+	}
+	sort.Slice(packs, func(i, j int) bool {
+		if packs[i].Price != packs[j].Price {
+			return packs[i].Price < packs[j].Price
+		}
+		return packs[i].ID < packs[j].ID
+	})
+	return packs, nil
+}
+
+func (m *Memory) GetPackByID(id int) (*models.Pack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if pack, ok := m.packs[id]; ok && pack.DeletedAt == nil {
+		found := *pack
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetPackByName(name string) (*models.Pack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, pack := range m.packs {
+		if pack.Name == name {
+			found := *pack
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *Memory) UpdatePack(pack *models.Pack, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.packs[pack.ID]
+	if !ok || stored.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	pack.UpdatedAt = time.Now()
+	if err := m.writeAudit(audit, pack); err != nil {
+		return err
+	}
+	stored.Name = pack.Name
+	stored.Description = pack.Description
+	stored.Price = pack.Price
+	stored.SetCode = pack.SetCode
+	stored.Slots = pack.Slots
+	stored.UpdatedAt = pack.UpdatedAt
+	return nil
+}
+
+func (m *Memory) SoftDeletePack(id int, audit *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.writeAudit(audit, nil); err != nil {
+		return err
+	}
+
+	if pack, ok := m.packs[id]; ok && pack.DeletedAt == nil {
+		now := time.Now()
+		pack.DeletedAt = &now
+		pack.UpdatedAt = now
+	}
+	return nil
+}
+
+func (m *Memory) OpenPack(opening *models.PackOpening) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, ok := m.userInfo[opening.UserID]
+	if !ok {
+		return false, fmt.Errorf("user info not found")
+	}
+	if info.Money < opening.Price {
+		return false, nil
+	}
+	for _, cardID := range opening.CardIDs {
+		if _, ok := m.cards[cardID]; !ok {
+			return false, fmt.Errorf("error adding card %d: card does not exist", cardID)
+		}
+	}
+
+	now := time.Now()
+	info.Money -= opening.Price
+	info.UpdatedAt = now
+	for _, cardID := range opening.CardIDs {
+		m.addUserCard(opening.UserID, cardID, 1, now)
+	}
+
+	opening.ID = m.nextID("pack_openings")
+	opening.MoneyLeft = info.Money
+	opening.CreatedAt = now
+	m.packOpenings = append(m.packOpenings, *opening)
+	return true, nil
+}
+
+// TradeRepository
+
+func (m *Memory) CreateTrade(trade *models.Trade) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insertTrade(trade)
+	return nil
+}
+
+func (m *Memory) insertTrade(trade *models.Trade) {
+	now := time.Now()
+	trade.ID = m.nextID("trades")
+	trade.Status = models.TradeStatusPending
+	trade.CreatedAt = now
+	trade.UpdatedAt = now
+
+	m.trades[trade.ID] = cloneTrade(trade)
+}
+
+func (m *Memory) GetTradeByID(id int) (*models.Trade, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if trade, ok := m.trades[id]; ok {
+		return cloneTrade(trade), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GetTradesByUserID(userID int, status models.TradeStatus) ([]models.Trade, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	trades := []models.Trade{}
+	for _, trade := range m.trades {
+		if trade.ProposerID != userID && trade.RecipientID != userID {
+			continue
+		}
+		if status != "" && trade.Status != status {
+			continue
+		}
+		trades = append(trades, *cloneTrade(trade))
+	}
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].ID > trades[j].ID
+	})
+	return trades, nil
+}
+
+func (m *Memory) CounterTrade(tradeID int, counter *models.Trade) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.resolveTrade(tradeID, models.TradeStatusCountered) {
+		return false, nil
+	}
+
+	counter.CounterOfID = &tradeID
+	m.insertTrade(counter)
+	return true, nil
+}
+
+func (m *Memory) ResolveTrade(id int, status models.TradeStatus) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.resolveTrade(id, status), nil
+}
+
+// resolveTrade moves a pending trade that has not expired to a final status
+func (m *Memory) resolveTrade(id int, status models.TradeStatus) bool {
+	trade, ok := m.trades[id]
+	now := time.Now()
+	if !ok || trade.Status != models.TradeStatusPending || !trade.ExpiresAt.After(now) {
+		return false
+	}
+
+	trade.Status = status
+	trade.ResolvedAt = &now
+	trade.UpdatedAt = now
+	return true
+}
+
+func (m *Memory) ExpireTrades() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, trade := range m.trades {
+		if trade.Status == models.TradeStatusPending && !trade.ExpiresAt.After(now) {
+			expiredAt := trade.ExpiresAt
+			trade.Status = models.TradeStatusExpired
+			trade.ResolvedAt = &expiredAt
+			trade.UpdatedAt = now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) AcceptTrade(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	trade, ok := m.trades[id]
+	if !ok || trade.Status != models.TradeStatusPending {
+		return models.ErrTradeNotPending
+	}
+
+	now := time.Now()
+	if !trade.ExpiresAt.After(now) {
+		expiredAt := trade.ExpiresAt
+		trade.Status = models.TradeStatusExpired
+		trade.ResolvedAt = &expiredAt
+		trade.UpdatedAt = now
+		return models.ErrTradeExpired
+	}
+
+	proposer, ok := m.userInfo[trade.ProposerID]
+	if !ok {
+		return fmt.Errorf("user info not found")
+	}
+	recipient, ok := m.userInfo[trade.RecipientID]
+	if !ok {
+		return fmt.Errorf("user info not found")
+	}
+
+	// Check both sides before moving anything, as the transaction would roll back
+	for _, card := range trade.OfferedCards {
+		if err := m.checkTakeUserCards(trade.ProposerID, card.CardID, card.Amount); err != nil {
+			return err
+		}
+	}
+	for _, card := range trade.RequestedCards {
+		if err := m.checkTakeUserCards(trade.RecipientID, card.CardID, card.Amount); err != nil {
+			return err
+		}
+	}
+	if proposer.Money < trade.OfferedMoney {
+		return fmt.Errorf("%w: required %d, available %d", models.ErrInsufficientFunds, trade.OfferedMoney, proposer.Money)
+	}
+	if recipient.Money < trade.RequestedMoney {
+		return fmt.Errorf("%w: required %d, available %d", models.ErrInsufficientFunds, trade.RequestedMoney, recipient.Money)
+	}
+
+	for _, card := range trade.OfferedCards {
+		m.takeUserCards(trade.ProposerID, card.CardID, card.Amount, now)
+		m.addUserCard(trade.RecipientID, card.CardID, card.Amount, now)
+	}
+	for _, card := range trade.RequestedCards {
+		m.takeUserCards(trade.RecipientID, card.CardID, card.Amount, now)
+		m.addUserCard(trade.ProposerID, card.CardID, card.Amount, now)
+	}
+
+	proposer.Money += trade.RequestedMoney - trade.OfferedMoney
+	proposer.UpdatedAt = now
+	recipient.Money += trade.OfferedMoney - trade.RequestedMoney
+	recipient.UpdatedAt = now
+
+	trade.Status = models.TradeStatusAccepted
+	trade.ResolvedAt = &now
+	trade.UpdatedAt = now
+	return nil
+}
+
+// MarketRepository
+
+func (m *Memory) CreateListing(listing *models.Listing) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkTakeUserCards(listing.SellerID, listing.CardID, listing.Amount); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	m.takeUserCards(listing.SellerID, listing.CardID, listing.Amount, now)
+
+	listing.ID = m.nextID("market_listings")
+	listing.Status = models.ListingStatusActive
+	listing.CreatedAt = now
+	listing.UpdatedAt = now
+
+	stored := *listing
+	stored.Card = nil
+	m.listings[listing.ID] = &stored
+	return nil
+}
+
+func (m *Memory) GetListingByID(id int) (*models.Listing, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if listing, ok := m.listings[id]; ok {
+		return m.withListingCard(*listing), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) SearchListings(filter models.ListingFilter) ([]models.Listing, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matching := []models.Listing{}
+	for _, stored := range m.listings {
+		listing := m.withListingCard(*stored)
+		switch {
+		case listing.Status != models.ListingStatusActive,
+			filter.CardID != 0 && listing.CardID != filter.CardID,
+			filter.SellerID != 0 && listing.SellerID != filter.SellerID,
+			filter.Element != "" && listing.Card.Element != filter.Element,
+			filter.Rarity != "" && listing.Card.Rarity != filter.Rarity,
+			filter.MinPrice != 0 && listing.Price < filter.MinPrice,
+			filter.MaxPrice != 0 && listing.Price > filter.MaxPrice:
+			continue
+		}
+		matching = append(matching, *listing)
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		switch filter.Sort {
+		case models.ListingSortPriceAsc:
+			if matching[i].Price != matching[j].Price {
+				return matching[i].Price < matching[j].Price
+			}
+			return matching[i].ID < matching[j].ID
+		case models.ListingSortPriceDesc:
+			if matching[i].Price != matching[j].Price {
+				return matching[i].Price > matching[j].Price
+			}
+			return matching[i].ID < matching[j].ID
+		}
+		return matching[i].ID > matching[j].ID
+	})
+
+	total := len(matching)
+	if filter.Offset >= total {
+		return []models.Listing{}, total, nil
+	}
+	matching = matching[filter.Offset:]
+	if len(matching) > filter.Limit {
+		matching = matching[:filter.Limit]
+	}
+	return matching, total, nil
+}
+
+func (m *Memory) CancelListing(id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	listing, ok := m.listings[id]
+	if !ok || listing.Status != models.ListingStatusActive {
+		return false, nil
+	}
+
+	now := time.Now()
+	m.addUserCard(listing.SellerID, listing.CardID, listing.Amount, now)
+	listing.Status = models.ListingStatusCancelled
+	listing.UpdatedAt = now
+	return true, nil
+}
+
+func (m *Memory) BuyListing(id, buyerID int, config market.Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	listing, ok := m.listings[id]
+	if !ok || listing.Status != models.ListingStatusActive {
+		return models.ErrListingNotActive
+	}
+	if listing.SellerID == buyerID {
+		return models.ErrOwnListing
+	}
+
+	userIDs := []int{buyerID, listing.SellerID}
+	if config.FeeSink != 0 {
+		userIDs = append(userIDs, config.FeeSink)
+	}
+	for _, userID := range userIDs {
+		if _, ok := m.userInfo[userID]; !ok {
+			return fmt.Errorf("user info not found")
+		}
+	}
+
+	buyer := m.userInfo[buyerID]
+	if buyer.Money < listing.Price {
+		return fmt.Errorf("%w: required %d, available %d", models.ErrInsufficientFunds, listing.Price, buyer.Money)
+	}
+
+	now := time.Now()
+	fee := config.Fee(listing.Price)
+	buyer.Money -= listing.Price
+	buyer.UpdatedAt = now
+	seller := m.userInfo[listing.SellerID]
+	seller.Money += listing.Price - fee
+	seller.UpdatedAt = now
+	if config.FeeSink != 0 && fee > 0 {
+		sink := m.userInfo[config.FeeSink]
+		sink.Money += fee
+		sink.UpdatedAt = now
+	}
+
+	m.addUserCard(buyerID, listing.CardID, listing.Amount, now)
+	listing.Status = models.ListingStatusSold
+	listing.BuyerID = &buyerID
+	listing.Fee = fee
+	listing.SoldAt = &now
+	listing.UpdatedAt = now
+	return nil
+}
+
+func (m *Memory) GetCardSales(cardID, limit int) ([]models.Sale, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sales := []models.Sale{}
+	for _, listing := range m.listings {
+		if listing.CardID != cardID || listing.Status != models.ListingStatusSold {
+			continue
+		}
+		sales = append(sales, models.Sale{
+			ListingID: listing.ID,
+			Amount:    listing.Amount,
+			Price:     listing.Price,
+			UnitPrice: float64(listing.Price) / float64(listing.Amount),
+			SoldAt:    *listing.SoldAt,
+		})
+	}
+
+	sort.Slice(sales, func(i, j int) bool {
+		if !sales[i].SoldAt.Equal(sales[j].SoldAt) {
+			return sales[i].SoldAt.After(sales[j].SoldAt)
+		}
+		return sales[i].ListingID > sales[j].ListingID
+	})
+	if len(sales) > limit {
+		sales = sales[:limit]
+	}
+	return sales, nil
+}
+
+// withListingCard returns a copy of a listing joined with its card, as the SQL queries do
+func (m *Memory) withListingCard(listing models.Listing) *models.Listing {
+	if listing.BuyerID != nil {
+		buyerID := *listing.BuyerID
+		listing.BuyerID = &buyerID
+	}
+	if listing.SoldAt != nil {
+		soldAt := *listing.SoldAt
+		listing.SoldAt = &soldAt
+	}
+	listing.Card = cloneCard(m.cards[listing.CardID])
+	return &listing
+}
+
+func cloneTrade(trade *models.Trade) *models.Trade {
+	clone := *trade
+	clone.OfferedCards = append([]models.TradeCard{}, trade.OfferedCards...)
+	clone.RequestedCards = append([]models.TradeCard{}, trade.RequestedCards...)
+	if trade.CounterOfID != nil {
+		counterOfID := *trade.CounterOfID
+		clone.CounterOfID = &counterOfID
+	}
+	if trade.ResolvedAt != nil {
+		resolvedAt := *trade.ResolvedAt
+		clone.ResolvedAt = &resolvedAt
+	}
+	return &clone
+}
+
+// RatingRepository
+
+func (m *Memory) GetUserRating(userID int) (*models.Rating, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.userRating(userID), nil
+}
+
+func (m *Memory) GetRatingHistory(userID, limit int) ([]models.RatingChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Newest first
+	changes := []models.RatingChange{}
+	for i := len(m.ratingHistory) - 1; i >= 0 && len(changes) < limit; i-- {
+		if m.ratingHistory[i].UserID == userID {
+			changes = append(changes, m.ratingHistory[i])
+		}
+	}
+	return changes, nil
+}
+
+func (m *Memory) GetLeaderboard(limit, offset int) ([]models.LeaderboardEntry, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ranked := []*models.Rating{}
+	for _, userRating := range m.ratings {
+		if _, ok := m.users[userRating.UserID]; ok && userRating.Games > 0 {
+			ranked = append(ranked, userRating)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Rating != ranked[j].Rating {
+			return ranked[i].Rating > ranked[j].Rating
+		}
+		if ranked[i].Deviation != ranked[j].Deviation {
+			return ranked[i].Deviation < ranked[j].Deviation
+		}
+		return ranked[i].UserID < ranked[j].UserID
+	})
+
+	total := len(ranked)
+	if offset >= total {
+		return []models.LeaderboardEntry{}, total, nil
+	}
+	ranked = ranked[offset:]
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	entries := make([]models.LeaderboardEntry, 0, len(ranked))
+	for i, userRating := range ranked {
+		entries = append(entries, models.LeaderboardEntry{
+			Rank:      offset + i + 1,
+			UserID:    userRating.UserID,
+			Name:      m.users[userRating.UserID].Name,
+			Rating:    userRating.Rating,
+			Deviation: userRating.Deviation,
+			Games:     userRating.Games,
+			Wins:      userRating.Wins,
+			Category:  rating.Category(toGlicko(userRating)),
+		})
+	}
+	return entries, total, nil
+}
+
+// userRating returns a copy of the rating of a user, or the default rating if they have
+// not played a ranked match yet
+func (m *Memory) userRating(userID int) *models.Rating {
+	found := models.Rating{UserID: userID}
+	if userRating, ok := m.ratings[userID]; ok {
+		found = *userRating
+	} else {
+		start := rating.Default()
+		found.Rating, found.Deviation, found.Volatility = start.Rating, start.Deviation, start.Volatility
+	}
+	found.Category = rating.Category(toGlicko(&found))
+	return &found
+}
+
+// updateRatings rates a finished match, as the SQL settlement does
+func (m *Memory) updateRatings(tableID uint, winnerID, loserID int, now time.Time) []models.RatingChange {
+	winner, loser := m.userRating(winnerID), m.userRating(loserID)
+	newWinner := rating.Update(toGlicko(winner), toGlicko(loser), 1)
+	newLoser := rating.Update(toGlicko(loser), toGlicko(winner), 0)
+
+	changes := []models.RatingChange{}
+	for _, update := range []struct {
+		before     *models.Rating
+		after      rating.Rating
+		opponentID int
+		won        bool
+	}{
+		{winner, newWinner, loserID, true},
+		{loser, newLoser, winnerID, false},
+	} {
+		opponentID := update.opponentID
+		change := models.RatingChange{
+			ID:           m.nextID("rating_history"),
+			UserID:       update.before.UserID,
+			TableID:      tableID,
+			OpponentID:   &opponentID,
+			Won:          update.won,
+			RatingBefore: update.before.Rating,
+			RatingAfter:  update.after.Rating,
+			Deviation:    update.after.Deviation,
+			Volatility:   update.after.Volatility,
+			CreatedAt:    now,
+		}
+		m.ratingHistory = append(m.ratingHistory, change)
+		changes = append(changes, change)
+
+		stored := *update.before
+		stored.Rating, stored.Deviation, stored.Volatility = update.after.Rating, update.after.Deviation, update.after.Volatility
+		stored.Games++
+		if update.won {
+			stored.Wins++
+		}
+		stored.Category = ""
+		stored.UpdatedAt = &now
+		m.ratings[stored.UserID] = &stored
+	}
+	return changes
+}
+
+func toGlicko(userRating *models.Rating) rating.Rating {
+	return rating.Rating{
+		Rating:     userRating.Rating,
+		Deviation:  userRating.Deviation,
+		Volatility: userRating.Volatility,
+	}
+}
+
+// FormatRepository
+
+func (m *Memory) GetFormats() ([]models.DeckFormat, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	formats := []models.DeckFormat{}
+	for _, format := range m.formats {
+		formats = append(formats, *copyFormat(format))
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i].Code < formats[j].Code
+	})
+	return formats, nil
+}
+
+func (m *Memory) GetFormat(code string) (*models.DeckFormat, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if format, ok := m.formats[code]; ok {
+		return copyFormat(format), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) SaveFormat(format *models.DeckFormat, audit *models.AuditEntry) ([]models.DeckValidation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	saved := copyFormat(format)
+	if existing, ok := m.formats[format.Code]; ok {
+		saved.ID, saved.CreatedAt = existing.ID, existing.CreatedAt
+	} else {
+		saved.ID, saved.CreatedAt = m.nextID("deck_formats"), now
+	}
+	saved.UpdatedAt = now
+
+	// The sets and card limits are keys of their tables, like in deck_format_sets and deck_format_cards
+	sets := make(map[string]bool)
+	saved.Sets = []string{}
+	for _, set := range format.Sets {
+		if !sets[set] {
+			sets[set] = true
+			saved.Sets = append(saved.Sets, set)
+		}
+	}
+	sort.Strings(saved.Sets)
+
+	limits := make(map[int]int)
+	for _, limit := range format.CardLimits {
+		limits[limit.CardID] = limit.Limit
+	}
+	saved.CardLimits = []models.FormatCardLimit{}
+	for cardID, limit := range limits {
+		saved.CardLimits = append(saved.CardLimits, models.FormatCardLimit{CardID: cardID, Limit: limit})
+	}
+	sort.Slice(saved.CardLimits, func(i, j int) bool {
+		return saved.CardLimits[i].CardID < saved.CardLimits[j].CardID
+	})
+
+	audit.EntityID = saved.ID
+	if err := m.writeAudit(audit, saved); err != nil {
+		return nil, err
+	}
+	m.formats[saved.Code] = saved
+	*format = *copyFormat(saved)
+
+	deckIDs := []int{}
+	for deckID, deck := range m.decks {
+		if deck.Format == saved.Code {
+			deckIDs = append(deckIDs, deckID)
+		}
+	}
+	sort.Ints(deckIDs)
+
+	changed := []models.DeckValidation{}
+	for _, deckID := range deckIDs {
+		deck := m.decks[deckID]
+		violations := m.checkDeckCards(deck.UserID, saved, m.savedDeckCards(deckID))
+		valid := len(violations) == 0
+		if valid == deck.Valid {
+			continue
+		}
+		deck.Valid = valid
+		changed = append(changed, models.DeckValidation{DeckID: deckID, Format: saved.Code, Valid: valid, Violations: violations})
+	}
+	return changed, nil
+}
+
+func (m *Memory) ValidateDeck(deckID int) (*models.DeckValidation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deck, ok := m.decks[deckID]
+	if !ok {
+		return nil, nil
+	}
+	format, ok := m.formats[deck.Format]
+	if !ok {
+		return nil, models.ErrFormatNotFound
+	}
+
+	violations := m.checkDeckCards(deck.UserID, format, m.savedDeckCards(deckID))
+	deck.Valid = len(violations) == 0
+	return &models.DeckValidation{DeckID: deckID, Format: format.Code, Valid: deck.Valid, Violations: violations}, nil
+}
+
+func copyFormat(format *models.DeckFormat) *models.DeckFormat {
+	clone := *format
+	if format.MaxCards != nil {
+		maxCards := *format.MaxCards
+		clone.MaxCards = &maxCards
+	}
+	if format.MaxCopies != nil {
+		maxCopies := *format.MaxCopies
+		clone.MaxCopies = &maxCopies
+	}
+	clone.Sets = append([]string{}, format.Sets...)
+	clone.CardLimits = append([]models.FormatCardLimit{}, format.CardLimits...)
+	return &clone
+}
+
+// AuditRepository
+
+// writeAudit records the audit entry of a change with the value the change writes. It is
+// called before the change is stored, so like in a transaction a change is not kept
+// without its entry. It must be called with mu held.
+func (m *Memory) writeAudit(entry *models.AuditEntry, newValue interface{}) error {
+	if newValue != nil {
+		encoded, err := json.Marshal(newValue)
+		if err != nil {
+			return fmt.Errorf("error encoding audited value: %v", err)
+		}
+		entry.NewValue = encoded
+	}
+
+	entry.ID = m.nextID("audit_log")
+	entry.CreatedAt = time.Now()
+	m.auditLog = append(m.auditLog, *entry)
+	return nil
+}
+
+func (m *Memory) GetAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Newest first
+	matching := []models.AuditEntry{}
+	for i := len(m.auditLog) - 1; i >= 0; i-- {
+		entry := m.auditLog[i]
+		if filter.EntityType != "" && entry.EntityType != filter.EntityType {
+			continue
+		}
+		if filter.EntityID != 0 && entry.EntityID != filter.EntityID {
+			continue
+		}
+		if filter.UserID != 0 && (entry.UserID == nil || *entry.UserID != filter.UserID) {
+			continue
+		}
+		matching = append(matching, entry)
+	}
+
+	total := len(matching)
+	if filter.Offset >= total {
+		return []models.AuditEntry{}, total, nil
+	}
+	matching = matching[filter.Offset:]
+	if len(matching) > filter.Limit {
+		matching = matching[:filter.Limit]
+	}
+	return matching, total, nil
+}
@@ -0,0 +1,202 @@
+// Package repository defines the storage interfaces used by the HTTP handlers and the
+// game, with a MariaDB implementation backed by the database package and an in-memory
+// implementation for tests.
+package repository
+
+import (
+	"time"
+
+	"tcg-server-go/market"
+	"tcg-server-go/models"
+)
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	CreateUser(user *models.User) error
+	GetUserByEmail(email string) (*models.User, error)
+	GetUserByID(id int) (*models.User, error)
+	EmailExists(email string) (bool, error)
+	VerifyEmail(email, validationCode string) (*models.User, error)
+	ResendValidationCode(email string) error
+	UpdatePassword(userID int, hashedPassword string) error
+	SetUserRole(userID int, role string) error
+}
+
+// PasswordResetRepository stores the hashes of password reset tokens
+type PasswordResetRepository interface {
+	CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error
+	ConsumePasswordReset(tokenHash string) (int, error)
+}
+
+// TokenRepository stores the hashes of refresh tokens and the access tokens revoked before they expire
+type TokenRepository interface {
+	CreateRefreshToken(token *models.RefreshToken) error
+	GetRefreshToken(tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(id int, next *models.RefreshToken) (bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID int) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+}
+
+// UserInfoRepository stores game progression and card collections of users
+type UserInfoRepository interface {
+	GetUserInfoByUserID(userID int) (*models.UserInfo, error)
+	CreateDefaultUserInfo(userID int) (*models.UserInfo, error)
+	AddExperience(userID int, experienceToAdd int) (*models.UserInfo, error)
+	AddMoney(userID int, amount int) (*models.UserInfo, error)
+	SpendMoney(userID int, amount int) (*models.UserInfo, error)
+	GetUserCardByUserAndCard(userID, cardID int) (*models.UserCard, error)
+	GetUserCardsByCardIDs(userID int, cardIDs []int) (map[int]*models.UserCard, error)
+	GetUserCardsByUserID(userID int) ([]models.UserCard, error)
+	GetCollection(userID int) ([]models.CollectionCard, error)
+	AddOrUpdateUserCard(userID, cardID, amount int) error
+}
+
+// CardRepository stores the card catalogue
+type CardRepository interface {
+	CreateCard(card *models.Card, audit *models.AuditEntry) error
+	GetCardByID(id int) (*models.Card, error)
+	GetCardsByIDs(ids []int) (map[int]*models.Card, error)
+	GetCardByName(name string) (*models.Card, error)
+	GetAllCards() ([]*models.Card, error)
+	GetCardsByType(cardType models.CardType) ([]*models.Card, error)
+	GetCardsByElement(element models.CardElement) ([]*models.Card, error)
+	GetCardsBySet(setCode string) ([]*models.Card, error)
+	SearchCards(searchTerm string) ([]*models.Card, error)
+	QueryCards(filter models.CardFilter) ([]*models.Card, bool, error)
+	UpdateCardPartial(id int, req *models.UpdateCardRequest, audit *models.AuditEntry) error
+	DeleteCard(id int, audit *models.AuditEntry) error
+}
+
+// DeckRepository stores the decks of users
+type DeckRepository interface {
+	GetDeckByID(id int) (*models.Deck, error)
+	GetDecksByUserID(userID int) ([]models.Deck, error)
+	GetDeckCards(deckID int) ([]models.DeckCard, error)
+	GetUserDeckLimit(userID int) (int, error)
+	CreateDeckWithValidation(userID int, name, format string, cardIDs []int, cardCounts []int) (*models.Deck, error)
+	UpdateDeck(deckID int, userID int, name, format string, cardIDs []int, cardCounts []int) (*models.Deck, error)
+	DeleteDeck(deckID int) error
+}
+
+// TableRepository stores tables and the players seated at them
+type TableRepository interface {
+	CreateTable(category, privacy, prize string, password *string, amount *int) (uint, error)
+	CreateUserTable(userID, tableID uint, rivalID *uint, ownerDeckID uint) error
+	OpenTable(ownerID, ownerDeckID uint, settings models.TableSettings) (uint, error)
+	GetTableByID(id uint) (*models.Table, error)
+	GetUserTablesByUserID(userID uint) ([]models.UserTable, error)
+	UpdateTable(id uint, settings models.TableSettings) error
+	IsTableOwner(userID, tableID uint) (bool, error)
+	IsTableWaitingForRival(tableID uint) (bool, error)
+	GetTablePlayers(tableID uint) (uint, *uint, error)
+	GetTableDecks(tableID uint) (*uint, *uint, error)
+	GetTableClock(tableID uint) (*models.TableClock, error)
+	UpdateTableClock(clock *models.TableClock) error
+	GetExpiredClocks(now, dealtBefore time.Time) ([]uint, error)
+	JoinTable(tableID, rivalID, rivalDeckID uint, rivalStakeCardID *int) (bool, error)
+	ReleaseTableSeat(tableID, rivalID uint) error
+	DeleteTable(tableID uint) error
+	FinishTable(tableID uint, ownerWon bool, rewards models.MatchRewards) (*models.MatchResult, error)
+	GetOpenTables(filter models.LobbyFilter) ([]models.LobbyTable, int, error)
+}
+
+// TableStateRepository stores the state of the match played at each table. StartTableState
+// saves a new state with the clock of its match, both or neither, and UpdateTableState
+// returns models.ErrStaleTableState if the state changed since it was read.
+type TableStateRepository interface {
+	CreateTableState(tableState *models.TableState) error
+	StartTableState(tableState *models.TableState, clock *models.TableClock) error
+	GetTableStateByTableID(tableID uint) (*models.TableState, error)
+	UpdateTableState(tableState *models.TableState) error
+}
+
+// EffectRepository stores card effects and which cards have them
+type EffectRepository interface {
+	CreateEffect(effect *models.Effect, audit *models.AuditEntry) error
+	UpdateEffect(effect *models.Effect, audit *models.AuditEntry) error
+	GetEffectByID(id int) (*models.Effect, error)
+	GetAllEffects() ([]models.Effect, error)
+	GetEffectsByCardID(cardID int) ([]models.Effect, error)
+	GetEffectsByCardIDs(cardIDs []int) (map[int][]models.Effect, error)
+	GetCardsByEffectID(effectID int) ([]*models.Card, error)
+	CreateCardEffect(cardID, effectID int, audit *models.AuditEntry) error
+	DeleteCardEffect(cardID, effectID int, audit *models.AuditEntry) error
+	SoftDeleteEffect(id int, audit *models.AuditEntry) error
+}
+
+// PackRepository stores the booster pack catalogue and sells packs
+type PackRepository interface {
+	GetPacks() ([]models.Pack, error)
+	GetPackByID(id int) (*models.Pack, error)
+	GetPackByName(name string) (*models.Pack, error)
+	CreatePack(pack *models.Pack, audit *models.AuditEntry) error
+	UpdatePack(pack *models.Pack, audit *models.AuditEntry) error
+	SoftDeletePack(id int, audit *models.AuditEntry) error
+	OpenPack(opening *models.PackOpening) (bool, error)
+}
+
+// TradeRepository stores trade offers between players and carries them out
+type TradeRepository interface {
+	CreateTrade(trade *models.Trade) error
+	GetTradeByID(id int) (*models.Trade, error)
+	GetTradesByUserID(userID int, status models.TradeStatus) ([]models.Trade, error)
+	CounterTrade(tradeID int, counter *models.Trade) (bool, error)
+	ResolveTrade(id int, status models.TradeStatus) (bool, error)
+	ExpireTrades() error
+	AcceptTrade(id int) error
+}
+
+// MarketRepository stores marketplace listings, holding their cards in escrow, and sells them
+type MarketRepository interface {
+	CreateListing(listing *models.Listing) error
+	GetListingByID(id int) (*models.Listing, error)
+	SearchListings(filter models.ListingFilter) ([]models.Listing, int, error)
+	CancelListing(id int) (bool, error)
+	BuyListing(id, buyerID int, config market.Config) error
+	GetCardSales(cardID, limit int) ([]models.Sale, error)
+}
+
+// RatingRepository reads the ratings of the ranked ladder, which are updated when a table finishes
+type RatingRepository interface {
+	GetUserRating(userID int) (*models.Rating, error)
+	GetRatingHistory(userID, limit int) ([]models.RatingChange, error)
+	GetLeaderboard(limit, offset int) ([]models.LeaderboardEntry, int, error)
+}
+
+// FormatRepository stores the deck building formats and checks decks against them. Saving a
+// format revalidates its decks.
+type FormatRepository interface {
+	GetFormats() ([]models.DeckFormat, error)
+	GetFormat(code string) (*models.DeckFormat, error)
+	SaveFormat(format *models.DeckFormat, audit *models.AuditEntry) ([]models.DeckValidation, error)
+	ValidateDeck(deckID int) (*models.DeckValidation, error)
+}
+
+// AuditRepository reads the audit trail of changes made through the admin API. The
+// repository methods making those changes take their audit entry, started with who made the
+// change and the value before it, and write it in the same transaction with the value after
+// it; a change whose entry cannot be written is not kept.
+type AuditRepository interface {
+	GetAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, int, error)
+}
+
+// Repositories groups every repository used by the server
+type Repositories struct {
+	Users          UserRepository
+	PasswordResets PasswordResetRepository
+	Tokens         TokenRepository
+	UserInfo       UserInfoRepository
+	Cards          CardRepository
+	Decks          DeckRepository
+	Tables         TableRepository
+	TableStates    TableStateRepository
+	Effects        EffectRepository
+	Audit          AuditRepository
+	Packs          PackRepository
+	Trades         TradeRepository
+	Market         MarketRepository
+	Ratings        RatingRepository
+	Formats        FormatRepository
+}
@@ -0,0 +1,488 @@
+package repository
+
+import (
+	"time"
+
+	"tcg-server-go/database"
+	"tcg-server-go/market"
+	"tcg-server-go/models"
+)
+
+// SQL implements every repository with the database package, on the global MariaDB connection
+type SQL struct{}
+
+// NewSQL returns the repositories backed by MariaDB
+func NewSQL() *Repositories {
+	store := SQL{}
+	return &Repositories{
+		Users:          store,
+		PasswordResets: store,
+		Tokens:         store,
+		UserInfo:       store,
+		Cards:          store,
+		Decks:          store,
+		Tables:         store,
+		TableStates:    store,
+		Effects:        store,
+		Audit:          store,
+		Packs:          store,
+		Trades:         store,
+		Market:         store,
+		Ratings:        store,
+		Formats:        store,
+	}
+}
+
+// UserRepository
+
+func (SQL) CreateUser(user *models.User) error {
+	return database.CreateUser(user)
+}
+
+func (SQL) GetUserByEmail(email string) (*models.User, error) {
+	return database.GetUserByEmail(email)
+}
+
+func (SQL) GetUserByID(id int) (*models.User, error) {
+	return database.GetUserByID(id)
+}
+
+func (SQL) EmailExists(email string) (bool, error) {
+	return database.EmailExists(email)
+}
+
+func (SQL) VerifyEmail(email, validationCode string) (*models.User, error) {
+	return database.VerifyEmail(email, validationCode)
+}
+
+func (SQL) ResendValidationCode(email string) error {
+	return database.ResendValidationCode(email)
+}
+
+func (SQL) UpdatePassword(userID int, hashedPassword string) error {
+	return database.UpdatePassword(userID, hashedPassword)
+}
+
+func (SQL) SetUserRole(userID int, role string) error {
+	return database.SetUserRole(userID, role)
+}
+
+// PasswordResetRepository
+
+func (SQL) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	return database.CreatePasswordReset(userID, tokenHash, expiresAt)
+}
+
+func (SQL) ConsumePasswordReset(tokenHash string) (int, error) {
+	return database.ConsumePasswordReset(tokenHash)
+}
+
+// TokenRepository
+
+func (SQL) CreateRefreshToken(token *models.RefreshToken) error {
+	return database.CreateRefreshToken(token)
+}
+
+func (SQL) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	return database.GetRefreshToken(tokenHash)
+}
+
+func (SQL) RotateRefreshToken(id int, next *models.RefreshToken) (bool, error) {
+	return database.RotateRefreshToken(id, next)
+}
+
+func (SQL) RevokeRefreshTokenFamily(familyID string) error {
+	return database.RevokeRefreshTokenFamily(familyID)
+}
+
+func (SQL) RevokeUserRefreshTokens(userID int) error {
+	return database.RevokeUserRefreshTokens(userID)
+}
+
+func (SQL) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	return database.RevokeAccessToken(jti, expiresAt)
+}
+
+func (SQL) IsAccessTokenRevoked(jti string) (bool, error) {
+	return database.IsAccessTokenRevoked(jti)
+}
+
+// UserInfoRepository
+
+func (SQL) GetUserInfoByUserID(userID int) (*models.UserInfo, error) {
+	return database.GetUserInfoByUserID(userID)
+}
+
+func (SQL) CreateDefaultUserInfo(userID int) (*models.UserInfo, error) {
+	return database.CreateDefaultUserInfo(userID)
+}
+
+func (SQL) AddExperience(userID int, experienceToAdd int) (*models.UserInfo, error) {
+	return database.AddExperience(userID, experienceToAdd)
+}
+
+func (SQL) AddMoney(userID int, amount int) (*models.UserInfo, error) {
+	return database.AddMoney(userID, amount)
+}
+
+func (SQL) SpendMoney(userID int, amount int) (*models.UserInfo, error) {
+	return database.SpendMoney(userID, amount)
+}
+
+func (SQL) GetUserCardByUserAndCard(userID, cardID int) (*models.UserCard, error) {
+	return database.GetUserCardByUserAndCard(userID, cardID)
+}
+
+func (SQL) GetUserCardsByCardIDs(userID int, cardIDs []int) (map[int]*models.UserCard, error) {
+	return database.GetUserCardsByCardIDs(userID, cardIDs)
+}
+
+func (SQL) GetUserCardsByUserID(userID int) ([]models.UserCard, error) {
+	return database.GetUserCardsByUserID(userID)
+}
+
+func (SQL) GetCollection(userID int) ([]models.CollectionCard, error) {
+	return database.GetCollection(userID)
+}
+
+func (SQL) AddOrUpdateUserCard(userID, cardID, amount int) error {
+	return database.AddOrUpdateUserCard(userID, cardID, amount)
+}
+
+// CardRepository
+
+func (SQL) CreateCard(card *models.Card, audit *models.AuditEntry) error {
+	return database.CreateCard(card, audit)
+}
+
+func (SQL) GetCardByID(id int) (*models.Card, error) {
+	return database.GetCardByID(id)
+}
+
+func (SQL) GetCardsByIDs(ids []int) (map[int]*models.Card, error) {
+	return database.GetCardsByIDs(ids)
+}
+
+func (SQL) GetCardByName(name string) (*models.Card, error) {
+	return database.GetCardByName(name)
+}
+
+func (SQL) GetAllCards() ([]*models.Card, error) {
+	return database.GetAllCards()
+}
+
+func (SQL) GetCardsByType(cardType models.CardType) ([]*models.Card, error) {
+	return database.GetCardsByType(cardType)
+}
+
+func (SQL) GetCardsByElement(element models.CardElement) ([]*models.Card, error) {
+	return database.GetCardsByElement(element)
+}
+
+func (SQL) GetCardsBySet(setCode string) ([]*models.Card, error) {
+	return database.GetCardsBySet(setCode)
+}
+
+func (SQL) SearchCards(searchTerm string) ([]*models.Card, error) {
+	return database.SearchCards(searchTerm)
+}
+
+func (SQL) QueryCards(filter models.CardFilter) ([]*models.Card, bool, error) {
+	return database.QueryCards(filter)
+}
+
+func (SQL) UpdateCardPartial(id int, req *models.UpdateCardRequest, audit *models.AuditEntry) error {
+	return database.UpdateCardPartial(id, req, audit)
+}
+
+func (SQL) DeleteCard(id int, audit *models.AuditEntry) error {
+	return database.DeleteCard(id, audit)
+}
+
+// DeckRepository
+
+func (SQL) GetDeckByID(id int) (*models.Deck, error) {
+	return database.GetDeckByID(id)
+}
+
+func (SQL) GetDecksByUserID(userID int) ([]models.Deck, error) {
+	return database.GetDecksByUserID(userID)
+}
+
+func (SQL) GetDeckCards(deckID int) ([]models.DeckCard, error) {
+	return database.GetDeckCards(deckID)
+}
+
+func (SQL) GetUserDeckLimit(userID int) (int, error) {
+	return database.GetUserDeckLimit(userID)
+}
+
+func (SQL) CreateDeckWithValidation(userID int, name, format string, cardIDs []int, cardCounts []int) (*models.Deck, error) {
+	return database.CreateDeckWithValidation(userID, name, format, cardIDs, cardCounts)
+}
+
+func (SQL) UpdateDeck(deckID int, userID int, name, format string, cardIDs []int, cardCounts []int) (*models.Deck, error) {
+	return database.UpdateDeck(deckID, userID, name, format, cardIDs, cardCounts)
+}
+
+func (SQL) DeleteDeck(deckID int) error {
+	return database.DeleteDeck(deckID)
+}
+
+// TableRepository
+
+func (SQL) CreateTable(category, privacy, prize string, password *string, amount *int) (uint, error) {
+	return database.CreateTable(category, privacy, prize, password, amount)
+}
+
+func (SQL) CreateUserTable(userID, tableID uint, rivalID *uint, ownerDeckID uint) error {
+	return database.CreateUserTable(userID, tableID, rivalID, ownerDeckID)
+}
+
+func (SQL) OpenTable(ownerID, ownerDeckID uint, settings models.TableSettings) (uint, error) {
+	return database.OpenTable(ownerID, ownerDeckID, settings)
+}
+
+func (SQL) GetTableByID(id uint) (*models.Table, error) {
+	return database.GetTableByID(id)
+}
+
+func (SQL) GetUserTablesByUserID(userID uint) ([]models.UserTable, error) {
+	return database.GetUserTablesByUserID(userID)
+}
+
+func (SQL) UpdateTable(id uint, settings models.TableSettings) error {
+	return database.UpdateTable(id, settings)
+}
+
+func (SQL) IsTableOwner(userID, tableID uint) (bool, error) {
+	return database.IsTableOwner(userID, tableID)
+}
+
+func (SQL) IsTableWaitingForRival(tableID uint) (bool, error) {
+	return database.IsTableWaitingForRival(tableID)
+}
+
+func (SQL) GetTablePlayers(tableID uint) (uint, *uint, error) {
+	return database.GetTablePlayers(tableID)
+}
+
+func (SQL) GetTableDecks(tableID uint) (*uint, *uint, error) {
+	return database.GetTableDecks(tableID)
+}
+
+func (SQL) GetTableClock(tableID uint) (*models.TableClock, error) {
+	return database.GetTableClock(tableID)
+}
+
+func (SQL) UpdateTableClock(clock *models.TableClock) error {
+	return database.UpdateTableClock(clock)
+}
+
+func (SQL) GetExpiredClocks(now, dealtBefore time.Time) ([]uint, error) {
+	return database.GetExpiredClocks(now, dealtBefore)
+}
+
+func (SQL) JoinTable(tableID, rivalID, rivalDeckID uint, rivalStakeCardID *int) (bool, error) {
+	return database.JoinTable(tableID, rivalID, rivalDeckID, rivalStakeCardID)
+}
+
+func (SQL) ReleaseTableSeat(tableID, rivalID uint) error {
+	return database.ReleaseTableSeat(tableID, rivalID)
+}
+
+func (SQL) DeleteTable(tableID uint) error {
+	return database.DeleteTable(tableID)
+}
+
+func (SQL) FinishTable(tableID uint, ownerWon bool, rewards models.MatchRewards) (*models.MatchResult, error) {
+	return database.FinishTable(tableID, ownerWon, rewards)
+}
+
+func (SQL) GetOpenTables(filter models.LobbyFilter) ([]models.LobbyTable, int, error) {
+	return database.GetOpenTables(filter)
+}
+
+// TableStateRepository
+
+func (SQL) CreateTableState(tableState *models.TableState) error {
+	return database.CreateTableState(tableState)
+}
+
+func (SQL) StartTableState(tableState *models.TableState, clock *models.TableClock) error {
+	return database.StartTableState(tableState, clock)
+}
+
+func (SQL) GetTableStateByTableID(tableID uint) (*models.TableState, error) {
+	return database.GetTableStateByTableID(tableID)
+}
+
+func (SQL) UpdateTableState(tableState *models.TableState) error {
+	return database.UpdateTableState(tableState)
+}
+
+// EffectRepository
+
+func (SQL) CreateEffect(effect *models.Effect, audit *models.AuditEntry) error {
+	return database.CreateEffect(effect, audit)
+}
+
+func (SQL) UpdateEffect(effect *models.Effect, audit *models.AuditEntry) error {
+	return database.UpdateEffect(effect, audit)
+}
+
+func (SQL) GetEffectByID(id int) (*models.Effect, error) {
+	return database.GetEffectByID(id)
+}
+
+func (SQL) GetAllEffects() ([]models.Effect, error) {
+	return database.GetAllEffects()
+}
+
+func (SQL) GetEffectsByCardID(cardID int) ([]models.Effect, error) {
+	return database.GetEffectsByCardID(cardID)
+}
+
+func (SQL) GetEffectsByCardIDs(cardIDs []int) (map[int][]models.Effect, error) {
+	return database.GetEffectsByCardIDs(cardIDs)
+}
+
+func (SQL) GetCardsByEffectID(effectID int) ([]*models.Card, error) {
+	return database.GetCardsByEffectID(effectID)
+}
+
+func (SQL) CreateCardEffect(cardID, effectID int, audit *models.AuditEntry) error {
+	return database.CreateCardEffect(cardID, effectID, audit)
+}
+
+func (SQL) DeleteCardEffect(cardID, effectID int, audit *models.AuditEntry) error {
+	return database.DeleteCardEffect(cardID, effectID, audit)
+}
+
+func (SQL) SoftDeleteEffect(id int, audit *models.AuditEntry) error {
+	return database.SoftDeleteEffect(id, audit)
+}
+
+// PackRepository
+
+func (SQL) GetPacks() ([]models.Pack, error) {
+	return database.GetPacks()
+}
+
+func (SQL) GetPackByID(id int) (*models.Pack, error) {
+	return database.GetPackByID(id)
+}
+
+func (SQL) GetPackByName(name string) (*models.Pack, error) {
+	return database.GetPackByName(name)
+}
+
+func (SQL) CreatePack(pack *models.Pack, audit *models.AuditEntry) error {
+	return database.CreatePack(pack, audit)
+}
+
+func (SQL) UpdatePack(pack *models.Pack, audit *models.AuditEntry) error {
+	return database.UpdatePack(pack, audit)
+}
+
+func (SQL) SoftDeletePack(id int, audit *models.AuditEntry) error {
+	return database.SoftDeletePack(id, audit)
+}
+
+func (SQL) OpenPack(opening *models.PackOpening) (bool, error) {
+	return database.OpenPack(opening)
+}
+
+// TradeRepository
+
+func (SQL) CreateTrade(trade *models.Trade) error {
+	return database.CreateTrade(trade)
+}
+
+func (SQL) GetTradeByID(id int) (*models.Trade, error) {
+	return database.GetTradeByID(id)
+}
+
+func (SQL) GetTradesByUserID(userID int, status models.TradeStatus) ([]models.Trade, error) {
+	return database.GetTradesByUserID(userID, status)
+}
+
+func (SQL) CounterTrade(tradeID int, counter *models.Trade) (bool, error) {
+	return database.CounterTrade(tradeID, counter)
+}
+
+func (SQL) ResolveTrade(id int, status models.TradeStatus) (bool, error) {
+	return database.ResolveTrade(id, status)
+}
+
+func (SQL) ExpireTrades() error {
+	return database.ExpireTrades()
+}
+
+func (SQL) AcceptTrade(id int) error {
+	return database.AcceptTrade(id)
+}
+
+// MarketRepository
+
+func (SQL) CreateListing(listing *models.Listing) error {
+	return database.CreateListing(listing)
+}
+
+func (SQL) GetListingByID(id int) (*models.Listing, error) {
+	return database.GetListingByID(id)
+}
+
+func (SQL) SearchListings(filter models.ListingFilter) ([]models.Listing, int, error) {
+	return database.SearchListings(filter)
+}
+
+func (SQL) CancelListing(id int) (bool, error) {
+	return database.CancelListing(id)
+}
+
+func (SQL) BuyListing(id, buyerID int, config market.Config) error {
+	return database.BuyListing(id, buyerID, config)
+}
+
+func (SQL) GetCardSales(cardID, limit int) ([]models.Sale, error) {
+	return database.GetCardSales(cardID, limit)
+}
+
+// RatingRepository
+
+func (SQL) GetUserRating(userID int) (*models.Rating, error) {
+	return database.GetUserRating(userID)
+}
+
+func (SQL) GetRatingHistory(userID, limit int) ([]models.RatingChange, error) {
+	return database.GetRatingHistory(userID, limit)
+}
+
+func (SQL) GetLeaderboard(limit, offset int) ([]models.LeaderboardEntry, int, error) {
+	return database.GetLeaderboard(limit, offset)
+}
+
+// FormatRepository
+
+func (SQL) GetFormats() ([]models.DeckFormat, error) {
+	return database.GetFormats()
+}
+
+func (SQL) GetFormat(code string) (*models.DeckFormat, error) {
+	return database.GetFormat(code)
+}
+
+func (SQL) SaveFormat(format *models.DeckFormat, audit *models.AuditEntry) ([]models.DeckValidation, error) {
+	return database.SaveFormat(format, audit)
+}
+
+func (SQL) ValidateDeck(deckID int) (*models.DeckValidation, error) {
+	return database.ValidateDeck(deckID)
+}
+
+// AuditRepository
+
+func (SQL) GetAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, int, error) {
+	return database.GetAuditEntries(filter)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"tcg-server-go/database"
+	"tcg-server-go/models"
+)
+
+const roleUsage = "usage: tcg-server-go role <email> user | admin"
+
+// runRole handles the role subcommand, which grants or revokes the admin role. It is the
+// only way to appoint the first admin.
+func runRole(args []string) error {
+	if len(args) != 2 {
+		return errors.New(roleUsage)
+	}
+
+	email, role := args[0], args[1]
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return errors.New(roleUsage)
+	}
+
+	user, err := database.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", email)
+	}
+
+	if err := database.SetUserRole(user.ID, role); err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s now has the %s role\n", email, role)
+	return nil
+}
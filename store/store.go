@@ -0,0 +1,154 @@
+// Package store sells booster packs. Pulls are rolled with a seed drawn for each opening and
+// stored with it, so any opening can be replayed with RollPack.
+package store
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"tcg-server-go/models"
+	"tcg-server-go/repository"
+)
+
+var (
+	ErrPackNotFound      = errors.New("pack not found")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrEmptyPack         = errors.New("pack has no cards to pull")
+)
+
+// rarityOrder fixes the order rarities are weighed in, so a seed always rolls the same cards
+var rarityOrder = []models.CardRarity{
+	models.CardRarityCommon,
+	models.CardRarityUncommon,
+	models.CardRarityRare,
+	models.CardRarityEpic,
+	models.CardRarityLegendary,
+}
+
+// Store opens booster packs for users
+type Store struct {
+	Packs repository.PackRepository
+	Cards repository.CardRepository
+
+	mu    sync.Mutex
+	seeds *rand.Rand // Draws the seed of each opening
+}
+
+// New creates a store seeded from the clock
+func New(repos *repository.Repositories) *Store {
+	return NewSeeded(repos, time.Now().UnixNano())
+}
+
+// NewSeeded creates a store whose sequence of openings is determined by seed; tests use it
+// to get predictable pulls
+func NewSeeded(repos *repository.Repositories, seed int64) *Store {
+	return &Store{
+		Packs: repos.Packs,
+		Cards: repos.Cards,
+		seeds: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// OpenPack charges a user for a pack and adds the pulled cards to their collection. The
+// cards are returned in slot order.
+func (s *Store) OpenPack(userID, packID int) (*models.PackOpening, []*models.Card, error) {
+	pack, err := s.Packs.GetPackByID(packID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pack == nil {
+		return nil, nil, ErrPackNotFound
+	}
+
+	pool, err := s.Cards.GetCardsBySet(pack.SetCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seed := s.nextSeed()
+	pulls, err := RollPack(pack, pool, seed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opening := &models.PackOpening{
+		UserID:  userID,
+		PackID:  pack.ID,
+		Price:   pack.Price,
+		Seed:    seed,
+		CardIDs: make(models.CardIDs, len(pulls)),
+	}
+	for i, card := range pulls {
+		opening.CardIDs[i] = card.ID
+	}
+
+	paid, err := s.Packs.OpenPack(opening)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !paid {
+		return nil, nil, ErrInsufficientFunds
+	}
+
+	return opening, pulls, nil
+}
+
+func (s *Store) nextSeed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seeds.Int63()
+}
+
+// RollPack pulls one card per slot of a pack from its pool. Each slot picks a rarity by
+// weight among the rarities the pool has cards of, then a card of that rarity. The same
+// pack, pool and seed always give the same cards.
+func RollPack(pack *models.Pack, pool []*models.Card, seed int64) ([]*models.Card, error) {
+	byRarity := make(map[models.CardRarity][]*models.Card)
+	for _, card := range pool {
+		byRarity[card.Rarity] = append(byRarity[card.Rarity], card)
+	}
+	for _, cards := range byRarity {
+		sort.Slice(cards, func(i, j int) bool { return cards[i].ID < cards[j].ID })
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	pulls := make([]*models.Card, 0, len(pack.Slots))
+	for _, weights := range pack.Slots {
+		rarity, ok := pickRarity(rng, weights, byRarity)
+		if !ok {
+			return nil, ErrEmptyPack
+		}
+		cards := byRarity[rarity]
+		pulls = append(pulls, cards[rng.Intn(len(cards))])
+	}
+
+	return pulls, nil
+}
+
+// pickRarity picks a rarity by weight, leaving out rarities the pool has no cards of
+func pickRarity(rng *rand.Rand, weights models.RarityWeights, byRarity map[models.CardRarity][]*models.Card) (models.CardRarity, bool) {
+	total := 0
+	for _, rarity := range rarityOrder {
+		if weights[rarity] > 0 && len(byRarity[rarity]) > 0 {
+			total += weights[rarity]
+		}
+	}
+	if total == 0 {
+		return "", false
+	}
+
+	roll := rng.Intn(total)
+	for _, rarity := range rarityOrder {
+		if weights[rarity] <= 0 || len(byRarity[rarity]) == 0 {
+			continue
+		}
+		if roll < weights[rarity] {
+			return rarity, true
+		}
+		roll -= weights[rarity]
+	}
+	return "", false
+}